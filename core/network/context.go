@@ -3,6 +3,8 @@ package network
 import (
 	"context"
 	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // DialPeerTimeout is the default timeout for a single call to `DialPeer`. When
@@ -15,6 +17,7 @@ type dialPeerTimeoutCtxKey struct{}
 type forceDirectDialCtxKey struct{}
 type allowLimitedConnCtxKey struct{}
 type simConnectCtxKey struct{ isClient bool }
+type preferredLocalAddrCtxKey struct{}
 
 var noDial = noDialCtxKey{}
 var forceDirectDial = forceDirectDialCtxKey{}
@@ -128,3 +131,19 @@ func GetUseTransient(ctx context.Context) (usetransient bool, reason string) {
 	}
 	return false, ""
 }
+
+// WithPreferredLocalAddr constructs a new context with an option that instructs the network to
+// prefer connections whose local address is, or starts with, addr when opening a new stream.
+// For example, /ip4/192.0.2.1 prefers connections on that local IP address, on multi-homed hosts.
+// It doesn't take precedence over the preference for direct, unlimited connections, and is
+// ignored if there is no such connection. New dials are not affected, as their local address is
+// up to the transport.
+func WithPreferredLocalAddr(ctx context.Context, addr ma.Multiaddr) context.Context {
+	return context.WithValue(ctx, preferredLocalAddrCtxKey{}, addr)
+}
+
+// GetPreferredLocalAddr returns the preferred local address set in the context, if any.
+func GetPreferredLocalAddr(ctx context.Context) (addr ma.Multiaddr, ok bool) {
+	addr, ok = ctx.Value(preferredLocalAddrCtxKey{}).(ma.Multiaddr)
+	return addr, ok && len(addr) > 0
+}
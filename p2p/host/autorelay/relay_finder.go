@@ -682,10 +682,11 @@ func (rf *relayFinder) connectToRelay(ctx context.Context, cand *candidate) (*ci
 func (rf *relayFinder) refreshReservations(ctx context.Context, now time.Time) bool {
 	rf.relayMx.Lock()
 
-	// find reservations about to expire and refresh them in parallel
+	// find reservations about to expire, or that the relay asked to renew, and refresh them in parallel
 	g := new(errgroup.Group)
 	for p, rsvp := range rf.relays {
-		if now.Add(rsvpExpirationSlack).Before(rsvp.Expiration) {
+		renew := !rsvp.RenewAfter.IsZero() && !now.Before(rsvp.RenewAfter)
+		if !renew && now.Add(rsvpExpirationSlack).Before(rsvp.Expiration) {
 			continue
 		}
 
@@ -2,6 +2,7 @@ package rcmgr
 
 import (
 	"bytes"
+	"maps"
 	"slices"
 	"sort"
 	"strings"
@@ -19,6 +20,30 @@ type ResourceScopeLimiter interface {
 
 var _ ResourceScopeLimiter = (*resourceScope)(nil)
 
+// ServiceScopeGauges is a trait interface that allows services to report gauges of their own
+// state, such as the number of sessions they hold, through their service scope. Gauges are traced,
+// and exported by the StatsTraceReporter alongside the resources used by the service.
+type ServiceScopeGauges interface {
+	// SetGauge sets the gauge with the given name to value.
+	SetGauge(name string, value int64)
+	// Gauges returns a copy of the gauges set on the scope.
+	Gauges() map[string]int64
+}
+
+var _ ServiceScopeGauges = (*serviceScope)(nil)
+
+// ResourceScopeBandwidth is a trait interface that allows services to account the bytes they
+// transfer on behalf of a connection or stream to its scope. The bytes are added to the scope and
+// to the scopes constraining it, and traced.
+type ResourceScopeBandwidth interface {
+	// RecordBandwidth records size bytes transferred in the given direction.
+	RecordBandwidth(dir network.Direction, size int)
+	// Bandwidth returns the bytes recorded in the scope and its descendants in each direction.
+	Bandwidth() (in, out int64)
+}
+
+var _ ResourceScopeBandwidth = (*resourceScope)(nil)
+
 // ResourceManagerStat is a trait that allows you to access resource manager state.
 type ResourceManagerState interface {
 	ListServices() []string
@@ -62,6 +87,68 @@ func (s *peerScope) SetLimit(limit Limit) {
 	s.resourceScope.SetLimit(limit)
 }
 
+func (s *serviceScope) SetGauge(name string, value int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.gauges == nil {
+		s.gauges = make(map[string]int64)
+	}
+	s.gauges[name] = value
+	s.trace.SetGauge(s.name, name, value)
+}
+
+func (s *serviceScope) Gauges() map[string]int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return maps.Clone(s.gauges)
+}
+
+func (s *resourceScope) RecordBandwidth(dir network.Direction, size int) {
+	if size <= 0 {
+		return
+	}
+
+	s.addBandwidth(dir, int64(size))
+	s.trace.RecordBandwidth(s.name, dir, int64(size))
+}
+
+// addBandwidth adds size bytes to the scope and its ancestors. The edges of a DAG scope are
+// its linearized parent set, so they are added to without recursing into their own edges.
+func (s *resourceScope) addBandwidth(dir network.Direction, size int64) {
+	s.Lock()
+	s.addBandwidthLocked(dir, size)
+	owner := s.owner
+	edges := s.edges
+	s.Unlock()
+
+	if owner != nil {
+		owner.addBandwidth(dir, size)
+		return
+	}
+	for _, e := range edges {
+		e.Lock()
+		e.addBandwidthLocked(dir, size)
+		e.Unlock()
+	}
+}
+
+func (s *resourceScope) addBandwidthLocked(dir network.Direction, size int64) {
+	if dir == network.DirInbound {
+		s.bwIn += size
+	} else {
+		s.bwOut += size
+	}
+}
+
+func (s *resourceScope) Bandwidth() (in, out int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.bwIn, s.bwOut
+}
+
 func (r *resourceManager) ListServices() []string {
 	r.mx.Lock()
 	defer r.mx.Unlock()
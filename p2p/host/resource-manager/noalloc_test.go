@@ -27,6 +27,8 @@ func randomTraceEvt(rng *rand.Rand) TraceEvt {
 		TraceAddConnEvt,
 		TraceBlockAddConnEvt,
 		TraceRemoveConnEvt,
+		TraceSetGaugeEvt,
+		TraceRecordBandwidthEvt,
 	}
 
 	names := []string{
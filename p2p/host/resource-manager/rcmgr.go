@@ -78,7 +78,8 @@ type serviceScope struct {
 	service string
 	rcmgr   *resourceManager
 
-	peers map[peer.ID]*resourceScope
+	peers  map[peer.ID]*resourceScope
+	gauges map[string]int64
 }
 
 var _ network.ServiceScope = (*serviceScope)(nil)
@@ -44,6 +44,8 @@ type resourceScope struct {
 	name    string   // for debugging purposes
 	trace   *trace   // debug tracing
 	metrics *metrics // metrics collection
+
+	bwIn, bwOut int64 // bytes recorded with RecordBandwidth in the scope and its descendants
 }
 
 var _ network.ResourceScope = (*resourceScope)(nil)
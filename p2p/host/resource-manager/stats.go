@@ -125,6 +125,20 @@ var (
 		Help:      "Number of blocked resources",
 	}, []string{"dir", "scope", "resource"})
 
+	// Gauges reported by services
+	serviceGauges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricNamespace,
+		Name:      "service_gauge",
+		Help:      "Gauges reported by services through their service scope",
+	}, []string{"service", "gauge"})
+
+	// Bytes recorded by services
+	bandwidthBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Name:      "bandwidth_bytes_total",
+		Help:      "Bytes transferred by services on behalf of connections and streams, as recorded with their scopes",
+	}, []string{"dir", "scope"})
+
 	// System limits
 	limits = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: metricNamespace,
@@ -165,6 +179,8 @@ func MustRegisterWith(reg prometheus.Registerer) {
 		previousConnMemory,
 		fds,
 		blockedResources,
+		serviceGauges,
+		bandwidthBytes,
 		limits,
 	)
 }
@@ -397,18 +413,7 @@ func (r StatsTraceReporter) consumeEventWithLabelSlice(evt TraceEvt, tags *[]str
 			resource = "memory"
 		}
 
-		scopeName := evt.Name
-		// Only the top scopeName. We don't want to get the peerid here.
-		// Using indexes and slices to avoid allocating.
-		scopeSplitIdx := strings.IndexByte(scopeName, ':')
-		if scopeSplitIdx != -1 {
-			scopeName = evt.Name[0:scopeSplitIdx]
-		}
-		// Drop the connection or stream id
-		idSplitIdx := strings.IndexByte(scopeName, '-')
-		if idSplitIdx != -1 {
-			scopeName = scopeName[0:idSplitIdx]
-		}
+		scopeName := topScopeName(evt.Name)
 
 		if evt.DeltaIn != 0 {
 			*tags = (*tags)[:0]
@@ -432,5 +437,39 @@ func (r StatsTraceReporter) consumeEventWithLabelSlice(evt TraceEvt, tags *[]str
 			*tags = append(*tags, "", scopeName, resource)
 			blockedResources.WithLabelValues(*tags...).Add(float64(evt.Delta))
 		}
+	case TraceSetGaugeEvt:
+		if svc, ok := strings.CutPrefix(evt.Name, "service:"); ok {
+			*tags = (*tags)[:0]
+			*tags = append(*tags, svc, evt.Gauge)
+			serviceGauges.WithLabelValues(*tags...).Set(float64(evt.Value))
+		}
+	case TraceRecordBandwidthEvt:
+		scopeName := topScopeName(evt.Name)
+		if evt.DeltaIn != 0 {
+			*tags = (*tags)[:0]
+			*tags = append(*tags, "inbound", scopeName)
+			bandwidthBytes.WithLabelValues(*tags...).Add(float64(evt.DeltaIn))
+		}
+		if evt.DeltaOut != 0 {
+			*tags = (*tags)[:0]
+			*tags = append(*tags, "outbound", scopeName)
+			bandwidthBytes.WithLabelValues(*tags...).Add(float64(evt.DeltaOut))
+		}
+	}
+}
+
+// topScopeName returns the class of the scope with the given name, such as "peer" or "stream".
+// We don't want to get the peerid or the connection or stream id here.
+func topScopeName(name string) string {
+	// Using indexes and slices to avoid allocating.
+	scopeSplitIdx := strings.IndexByte(name, ':')
+	if scopeSplitIdx != -1 {
+		name = name[0:scopeSplitIdx]
+	}
+	// Drop the connection or stream id
+	idSplitIdx := strings.IndexByte(name, '-')
+	if idSplitIdx != -1 {
+		name = name[0:idSplitIdx]
 	}
+	return name
 }
@@ -5,7 +5,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/test"
+
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
 )
 
 var registerOnce sync.Once
@@ -37,3 +42,83 @@ func TestConsumeEvent(t *testing.T) {
 
 	str.ConsumeEvent(evt)
 }
+
+func TestServiceScopeGauges(t *testing.T) {
+	rcmgr, err := NewResourceManager(NewFixedLimiter(DefaultLimits.AutoScale()), WithTraceReporter(StatsTraceReporter{}))
+	require.NoError(t, err)
+	defer rcmgr.Close()
+
+	setGauge := func(name string, value int64) {
+		t.Helper()
+		err := rcmgr.ViewService("test.gauges", func(s network.ServiceScope) error {
+			s.(ServiceScopeGauges).SetGauge(name, value)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	setGauge("sessions", 3)
+	setGauge("sessions", 2)
+	setGauge("pending", 1)
+
+	err = rcmgr.ViewService("test.gauges", func(s network.ServiceScope) error {
+		require.Equal(t, map[string]int64{"sessions": 2, "pending": 1}, s.(ServiceScopeGauges).Gauges())
+		return nil
+	})
+	require.NoError(t, err)
+	gaugeValue := func(gauge string) float64 {
+		t.Helper()
+		var m dto.Metric
+		require.NoError(t, serviceGauges.WithLabelValues("test.gauges", gauge).Write(&m))
+		return m.GetGauge().GetValue()
+	}
+	require.Equal(t, 2.0, gaugeValue("sessions"))
+	require.Equal(t, 1.0, gaugeValue("pending"))
+}
+
+func TestScopeBandwidth(t *testing.T) {
+	rcmgr, err := NewResourceManager(NewFixedLimiter(DefaultLimits.AutoScale()), WithTraceReporter(StatsTraceReporter{}))
+	require.NoError(t, err)
+	defer rcmgr.Close()
+
+	counterValue := func(dir string) float64 {
+		t.Helper()
+		var m dto.Metric
+		require.NoError(t, bandwidthBytes.WithLabelValues(dir, "stream").Write(&m))
+		return m.GetCounter().GetValue()
+	}
+	inBefore, outBefore := counterValue("inbound"), counterValue("outbound")
+
+	p := test.RandPeerIDFatal(t)
+	stream, err := rcmgr.OpenStream(p, network.DirInbound)
+	require.NoError(t, err)
+	defer stream.Done()
+	require.NoError(t, stream.SetProtocol("/test/bandwidth"))
+
+	stream.(ResourceScopeBandwidth).RecordBandwidth(network.DirInbound, 100)
+	stream.(ResourceScopeBandwidth).RecordBandwidth(network.DirOutbound, 40)
+	stream.(ResourceScopeBandwidth).RecordBandwidth(network.DirInbound, 0)
+
+	bandwidth := func(s any) [2]int64 {
+		in, out := s.(ResourceScopeBandwidth).Bandwidth()
+		return [2]int64{in, out}
+	}
+	require.Equal(t, [2]int64{100, 40}, bandwidth(stream))
+	require.NoError(t, rcmgr.ViewPeer(p, func(s network.PeerScope) error {
+		require.Equal(t, [2]int64{100, 40}, bandwidth(s))
+		return nil
+	}))
+	require.NoError(t, rcmgr.ViewProtocol("/test/bandwidth", func(s network.ProtocolScope) error {
+		require.Equal(t, [2]int64{100, 40}, bandwidth(s))
+		return nil
+	}))
+	require.NoError(t, rcmgr.ViewSystem(func(s network.ResourceScope) error {
+		in, out := s.(ResourceScopeBandwidth).Bandwidth()
+		require.GreaterOrEqual(t, in, int64(100))
+		require.GreaterOrEqual(t, out, int64(40))
+		return nil
+	}))
+
+	require.Eventually(t, func() bool {
+		return counterValue("inbound")-inBefore == 100 && counterValue("outbound")-outBefore == 40
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -69,6 +69,8 @@ const (
 	TraceAddConnEvt            TraceEvtTyp = "add_conn"
 	TraceBlockAddConnEvt       TraceEvtTyp = "block_add_conn"
 	TraceRemoveConnEvt         TraceEvtTyp = "remove_conn"
+	TraceSetGaugeEvt           TraceEvtTyp = "set_gauge"
+	TraceRecordBandwidthEvt    TraceEvtTyp = "record_bandwidth"
 )
 
 type scopeClass struct {
@@ -208,6 +210,9 @@ type TraceEvt struct {
 	ConnsOut int `json:",omitempty"`
 
 	FD int `json:",omitempty"`
+
+	Gauge string `json:",omitempty"`
+	Value int64  `json:",omitempty"`
 }
 
 func (t *trace) push(evt TraceEvt) {
@@ -696,3 +701,33 @@ func (t *trace) RemoveConns(scope string, deltaIn, deltaOut, deltafd, nconnsIn,
 		FD:       nfd,
 	})
 }
+
+func (t *trace) SetGauge(scope, gauge string, value int64) {
+	if t == nil {
+		return
+	}
+
+	t.push(TraceEvt{
+		Type:  TraceSetGaugeEvt,
+		Name:  scope,
+		Gauge: gauge,
+		Value: value,
+	})
+}
+
+func (t *trace) RecordBandwidth(scope string, dir network.Direction, size int64) {
+	if t == nil {
+		return
+	}
+
+	evt := TraceEvt{
+		Type: TraceRecordBandwidthEvt,
+		Name: scope,
+	}
+	if dir == network.DirInbound {
+		evt.DeltaIn = int(size)
+	} else {
+		evt.DeltaOut = int(size)
+	}
+	t.push(evt)
+}
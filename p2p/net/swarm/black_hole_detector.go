@@ -8,21 +8,26 @@ import (
 	manet "github.com/multiformats/go-multiaddr/net"
 )
 
+// BlackHoleState is the state of a black hole filter.
 type BlackHoleState int
 
 const (
-	blackHoleStateProbing BlackHoleState = iota
-	blackHoleStateAllowed
-	blackHoleStateBlocked
+	// BlackHoleStateProbing means there aren't enough dial results to determine the state;
+	// dials are allowed.
+	BlackHoleStateProbing BlackHoleState = iota
+	// BlackHoleStateAllowed means dials are allowed.
+	BlackHoleStateAllowed
+	// BlackHoleStateBlocked means dials are refused, except for periodic probes.
+	BlackHoleStateBlocked
 )
 
 func (st BlackHoleState) String() string {
 	switch st {
-	case blackHoleStateProbing:
+	case BlackHoleStateProbing:
 		return "Probing"
-	case blackHoleStateAllowed:
+	case BlackHoleStateAllowed:
 		return "Allowed"
-	case blackHoleStateBlocked:
+	case BlackHoleStateBlocked:
 		return "Blocked"
 	default:
 		return fmt.Sprintf("Unknown %d", st)
@@ -67,7 +72,7 @@ func (b *BlackHoleSuccessCounter) RecordResult(success bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if b.state == blackHoleStateBlocked && success {
+	if b.state == BlackHoleStateBlocked && success {
 		// If the call succeeds in a blocked state we reset to allowed.
 		// This is better than slowly accumulating values till we cross the minSuccessFraction
 		// threshold since a black hole is a binary property.
@@ -97,12 +102,12 @@ func (b *BlackHoleSuccessCounter) HandleRequest() BlackHoleState {
 
 	b.requests++
 
-	if b.state == blackHoleStateAllowed {
-		return blackHoleStateAllowed
-	} else if b.state == blackHoleStateProbing || b.requests%b.N == 0 {
-		return blackHoleStateProbing
+	if b.state == BlackHoleStateAllowed {
+		return BlackHoleStateAllowed
+	} else if b.state == BlackHoleStateProbing || b.requests%b.N == 0 {
+		return BlackHoleStateProbing
 	} else {
-		return blackHoleStateBlocked
+		return BlackHoleStateBlocked
 	}
 }
 
@@ -117,11 +122,11 @@ func (b *BlackHoleSuccessCounter) updateState() {
 	st := b.state
 
 	if len(b.dialResults) < b.N {
-		b.state = blackHoleStateProbing
+		b.state = BlackHoleStateProbing
 	} else if b.successes >= b.MinSuccesses {
-		b.state = blackHoleStateAllowed
+		b.state = BlackHoleStateAllowed
 	} else {
-		b.state = blackHoleStateBlocked
+		b.state = BlackHoleStateBlocked
 	}
 
 	if st != b.state {
@@ -136,19 +141,26 @@ func (b *BlackHoleSuccessCounter) State() BlackHoleState {
 	return b.state
 }
 
-type blackHoleInfo struct {
-	name            string
-	state           BlackHoleState
-	nextProbeAfter  int
-	successFraction float64
+// BlackHoleInfo describes the state of a BlackHoleSuccessCounter.
+type BlackHoleInfo struct {
+	// Name is the name of the counter, e.g. "IPv6".
+	Name string
+	// State is the current state of the counter.
+	State BlackHoleState
+	// NextProbeAfter is the number of dial requests after which the next probe is allowed in
+	// Blocked state.
+	NextProbeAfter int
+	// SuccessFraction is the fraction of successful dials among the recorded dial results.
+	SuccessFraction float64
 }
 
-func (b *BlackHoleSuccessCounter) info() blackHoleInfo {
+// Info returns the current state of the counter.
+func (b *BlackHoleSuccessCounter) Info() BlackHoleInfo {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	nextProbeAfter := 0
-	if b.state == blackHoleStateBlocked {
+	if b.state == BlackHoleStateBlocked {
 		nextProbeAfter = b.N - (b.requests % b.N)
 	}
 
@@ -157,15 +169,16 @@ func (b *BlackHoleSuccessCounter) info() blackHoleInfo {
 		successFraction = float64(b.successes) / float64(len(b.dialResults))
 	}
 
-	return blackHoleInfo{
-		name:            b.Name,
-		state:           b.state,
-		nextProbeAfter:  nextProbeAfter,
-		successFraction: successFraction,
+	return BlackHoleInfo{
+		Name:            b.Name,
+		State:           b.state,
+		NextProbeAfter:  nextProbeAfter,
+		SuccessFraction: successFraction,
 	}
 }
 
-// blackHoleDetector provides UDP and IPv6 black hole detection using a `BlackHoleSuccessCounter` for each.
+// blackHoleDetector provides UDP, IPv4 and IPv6 black hole detection using a
+// `BlackHoleSuccessCounter` for each. IPv4 black hole detection is disabled by default.
 // For details of the black hole detection logic see `BlackHoleSuccessCounter`.
 // In Read Only mode, detector doesn't update the state of underlying filters and refuses requests
 // when black hole state is unknown. This is useful for Swarms made specifically for services like
@@ -175,38 +188,51 @@ func (b *BlackHoleSuccessCounter) info() blackHoleInfo {
 // of the black hole state are actually dialed and are not skipped because of dial prioritisation
 // logic.
 type blackHoleDetector struct {
-	udp, ipv6 *BlackHoleSuccessCounter
-	mt        MetricsTracer
-	readOnly  bool
+	udp, ipv4, ipv6 *BlackHoleSuccessCounter
+	mt              MetricsTracer
+	readOnly        bool
+}
+
+type blackHoleFilter struct {
+	counter *BlackHoleSuccessCounter
+	// code is the multiaddr protocol code of the addresses the counter applies to
+	code int
+}
+
+// filters returns the configured counters along with the protocol they apply to.
+func (d *blackHoleDetector) filters() []blackHoleFilter {
+	filters := make([]blackHoleFilter, 0, 3)
+	if d.udp != nil {
+		filters = append(filters, blackHoleFilter{counter: d.udp, code: ma.P_UDP})
+	}
+	if d.ipv4 != nil {
+		filters = append(filters, blackHoleFilter{counter: d.ipv4, code: ma.P_IP4})
+	}
+	if d.ipv6 != nil {
+		filters = append(filters, blackHoleFilter{counter: d.ipv6, code: ma.P_IP6})
+	}
+	return filters
 }
 
 // FilterAddrs filters the peer's addresses removing black holed addresses
 func (d *blackHoleDetector) FilterAddrs(addrs []ma.Multiaddr) (valid []ma.Multiaddr, blackHoled []ma.Multiaddr) {
-	hasUDP, hasIPv6 := false, false
-	for _, a := range addrs {
-		if !manet.IsPublicAddr(a) {
-			continue
-		}
-		if isProtocolAddr(a, ma.P_UDP) {
-			hasUDP = true
+	filters := d.filters()
+	states := make([]BlackHoleState, len(filters))
+	for i, f := range filters {
+		states[i] = BlackHoleStateAllowed
+		hasAddr := false
+		for _, a := range addrs {
+			if manet.IsPublicAddr(a) && isProtocolAddr(a, f.code) {
+				hasAddr = true
+				break
+			}
 		}
-		if isProtocolAddr(a, ma.P_IP6) {
-			hasIPv6 = true
+		if hasAddr {
+			states[i] = d.getFilterState(f.counter)
+			d.trackMetrics(f.counter)
 		}
 	}
 
-	udpRes := blackHoleStateAllowed
-	if d.udp != nil && hasUDP {
-		udpRes = d.getFilterState(d.udp)
-		d.trackMetrics(d.udp)
-	}
-
-	ipv6Res := blackHoleStateAllowed
-	if d.ipv6 != nil && hasIPv6 {
-		ipv6Res = d.getFilterState(d.ipv6)
-		d.trackMetrics(d.ipv6)
-	}
-
 	blackHoled = make([]ma.Multiaddr, 0, len(addrs))
 	return ma.FilterAddrs(
 		addrs,
@@ -214,22 +240,19 @@ func (d *blackHoleDetector) FilterAddrs(addrs []ma.Multiaddr) (valid []ma.Multia
 			if !manet.IsPublicAddr(a) {
 				return true
 			}
-			// allow all UDP addresses while probing irrespective of IPv6 black hole state
-			if udpRes == blackHoleStateProbing && isProtocolAddr(a, ma.P_UDP) {
-				return true
+			// allow all addresses of a filter that is probing, irrespective of the state of
+			// the other filters. For example, UDP addresses are allowed while probing UDP,
+			// irrespective of IPv6 black hole state.
+			for i, f := range filters {
+				if states[i] == BlackHoleStateProbing && isProtocolAddr(a, f.code) {
+					return true
+				}
 			}
-			// allow all IPv6 addresses while probing irrespective of UDP black hole state
-			if ipv6Res == blackHoleStateProbing && isProtocolAddr(a, ma.P_IP6) {
-				return true
-			}
-
-			if udpRes == blackHoleStateBlocked && isProtocolAddr(a, ma.P_UDP) {
-				blackHoled = append(blackHoled, a)
-				return false
-			}
-			if ipv6Res == blackHoleStateBlocked && isProtocolAddr(a, ma.P_IP6) {
-				blackHoled = append(blackHoled, a)
-				return false
+			for i, f := range filters {
+				if states[i] == BlackHoleStateBlocked && isProtocolAddr(a, f.code) {
+					blackHoled = append(blackHoled, a)
+					return false
+				}
 			}
 			return true
 		},
@@ -241,22 +264,30 @@ func (d *blackHoleDetector) RecordResult(addr ma.Multiaddr, success bool) {
 	if d.readOnly || !manet.IsPublicAddr(addr) {
 		return
 	}
-	if d.udp != nil && isProtocolAddr(addr, ma.P_UDP) {
-		d.udp.RecordResult(success)
-		d.trackMetrics(d.udp)
+	for _, f := range d.filters() {
+		if isProtocolAddr(addr, f.code) {
+			f.counter.RecordResult(success)
+			d.trackMetrics(f.counter)
+		}
 	}
-	if d.ipv6 != nil && isProtocolAddr(addr, ma.P_IP6) {
-		d.ipv6.RecordResult(success)
-		d.trackMetrics(d.ipv6)
+}
+
+// Info returns the state of the configured counters.
+func (d *blackHoleDetector) Info() []BlackHoleInfo {
+	filters := d.filters()
+	res := make([]BlackHoleInfo, 0, len(filters))
+	for _, f := range filters {
+		res = append(res, f.counter.Info())
 	}
+	return res
 }
 
 func (d *blackHoleDetector) getFilterState(f *BlackHoleSuccessCounter) BlackHoleState {
 	if d.readOnly {
-		if f.State() != blackHoleStateAllowed {
-			return blackHoleStateBlocked
+		if f.State() != BlackHoleStateAllowed {
+			return BlackHoleStateBlocked
 		}
-		return blackHoleStateAllowed
+		return BlackHoleStateAllowed
 	}
 	return f.HandleRequest()
 }
@@ -266,6 +297,6 @@ func (d *blackHoleDetector) trackMetrics(f *BlackHoleSuccessCounter) {
 		return
 	}
 	// Track metrics only in non readOnly state
-	info := f.info()
-	d.mt.UpdatedBlackHoleSuccessCounter(info.name, info.state, info.nextProbeAfter, info.successFraction)
+	info := f.Info()
+	d.mt.UpdatedBlackHoleSuccessCounter(info.Name, info.State, info.NextProbeAfter, info.SuccessFraction)
 }
@@ -13,10 +13,10 @@ func TestBlackHoleSuccessCounterReset(t *testing.T) {
 	bhf := &BlackHoleSuccessCounter{N: n, MinSuccesses: 2, Name: "test"}
 	// calls up to n should be probing
 	for i := 1; i <= n; i++ {
-		if bhf.HandleRequest() != blackHoleStateProbing {
+		if bhf.HandleRequest() != BlackHoleStateProbing {
 			t.Fatalf("expected calls up to n to be probes")
 		}
-		if bhf.State() != blackHoleStateProbing {
+		if bhf.State() != BlackHoleStateProbing {
 			t.Fatalf("expected state to be probing got %s", bhf.State())
 		}
 		bhf.RecordResult(false)
@@ -25,10 +25,10 @@ func TestBlackHoleSuccessCounterReset(t *testing.T) {
 	// after threshold calls every nth call should be a probe
 	for i := n + 1; i < 42; i++ {
 		result := bhf.HandleRequest()
-		if (i%n == 0 && result != blackHoleStateProbing) || (i%n != 0 && result != blackHoleStateBlocked) {
+		if (i%n == 0 && result != BlackHoleStateProbing) || (i%n != 0 && result != BlackHoleStateBlocked) {
 			t.Fatalf("expected every nth dial to be a probe")
 		}
-		if bhf.State() != blackHoleStateBlocked {
+		if bhf.State() != BlackHoleStateBlocked {
 			t.Fatalf("expected state to be blocked, got %s", bhf.State())
 		}
 	}
@@ -36,19 +36,19 @@ func TestBlackHoleSuccessCounterReset(t *testing.T) {
 	bhf.RecordResult(true)
 	// check if calls up to n are probes again
 	for range n {
-		if bhf.HandleRequest() != blackHoleStateProbing {
+		if bhf.HandleRequest() != BlackHoleStateProbing {
 			t.Fatalf("expected black hole detector state to reset after success")
 		}
-		if bhf.State() != blackHoleStateProbing {
+		if bhf.State() != BlackHoleStateProbing {
 			t.Fatalf("expected state to be probing got %s", bhf.State())
 		}
 		bhf.RecordResult(false)
 	}
 
 	// next call should be blocked
-	if bhf.HandleRequest() != blackHoleStateBlocked {
+	if bhf.HandleRequest() != BlackHoleStateBlocked {
 		t.Fatalf("expected dial to be blocked")
-		if bhf.State() != blackHoleStateBlocked {
+		if bhf.State() != BlackHoleStateBlocked {
 			t.Fatalf("expected state to be blocked, got %s", bhf.State())
 		}
 	}
@@ -60,13 +60,13 @@ func TestBlackHoleSuccessCounterSuccessFraction(t *testing.T) {
 		minSuccesses, successes int
 		result                  BlackHoleState
 	}{
-		{minSuccesses: 5, successes: 5, result: blackHoleStateAllowed},
-		{minSuccesses: 3, successes: 3, result: blackHoleStateAllowed},
-		{minSuccesses: 5, successes: 4, result: blackHoleStateBlocked},
-		{minSuccesses: 5, successes: 7, result: blackHoleStateAllowed},
-		{minSuccesses: 3, successes: 1, result: blackHoleStateBlocked},
-		{minSuccesses: 0, successes: 0, result: blackHoleStateAllowed},
-		{minSuccesses: 10, successes: 10, result: blackHoleStateAllowed},
+		{minSuccesses: 5, successes: 5, result: BlackHoleStateAllowed},
+		{minSuccesses: 3, successes: 3, result: BlackHoleStateAllowed},
+		{minSuccesses: 5, successes: 4, result: BlackHoleStateBlocked},
+		{minSuccesses: 5, successes: 7, result: BlackHoleStateAllowed},
+		{minSuccesses: 3, successes: 1, result: BlackHoleStateBlocked},
+		{minSuccesses: 0, successes: 0, result: BlackHoleStateAllowed},
+		{minSuccesses: 10, successes: 10, result: BlackHoleStateAllowed},
 	}
 	for i, tc := range tests {
 		t.Run(fmt.Sprintf("case-%d", i), func(t *testing.T) {
@@ -137,6 +137,41 @@ func TestBlackHoleDetectorIPv6Disabled(t *testing.T) {
 	require.ElementsMatch(t, wantRemovedAddrs, gotRemovedAddrs)
 }
 
+func TestBlackHoleDetectorIPv4(t *testing.T) {
+	bhd := &blackHoleDetector{
+		ipv4: &BlackHoleSuccessCounter{N: 10, MinSuccesses: 5, Name: "IPv4"},
+		ipv6: &BlackHoleSuccessCounter{N: 10, MinSuccesses: 5, Name: "IPv6"},
+	}
+	tcp4Pub := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	tcp4Pri := ma.StringCast("/ip4/192.168.1.5/tcp/1234")
+	tcp6Pub := ma.StringCast("/ip6/2001::1/tcp/1234")
+	for range 10 {
+		bhd.RecordResult(tcp4Pub, false)
+		bhd.RecordResult(tcp6Pub, true)
+	}
+
+	gotAddrs, gotRemovedAddrs := bhd.FilterAddrs([]ma.Multiaddr{tcp4Pub, tcp4Pri, tcp6Pub})
+	require.ElementsMatch(t, []ma.Multiaddr{tcp4Pri, tcp6Pub}, gotAddrs)
+	require.ElementsMatch(t, []ma.Multiaddr{tcp4Pub}, gotRemovedAddrs)
+
+	info := bhd.Info()
+	require.Len(t, info, 2)
+	require.Equal(t, "IPv4", info[0].Name)
+	require.Equal(t, BlackHoleStateBlocked, info[0].State)
+	require.Zero(t, info[0].SuccessFraction)
+	require.Equal(t, "IPv6", info[1].Name)
+	require.Equal(t, BlackHoleStateAllowed, info[1].State)
+	require.Equal(t, 1.0, info[1].SuccessFraction)
+
+	// a successful probe unblocks the address family
+	for bhd.ipv4.State() == BlackHoleStateBlocked {
+		if addrs, _ := bhd.FilterAddrs([]ma.Multiaddr{tcp4Pub}); len(addrs) > 0 {
+			bhd.RecordResult(tcp4Pub, true)
+		}
+	}
+	require.Equal(t, BlackHoleStateProbing, bhd.ipv4.State())
+}
+
 func TestBlackHoleDetectorProbes(t *testing.T) {
 	bhd := &blackHoleDetector{
 		udp:  &BlackHoleSuccessCounter{N: 2, MinSuccesses: 1, Name: "udp"},
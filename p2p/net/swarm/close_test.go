@@ -0,0 +1,173 @@
+package swarm_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	. "github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func numStreams(s *Swarm) int {
+	n := 0
+	for _, c := range s.Conns() {
+		n += len(c.GetStreams())
+	}
+	return n
+}
+
+func TestCloseGracefully(t *testing.T) {
+	opts := []swarmt.Option{swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC}
+	s1 := swarmt.GenSwarm(t, opts...)
+	s2 := swarmt.GenSwarm(t, opts...)
+	s3 := swarmt.GenSwarm(t, opts...)
+
+	// s1 echoes a line and waits for s2 to end the stream
+	s1.SetStreamHandler(func(s network.Stream) {
+		defer s.Close()
+		line, err := bufio.NewReader(s).ReadString('\n')
+		if err != nil {
+			s.Reset()
+			return
+		}
+		s.Write([]byte(line))
+		io.Copy(io.Discard, s)
+	})
+	listenClosed := make(chan ma.Multiaddr, 10)
+	s1.Notify(&network.NotifyBundle{ListenCloseF: func(_ network.Network, a ma.Multiaddr) { listenClosed <- a }})
+
+	s1Addrs := s1.ListenAddresses()
+	s2.Peerstore().AddAddrs(s1.LocalPeer(), s1Addrs, time.Hour)
+	s3.Peerstore().AddAddrs(s1.LocalPeer(), s1Addrs, time.Hour)
+	s1.Peerstore().AddAddrs(s3.LocalPeer(), s3.ListenAddresses(), time.Hour)
+
+	str, err := s2.NewStream(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	_, err = str.Write([]byte("hello "))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return numStreams(s1) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- s1.CloseGracefully(context.Background()) }()
+
+	// listeners close first
+	require.Eventually(t, func() bool { return len(s1.ListenAddresses()) == 0 }, 5*time.Second, 10*time.Millisecond)
+	select {
+	case a := <-listenClosed:
+		require.Contains(t, s1Addrs, a)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a listen close notification")
+	}
+
+	// no new connections while draining
+	_, err = s3.DialPeer(context.Background(), s1.LocalPeer())
+	require.Error(t, err)
+	_, err = s1.DialPeer(context.Background(), s3.LocalPeer())
+	require.ErrorIs(t, err, ErrSwarmClosed)
+
+	select {
+	case <-closed:
+		t.Fatal("swarm closed with an in-flight stream")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the in-flight stream completes
+	_, err = str.Write([]byte("world\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(str).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "hello world\n", line)
+	str.Close()
+
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("swarm didn't close after the stream completed")
+	}
+	select {
+	case <-s1.Done():
+	default:
+		t.Fatal("swarm not closed")
+	}
+	require.Empty(t, s1.Conns())
+}
+
+func TestCloseGracefullyTimeout(t *testing.T) {
+	opts := []swarmt.Option{swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC}
+	s1 := swarmt.GenSwarm(t, opts...)
+	s2 := swarmt.GenSwarm(t, opts...)
+	s1.SetStreamHandler(func(s network.Stream) {
+		io.Copy(io.Discard, s)
+		s.Close()
+	})
+	s2.Peerstore().AddAddrs(s1.LocalPeer(), s1.ListenAddresses(), time.Hour)
+
+	str, err := s2.NewStream(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	defer str.Close()
+	_, err = str.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return numStreams(s1) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s1.CloseGracefully(ctx), context.DeadlineExceeded)
+	require.Empty(t, s1.Conns())
+	require.Eventually(t, func() bool {
+		return s2.Connectedness(s1.LocalPeer()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// closing again is a no-op
+	require.NoError(t, s1.CloseGracefully(context.Background()))
+	require.NoError(t, s1.Close())
+}
+
+func TestCloseGracefullyConcurrent(t *testing.T) {
+	opts := []swarmt.Option{swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC}
+	s1 := swarmt.GenSwarm(t, opts...)
+	s2 := swarmt.GenSwarm(t, opts...)
+	s1.SetStreamHandler(func(s network.Stream) {
+		io.Copy(io.Discard, s)
+		s.Close()
+	})
+	s2.Peerstore().AddAddrs(s1.LocalPeer(), s1.ListenAddresses(), time.Hour)
+
+	str, err := s2.NewStream(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	_, err = str.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return numStreams(s1) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	first := make(chan error, 1)
+	go func() { first <- s1.CloseGracefully(context.Background()) }()
+	require.Eventually(t, func() bool { return len(s1.ListenAddresses()) == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// a second call waits for the drain in progress rather than closing the swarm
+	second := make(chan error, 1)
+	go func() { second <- s1.CloseGracefully(context.Background()) }()
+	select {
+	case <-second:
+		t.Fatal("second call returned while draining")
+	case <-s1.Done():
+		t.Fatal("swarm closed with an in-flight stream")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	str.Close()
+	for _, closed := range []chan error{first, second} {
+		select {
+		case err := <-closed:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("swarm didn't close after the stream completed")
+		}
+	}
+}
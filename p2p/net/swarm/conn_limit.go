@@ -0,0 +1,120 @@
+package swarm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// ErrMaxConnections is returned when a new connection is refused because the
+// swarm already has the maximum number of open connections.
+var ErrMaxConnections = errors.New("swarm: maximum number of connections reached")
+
+// EvictionPolicy decides what happens when a new connection would exceed the
+// limit set with WithMaxConnections.
+//
+// Evict is called with all currently open connections and returns the one to
+// close to make room for the new connection, or nil to refuse the new
+// connection. It's called with the swarm's connection lock held and must not
+// call back into the swarm.
+type EvictionPolicy interface {
+	Evict(conns []network.Conn) network.Conn
+}
+
+// EvictionPolicyFunc is an adapter to allow the use of ordinary functions as
+// eviction policies.
+type EvictionPolicyFunc func(conns []network.Conn) network.Conn
+
+func (f EvictionPolicyFunc) Evict(conns []network.Conn) network.Conn { return f(conns) }
+
+// RefuseNewConns is an EvictionPolicy that never evicts: once the limit is
+// reached, new connections are refused until an existing one is closed.
+var RefuseNewConns EvictionPolicy = EvictionPolicyFunc(func([]network.Conn) network.Conn { return nil })
+
+// ConnScorer returns the value of a connection. Lower scores are less valuable.
+type ConnScorer func(c network.Conn) float64
+
+// ScoreByIdleTime scores connections by how long they have been idle and how
+// many streams they carry. A connection without streams scores lower the
+// longer it has been idle, since its last stream was opened or closed, or since
+// it was opened if it never carried a stream. The connection that has been idle
+// the longest is evicted first. Connections with open streams always score
+// higher than idle ones.
+func ScoreByIdleTime(c network.Conn) float64 {
+	if n := len(c.GetStreams()); n > 0 {
+		return float64(n)
+	}
+	idleSince := c.Stat().Opened
+	if sc, ok := c.(*Conn); ok {
+		if t := sc.lastStreamActivity(); !t.IsZero() {
+			idleSince = t
+		}
+	}
+	return -time.Since(idleSince).Seconds()
+}
+
+// EvictLowestScore returns an EvictionPolicy that evicts the connection with
+// the lowest score. Ties are broken in favor of evicting the older connection.
+func EvictLowestScore(score ConnScorer) EvictionPolicy {
+	return EvictionPolicyFunc(func(conns []network.Conn) network.Conn {
+		var (
+			victim network.Conn
+			lowest float64
+		)
+		for _, c := range conns {
+			s := score(c)
+			if victim == nil || s < lowest {
+				victim, lowest = c, s
+			}
+		}
+		return victim
+	})
+}
+
+// WithMaxConnections caps the total number of open connections of the swarm,
+// across all peers and both directions. When the limit is reached, policy
+// decides whether a new connection is refused or an existing one is closed to
+// make room for it.
+//
+// Unlike the connection manager, which trims connections down to a watermark
+// after the fact, this is a hard cap enforced when a connection is added.
+func WithMaxConnections(n int, policy EvictionPolicy) Option {
+	return func(s *Swarm) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid connection limit: %d", n)
+		}
+		if policy == nil {
+			return errors.New("eviction policy must not be nil")
+		}
+		s.maxConns = n
+		s.connEviction = policy
+		return nil
+	}
+}
+
+// makeRoomLocked makes room for one more connection if the connection limit
+// is reached. It returns the evicted connection, which has been removed from
+// the swarm and must be closed by the caller after releasing the lock, or
+// ErrMaxConnections if the policy refused the new connection.
+// s.conns must be locked.
+func (s *Swarm) makeRoomLocked() (*Conn, error) {
+	if s.maxConns <= 0 {
+		return nil, nil
+	}
+	var conns []network.Conn
+	for _, cs := range s.conns.m {
+		for _, c := range cs {
+			conns = append(conns, c)
+		}
+	}
+	if len(conns) < s.maxConns {
+		return nil, nil
+	}
+	victim, _ := s.connEviction.Evict(conns).(*Conn)
+	if victim == nil || !s.removeConnLocked(victim) {
+		return nil, ErrMaxConnections
+	}
+	return victim, nil
+}
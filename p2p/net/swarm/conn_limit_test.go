@@ -0,0 +1,134 @@
+package swarm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	. "github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var connLimitTestOpts = []swarmt.Option{swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC}
+
+func genLimitedSwarm(t *testing.T, n int, policy EvictionPolicy) *Swarm {
+	opts := append([]swarmt.Option{swarmt.WithSwarmOpts(WithMaxConnections(n, policy))}, connLimitTestOpts...)
+	return swarmt.GenSwarm(t, opts...)
+}
+
+func connectedPeers(s *Swarm) []peer.ID {
+	var peers []peer.ID
+	for _, c := range s.Conns() {
+		peers = append(peers, c.RemotePeer())
+	}
+	return peers
+}
+
+func dialFrom(t *testing.T, from, to *Swarm) error {
+	t.Helper()
+	from.Peerstore().AddAddrs(to.LocalPeer(), to.ListenAddresses(), time.Hour)
+	_, err := from.DialPeer(context.Background(), to.LocalPeer())
+	return err
+}
+
+func TestMaxConnectionsOption(t *testing.T) {
+	require.Error(t, WithMaxConnections(0, RefuseNewConns)(&Swarm{}))
+	require.Error(t, WithMaxConnections(1, nil)(&Swarm{}))
+	require.NoError(t, WithMaxConnections(1, RefuseNewConns)(&Swarm{}))
+}
+
+func TestMaxConnectionsRefuse(t *testing.T) {
+	s := genLimitedSwarm(t, 2, RefuseNewConns)
+	s1 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s2 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s3 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s4 := swarmt.GenSwarm(t, connLimitTestOpts...)
+
+	require.NoError(t, dialFrom(t, s1, s))
+	require.NoError(t, dialFrom(t, s2, s))
+	require.Eventually(t, func() bool { return len(s.Conns()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// inbound connections over the limit are closed
+	dialFrom(t, s3, s)
+	require.Eventually(t, func() bool {
+		return s3.Connectedness(s.LocalPeer()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// outbound connections over the limit fail
+	err := dialFrom(t, s, s4)
+	require.ErrorIs(t, err, ErrMaxConnections)
+
+	require.ElementsMatch(t, []peer.ID{s1.LocalPeer(), s2.LocalPeer()}, connectedPeers(s))
+
+	// closing a connection makes room for a new one
+	require.NoError(t, s.ClosePeer(s1.LocalPeer()))
+	require.NoError(t, dialFrom(t, s, s4))
+	require.ElementsMatch(t, []peer.ID{s2.LocalPeer(), s4.LocalPeer()}, connectedPeers(s))
+}
+
+func TestMaxConnectionsEvictIdle(t *testing.T) {
+	s := genLimitedSwarm(t, 2, EvictLowestScore(ScoreByIdleTime))
+	s1 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s2 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s3 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s4 := swarmt.GenSwarm(t, connLimitTestOpts...)
+
+	require.NoError(t, dialFrom(t, s, s1))
+	require.NoError(t, dialFrom(t, s, s2))
+
+	// a connection carrying a stream is more valuable than an idle one
+	str, err := s.NewStream(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	defer str.Close()
+
+	// the idle connection to s2 is evicted to make room for the inbound connection
+	require.NoError(t, dialFrom(t, s3, s))
+	require.Eventually(t, func() bool {
+		return s.Connectedness(s3.LocalPeer()) == network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.ElementsMatch(t, []peer.ID{s1.LocalPeer(), s3.LocalPeer()}, connectedPeers(s))
+	require.Eventually(t, func() bool {
+		return s2.Connectedness(s.LocalPeer()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the same applies to outbound connections
+	require.NoError(t, dialFrom(t, s, s4))
+	require.ElementsMatch(t, []peer.ID{s1.LocalPeer(), s4.LocalPeer()}, connectedPeers(s))
+}
+
+func TestMaxConnectionsEvictIdleSinceLastStream(t *testing.T) {
+	s := genLimitedSwarm(t, 2, EvictLowestScore(ScoreByIdleTime))
+	s1 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s2 := swarmt.GenSwarm(t, connLimitTestOpts...)
+	s3 := swarmt.GenSwarm(t, connLimitTestOpts...)
+
+	require.NoError(t, dialFrom(t, s, s1))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, dialFrom(t, s, s2))
+	time.Sleep(50 * time.Millisecond)
+
+	// the older connection to s1 carried a stream more recently than the connection to s2
+	str, err := s.NewStream(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	require.NoError(t, str.Reset())
+	require.Eventually(t, func() bool {
+		for _, c := range s.ConnsToPeer(s1.LocalPeer()) {
+			if len(c.GetStreams()) > 0 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, dialFrom(t, s, s3))
+	require.ElementsMatch(t, []peer.ID{s1.LocalPeer(), s3.LocalPeer()}, connectedPeers(s))
+}
+
+func TestEvictLowestScore(t *testing.T) {
+	require.Nil(t, EvictLowestScore(ScoreByIdleTime).Evict(nil))
+	require.Nil(t, RefuseNewConns.Evict(nil))
+}
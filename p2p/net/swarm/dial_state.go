@@ -0,0 +1,130 @@
+package swarm
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// DialState describes an in-progress dial to a peer.
+type DialState struct {
+	// Peer is the peer being dialed.
+	Peer peer.ID
+	// Duration is how long the dial to the peer has been running.
+	Duration time.Duration
+	// PendingRequests is the number of dial requests waiting for the dial to complete.
+	PendingRequests int
+	// Addrs are the addresses of the peer that are being dialed or waiting to be dialed.
+	Addrs []AddrDialState
+}
+
+// AddrDialState describes the dial to an address of a peer.
+type AddrDialState struct {
+	// Addr is the address.
+	Addr ma.Multiaddr
+	// Waiting is true if the address is waiting for its dial ranking (happy eyeballs) delay
+	// and hasn't been dialed yet.
+	Waiting bool
+	// Duration is how long the address has been dialed, or waiting to be dialed if Waiting is true.
+	Duration time.Duration
+}
+
+// dialWorkerState is a snapshot of the state of a dial worker, taken by the worker loop on request.
+type dialWorkerState struct {
+	started         time.Time
+	pendingRequests int
+	addrs           []addrDialState
+}
+
+type addrDialState struct {
+	addr    ma.Multiaddr
+	dialed  bool
+	started time.Time
+}
+
+// snapshotState returns a snapshot of the worker's state for InProgressDials.
+// It must only be called from the worker loop.
+func (w *dialWorker) snapshotState(started time.Time) *dialWorkerState {
+	st := &dialWorkerState{
+		started:         started,
+		pendingRequests: len(w.pendingRequests),
+		addrs:           make([]addrDialState, 0, len(w.trackedDials)),
+	}
+	for _, ad := range w.trackedDials {
+		if ad.conn != nil || ad.err != nil {
+			// the dial to this address has completed
+			continue
+		}
+		as := addrDialState{addr: ad.addr, dialed: ad.dialed, started: ad.createdAt}
+		if ad.dialed {
+			as.started = ad.createdAt.Add(ad.dialRankingDelay)
+		}
+		st.addrs = append(st.addrs, as)
+	}
+	return st
+}
+
+func (s *Swarm) addDialWorker(w *dialWorker) {
+	s.dialWorkers.Lock()
+	defer s.dialWorkers.Unlock()
+	s.dialWorkers.m[w.peer] = w
+}
+
+func (s *Swarm) removeDialWorker(w *dialWorker) {
+	s.dialWorkers.Lock()
+	defer s.dialWorkers.Unlock()
+	if s.dialWorkers.m[w.peer] == w {
+		delete(s.dialWorkers.m, w.peer)
+	}
+}
+
+// InProgressDials returns the dials that are currently in progress, with the addresses that are
+// being dialed or waiting to be dialed. Each dial's state is a consistent snapshot taken by the
+// dial worker between processing events, so it is never partially updated by a completing dial.
+// Intended for debugging.
+func (s *Swarm) InProgressDials() []DialState {
+	s.dialWorkers.Lock()
+	workers := make([]*dialWorker, 0, len(s.dialWorkers.m))
+	for _, w := range s.dialWorkers.m {
+		workers = append(workers, w)
+	}
+	s.dialWorkers.Unlock()
+
+	states := make(map[peer.ID]*dialWorkerState, len(workers))
+	for _, w := range workers {
+		// the reply channel is buffered so that the worker never blocks on it
+		ch := make(chan *dialWorkerState, 1)
+		select {
+		case w.stateReqs <- ch:
+			states[w.peer] = <-ch
+		case <-w.done:
+			// the worker exited before handling the request
+		}
+	}
+
+	now := time.Now()
+	dials := make([]DialState, 0, len(states))
+	for p, st := range states {
+		if st.pendingRequests == 0 && len(st.addrs) == 0 {
+			// the worker is idle, waiting for requests or for the dial to be cleaned up
+			continue
+		}
+		ds := DialState{
+			Peer:            p,
+			Duration:        now.Sub(st.started),
+			PendingRequests: st.pendingRequests,
+			Addrs:           make([]AddrDialState, 0, len(st.addrs)),
+		}
+		for _, as := range st.addrs {
+			ds.Addrs = append(ds.Addrs, AddrDialState{
+				Addr:     as.addr,
+				Waiting:  !as.dialed,
+				Duration: now.Sub(as.started),
+			})
+		}
+		dials = append(dials, ds)
+	}
+	return dials
+}
@@ -0,0 +1,94 @@
+package swarm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInProgressDials(t *testing.T) {
+	delayed := ma.StringCast("/ip4/127.0.0.1/tcp/1")
+	ranker := func(addrs []ma.Multiaddr) []network.AddrDelay {
+		res := make([]network.AddrDelay, 0, len(addrs))
+		for _, a := range addrs {
+			if a.Equal(delayed) {
+				res = append(res, network.AddrDelay{Addr: a, Delay: time.Hour})
+				continue
+			}
+			res = append(res, network.AddrDelay{Addr: a})
+		}
+		return res
+	}
+
+	release := make(chan struct{})
+	gater := swarmt.DefaultMockConnectionGater()
+	gater.Secured = func(dir network.Direction, _ peer.ID, _ network.ConnMultiaddrs) bool {
+		if dir == network.DirOutbound {
+			<-release
+		}
+		return true
+	}
+	s1 := swarmt.GenSwarm(t, swarmt.OptConnGater(gater), swarmt.WithSwarmOpts(swarm.WithDialRanker(ranker)),
+		swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC)
+	s2 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC)
+	defer s1.Close()
+	defer s2.Close()
+	require.Len(t, s2.ListenAddresses(), 1)
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), s2.ListenAddresses(), peerstore.PermanentAddrTTL)
+	s1.Peerstore().AddAddr(s2.LocalPeer(), delayed, peerstore.PermanentAddrTTL)
+
+	require.Empty(t, s1.InProgressDials())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+		done <- err
+	}()
+
+	// wait until the first address is being dialed
+	var dials []swarm.DialState
+	require.Eventually(t, func() bool {
+		dials = s1.InProgressDials()
+		if len(dials) != 1 || len(dials[0].Addrs) != 2 {
+			return false
+		}
+		for _, a := range dials[0].Addrs {
+			if !a.Waiting {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	d := dials[0]
+	require.Equal(t, s2.LocalPeer(), d.Peer)
+	require.Equal(t, 1, d.PendingRequests)
+	require.Positive(t, d.Duration)
+	for _, a := range d.Addrs {
+		if a.Addr.Equal(delayed) {
+			require.True(t, a.Waiting)
+		} else {
+			require.True(t, a.Addr.Equal(s2.ListenAddresses()[0]))
+			require.False(t, a.Waiting)
+		}
+		require.GreaterOrEqual(t, a.Duration, time.Duration(0))
+	}
+
+	close(release)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("dial didn't complete")
+	}
+	require.Eventually(t, func() bool { return len(s1.InProgressDials()) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
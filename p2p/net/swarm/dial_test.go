@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -465,6 +466,36 @@ func TestDialBackoffClears(t *testing.T) {
 	require.False(t, s1.Backoff().Backoff(s2.LocalPeer(), s2bad), "s2 should no longer be on backoff")
 }
 
+func TestPrioritizeReconnect(t *testing.T) {
+	swarms := makeSwarms(t, 2)
+	defer closeSwarms(swarms)
+	s1 := swarms[0]
+	s2 := swarms[1]
+
+	// find a port nothing listens on, so that dialing it fails promptly
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr, err := manet.FromNetAddr(l.Addr())
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	s1.Peerstore().AddAddr(s2.LocalPeer(), addr, peerstore.PermanentAddrTTL)
+	_, err = s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.Error(t, err)
+	require.True(t, s1.Backoff().Backoff(s2.LocalPeer(), addr), "s2 should now be on backoff")
+
+	// s2 comes back on the same address, but s1 keeps backing off
+	require.NoError(t, s2.Listen(addr))
+	_, err = s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.ErrorIs(t, err, swarm.ErrDialBackoff)
+
+	s1.PrioritizeReconnect(s2.LocalPeer())
+	require.False(t, s1.Backoff().Backoff(s2.LocalPeer(), addr), "s2 should no longer be on backoff")
+	c, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	defer c.Close()
+}
+
 func TestDialPeerFailed(t *testing.T) {
 	swarms := makeSwarms(t, 2, swarmt.WithSwarmOpts(swarm.WithDialTimeout(100*time.Millisecond)))
 	defer closeSwarms(swarms)
@@ -634,6 +665,72 @@ func TestDialSimultaneousJoin(t *testing.T) {
 	}
 }
 
+func TestDialPeerSingleFlight(t *testing.T) {
+	var outbound atomic.Int32
+	release := make(chan struct{})
+	gater := swarmt.DefaultMockConnectionGater()
+	gater.Secured = func(dir network.Direction, _ peer.ID, _ network.ConnMultiaddrs) bool {
+		if dir == network.DirOutbound {
+			outbound.Add(1)
+			<-release
+		}
+		return true
+	}
+	s1 := swarmt.GenSwarm(t, swarmt.OptConnGater(gater), swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC)
+	s2 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC)
+	defer s1.Close()
+	defer s2.Close()
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), s2.ListenAddresses(), peerstore.PermanentAddrTTL)
+
+	const dials = 20
+	conns := make(chan network.Conn, dials)
+	errs := make(chan error, dials)
+	for range dials {
+		go func() {
+			c, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+			if err != nil {
+				errs <- err
+				return
+			}
+			conns <- c
+		}()
+	}
+
+	// a caller giving up doesn't cancel the shared dial
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := s1.DialPeer(ctx, s2.LocalPeer())
+		canceled <- err
+	}()
+	require.Eventually(t, func() bool { return outbound.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case err := <-canceled:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("canceled dial didn't return")
+	}
+
+	close(release)
+	var first network.Conn
+	for range dials {
+		select {
+		case c := <-conns:
+			if first == nil {
+				first = c
+			}
+			require.Equal(t, first, c)
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("dial didn't complete")
+		}
+	}
+	require.Equal(t, int32(1), outbound.Load())
+	require.Len(t, s1.ConnsToPeer(s2.LocalPeer()), 1)
+}
+
 func TestDialSelf(t *testing.T) {
 	swarms := makeSwarms(t, 2)
 	defer closeSwarms(swarms)
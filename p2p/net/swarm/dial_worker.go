@@ -85,6 +85,11 @@ type dialWorker struct {
 
 	connected bool // true when a connection has been successfully established
 
+	// stateReqs receives requests for a snapshot of the worker's state, for InProgressDials
+	stateReqs chan chan<- *dialWorkerState
+	// done is closed when the worker loop exits
+	done chan struct{}
+
 	// for testing
 	wg sync.WaitGroup
 	cl Clock
@@ -101,6 +106,8 @@ func newDialWorker(s *Swarm, p peer.ID, reqch <-chan dialRequest, cl Clock) *dia
 		pendingRequests: make(map[*pendRequest]struct{}),
 		trackedDials:    make(map[string]*addrDial),
 		resch:           make(chan tpt.DialUpdate),
+		stateReqs:       make(chan chan<- *dialWorkerState),
+		done:            make(chan struct{}),
 		cl:              cl,
 	}
 }
@@ -110,6 +117,7 @@ func newDialWorker(s *Swarm, p peer.ID, reqch <-chan dialRequest, cl Clock) *dia
 func (w *dialWorker) loop() {
 	w.wg.Add(1)
 	defer w.wg.Done()
+	defer close(w.done)
 	defer w.s.limiter.clearAllPeerDials(w.peer)
 
 	// dq is used to pace dials to different addresses of the peer
@@ -279,6 +287,9 @@ loop:
 			// setup dialTimer for updates to dq
 			scheduleNextDial()
 
+		case ch := <-w.stateReqs:
+			ch <- w.snapshotState(startTime)
+
 		case <-dialTimer.Ch():
 			// It's time to dial the next batch of addresses.
 			// We don't check the delay of the addresses received from the queue here
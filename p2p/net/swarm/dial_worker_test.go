@@ -1194,3 +1194,26 @@ func BenchmarkDialRanker(b *testing.B) {
 		}
 	})
 }
+
+func TestInProgressDialsExitedWorker(t *testing.T) {
+	s1 := makeSwarm(t)
+	defer s1.Close()
+
+	_, p2 := newPeer(t)
+	reqch := make(chan dialRequest)
+	worker := newDialWorker(s1, p2, reqch, nil)
+	// a worker that exited but hasn't been removed yet must not block InProgressDials
+	s1.addDialWorker(worker)
+	defer s1.removeDialWorker(worker)
+	close(reqch)
+	worker.loop()
+
+	done := make(chan []DialState)
+	go func() { done <- s1.InProgressDials() }()
+	select {
+	case dials := <-done:
+		require.Empty(t, dials)
+	case <-time.After(5 * time.Second):
+		t.Fatal("InProgressDials blocked on an exited worker")
+	}
+}
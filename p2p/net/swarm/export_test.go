@@ -0,0 +1,43 @@
+package swarm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ForceSimultaneousOpen makes the next dials of a and b to each other wait
+// until both have been started, so that the peers connect simultaneously.
+// It must be called before either swarm dials.
+func ForceSimultaneousOpen(a, b *Swarm) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	barrier := func(target peer.ID) func(peer.ID, ma.Multiaddr) {
+		var once sync.Once
+		return func(p peer.ID, _ ma.Multiaddr) {
+			if p != target {
+				return
+			}
+			once.Do(func() {
+				wg.Done()
+				wg.Wait()
+			})
+		}
+	}
+	a.dialHook = barrier(b.LocalPeer())
+	b.dialHook = barrier(a.LocalPeer())
+}
+
+// DialAddr dials p at addr and adds the connection to s, even if s is already
+// connected to p.
+func DialAddr(ctx context.Context, s *Swarm, p peer.ID, addr ma.Multiaddr) (network.Conn, error) {
+	tc, err := s.dialAddr(ctx, p, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.addConn(tc, network.DirOutbound)
+}
@@ -213,6 +213,27 @@ func (dl *dialLimiter) clearAllPeerDials(p peer.ID) {
 	// point
 }
 
+// prioritize moves the dials to p waiting for a file descriptor to the front of the queue, keeping
+// their order and the order of all other waiting dials.
+func (dl *dialLimiter) prioritize(p peer.ID) {
+	dl.lk.Lock()
+	defer dl.lk.Unlock()
+
+	var front, back []*dialJob
+	for _, dj := range dl.waitingOnFd {
+		if dj.peer == p {
+			front = append(front, dj)
+		} else {
+			back = append(back, dj)
+		}
+	}
+	if len(front) == 0 {
+		return
+	}
+	log.Debug("[limiter] prioritizing peer dials", "peer", p, "dials", len(front))
+	dl.waitingOnFd = append(front, back...)
+}
+
 // executeDial calls the dialFunc, and reports the result through the response
 // channel when finished. Once the response is sent it also releases all tokens
 // it held during the dial.
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -184,6 +185,45 @@ func TestFDLimiting(t *testing.T) {
 	}
 }
 
+func TestLimiterPrioritize(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	l := newDialLimiterWithParams(hangDialFunc(hang), 1, 5)
+
+	ctx := context.Background()
+	resch := make(chan transport.DialUpdate)
+
+	// take the only fd token, then queue dials to three peers behind it
+	l.AddDialJob(&dialJob{ctx: ctx, peer: "blocker", addr: addrWithPort(1), resp: resch})
+	pids := []peer.ID{"testpeer1", "testpeer2", "testpeer3"}
+	for _, pid := range pids {
+		for _, port := range []int{20, 21} {
+			l.AddDialJob(&dialJob{ctx: ctx, peer: pid, addr: addrWithPort(port), resp: resch})
+		}
+	}
+
+	l.prioritize(pids[2])
+	l.prioritize("unknown")
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	var got []string
+	for _, dj := range l.waitingOnFd {
+		got = append(got, fmt.Sprintf("%s %s", dj.peer, dj.addr))
+	}
+	expected := []string{
+		fmt.Sprintf("%s %s", pids[2], addrWithPort(20)),
+		fmt.Sprintf("%s %s", pids[2], addrWithPort(21)),
+		fmt.Sprintf("%s %s", pids[0], addrWithPort(20)),
+		fmt.Sprintf("%s %s", pids[0], addrWithPort(21)),
+		fmt.Sprintf("%s %s", pids[1], addrWithPort(20)),
+		fmt.Sprintf("%s %s", pids[1], addrWithPort(21)),
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected queue order:\n%s", strings.Join(got, "\n"))
+	}
+}
+
 func TestTokenRedistribution(t *testing.T) {
 	var lk sync.Mutex
 	hangchs := make(map[peer.ID]chan struct{})
@@ -0,0 +1,53 @@
+package swarm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	. "github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStreamPreferredLocalAddr(t *testing.T) {
+	opts := []swarmt.Option{swarmt.OptDialOnly, swarmt.OptDisableQUIC, swarmt.OptDisableWebTransport, swarmt.OptDisableWebRTC}
+	s1 := swarmt.GenSwarm(t, opts...)
+	s2 := swarmt.GenSwarm(t, opts...)
+	s2.SetStreamHandler(func(s network.Stream) { s.Close() })
+
+	if err := s1.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"), ma.StringCast("/ip4/127.0.0.2/tcp/0")); err != nil {
+		t.Skipf("cannot listen on two loopback addresses: %s", err)
+	}
+	require.Len(t, s1.ListenAddresses(), 2)
+
+	// s2 connects to s1 on both of its addresses
+	for _, a := range s1.ListenAddresses() {
+		_, err := DialAddr(context.Background(), s2, s1.LocalPeer(), a)
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool { return len(s1.ConnsToPeer(s2.LocalPeer())) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	for _, local := range []string{"/ip4/127.0.0.1", "/ip4/127.0.0.2"} {
+		t.Run(local, func(t *testing.T) {
+			ctx := network.WithPreferredLocalAddr(context.Background(), ma.StringCast(local))
+			for range 3 {
+				str, err := s1.NewStream(ctx, s2.LocalPeer())
+				require.NoError(t, err)
+				ip, err := str.Conn().LocalMultiaddr().ValueForProtocol(ma.P_IP4)
+				require.NoError(t, err)
+				require.Equal(t, ma.StringCast(local).String(), "/ip4/"+ip)
+				str.Close()
+			}
+		})
+	}
+
+	// a preference no connection satisfies is ignored
+	ctx := network.WithPreferredLocalAddr(context.Background(), ma.StringCast("/ip4/192.0.2.1"))
+	str, err := s1.NewStream(ctx, s2.LocalPeer())
+	require.NoError(t, err)
+	str.Close()
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	. "github.com/libp2p/go-libp2p/p2p/net/swarm"
@@ -14,32 +15,53 @@ import (
 
 	"github.com/libp2p/go-libp2p-testing/ci"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSimultOpen(t *testing.T) {
 	t.Parallel()
 	swarms := makeSwarms(t, 2, swarmt.OptDisableReuseport)
+	ForceSimultaneousOpen(swarms[0], swarms[1])
 
 	// connect everyone
+	conns := make([]network.Conn, len(swarms))
 	{
 		var wg sync.WaitGroup
-		connect := func(s *Swarm, dst peer.ID, addr ma.Multiaddr) {
+		connect := func(i int, s *Swarm, dst peer.ID, addr ma.Multiaddr) {
 			defer wg.Done()
 			// copy for other peer
 			log.Debug("TestSimultOpen: connecting", "local", s.LocalPeer(), "remote", dst, "addr", addr)
 			s.Peerstore().AddAddr(dst, addr, peerstore.PermanentAddrTTL)
-			if _, err := s.DialPeer(context.Background(), dst); err != nil {
+			c, err := s.DialPeer(context.Background(), dst)
+			if err != nil {
 				t.Error("error swarm dialing to peer", err)
+				return
 			}
+			conns[i] = c
 		}
 
 		log.Info("Connecting swarms simultaneously.")
 		wg.Add(2)
-		go connect(swarms[0], swarms[1].LocalPeer(), swarms[1].ListenAddresses()[0])
-		go connect(swarms[1], swarms[0].LocalPeer(), swarms[0].ListenAddresses()[0])
+		go connect(0, swarms[0], swarms[1].LocalPeer(), swarms[1].ListenAddresses()[0])
+		go connect(1, swarms[1], swarms[0].LocalPeer(), swarms[0].ListenAddresses()[0])
 		wg.Wait()
 	}
 
+	// Both dials were in flight at once, so neither could reuse the other's connection.
+	// The swarm keeps both: each side wins its own outbound dial and also holds the
+	// inbound connection from the other side.
+	for i, s := range swarms {
+		require.NotNil(t, conns[i])
+		require.Equal(t, network.DirOutbound, conns[i].Stat().Direction)
+		other := swarms[1-i].LocalPeer()
+		require.Eventually(t, func() bool { return len(s.ConnsToPeer(other)) == 2 }, 5*time.Second, 10*time.Millisecond)
+		var dirs []network.Direction
+		for _, c := range s.ConnsToPeer(other) {
+			dirs = append(dirs, c.Stat().Direction)
+		}
+		require.ElementsMatch(t, []network.Direction{network.DirInbound, network.DirOutbound}, dirs)
+	}
+
 	for _, s := range swarms {
 		s.Close()
 	}
@@ -135,6 +135,17 @@ func WithIPv6BlackHoleSuccessCounter(f *BlackHoleSuccessCounter) Option {
 	}
 }
 
+// WithIPv4BlackHoleSuccessCounter configures swarm to use the provided config for IPv4 black hole
+// detection. IPv4 black hole detection is disabled by default, as broken IPv4 connectivity is rare.
+// n is the size of the sliding window used to evaluate black hole state
+// min is the minimum number of successes out of n required to not block requests
+func WithIPv4BlackHoleSuccessCounter(f *BlackHoleSuccessCounter) Option {
+	return func(s *Swarm) error {
+		s.ipv4BHF = f
+		return nil
+	}
+}
+
 // WithReadOnlyBlackHoleDetector configures the swarm to use the black hole detector in
 // read only mode. In Read Only mode dial requests are refused in unknown state and
 // no updates to the detector state are made. This is useful for services like AutoNAT that
@@ -192,6 +203,19 @@ type Swarm struct {
 		m map[peer.ID][]chan struct{}
 	}
 
+	// dialWorkers are the running dial workers, for InProgressDials
+	dialWorkers struct {
+		sync.Mutex
+		m map[peer.ID]*dialWorker
+	}
+
+	// dialHook, if set, is called before each address dial. It is only set by tests.
+	dialHook func(peer.ID, ma.Multiaddr)
+
+	// maxConns caps the number of open connections if positive. See WithMaxConnections.
+	maxConns     int
+	connEviction EvictionPolicy
+
 	transports struct {
 		sync.RWMutex
 		m map[int]transport.Transport
@@ -212,6 +236,11 @@ type Swarm struct {
 	ctx       context.Context // is canceled when Close is called
 	ctxCancel context.CancelFunc
 
+	// draining is set by CloseGracefully while it waits for open streams to finish.
+	draining atomic.Bool
+	// streamClosed is signaled when a stream is closed while draining.
+	streamClosed chan struct{}
+
 	bwc           metrics.Reporter
 	metricsTracer MetricsTracer
 
@@ -219,6 +248,7 @@ type Swarm struct {
 
 	connectionEventsEmitter *connectionEventsEmitter
 	udpBHF                  *BlackHoleSuccessCounter
+	ipv4BHF                 *BlackHoleSuccessCounter
 	ipv6BHF                 *BlackHoleSuccessCounter
 	bhd                     *blackHoleDetector
 	readOnlyBHD             bool
@@ -241,6 +271,7 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 		dialTimeoutLocal:  defaultDialTimeoutLocal,
 		multiaddrResolver: ResolverFromMaDNS{madns.DefaultResolver},
 		dialRanker:        DefaultDialRanker,
+		streamClosed:      make(chan struct{}, 1),
 
 		// A black hole is a binary property. On a network if UDP dials are blocked or there is
 		// no IPv6 connectivity, all dials will fail. So a low success rate of 5 out 100 dials
@@ -254,6 +285,7 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 	s.transports.m = make(map[int]transport.Transport)
 	s.notifs.m = make(map[network.Notifiee]struct{})
 	s.directConnNotifs.m = make(map[peer.ID][]chan struct{})
+	s.dialWorkers.m = make(map[peer.ID]*dialWorker)
 	s.connectionEventsEmitter = newConnectionEventsEmitter(
 		s.Connectedness, emitter,
 		func(c *Conn) { s.notifyAll(func(f network.Notifiee) { f.Connected(s, c) }) },
@@ -276,6 +308,7 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 
 	s.bhd = &blackHoleDetector{
 		udp:      s.udpBHF,
+		ipv4:     s.ipv4BHF,
 		ipv6:     s.ipv6BHF,
 		mt:       s.metricsTracer,
 		readOnly: s.readOnlyBHD,
@@ -283,11 +316,89 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 	return s, nil
 }
 
+// BlackHoleStates returns the state of the swarm's black hole detection for each address family
+// or transport it is enabled for.
+func (s *Swarm) BlackHoleStates() []BlackHoleInfo {
+	return s.bhd.Info()
+}
+
 func (s *Swarm) Close() error {
 	s.closeOnce.Do(s.close)
 	return nil
 }
 
+// CloseGracefully closes the swarm after letting open streams finish.
+//
+// It first closes all listeners and stops accepting new connections, both inbound and outbound,
+// so that no new connections arrive while draining. Existing connections are kept open, and
+// streams can still be opened on them, until all streams have been closed or ctx is done. The
+// swarm is then closed as with Close. If ctx is done before all streams have finished, the
+// remaining streams are reset and ctx's error is returned.
+//
+// A call made while another is draining the swarm waits for that drain to finish, bounded by its
+// own ctx.
+func (s *Swarm) CloseGracefully(ctx context.Context) error {
+	if s.draining.Swap(true) {
+		// already draining, or closed
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		}
+	}
+
+	s.listeners.Lock()
+	listeners := s.listeners.m
+	if listeners == nil {
+		// already closed
+		s.listeners.Unlock()
+		return nil
+	}
+	s.listeners.m = make(map[transport.Listener]struct{})
+	s.listeners.cacheEOL = time.Time{}
+	s.listeners.Unlock()
+	// Closing a listener makes its accept loop exit, which fires the ListenClose notifications.
+	for l := range listeners {
+		if err := l.Close(); err != nil && err != transport.ErrListenerClosed {
+			log.Error("error when shutting down listener", "err", err)
+		}
+	}
+
+	var err error
+	for s.numStreams() > 0 && err == nil {
+		select {
+		case <-s.streamClosed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-s.ctx.Done():
+			err = ErrSwarmClosed
+		}
+	}
+	if err == ErrSwarmClosed {
+		// closed concurrently
+		return nil
+	}
+	s.Close()
+	return err
+}
+
+// numStreams returns the number of open streams across all connections.
+func (s *Swarm) numStreams() int {
+	s.conns.RLock()
+	defer s.conns.RUnlock()
+	n := 0
+	for _, cs := range s.conns.m {
+		for _, c := range cs {
+			c.streams.Lock()
+			n += len(c.streams.m)
+			c.streams.Unlock()
+		}
+	}
+	return n
+}
+
 // Done returns a channel that is closed when the swarm is closed.
 func (s *Swarm) Done() <-chan struct{} {
 	return s.ctx.Done()
@@ -415,6 +526,21 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 		tc.Close()
 		return nil, ErrSwarmClosed
 	}
+	// Don't accept new connections while draining
+	if s.draining.Load() {
+		s.conns.Unlock()
+		tc.Close()
+		return nil, ErrSwarmClosed
+	}
+
+	evicted, err := s.makeRoomLocked()
+	if err != nil {
+		s.conns.Unlock()
+		if err := tc.CloseWithError(network.ConnResourceLimitExceeded); err != nil {
+			log.Warn("failed to close connection with peer and addr", "peer", p, "addr", addr, "err", err)
+		}
+		return nil, err
+	}
 
 	c.streams.m = make(map[*Stream]struct{})
 	s.conns.m[p] = append(s.conns.m[p], c)
@@ -424,6 +550,11 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 	s.refs.Add(2)
 	s.conns.Unlock()
 
+	if evicted != nil {
+		log.Debug("evicted connection to make room for new connection", "peer", evicted.RemotePeer(), "new_peer", p)
+		evicted.CloseWithError(network.ConnResourceLimitExceeded)
+	}
+
 	if !isLimited {
 		// Notify goroutines waiting for a direct connection
 		// do this before connected events, as there's no reason to stall this
@@ -487,9 +618,10 @@ func (s *Swarm) NewStream(ctx context.Context, p peer.ID) (network.Stream, error
 	//
 	// TODO: Try all connections even if we get an error opening a stream on
 	// a non-closed connection.
+	local, _ := network.GetPreferredLocalAddr(ctx)
 	numDials := 0
 	for {
-		c := s.bestConnToPeer(p)
+		c := s.bestConnToPeerFrom(p, local)
 		if c == nil {
 			if nodial, _ := network.GetNoDial(ctx); !nodial {
 				numDials++
@@ -592,7 +724,7 @@ func (s *Swarm) ConnsToPeer(p peer.ID) []network.Conn {
 	return output
 }
 
-func isBetterConn(a, b *Conn) bool {
+func isBetterConn(a, b *Conn, local ma.Multiaddr) bool {
 	// If one is limited and not the other, prefer the unlimited connection.
 	aLimited := a.Stat().Limited
 	bLimited := b.Stat().Limited
@@ -607,6 +739,15 @@ func isBetterConn(a, b *Conn) bool {
 		return aDirect
 	}
 
+	// If a local address is preferred, prefer the connection on it.
+	if local != nil {
+		aLocal := hasLocalAddr(a, local)
+		bLocal := hasLocalAddr(b, local)
+		if aLocal != bLocal {
+			return aLocal
+		}
+	}
+
 	// Otherwise, prefer the connection with more open streams.
 	a.streams.Lock()
 	aLen := len(a.streams.m)
@@ -624,8 +765,20 @@ func isBetterConn(a, b *Conn) bool {
 	return true
 }
 
+// hasLocalAddr returns true if the local address of c is, or starts with, local.
+func hasLocalAddr(c *Conn, local ma.Multiaddr) bool {
+	laddr := c.LocalMultiaddr()
+	return len(laddr) >= len(local) && laddr[:len(local)].Equal(local)
+}
+
 // bestConnToPeer returns the best connection to peer.
 func (s *Swarm) bestConnToPeer(p peer.ID) *Conn {
+	return s.bestConnToPeerFrom(p, nil)
+}
+
+// bestConnToPeerFrom returns the best connection to peer, preferring connections on the local
+// address local if it is not nil.
+func (s *Swarm) bestConnToPeerFrom(p peer.ID, local ma.Multiaddr) *Conn {
 	// TODO: Prefer some transports over others.
 	// For now, prefers direct connections over Relayed connections.
 	// For tie-breaking, select the newest non-closed connection with the most streams.
@@ -638,7 +791,7 @@ func (s *Swarm) bestConnToPeer(p peer.ID) *Conn {
 			// We *will* garbage collect this soon anyways.
 			continue
 		}
-		if best == nil || isBetterConn(c, best) {
+		if best == nil || isBetterConn(c, best, local) {
 			best = c
 		}
 	}
@@ -783,12 +936,18 @@ func (s *Swarm) StopNotify(f network.Notifiee) {
 }
 
 func (s *Swarm) removeConn(c *Conn) {
-	p := c.RemotePeer()
-
 	s.conns.Lock()
 	defer s.conns.Unlock()
 
+	s.removeConnLocked(c)
+}
+
+// removeConnLocked removes c from the swarm and reports whether it was found.
+// s.conns must be locked.
+func (s *Swarm) removeConnLocked(c *Conn) bool {
+	p := c.RemotePeer()
 	cs := s.conns.m[p]
+	found := false
 	for i, ci := range cs {
 		if ci == c {
 			// NOTE: We're intentionally preserving order.
@@ -797,12 +956,14 @@ func (s *Swarm) removeConn(c *Conn) {
 			copy(cs[i:], cs[i+1:])
 			cs[len(cs)-1] = nil
 			s.conns.m[p] = cs[:len(cs)-1]
+			found = true
 			break
 		}
 	}
 	if len(s.conns.m[p]) == 0 {
 		delete(s.conns.m, p)
 	}
+	return found
 }
 
 // String returns a string representation of Network.
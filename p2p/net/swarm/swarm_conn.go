@@ -33,6 +33,8 @@ type Conn struct {
 	streams struct {
 		sync.Mutex
 		m map[*Stream]struct{}
+		// lastActivity is the last time a stream was opened or closed; it is zero until then.
+		lastActivity time.Time
 	}
 
 	stat network.ConnStats
@@ -114,8 +116,16 @@ func (c *Conn) removeStream(s *Stream) {
 	c.streams.Lock()
 	c.stat.NumStreams--
 	delete(c.streams.m, s)
+	c.streams.lastActivity = time.Now()
 	c.streams.Unlock()
 	s.scope.Done()
+
+	if c.swarm.draining.Load() {
+		select {
+		case c.swarm.streamClosed <- struct{}{}:
+		default:
+		}
+	}
 }
 
 // listens for new streams.
@@ -256,19 +266,21 @@ func (c *Conn) addStream(ts network.MuxedStream, dir network.Direction, scope ne
 	}
 
 	// Wrap and register the stream.
+	now := time.Now()
 	s := &Stream{
 		stream: ts,
 		conn:   c,
 		scope:  scope,
 		stat: network.Stats{
 			Direction: dir,
-			Opened:    time.Now(),
+			Opened:    now,
 		},
 		id:                             c.swarm.nextStreamID.Add(1),
 		acceptStreamGoroutineCompleted: dir != network.DirInbound,
 	}
 	c.stat.NumStreams++
 	c.streams.m[s] = struct{}{}
+	c.streams.lastActivity = now
 
 	// Released once the stream disconnect notifications have finished
 	// firing (in Swarm.remove).
@@ -278,6 +290,14 @@ func (c *Conn) addStream(ts network.MuxedStream, dir network.Direction, scope ne
 	return s, nil
 }
 
+// lastStreamActivity returns the last time a stream was opened or closed on the
+// connection, or the zero time if it never carried a stream.
+func (c *Conn) lastStreamActivity() time.Time {
+	c.streams.Lock()
+	defer c.streams.Unlock()
+	return c.streams.lastActivity
+}
+
 // GetStreams returns the streams associated with this connection.
 func (c *Conn) GetStreams() []network.Stream {
 	c.streams.Lock()
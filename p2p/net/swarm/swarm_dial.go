@@ -192,6 +192,19 @@ func (db *DialBackoff) Clear(p peer.ID) {
 	delete(db.entries, p)
 }
 
+// expire ends the current backoff of all of p's addresses, without resetting the number of
+// prior backoffs, so the next failure backs off as long as it would have anyway.
+func (db *DialBackoff) expire(p peer.ID) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	now := time.Now()
+	for _, ba := range db.entries[p] {
+		if ba.until.After(now) {
+			ba.until = now
+		}
+	}
+}
+
 func (db *DialBackoff) cleanup() {
 	db.lock.Lock()
 	defer db.lock.Unlock()
@@ -211,6 +224,15 @@ func (db *DialBackoff) cleanup() {
 	}
 }
 
+// PrioritizeReconnect hints the swarm that p should be reconnected to as soon as possible, e.g.
+// after a transient disconnect from a critical peer. It ends the dial backoff of p's addresses
+// once, and moves dials to p that are waiting for a file descriptor to the front of the queue.
+// It doesn't dial p by itself; the caller is expected to follow up with DialPeer or NewStream.
+func (s *Swarm) PrioritizeReconnect(p peer.ID) {
+	s.backf.expire(p)
+	s.limiter.prioritize(p)
+}
+
 // DialPeer connects to a peer. Use network.WithForceDirectDial to force a
 // direct connection.
 //
@@ -218,6 +240,10 @@ func (db *DialBackoff) cleanup() {
 // the connection will happen over. Swarm can use whichever it choses.
 // This allows us to use various transport protocols, do NAT traversal/relay,
 // etc. to achieve connection.
+//
+// Concurrent calls for the same peer share a single dial: all callers receive
+// the resulting connection or error. Canceling the context of one caller only
+// abandons the dial once no other caller is waiting for it.
 func (s *Swarm) DialPeer(ctx context.Context, p peer.ID) (network.Conn, error) {
 	// Avoid typed nil issues.
 	c, err := s.dialPeer(ctx, p)
@@ -248,6 +274,11 @@ func (s *Swarm) dialPeer(ctx context.Context, p peer.ID) (*Conn, error) {
 		return conn, nil
 	}
 
+	// don't dial new connections while draining
+	if s.draining.Load() {
+		return nil, &DialError{Peer: p, Cause: ErrSwarmClosed}
+	}
+
 	if s.gater != nil && !s.gater.InterceptPeerDial(p) {
 		log.Debug("gater disallowed outbound connection to peer", "peer", p)
 		return nil, &DialError{Peer: p, Cause: ErrGaterDisallowedConnection}
@@ -287,6 +318,8 @@ func (s *Swarm) dialPeer(ctx context.Context, p peer.ID) (*Conn, error) {
 // dialWorkerLoop synchronizes and executes concurrent dials to a single peer
 func (s *Swarm) dialWorkerLoop(p peer.ID, reqch <-chan dialRequest) {
 	w := newDialWorker(s, p, reqch, nil)
+	s.addDialWorker(w)
+	defer s.removeDialWorker(w)
 	w.loop()
 }
 
@@ -460,6 +493,10 @@ func (s *Swarm) dialNextAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr,
 		}
 	}
 
+	if s.dialHook != nil {
+		s.dialHook(p, addr)
+	}
+
 	// start the dial
 	s.limitedDial(ctx, p, addr, resch)
 
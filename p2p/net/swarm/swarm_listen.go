@@ -119,7 +119,7 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 	}
 
 	s.listeners.Lock()
-	if s.listeners.m == nil {
+	if s.listeners.m == nil || s.draining.Load() {
 		s.listeners.Unlock()
 		list.Close()
 		return ErrSwarmClosed
@@ -79,7 +79,7 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 	}
 
 	bhfNames := []string{"udp", "ipv6", "tcp", "icmp"}
-	bhfState := []BlackHoleState{blackHoleStateAllowed, blackHoleStateBlocked}
+	bhfState := []BlackHoleState{BlackHoleStateAllowed, BlackHoleStateBlocked}
 
 	tests := map[string]func(){
 		"OpenedConnection": func() {
@@ -626,3 +626,15 @@ func TestAddCertHashes(t *testing.T) {
 		}
 	}
 }
+
+func TestSwarmBlackHoleStates(t *testing.T) {
+	s := makeSwarms(t, 1, WithSwarmOpts(
+		swarm.WithIPv4BlackHoleSuccessCounter(&swarm.BlackHoleSuccessCounter{N: 10, MinSuccesses: 5, Name: "IPv4"}),
+	))[0]
+	var names []string
+	for _, info := range s.BlackHoleStates() {
+		names = append(names, info.Name)
+		require.Equal(t, swarm.BlackHoleStateProbing, info.State)
+	}
+	require.ElementsMatch(t, []string{"UDP", "IPv4", "IPv6"}, names)
+}
@@ -18,10 +18,13 @@ var HopTagWeight = 5
 
 type statLimitDuration struct{}
 type statLimitData struct{}
+type statTraceID struct{}
 
 var (
 	StatLimitDuration = statLimitDuration{}
 	StatLimitData     = statLimitData{}
+	// StatTraceID is the key of the circuit trace ID in the connection stats, if one is known.
+	StatTraceID = statTraceID{}
 )
 
 type Conn struct {
@@ -8,6 +8,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
@@ -129,10 +130,12 @@ func (c *Client) dialPeer(ctx context.Context, relay, dest peer.AddrInfo) (*Conn
 	if err != nil {
 		return nil, fmt.Errorf("error opening hop stream to relay: %w", err)
 	}
-	return c.connect(s, dest)
+	traceID, _ := util.TraceIDFromContext(ctx)
+	pid, _ := util.ProtocolFromContext(ctx)
+	return c.connect(s, dest, traceID, pid)
 }
 
-func (c *Client) connect(s network.Stream, dest peer.AddrInfo) (*Conn, error) {
+func (c *Client) connect(s network.Stream, dest peer.AddrInfo, traceID string, pid protocol.ID) (*Conn, error) {
 	if err := s.Scope().ReserveMemory(maxMessageSize, network.ReservationPriorityAlways); err != nil {
 		s.Reset()
 		return nil, err
@@ -147,6 +150,13 @@ func (c *Client) connect(s network.Stream, dest peer.AddrInfo) (*Conn, error) {
 
 	msg.Type = pbv2.HopMessage_CONNECT.Enum()
 	msg.Peer = util.PeerInfoToPeerV2(dest)
+	if traceID != "" {
+		msg.TraceID = &traceID
+	}
+	if pid != "" {
+		p := string(pid)
+		msg.Protocol = &p
+	}
 
 	s.SetDeadline(time.Now().Add(DialTimeout))
 
@@ -186,6 +196,12 @@ func (c *Client) connect(s network.Stream, dest peer.AddrInfo) (*Conn, error) {
 		stat.Extra[StatLimitDuration] = time.Duration(limit.GetDuration()) * time.Second
 		stat.Extra[StatLimitData] = limit.GetData()
 	}
+	if traceID != "" {
+		if stat.Extra == nil {
+			stat.Extra = make(map[any]any)
+		}
+		stat.Extra[StatTraceID] = traceID
+	}
 
 	return &Conn{stream: s, remote: dest, stat: stat, client: c}, nil
 }
@@ -54,6 +54,17 @@ func (c *Client) handleStreamV2(s network.Stream) {
 	// reset stream deadline as message has been read
 	s.SetReadDeadline(time.Time{})
 
+	if msg.GetType() == pbv2.StopMessage_PROBE {
+		// the relay is checking whether we are reachable; answer without accepting a connection
+		if err := writeResponse(pbv2.Status_OK); err != nil {
+			log.Debug("error writing probe response", "err", err)
+			s.Reset()
+			return
+		}
+		s.Close()
+		return
+	}
+
 	if msg.GetType() != pbv2.StopMessage_CONNECT {
 		handleError(pbv2.Status_UNEXPECTED_MESSAGE)
 		return
@@ -74,8 +85,14 @@ func (c *Client) handleStreamV2(s network.Stream) {
 		stat.Extra[StatLimitDuration] = time.Duration(limit.GetDuration()) * time.Second
 		stat.Extra[StatLimitData] = limit.GetData()
 	}
+	if traceID := msg.GetTraceID(); traceID != "" {
+		if stat.Extra == nil {
+			stat.Extra = make(map[any]any)
+		}
+		stat.Extra[StatTraceID] = traceID
+	}
 
-	log.Debug("incoming relay connection", "source_peer", src.ID)
+	log.Debug("incoming relay connection", "source_peer", src.ID, "trace_id", msg.GetTraceID())
 
 	select {
 	case c.incoming <- accept{
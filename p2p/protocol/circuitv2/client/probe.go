@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+var ProbeTimeout = time.Minute
+
+// ProbeCircuit asks a relay whether it can reach dest, without establishing a circuit.
+// It returns nil if the relay performed a handshake with dest.
+// Relays that don't support probing or have probing disabled refuse the request.
+func ProbeCircuit(ctx context.Context, h host.Host, ai peer.AddrInfo, dest peer.ID) error {
+	if len(ai.Addrs) > 0 {
+		h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.TempAddrTTL)
+	}
+
+	s, err := h.NewStream(ctx, ai.ID, proto.ProtoIDv2Hop)
+	if err != nil {
+		return fmt.Errorf("error opening hop stream to relay: %w", err)
+	}
+	defer s.Close()
+
+	rd := util.NewDelimitedReader(s, maxMessageSize)
+	wr := util.NewDelimitedWriter(s)
+	defer rd.Close()
+
+	var msg pbv2.HopMessage
+	msg.Type = pbv2.HopMessage_PROBE.Enum()
+	msg.Peer = util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest})
+
+	s.SetDeadline(time.Now().Add(ProbeTimeout))
+
+	if err := wr.WriteMsg(&msg); err != nil {
+		s.Reset()
+		return fmt.Errorf("error writing probe message: %w", err)
+	}
+
+	msg.Reset()
+
+	if err := rd.ReadMsg(&msg); err != nil {
+		s.Reset()
+		return fmt.Errorf("error reading probe response: %w", err)
+	}
+
+	if msg.GetType() != pbv2.HopMessage_STATUS {
+		return newRelayError("unexpected relay response; not a status message (%d)", msg.GetType())
+	}
+	if status := msg.GetStatus(); status != pbv2.Status_OK {
+		return newRelayError("probe failed: %s (%d)", pbv2.Status_name[int32(status)], status)
+	}
+	return nil
+}
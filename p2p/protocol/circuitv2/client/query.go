@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+var QueryTimeout = time.Minute
+
+// RelayInfo describes the current limits of a relay.
+type RelayInfo struct {
+	// ReservationTTL is the duration of the reservations granted by the relay.
+	ReservationTTL time.Duration
+	// ReservationCapacity is the number of additional reservations the relay currently accepts.
+	ReservationCapacity int
+	// MaxCircuits is the maximum number of concurrent relayed connections per peer.
+	MaxCircuits int
+
+	// LimitDuration is the time limit for which the relay keeps a relayed connection open.
+	// If 0, there is no limit.
+	LimitDuration time.Duration
+	// LimitData is the number of bytes that the relay relays in each direction before
+	// resetting a relayed connection. If 0, there is no limit.
+	LimitData uint64
+}
+
+// Query asks a relay for its current limits, without reserving a slot.
+// Relays that don't support querying refuse the request.
+func Query(ctx context.Context, h host.Host, ai peer.AddrInfo) (*RelayInfo, error) {
+	if len(ai.Addrs) > 0 {
+		h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.TempAddrTTL)
+	}
+
+	s, err := h.NewStream(ctx, ai.ID, proto.ProtoIDv2Hop)
+	if err != nil {
+		return nil, fmt.Errorf("error opening hop stream to relay: %w", err)
+	}
+	defer s.Close()
+
+	rd := util.NewDelimitedReader(s, maxMessageSize)
+	wr := util.NewDelimitedWriter(s)
+	defer rd.Close()
+
+	var msg pbv2.HopMessage
+	msg.Type = pbv2.HopMessage_QUERY.Enum()
+
+	s.SetDeadline(time.Now().Add(QueryTimeout))
+
+	if err := wr.WriteMsg(&msg); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("error writing query message: %w", err)
+	}
+
+	msg.Reset()
+
+	if err := rd.ReadMsg(&msg); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("error reading query response: %w", err)
+	}
+
+	if msg.GetType() != pbv2.HopMessage_STATUS {
+		return nil, newRelayError("unexpected relay response; not a status message (%d)", msg.GetType())
+	}
+	if status := msg.GetStatus(); status != pbv2.Status_OK {
+		return nil, newRelayError("query failed: %s (%d)", pbv2.Status_name[int32(status)], status)
+	}
+	info := msg.GetInfo()
+	if info == nil {
+		return nil, newRelayError("missing relay info")
+	}
+
+	return &RelayInfo{
+		ReservationTTL:      time.Duration(info.GetReservationTTL()) * time.Second,
+		ReservationCapacity: int(info.GetReservationCapacity()),
+		MaxCircuits:         int(info.GetMaxCircuits()),
+		LimitDuration:       time.Duration(msg.GetLimit().GetDuration()) * time.Second,
+		LimitData:           msg.GetLimit().GetData(),
+	}, nil
+}
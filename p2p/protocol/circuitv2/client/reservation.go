@@ -22,6 +22,9 @@ var ReserveTimeout = time.Minute
 type Reservation struct {
 	// Expiration is the expiration time of the reservation
 	Expiration time.Time
+	// RenewAfter is the time after which the relay suggests renewing the reservation.
+	// It is zero if the relay didn't provide a hint.
+	RenewAfter time.Time
 	// Addrs contains the vouched public addresses of the reserving peer, which can be
 	// announced to the network
 	Addrs []ma.Multiaddr
@@ -35,6 +38,32 @@ type Reservation struct {
 
 	// Voucher is a signed reservation voucher provided by the relay
 	Voucher *proto.ReservationVoucher
+
+	// Capabilities are the optional protocol features advertised by the relay.
+	Capabilities proto.Capabilities
+
+	// Quality is the relay's hint about its current load. It is nil if the relay didn't
+	// provide one.
+	Quality *ReservationQuality
+
+	// BackupRelays are other relays advertised by the relay, which can be used to fail over
+	// without discovering relays anew.
+	BackupRelays []peer.AddrInfo
+
+	// HandoffToken is an opaque token issued by relays supporting handoff tokens, which can be
+	// presented with WithHandoffToken to restore the reservation if the relay restarts before
+	// it expires. It is nil if the relay didn't issue one.
+	HandoffToken []byte
+}
+
+// ReservationQuality is a hint about the current load of a relay, which clients can use to
+// balance their reservations over several relays.
+type ReservationQuality struct {
+	// CircuitUtilization is the percentage of the relay's circuit capacity in use.
+	CircuitUtilization int
+	// HandshakeLatency is the median latency of the relay's recent stop handshakes. It is 0 if
+	// the relay has no recent handshakes.
+	HandshakeLatency time.Duration
 }
 
 // ReservationError is the error returned on failure to reserve a slot in the relay
@@ -58,9 +87,77 @@ func (re ReservationError) Unwrap() error {
 	return re.err
 }
 
+// ReserveOption is an option for Reserve.
+type ReserveOption func(*reserveConfig)
+
+type reserveConfig struct {
+	ttl              time.Duration
+	caps             proto.Capabilities
+	signedPeerRecord *record.Envelope
+	handoffToken     []byte
+	psk              []byte
+}
+
+// WithReservationTTL requests a reservation lasting for ttl, which is rounded down to whole
+// seconds. Relays may grant a different duration; relays that don't support requesting a duration
+// ignore it. The granted duration is reflected in the reservation's Expiration.
+func WithReservationTTL(ttl time.Duration) ReserveOption {
+	return func(cfg *reserveConfig) {
+		cfg.ttl = ttl
+	}
+}
+
+// WithCapabilities overrides the capabilities advertised to the relay, which default to
+// proto.SupportedCapabilities.
+func WithCapabilities(caps proto.Capabilities) ReserveOption {
+	return func(cfg *reserveConfig) {
+		cfg.caps = caps
+	}
+}
+
+// WithSignedPeerRecord sends the client's signed peer record to the relay, which verifies it and
+// hands the certified addresses to peers connecting to the client through it. Relays that don't
+// support it ignore it.
+func WithSignedPeerRecord(env *record.Envelope) ReserveOption {
+	return func(cfg *reserveConfig) {
+		cfg.signedPeerRecord = env
+	}
+}
+
+// WithHandoffToken presents the handoff token of a previous reservation with the relay, so that
+// the relay restores the reservation if it has restarted since. Relays that don't support it, or
+// that don't accept the token, treat the request as a regular reservation.
+func WithHandoffToken(token []byte) ReserveOption {
+	return func(cfg *reserveConfig) {
+		cfg.handoffToken = token
+	}
+}
+
+// WithPSK answers the pre-shared key challenge of relays gating reservations with a pre-shared
+// key. Without it, reservations with such relays fail with Status_PERMISSION_DENIED.
+func WithPSK(psk []byte) ReserveOption {
+	return func(cfg *reserveConfig) {
+		cfg.psk = psk
+	}
+}
+
 // Reserve reserves a slot in a relay and returns the reservation information.
 // Clients must reserve slots in order for the relay to relay connections to them.
-func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation, error) {
+func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo, opts ...ReserveOption) (*Reservation, error) {
+	cfg := reserveConfig{caps: proto.SupportedCapabilities}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var signedPeerRecord []byte
+	if cfg.signedPeerRecord != nil {
+		b, err := cfg.signedPeerRecord.Marshal()
+		if err != nil {
+			return nil, ReservationError{Status: pbv2.Status_MALFORMED_MESSAGE, Reason: "error marshalling signed peer record", err: err}
+		}
+		signedPeerRecord = b
+	}
+
 	if len(ai.Addrs) > 0 {
 		h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.TempAddrTTL)
 	}
@@ -77,6 +174,18 @@ func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation,
 
 	var msg pbv2.HopMessage
 	msg.Type = pbv2.HopMessage_RESERVE.Enum()
+	if cfg.ttl > 0 {
+		ttl := uint32(cfg.ttl / time.Second)
+		msg.Ttl = &ttl
+	}
+	if cfg.psk != nil {
+		// the relay only challenges clients that can answer
+		cfg.caps |= proto.CapabilityPSK
+	}
+	caps := uint64(cfg.caps)
+	msg.Capabilities = &caps
+	msg.SignedPeerRecord = signedPeerRecord
+	msg.HandoffToken = cfg.handoffToken
 
 	s.SetDeadline(time.Now().Add(ReserveTimeout))
 
@@ -92,6 +201,28 @@ func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation,
 		return nil, ReservationError{Status: pbv2.Status_CONNECTION_FAILED, Reason: "error reading reservation response message: %w", err: err}
 	}
 
+	if msg.GetType() == pbv2.HopMessage_CHALLENGE {
+		if cfg.psk == nil {
+			s.Reset()
+			return nil, ReservationError{Status: pbv2.Status_PERMISSION_DENIED, Reason: "relay requires a pre-shared key"}
+		}
+		challenge := msg.GetPskChallenge()
+		msg.Reset()
+		msg.Type = pbv2.HopMessage_RESERVE.Enum()
+		msg.PskResponse = proto.PSKResponse(cfg.psk, challenge, ai.ID, h.ID())
+		if err := wr.WriteMsg(&msg); err != nil {
+			s.Reset()
+			return nil, ReservationError{Status: pbv2.Status_CONNECTION_FAILED, Reason: "error writing pre-shared key response", err: err}
+		}
+
+		msg.Reset()
+
+		if err := rd.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return nil, ReservationError{Status: pbv2.Status_CONNECTION_FAILED, Reason: "error reading reservation response message", err: err}
+		}
+	}
+
 	if msg.GetType() != pbv2.HopMessage_STATUS {
 		return nil, ReservationError{Status: pbv2.Status_MALFORMED_MESSAGE, Reason: fmt.Sprintf("unexpected relay response: not a status message (%d)", msg.GetType())}
 	}
@@ -105,7 +236,7 @@ func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation,
 		return nil, ReservationError{Status: pbv2.Status_MALFORMED_MESSAGE, Reason: "missing reservation info"}
 	}
 
-	result := &Reservation{}
+	result := &Reservation{Capabilities: proto.Capabilities(msg.GetCapabilities())}
 	result.Expiration = time.Unix(int64(rsvp.GetExpire()), 0)
 	if result.Expiration.Before(time.Now()) {
 		return nil, ReservationError{
@@ -113,6 +244,21 @@ func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation,
 			Reason: fmt.Sprintf("received reservation with expiration date in the past: %s", result.Expiration),
 		}
 	}
+	if rsvp.RenewAfter != nil {
+		renewAfter := time.Unix(int64(rsvp.GetRenewAfter()), 0)
+		if renewAfter.After(result.Expiration) {
+			log.Warn("ignoring reservation renew hint after expiration", "renew_after", renewAfter, "expiration", result.Expiration)
+		} else {
+			result.RenewAfter = renewAfter
+		}
+	}
+
+	if q := rsvp.GetQuality(); q != nil {
+		result.Quality = &ReservationQuality{
+			CircuitUtilization: int(min(q.GetCircuitUtilization(), 100)),
+			HandshakeLatency:   time.Duration(q.GetHandshakeLatency()) * time.Millisecond,
+		}
+	}
 
 	addrs := rsvp.GetAddrs()
 	result.Addrs = make([]ma.Multiaddr, 0, len(addrs))
@@ -125,6 +271,17 @@ func Reserve(ctx context.Context, h host.Host, ai peer.AddrInfo) (*Reservation,
 		result.Addrs = append(result.Addrs, a)
 	}
 
+	for _, b := range rsvp.GetBackupRelays() {
+		pi, err := util.PeerToPeerInfoV2(b)
+		if err != nil {
+			log.Warn("ignoring invalid backup relay", "err", err)
+			continue
+		}
+		result.BackupRelays = append(result.BackupRelays, pi)
+	}
+
+	result.HandoffToken = rsvp.GetHandoffToken()
+
 	voucherBytes := rsvp.GetVoucher()
 	if voucherBytes != nil {
 		env, rec, err := record.ConsumeEnvelope(voucherBytes, proto.RecordDomain)
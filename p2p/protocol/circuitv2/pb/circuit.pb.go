@@ -95,6 +95,22 @@ const (
 	HopMessage_RESERVE HopMessage_Type = 0
 	HopMessage_CONNECT HopMessage_Type = 1
 	HopMessage_STATUS  HopMessage_Type = 2
+	// RESERVE_CONNECT reserves a slot for the sender and connects it to the given peer in a
+	// single exchange. Relays that don't support it refuse it as a malformed message.
+	HopMessage_RESERVE_CONNECT HopMessage_Type = 3
+	// QUERY requests the relay's current limits without reserving a slot.
+	// Relays that don't support it refuse it as a malformed message.
+	HopMessage_QUERY HopMessage_Type = 4
+	// PROBE asks the relay whether it can reach the given peer, without establishing a
+	// connection. The relay sends a PROBE StopMessage to the peer and responds OK if the peer
+	// answered. Relays that don't support it refuse it as a malformed message.
+	HopMessage_PROBE HopMessage_Type = 5
+	// CHALLENGE is sent by relays requiring a pre-shared key in response to a RESERVE or
+	// RESERVE_CONNECT message, carrying a random pskChallenge. The client answers with a RESERVE
+	// message carrying the pskResponse, after which the relay handles the original request.
+	// It is only sent to clients advertising the PSK capability; others are refused with
+	// PERMISSION_DENIED.
+	HopMessage_CHALLENGE HopMessage_Type = 6
 )
 
 // Enum value maps for HopMessage_Type.
@@ -103,11 +119,19 @@ var (
 		0: "RESERVE",
 		1: "CONNECT",
 		2: "STATUS",
+		3: "RESERVE_CONNECT",
+		4: "QUERY",
+		5: "PROBE",
+		6: "CHALLENGE",
 	}
 	HopMessage_Type_value = map[string]int32{
-		"RESERVE": 0,
-		"CONNECT": 1,
-		"STATUS":  2,
+		"RESERVE":         0,
+		"CONNECT":         1,
+		"STATUS":          2,
+		"RESERVE_CONNECT": 3,
+		"QUERY":           4,
+		"PROBE":           5,
+		"CHALLENGE":       6,
 	}
 )
 
@@ -143,6 +167,9 @@ type StopMessage_Type int32
 const (
 	StopMessage_CONNECT StopMessage_Type = 0
 	StopMessage_STATUS  StopMessage_Type = 1
+	// PROBE checks whether the peer is reachable through the relay, without establishing a
+	// connection. The peer responds with a STATUS message and closes the stream.
+	StopMessage_PROBE StopMessage_Type = 2
 )
 
 // Enum value maps for StopMessage_Type.
@@ -150,10 +177,12 @@ var (
 	StopMessage_Type_name = map[int32]string{
 		0: "CONNECT",
 		1: "STATUS",
+		2: "PROBE",
 	}
 	StopMessage_Type_value = map[string]int32{
 		"CONNECT": 0,
 		"STATUS":  1,
+		"PROBE":   2,
 	}
 )
 
@@ -188,11 +217,44 @@ type HopMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// This field is marked optional for backwards compatibility with proto2.
 	// Users should make sure to always set this.
-	Type          *HopMessage_Type `protobuf:"varint,1,opt,name=type,proto3,enum=circuit.pb.HopMessage_Type,oneof" json:"type,omitempty"`
-	Peer          *Peer            `protobuf:"bytes,2,opt,name=peer,proto3,oneof" json:"peer,omitempty"`
-	Reservation   *Reservation     `protobuf:"bytes,3,opt,name=reservation,proto3,oneof" json:"reservation,omitempty"`
-	Limit         *Limit           `protobuf:"bytes,4,opt,name=limit,proto3,oneof" json:"limit,omitempty"`
-	Status        *Status          `protobuf:"varint,5,opt,name=status,proto3,enum=circuit.pb.Status,oneof" json:"status,omitempty"`
+	Type        *HopMessage_Type `protobuf:"varint,1,opt,name=type,proto3,enum=circuit.pb.HopMessage_Type,oneof" json:"type,omitempty"`
+	Peer        *Peer            `protobuf:"bytes,2,opt,name=peer,proto3,oneof" json:"peer,omitempty"`
+	Reservation *Reservation     `protobuf:"bytes,3,opt,name=reservation,proto3,oneof" json:"reservation,omitempty"`
+	Limit       *Limit           `protobuf:"bytes,4,opt,name=limit,proto3,oneof" json:"limit,omitempty"`
+	Status      *Status          `protobuf:"varint,5,opt,name=status,proto3,enum=circuit.pb.Status,oneof" json:"status,omitempty"`
+	// ttl is the reservation duration in seconds requested by the client in a RESERVE message.
+	// The relay clamps it to its configured bounds; the granted expiration is in the reservation.
+	Ttl *uint32 `protobuf:"varint,6,opt,name=ttl,proto3,oneof" json:"ttl,omitempty"`
+	// traceID is an optional correlation ID for the circuit in a CONNECT message.
+	// The relay forwards it to the destination in the StopMessage.
+	TraceID *string `protobuf:"bytes,7,opt,name=traceID,proto3,oneof" json:"traceID,omitempty"`
+	// capabilities is a bitmap of optional protocol features.
+	// Clients advertise their own in a RESERVE message and the relay answers with its own in the
+	// STATUS response; unknown bits are ignored.
+	Capabilities *uint64 `protobuf:"varint,8,opt,name=capabilities,proto3,oneof" json:"capabilities,omitempty"`
+	// info describes the relay's current limits in the STATUS response to a QUERY message.
+	Info *RelayInfo `protobuf:"bytes,9,opt,name=info,proto3,oneof" json:"info,omitempty"`
+	// signedPeerRecord is the sender's signed peer record, as a serialized record envelope, that
+	// clients may include in a RESERVE message. The relay verifies it and includes the certified
+	// addresses as the peer of the STATUS response to CONNECT messages for the client.
+	SignedPeerRecord []byte `protobuf:"bytes,10,opt,name=signedPeerRecord,proto3,oneof" json:"signedPeerRecord,omitempty"`
+	// hops is the number of relays preceding the receiving relay in the circuit, in a CONNECT
+	// message. Relays allowing two-hop circuits set it when connecting to the destination through
+	// another relay, and refuse CONNECT messages exceeding their hop limit.
+	Hops *uint32 `protobuf:"varint,11,opt,name=hops,proto3,oneof" json:"hops,omitempty"`
+	// protocol is the application protocol that the sender intends to use over the circuit, in a
+	// CONNECT message. Relays may account the resources of the circuit to that protocol.
+	Protocol *string `protobuf:"bytes,12,opt,name=protocol,proto3,oneof" json:"protocol,omitempty"`
+	// handoffToken is a handoff token from a previous reservation, as a serialized record envelope,
+	// that clients may include in a RESERVE message. Relays supporting handoff tokens restore the
+	// reservation it was issued for, e.g. after a restart, checking only their reservation capacity.
+	HandoffToken []byte `protobuf:"bytes,13,opt,name=handoffToken,proto3,oneof" json:"handoffToken,omitempty"`
+	// pskChallenge is the random nonce to prove knowledge of the pre-shared key for, in a CHALLENGE
+	// message.
+	PskChallenge []byte `protobuf:"bytes,14,opt,name=pskChallenge,proto3,oneof" json:"pskChallenge,omitempty"`
+	// pskResponse is the HMAC-SHA256 of the pskChallenge, the relay's peer ID and the client's peer
+	// ID, keyed with the pre-shared key, in the RESERVE message answering a CHALLENGE message.
+	PskResponse   []byte `protobuf:"bytes,15,opt,name=pskResponse,proto3,oneof" json:"pskResponse,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -262,14 +324,86 @@ func (x *HopMessage) GetStatus() Status {
 	return Status_UNUSED
 }
 
+func (x *HopMessage) GetTtl() uint32 {
+	if x != nil && x.Ttl != nil {
+		return *x.Ttl
+	}
+	return 0
+}
+
+func (x *HopMessage) GetTraceID() string {
+	if x != nil && x.TraceID != nil {
+		return *x.TraceID
+	}
+	return ""
+}
+
+func (x *HopMessage) GetCapabilities() uint64 {
+	if x != nil && x.Capabilities != nil {
+		return *x.Capabilities
+	}
+	return 0
+}
+
+func (x *HopMessage) GetInfo() *RelayInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *HopMessage) GetSignedPeerRecord() []byte {
+	if x != nil {
+		return x.SignedPeerRecord
+	}
+	return nil
+}
+
+func (x *HopMessage) GetHops() uint32 {
+	if x != nil && x.Hops != nil {
+		return *x.Hops
+	}
+	return 0
+}
+
+func (x *HopMessage) GetProtocol() string {
+	if x != nil && x.Protocol != nil {
+		return *x.Protocol
+	}
+	return ""
+}
+
+func (x *HopMessage) GetHandoffToken() []byte {
+	if x != nil {
+		return x.HandoffToken
+	}
+	return nil
+}
+
+func (x *HopMessage) GetPskChallenge() []byte {
+	if x != nil {
+		return x.PskChallenge
+	}
+	return nil
+}
+
+func (x *HopMessage) GetPskResponse() []byte {
+	if x != nil {
+		return x.PskResponse
+	}
+	return nil
+}
+
 type StopMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// This field is marked optional for backwards compatibility with proto2.
 	// Users should make sure to always set this.
-	Type          *StopMessage_Type `protobuf:"varint,1,opt,name=type,proto3,enum=circuit.pb.StopMessage_Type,oneof" json:"type,omitempty"`
-	Peer          *Peer             `protobuf:"bytes,2,opt,name=peer,proto3,oneof" json:"peer,omitempty"`
-	Limit         *Limit            `protobuf:"bytes,3,opt,name=limit,proto3,oneof" json:"limit,omitempty"`
-	Status        *Status           `protobuf:"varint,4,opt,name=status,proto3,enum=circuit.pb.Status,oneof" json:"status,omitempty"`
+	Type   *StopMessage_Type `protobuf:"varint,1,opt,name=type,proto3,enum=circuit.pb.StopMessage_Type,oneof" json:"type,omitempty"`
+	Peer   *Peer             `protobuf:"bytes,2,opt,name=peer,proto3,oneof" json:"peer,omitempty"`
+	Limit  *Limit            `protobuf:"bytes,3,opt,name=limit,proto3,oneof" json:"limit,omitempty"`
+	Status *Status           `protobuf:"varint,4,opt,name=status,proto3,enum=circuit.pb.Status,oneof" json:"status,omitempty"`
+	// traceID is the correlation ID of the circuit in a CONNECT message.
+	TraceID       *string `protobuf:"bytes,5,opt,name=traceID,proto3,oneof" json:"traceID,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -332,6 +466,13 @@ func (x *StopMessage) GetStatus() Status {
 	return Status_UNUSED
 }
 
+func (x *StopMessage) GetTraceID() string {
+	if x != nil && x.TraceID != nil {
+		return *x.TraceID
+	}
+	return ""
+}
+
 type Peer struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// This field is marked optional for backwards compatibility with proto2.
@@ -390,9 +531,21 @@ type Reservation struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// This field is marked optional for backwards compatibility with proto2.
 	// Users should make sure to always set this.
-	Expire        *uint64  `protobuf:"varint,1,opt,name=expire,proto3,oneof" json:"expire,omitempty"`  // Unix expiration time (UTC)
-	Addrs         [][]byte `protobuf:"bytes,2,rep,name=addrs,proto3" json:"addrs,omitempty"`           // relay addrs for reserving peer
-	Voucher       []byte   `protobuf:"bytes,3,opt,name=voucher,proto3,oneof" json:"voucher,omitempty"` // reservation voucher
+	Expire  *uint64  `protobuf:"varint,1,opt,name=expire,proto3,oneof" json:"expire,omitempty"`  // Unix expiration time (UTC)
+	Addrs   [][]byte `protobuf:"bytes,2,rep,name=addrs,proto3" json:"addrs,omitempty"`           // relay addrs for reserving peer
+	Voucher []byte   `protobuf:"bytes,3,opt,name=voucher,proto3,oneof" json:"voucher,omitempty"` // reservation voucher
+	// renewAfter is the Unix time (UTC) after which the relay suggests renewing the reservation,
+	// so that renewals from its clients are spread over time. Clients may renew earlier.
+	RenewAfter *uint64 `protobuf:"varint,4,opt,name=renewAfter,proto3,oneof" json:"renewAfter,omitempty"`
+	// quality is an optional hint about the current load of the relay, so that clients can
+	// balance their reservations over several relays.
+	Quality *ReservationQuality `protobuf:"bytes,5,opt,name=quality,proto3,oneof" json:"quality,omitempty"`
+	// backupRelays are other relays operated alongside this one, which the reserving peer can fail
+	// over to without discovering relays anew.
+	BackupRelays []*Peer `protobuf:"bytes,6,rep,name=backupRelays,proto3" json:"backupRelays,omitempty"`
+	// handoffToken is a signed HandoffToken record envelope, which the reserving peer can present
+	// to restore the reservation if the relay restarts before it expires.
+	HandoffToken  []byte `protobuf:"bytes,7,opt,name=handoffToken,proto3,oneof" json:"handoffToken,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -448,6 +601,149 @@ func (x *Reservation) GetVoucher() []byte {
 	return nil
 }
 
+func (x *Reservation) GetRenewAfter() uint64 {
+	if x != nil && x.RenewAfter != nil {
+		return *x.RenewAfter
+	}
+	return 0
+}
+
+func (x *Reservation) GetQuality() *ReservationQuality {
+	if x != nil {
+		return x.Quality
+	}
+	return nil
+}
+
+func (x *Reservation) GetBackupRelays() []*Peer {
+	if x != nil {
+		return x.BackupRelays
+	}
+	return nil
+}
+
+func (x *Reservation) GetHandoffToken() []byte {
+	if x != nil {
+		return x.HandoffToken
+	}
+	return nil
+}
+
+type ReservationQuality struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	CircuitUtilization *uint32                `protobuf:"varint,1,opt,name=circuitUtilization,proto3,oneof" json:"circuitUtilization,omitempty"` // percentage of the relay's circuit capacity in use
+	HandshakeLatency   *uint32                `protobuf:"varint,2,opt,name=handshakeLatency,proto3,oneof" json:"handshakeLatency,omitempty"`     // median of recent stop handshake latencies, in milliseconds
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *ReservationQuality) Reset() {
+	*x = ReservationQuality{}
+	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReservationQuality) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReservationQuality) ProtoMessage() {}
+
+func (x *ReservationQuality) ProtoReflect() protoreflect.Message {
+	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReservationQuality.ProtoReflect.Descriptor instead.
+func (*ReservationQuality) Descriptor() ([]byte, []int) {
+	return file_p2p_protocol_circuitv2_pb_circuit_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ReservationQuality) GetCircuitUtilization() uint32 {
+	if x != nil && x.CircuitUtilization != nil {
+		return *x.CircuitUtilization
+	}
+	return 0
+}
+
+func (x *ReservationQuality) GetHandshakeLatency() uint32 {
+	if x != nil && x.HandshakeLatency != nil {
+		return *x.HandshakeLatency
+	}
+	return 0
+}
+
+type RelayInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// reservationTTL is the duration in seconds of the reservations granted by the relay.
+	ReservationTTL *uint32 `protobuf:"varint,1,opt,name=reservationTTL,proto3,oneof" json:"reservationTTL,omitempty"`
+	// reservationCapacity is the number of additional reservations the relay currently accepts.
+	ReservationCapacity *uint32 `protobuf:"varint,2,opt,name=reservationCapacity,proto3,oneof" json:"reservationCapacity,omitempty"`
+	// maxCircuits is the maximum number of concurrent relayed connections per peer.
+	MaxCircuits   *uint32 `protobuf:"varint,3,opt,name=maxCircuits,proto3,oneof" json:"maxCircuits,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RelayInfo) Reset() {
+	*x = RelayInfo{}
+	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RelayInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RelayInfo) ProtoMessage() {}
+
+func (x *RelayInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RelayInfo.ProtoReflect.Descriptor instead.
+func (*RelayInfo) Descriptor() ([]byte, []int) {
+	return file_p2p_protocol_circuitv2_pb_circuit_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RelayInfo) GetReservationTTL() uint32 {
+	if x != nil && x.ReservationTTL != nil {
+		return *x.ReservationTTL
+	}
+	return 0
+}
+
+func (x *RelayInfo) GetReservationCapacity() uint32 {
+	if x != nil && x.ReservationCapacity != nil {
+		return *x.ReservationCapacity
+	}
+	return 0
+}
+
+func (x *RelayInfo) GetMaxCircuits() uint32 {
+	if x != nil && x.MaxCircuits != nil {
+		return *x.MaxCircuits
+	}
+	return 0
+}
+
 type Limit struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Duration      *uint32                `protobuf:"varint,1,opt,name=duration,proto3,oneof" json:"duration,omitempty"` // seconds
@@ -458,7 +754,7 @@ type Limit struct {
 
 func (x *Limit) Reset() {
 	*x = Limit{}
-	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[4]
+	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -470,7 +766,7 @@ func (x *Limit) String() string {
 func (*Limit) ProtoMessage() {}
 
 func (x *Limit) ProtoReflect() protoreflect.Message {
-	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[4]
+	mi := &file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -483,7 +779,7 @@ func (x *Limit) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Limit.ProtoReflect.Descriptor instead.
 func (*Limit) Descriptor() ([]byte, []int) {
-	return file_p2p_protocol_circuitv2_pb_circuit_proto_rawDescGZIP(), []int{4}
+	return file_p2p_protocol_circuitv2_pb_circuit_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Limit) GetDuration() uint32 {
@@ -505,48 +801,101 @@ var File_p2p_protocol_circuitv2_pb_circuit_proto protoreflect.FileDescriptor
 const file_p2p_protocol_circuitv2_pb_circuit_proto_rawDesc = "" +
 	"\n" +
 	"'p2p/protocol/circuitv2/pb/circuit.proto\x12\n" +
-	"circuit.pb\"\xf1\x02\n" +
+	"circuit.pb\"\xa9\a\n" +
 	"\n" +
 	"HopMessage\x124\n" +
 	"\x04type\x18\x01 \x01(\x0e2\x1b.circuit.pb.HopMessage.TypeH\x00R\x04type\x88\x01\x01\x12)\n" +
 	"\x04peer\x18\x02 \x01(\v2\x10.circuit.pb.PeerH\x01R\x04peer\x88\x01\x01\x12>\n" +
 	"\vreservation\x18\x03 \x01(\v2\x17.circuit.pb.ReservationH\x02R\vreservation\x88\x01\x01\x12,\n" +
 	"\x05limit\x18\x04 \x01(\v2\x11.circuit.pb.LimitH\x03R\x05limit\x88\x01\x01\x12/\n" +
-	"\x06status\x18\x05 \x01(\x0e2\x12.circuit.pb.StatusH\x04R\x06status\x88\x01\x01\",\n" +
+	"\x06status\x18\x05 \x01(\x0e2\x12.circuit.pb.StatusH\x04R\x06status\x88\x01\x01\x12\x15\n" +
+	"\x03ttl\x18\x06 \x01(\rH\x05R\x03ttl\x88\x01\x01\x12\x1d\n" +
+	"\atraceID\x18\a \x01(\tH\x06R\atraceID\x88\x01\x01\x12'\n" +
+	"\fcapabilities\x18\b \x01(\x04H\aR\fcapabilities\x88\x01\x01\x12.\n" +
+	"\x04info\x18\t \x01(\v2\x15.circuit.pb.RelayInfoH\bR\x04info\x88\x01\x01\x12/\n" +
+	"\x10signedPeerRecord\x18\n" +
+	" \x01(\fH\tR\x10signedPeerRecord\x88\x01\x01\x12\x17\n" +
+	"\x04hops\x18\v \x01(\rH\n" +
+	"R\x04hops\x88\x01\x01\x12\x1f\n" +
+	"\bprotocol\x18\f \x01(\tH\vR\bprotocol\x88\x01\x01\x12'\n" +
+	"\fhandoffToken\x18\r \x01(\fH\fR\fhandoffToken\x88\x01\x01\x12'\n" +
+	"\fpskChallenge\x18\x0e \x01(\fH\rR\fpskChallenge\x88\x01\x01\x12%\n" +
+	"\vpskResponse\x18\x0f \x01(\fH\x0eR\vpskResponse\x88\x01\x01\"f\n" +
 	"\x04Type\x12\v\n" +
 	"\aRESERVE\x10\x00\x12\v\n" +
 	"\aCONNECT\x10\x01\x12\n" +
 	"\n" +
-	"\x06STATUS\x10\x02B\a\n" +
+	"\x06STATUS\x10\x02\x12\x13\n" +
+	"\x0fRESERVE_CONNECT\x10\x03\x12\t\n" +
+	"\x05QUERY\x10\x04\x12\t\n" +
+	"\x05PROBE\x10\x05\x12\r\n" +
+	"\tCHALLENGE\x10\x06B\a\n" +
 	"\x05_typeB\a\n" +
 	"\x05_peerB\x0e\n" +
 	"\f_reservationB\b\n" +
 	"\x06_limitB\t\n" +
-	"\a_status\"\x96\x02\n" +
+	"\a_statusB\x06\n" +
+	"\x04_ttlB\n" +
+	"\n" +
+	"\b_traceIDB\x0f\n" +
+	"\r_capabilitiesB\a\n" +
+	"\x05_infoB\x13\n" +
+	"\x11_signedPeerRecordB\a\n" +
+	"\x05_hopsB\v\n" +
+	"\t_protocolB\x0f\n" +
+	"\r_handoffTokenB\x0f\n" +
+	"\r_pskChallengeB\x0e\n" +
+	"\f_pskResponse\"\xcc\x02\n" +
 	"\vStopMessage\x125\n" +
 	"\x04type\x18\x01 \x01(\x0e2\x1c.circuit.pb.StopMessage.TypeH\x00R\x04type\x88\x01\x01\x12)\n" +
 	"\x04peer\x18\x02 \x01(\v2\x10.circuit.pb.PeerH\x01R\x04peer\x88\x01\x01\x12,\n" +
 	"\x05limit\x18\x03 \x01(\v2\x11.circuit.pb.LimitH\x02R\x05limit\x88\x01\x01\x12/\n" +
-	"\x06status\x18\x04 \x01(\x0e2\x12.circuit.pb.StatusH\x03R\x06status\x88\x01\x01\"\x1f\n" +
+	"\x06status\x18\x04 \x01(\x0e2\x12.circuit.pb.StatusH\x03R\x06status\x88\x01\x01\x12\x1d\n" +
+	"\atraceID\x18\x05 \x01(\tH\x04R\atraceID\x88\x01\x01\"*\n" +
 	"\x04Type\x12\v\n" +
 	"\aCONNECT\x10\x00\x12\n" +
 	"\n" +
-	"\x06STATUS\x10\x01B\a\n" +
+	"\x06STATUS\x10\x01\x12\t\n" +
+	"\x05PROBE\x10\x02B\a\n" +
 	"\x05_typeB\a\n" +
 	"\x05_peerB\b\n" +
 	"\x06_limitB\t\n" +
-	"\a_status\"8\n" +
+	"\a_statusB\n" +
+	"\n" +
+	"\b_traceID\"8\n" +
 	"\x04Peer\x12\x13\n" +
 	"\x02id\x18\x01 \x01(\fH\x00R\x02id\x88\x01\x01\x12\x14\n" +
 	"\x05addrs\x18\x02 \x03(\fR\x05addrsB\x05\n" +
-	"\x03_id\"v\n" +
+	"\x03_id\"\xe5\x02\n" +
 	"\vReservation\x12\x1b\n" +
 	"\x06expire\x18\x01 \x01(\x04H\x00R\x06expire\x88\x01\x01\x12\x14\n" +
 	"\x05addrs\x18\x02 \x03(\fR\x05addrs\x12\x1d\n" +
-	"\avoucher\x18\x03 \x01(\fH\x01R\avoucher\x88\x01\x01B\t\n" +
+	"\avoucher\x18\x03 \x01(\fH\x01R\avoucher\x88\x01\x01\x12#\n" +
+	"\n" +
+	"renewAfter\x18\x04 \x01(\x04H\x02R\n" +
+	"renewAfter\x88\x01\x01\x12=\n" +
+	"\aquality\x18\x05 \x01(\v2\x1e.circuit.pb.ReservationQualityH\x03R\aquality\x88\x01\x01\x124\n" +
+	"\fbackupRelays\x18\x06 \x03(\v2\x10.circuit.pb.PeerR\fbackupRelays\x12'\n" +
+	"\fhandoffToken\x18\a \x01(\fH\x04R\fhandoffToken\x88\x01\x01B\t\n" +
 	"\a_expireB\n" +
 	"\n" +
-	"\b_voucher\"W\n" +
+	"\b_voucherB\r\n" +
+	"\v_renewAfterB\n" +
+	"\n" +
+	"\b_qualityB\x0f\n" +
+	"\r_handoffToken\"\xa6\x01\n" +
+	"\x12ReservationQuality\x123\n" +
+	"\x12circuitUtilization\x18\x01 \x01(\rH\x00R\x12circuitUtilization\x88\x01\x01\x12/\n" +
+	"\x10handshakeLatency\x18\x02 \x01(\rH\x01R\x10handshakeLatency\x88\x01\x01B\x15\n" +
+	"\x13_circuitUtilizationB\x13\n" +
+	"\x11_handshakeLatency\"\xd1\x01\n" +
+	"\tRelayInfo\x12+\n" +
+	"\x0ereservationTTL\x18\x01 \x01(\rH\x00R\x0ereservationTTL\x88\x01\x01\x125\n" +
+	"\x13reservationCapacity\x18\x02 \x01(\rH\x01R\x13reservationCapacity\x88\x01\x01\x12%\n" +
+	"\vmaxCircuits\x18\x03 \x01(\rH\x02R\vmaxCircuits\x88\x01\x01B\x11\n" +
+	"\x0f_reservationTTLB\x16\n" +
+	"\x14_reservationCapacityB\x0e\n" +
+	"\f_maxCircuits\"W\n" +
 	"\x05Limit\x12\x1f\n" +
 	"\bduration\x18\x01 \x01(\rH\x00R\bduration\x88\x01\x01\x12\x17\n" +
 	"\x04data\x18\x02 \x01(\x04H\x01R\x04data\x88\x01\x01B\v\n" +
@@ -577,32 +926,37 @@ func file_p2p_protocol_circuitv2_pb_circuit_proto_rawDescGZIP() []byte {
 }
 
 var file_p2p_protocol_circuitv2_pb_circuit_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_p2p_protocol_circuitv2_pb_circuit_proto_goTypes = []any{
-	(Status)(0),           // 0: circuit.pb.Status
-	(HopMessage_Type)(0),  // 1: circuit.pb.HopMessage.Type
-	(StopMessage_Type)(0), // 2: circuit.pb.StopMessage.Type
-	(*HopMessage)(nil),    // 3: circuit.pb.HopMessage
-	(*StopMessage)(nil),   // 4: circuit.pb.StopMessage
-	(*Peer)(nil),          // 5: circuit.pb.Peer
-	(*Reservation)(nil),   // 6: circuit.pb.Reservation
-	(*Limit)(nil),         // 7: circuit.pb.Limit
+	(Status)(0),                // 0: circuit.pb.Status
+	(HopMessage_Type)(0),       // 1: circuit.pb.HopMessage.Type
+	(StopMessage_Type)(0),      // 2: circuit.pb.StopMessage.Type
+	(*HopMessage)(nil),         // 3: circuit.pb.HopMessage
+	(*StopMessage)(nil),        // 4: circuit.pb.StopMessage
+	(*Peer)(nil),               // 5: circuit.pb.Peer
+	(*Reservation)(nil),        // 6: circuit.pb.Reservation
+	(*ReservationQuality)(nil), // 7: circuit.pb.ReservationQuality
+	(*RelayInfo)(nil),          // 8: circuit.pb.RelayInfo
+	(*Limit)(nil),              // 9: circuit.pb.Limit
 }
 var file_p2p_protocol_circuitv2_pb_circuit_proto_depIdxs = []int32{
-	1, // 0: circuit.pb.HopMessage.type:type_name -> circuit.pb.HopMessage.Type
-	5, // 1: circuit.pb.HopMessage.peer:type_name -> circuit.pb.Peer
-	6, // 2: circuit.pb.HopMessage.reservation:type_name -> circuit.pb.Reservation
-	7, // 3: circuit.pb.HopMessage.limit:type_name -> circuit.pb.Limit
-	0, // 4: circuit.pb.HopMessage.status:type_name -> circuit.pb.Status
-	2, // 5: circuit.pb.StopMessage.type:type_name -> circuit.pb.StopMessage.Type
-	5, // 6: circuit.pb.StopMessage.peer:type_name -> circuit.pb.Peer
-	7, // 7: circuit.pb.StopMessage.limit:type_name -> circuit.pb.Limit
-	0, // 8: circuit.pb.StopMessage.status:type_name -> circuit.pb.Status
-	9, // [9:9] is the sub-list for method output_type
-	9, // [9:9] is the sub-list for method input_type
-	9, // [9:9] is the sub-list for extension type_name
-	9, // [9:9] is the sub-list for extension extendee
-	0, // [0:9] is the sub-list for field type_name
+	1,  // 0: circuit.pb.HopMessage.type:type_name -> circuit.pb.HopMessage.Type
+	5,  // 1: circuit.pb.HopMessage.peer:type_name -> circuit.pb.Peer
+	6,  // 2: circuit.pb.HopMessage.reservation:type_name -> circuit.pb.Reservation
+	9,  // 3: circuit.pb.HopMessage.limit:type_name -> circuit.pb.Limit
+	0,  // 4: circuit.pb.HopMessage.status:type_name -> circuit.pb.Status
+	8,  // 5: circuit.pb.HopMessage.info:type_name -> circuit.pb.RelayInfo
+	2,  // 6: circuit.pb.StopMessage.type:type_name -> circuit.pb.StopMessage.Type
+	5,  // 7: circuit.pb.StopMessage.peer:type_name -> circuit.pb.Peer
+	9,  // 8: circuit.pb.StopMessage.limit:type_name -> circuit.pb.Limit
+	0,  // 9: circuit.pb.StopMessage.status:type_name -> circuit.pb.Status
+	7,  // 10: circuit.pb.Reservation.quality:type_name -> circuit.pb.ReservationQuality
+	5,  // 11: circuit.pb.Reservation.backupRelays:type_name -> circuit.pb.Peer
+	12, // [12:12] is the sub-list for method output_type
+	12, // [12:12] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_p2p_protocol_circuitv2_pb_circuit_proto_init() }
@@ -615,13 +969,15 @@ func file_p2p_protocol_circuitv2_pb_circuit_proto_init() {
 	file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[2].OneofWrappers = []any{}
 	file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[3].OneofWrappers = []any{}
 	file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[4].OneofWrappers = []any{}
+	file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[5].OneofWrappers = []any{}
+	file_p2p_protocol_circuitv2_pb_circuit_proto_msgTypes[6].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_p2p_protocol_circuitv2_pb_circuit_proto_rawDesc), len(file_p2p_protocol_circuitv2_pb_circuit_proto_rawDesc)),
 			NumEnums:      3,
-			NumMessages:   5,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -25,9 +25,12 @@ type ReservationVoucher struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// These fields are marked optional for backwards compatibility with proto2.
 	// Users should make sure to always set these.
-	Relay         []byte  `protobuf:"bytes,1,opt,name=relay,proto3,oneof" json:"relay,omitempty"`
-	Peer          []byte  `protobuf:"bytes,2,opt,name=peer,proto3,oneof" json:"peer,omitempty"`
-	Expiration    *uint64 `protobuf:"varint,3,opt,name=expiration,proto3,oneof" json:"expiration,omitempty"`
+	Relay      []byte  `protobuf:"bytes,1,opt,name=relay,proto3,oneof" json:"relay,omitempty"`
+	Peer       []byte  `protobuf:"bytes,2,opt,name=peer,proto3,oneof" json:"peer,omitempty"`
+	Expiration *uint64 `protobuf:"varint,3,opt,name=expiration,proto3,oneof" json:"expiration,omitempty"`
+	// nonce is a random value identifying this voucher, set by relays that track vouchers for
+	// single use.
+	Nonce         []byte `protobuf:"bytes,4,opt,name=nonce,proto3,oneof" json:"nonce,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -83,21 +86,115 @@ func (x *ReservationVoucher) GetExpiration() uint64 {
 	return 0
 }
 
+func (x *ReservationVoucher) GetNonce() []byte {
+	if x != nil {
+		return x.Nonce
+	}
+	return nil
+}
+
+type HandoffToken struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// These fields are marked optional for backwards compatibility with proto2.
+	// Users should make sure to always set these.
+	Relay      []byte  `protobuf:"bytes,1,opt,name=relay,proto3,oneof" json:"relay,omitempty"`
+	Peer       []byte  `protobuf:"bytes,2,opt,name=peer,proto3,oneof" json:"peer,omitempty"`
+	Expiration *uint64 `protobuf:"varint,3,opt,name=expiration,proto3,oneof" json:"expiration,omitempty"`
+	// relayStart is the start time of the relay instance that issued the token, in unix
+	// nanoseconds.
+	RelayStart    *uint64 `protobuf:"varint,4,opt,name=relayStart,proto3,oneof" json:"relayStart,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HandoffToken) Reset() {
+	*x = HandoffToken{}
+	mi := &file_p2p_protocol_circuitv2_pb_voucher_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HandoffToken) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandoffToken) ProtoMessage() {}
+
+func (x *HandoffToken) ProtoReflect() protoreflect.Message {
+	mi := &file_p2p_protocol_circuitv2_pb_voucher_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandoffToken.ProtoReflect.Descriptor instead.
+func (*HandoffToken) Descriptor() ([]byte, []int) {
+	return file_p2p_protocol_circuitv2_pb_voucher_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *HandoffToken) GetRelay() []byte {
+	if x != nil {
+		return x.Relay
+	}
+	return nil
+}
+
+func (x *HandoffToken) GetPeer() []byte {
+	if x != nil {
+		return x.Peer
+	}
+	return nil
+}
+
+func (x *HandoffToken) GetExpiration() uint64 {
+	if x != nil && x.Expiration != nil {
+		return *x.Expiration
+	}
+	return 0
+}
+
+func (x *HandoffToken) GetRelayStart() uint64 {
+	if x != nil && x.RelayStart != nil {
+		return *x.RelayStart
+	}
+	return 0
+}
+
 var File_p2p_protocol_circuitv2_pb_voucher_proto protoreflect.FileDescriptor
 
 const file_p2p_protocol_circuitv2_pb_voucher_proto_rawDesc = "" +
 	"\n" +
 	"'p2p/protocol/circuitv2/pb/voucher.proto\x12\n" +
-	"circuit.pb\"\x8f\x01\n" +
+	"circuit.pb\"\xb4\x01\n" +
 	"\x12ReservationVoucher\x12\x19\n" +
 	"\x05relay\x18\x01 \x01(\fH\x00R\x05relay\x88\x01\x01\x12\x17\n" +
 	"\x04peer\x18\x02 \x01(\fH\x01R\x04peer\x88\x01\x01\x12#\n" +
 	"\n" +
 	"expiration\x18\x03 \x01(\x04H\x02R\n" +
-	"expiration\x88\x01\x01B\b\n" +
+	"expiration\x88\x01\x01\x12\x19\n" +
+	"\x05nonce\x18\x04 \x01(\fH\x03R\x05nonce\x88\x01\x01B\b\n" +
+	"\x06_relayB\a\n" +
+	"\x05_peerB\r\n" +
+	"\v_expirationB\b\n" +
+	"\x06_nonce\"\xbd\x01\n" +
+	"\fHandoffToken\x12\x19\n" +
+	"\x05relay\x18\x01 \x01(\fH\x00R\x05relay\x88\x01\x01\x12\x17\n" +
+	"\x04peer\x18\x02 \x01(\fH\x01R\x04peer\x88\x01\x01\x12#\n" +
+	"\n" +
+	"expiration\x18\x03 \x01(\x04H\x02R\n" +
+	"expiration\x88\x01\x01\x12#\n" +
+	"\n" +
+	"relayStart\x18\x04 \x01(\x04H\x03R\n" +
+	"relayStart\x88\x01\x01B\b\n" +
 	"\x06_relayB\a\n" +
 	"\x05_peerB\r\n" +
-	"\v_expirationB7Z5github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pbb\x06proto3"
+	"\v_expirationB\r\n" +
+	"\v_relayStartB7Z5github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pbb\x06proto3"
 
 var (
 	file_p2p_protocol_circuitv2_pb_voucher_proto_rawDescOnce sync.Once
@@ -111,9 +208,10 @@ func file_p2p_protocol_circuitv2_pb_voucher_proto_rawDescGZIP() []byte {
 	return file_p2p_protocol_circuitv2_pb_voucher_proto_rawDescData
 }
 
-var file_p2p_protocol_circuitv2_pb_voucher_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_p2p_protocol_circuitv2_pb_voucher_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_p2p_protocol_circuitv2_pb_voucher_proto_goTypes = []any{
 	(*ReservationVoucher)(nil), // 0: circuit.pb.ReservationVoucher
+	(*HandoffToken)(nil),       // 1: circuit.pb.HandoffToken
 }
 var file_p2p_protocol_circuitv2_pb_voucher_proto_depIdxs = []int32{
 	0, // [0:0] is the sub-list for method output_type
@@ -129,13 +227,14 @@ func file_p2p_protocol_circuitv2_pb_voucher_proto_init() {
 		return
 	}
 	file_p2p_protocol_circuitv2_pb_voucher_proto_msgTypes[0].OneofWrappers = []any{}
+	file_p2p_protocol_circuitv2_pb_voucher_proto_msgTypes[1].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_p2p_protocol_circuitv2_pb_voucher_proto_rawDesc), len(file_p2p_protocol_circuitv2_pb_voucher_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   1,
+			NumMessages:   2,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
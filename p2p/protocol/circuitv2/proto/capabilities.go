@@ -0,0 +1,20 @@
+package proto
+
+// Capabilities is a bitmap of optional circuit relay protocol features, exchanged in the reserve
+// handshake.
+type Capabilities uint64
+
+const (
+	// CapabilityTraceID indicates support for circuit trace IDs in the stop handshake.
+	CapabilityTraceID Capabilities = 1 << iota
+	// CapabilityPSK indicates support for pre-shared key challenges in the reserve handshake.
+	CapabilityPSK
+)
+
+// SupportedCapabilities is the set of capabilities implemented by this module.
+const SupportedCapabilities = CapabilityTraceID | CapabilityPSK
+
+// Has returns true if all capabilities in o are set in c.
+func (c Capabilities) Has(o Capabilities) bool {
+	return c&o == o
+}
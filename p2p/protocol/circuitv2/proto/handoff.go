@@ -0,0 +1,79 @@
+package proto
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const HandoffRecordDomain = "libp2p-relay-handoff"
+
+// TODO: register in multicodec table in https://github.com/multiformats/multicodec
+var HandoffRecordCodec = []byte{0x03, 0x03}
+
+func init() {
+	record.RegisterType(&HandoffToken{})
+}
+
+// HandoffToken is issued by a relay with a reservation. The reserving peer can present it to the
+// relay to restore the reservation, for example after the relay restarts.
+type HandoffToken struct {
+	// Relay is the ID of the peer providing relay service
+	Relay peer.ID
+	// Peer is the ID of the peer holding the reservation
+	Peer peer.ID
+	// Expiration is the expiration time of the reservation the token was issued with
+	Expiration time.Time
+	// RelayStart is the start time of the relay instance that issued the token. It tells the
+	// tokens issued before a restart of the relay apart from the ones issued since.
+	RelayStart time.Time
+}
+
+var _ record.Record = (*HandoffToken)(nil)
+
+func (ht *HandoffToken) Domain() string {
+	return HandoffRecordDomain
+}
+
+func (ht *HandoffToken) Codec() []byte {
+	return HandoffRecordCodec
+}
+
+func (ht *HandoffToken) MarshalRecord() ([]byte, error) {
+	expiration := uint64(ht.Expiration.Unix())
+	relayStart := uint64(ht.RelayStart.UnixNano())
+	return proto.Marshal(&pbv2.HandoffToken{
+		Relay:      []byte(ht.Relay),
+		Peer:       []byte(ht.Peer),
+		Expiration: &expiration,
+		RelayStart: &relayStart,
+	})
+}
+
+func (ht *HandoffToken) UnmarshalRecord(blob []byte) error {
+	pbht := pbv2.HandoffToken{}
+	err := proto.Unmarshal(blob, &pbht)
+	if err != nil {
+		return err
+	}
+
+	ht.Relay, err = peer.IDFromBytes(pbht.GetRelay())
+	if err != nil {
+		return err
+	}
+
+	ht.Peer, err = peer.IDFromBytes(pbht.GetPeer())
+	if err != nil {
+		return err
+	}
+
+	ht.Expiration = time.Unix(int64(pbht.GetExpiration()), 0)
+	if pbht.RelayStart != nil {
+		ht.RelayStart = time.Unix(0, int64(pbht.GetRelayStart()))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package proto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+)
+
+func TestHandoffToken(t *testing.T) {
+	relayPrivk, relayPubk, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, peerPubk, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relayID, err := peer.IDFromPublicKey(relayPubk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerID, err := peer.IDFromPublicKey(peerPubk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := &HandoffToken{
+		Relay:      relayID,
+		Peer:       peerID,
+		Expiration: time.Now().Add(time.Hour),
+		RelayStart: time.Now().Add(-time.Minute),
+	}
+
+	envelope, err := record.Seal(token, relayPrivk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := envelope.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, rec, err := record.ConsumeEnvelope(blob, HandoffRecordDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token2, ok := rec.(*HandoffToken)
+	if !ok {
+		t.Fatalf("invalid record type %+T", rec)
+	}
+
+	if token.Relay != token2.Relay {
+		t.Fatal("relay IDs don't match")
+	}
+	if token.Peer != token2.Peer {
+		t.Fatal("peer IDs don't match")
+	}
+	if token.Expiration.Unix() != token2.Expiration.Unix() {
+		t.Fatal("expirations don't match")
+	}
+	if !token.RelayStart.Equal(token2.RelayStart) {
+		t.Fatal("relay start times don't match")
+	}
+
+	// a handoff token is not a reservation voucher
+	if _, _, err := record.ConsumeEnvelope(blob, RecordDomain); err == nil {
+		t.Fatal("expected handoff token to be rejected as a reservation voucher")
+	}
+}
@@ -0,0 +1,22 @@
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PSKChallengeSize is the size of the nonce in a pre-shared key challenge.
+const PSKChallengeSize = 32
+
+// PSKResponse computes the response to a pre-shared key challenge issued by relay to client.
+// Binding the response to both peers prevents it from being relayed to another relay or
+// presented on behalf of another client.
+func PSKResponse(psk, challenge []byte, relay, client peer.ID) []byte {
+	mac := hmac.New(sha256.New, psk)
+	mac.Write(challenge)
+	mac.Write([]byte(relay))
+	mac.Write([]byte(client))
+	return mac.Sum(nil)
+}
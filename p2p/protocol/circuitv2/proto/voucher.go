@@ -26,6 +26,10 @@ type ReservationVoucher struct {
 	Peer peer.ID
 	// Expiration is the expiration time of the reservation
 	Expiration time.Time
+	// Nonce is a random value identifying the voucher, so that relays can tell vouchers for the
+	// same peer and expiration apart and accept each one only once. It is nil if the relay
+	// doesn't track its vouchers.
+	Nonce []byte
 }
 
 var _ record.Record = (*ReservationVoucher)(nil)
@@ -44,6 +48,7 @@ func (rv *ReservationVoucher) MarshalRecord() ([]byte, error) {
 		Relay:      []byte(rv.Relay),
 		Peer:       []byte(rv.Peer),
 		Expiration: &expiration,
+		Nonce:      rv.Nonce,
 	})
 }
 
@@ -65,5 +70,6 @@ func (rv *ReservationVoucher) UnmarshalRecord(blob []byte) error {
 	}
 
 	rv.Expiration = time.Unix(int64(pbrv.GetExpiration()), 0)
+	rv.Nonce = pbrv.GetNonce()
 	return nil
 }
@@ -1,6 +1,7 @@
 package proto
 
 import (
+	"bytes"
 	"testing"
 	"time"
 
@@ -34,6 +35,7 @@ func TestReservationVoucher(t *testing.T) {
 		Relay:      relayID,
 		Peer:       peerID,
 		Expiration: time.Now().Add(time.Hour),
+		Nonce:      []byte("nonce"),
 	}
 
 	envelope, err := record.Seal(rsvp, relayPrivk)
@@ -65,4 +67,7 @@ func TestReservationVoucher(t *testing.T) {
 	if rsvp.Expiration.Unix() != rsvp2.Expiration.Unix() {
 		t.Fatal("expirations don't match")
 	}
+	if !bytes.Equal(rsvp.Nonce, rsvp2.Nonce) {
+		t.Fatal("nonces don't match")
+	}
 }
@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"time"
+)
+
+// Reasons reported by Accepting for not accepting reservations.
+const (
+	NotAcceptingClosed      = "relay closed"
+	NotAcceptingMaintenance = "relay in maintenance"
+	NotAcceptingLoadShed    = "load shed"
+	NotAcceptingUnreachable = "relay not publicly reachable"
+	NotAcceptingConnections = "too many host connections"
+	NotAcceptingFull        = "reservation capacity exhausted"
+)
+
+// Accepting returns whether the relay would currently accept a new reservation from an ordinary
+// peer, and if not, the reason, which is one of the NotAccepting* constants. If several reasons
+// apply, the first of closed, maintenance, load shed, unreachable, too many host connections and
+// full is reported. The relay is not full if a reservation could be evicted according to the eviction
+// policy, and capacity set aside for priority peers with WithReservedCapacity is not available.
+// The ACL and the per IP and per ASN limits, which depend on the requesting peer, are not taken
+// into account.
+func (r *Relay) Accepting() (bool, string) {
+	now := time.Now()
+
+	r.mx.Lock()
+	closed := r.closed
+	r.mx.Unlock()
+	if closed {
+		return false, NotAcceptingClosed
+	}
+	if r.maintenance.Load() {
+		return false, NotAcceptingMaintenance
+	}
+	if r.loadShedder.Shed(now) {
+		return false, NotAcceptingLoadShed
+	}
+	if r.reachabilityGating && !r.reachable.Load() {
+		return false, NotAcceptingUnreachable
+	}
+	if r.hostConnsExceeded() {
+		return false, NotAcceptingConnections
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.constraints.full(now) && !r.hasEvictableReservation() {
+		return false, NotAcceptingFull
+	}
+	return true, ""
+}
+
+// hasEvictableReservation returns true if a reservation could be evicted to make room for a new
+// one. r.mx must be held.
+func (r *Relay) hasEvictableReservation() bool {
+	if r.evictionPolicy == EvictNone {
+		return false
+	}
+	for p := range r.rsvp {
+		if r.conns[p] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMaintenance puts the relay in or out of maintenance mode. In maintenance mode the relay
+// refuses new reservations, so that it can be drained before it is taken down. Existing
+// reservations can still be renewed, and relayed connections are served as usual.
+func (r *Relay) SetMaintenance(enabled bool) {
+	if r.maintenance.Swap(enabled) != enabled {
+		log.Info("relay maintenance mode changed", "maintenance", enabled)
+	}
+}
+
+// Maintenance returns whether the relay is in maintenance mode.
+func (r *Relay) Maintenance() bool {
+	return r.maintenance.Load()
+}
@@ -0,0 +1,117 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireAccepting(t *testing.T, r *Relay, reason string) {
+	t.Helper()
+	accepting, got := r.Accepting()
+	require.Equal(t, reason == "", accepting)
+	require.Equal(t, reason, got)
+}
+
+func TestAccepting(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	var shed atomic.Bool
+	rc := DefaultResources()
+	rc.MaxReservations = 1
+	r, err := New(relayHost, WithResources(rc), WithLoadShedder(shed.Load), WithReachabilityGating(true))
+	require.NoError(t, err)
+	r.loadShedder.interval = 0
+	requireAccepting(t, r, "")
+
+	shed.Store(true)
+	requireAccepting(t, r, NotAcceptingLoadShed)
+	shed.Store(false)
+
+	r.reachabilityChanged(network.ReachabilityPrivate)
+	requireAccepting(t, r, NotAcceptingUnreachable)
+	r.reachabilityChanged(network.ReachabilityPublic)
+	requireAccepting(t, r, "")
+
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+	requireAccepting(t, r, NotAcceptingFull)
+	// the dominant reason is reported
+	shed.Store(true)
+	requireAccepting(t, r, NotAcceptingLoadShed)
+	shed.Store(false)
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+	var resp adminAccepting
+	getAdminJSON(t, srv, "/accepting", &resp)
+	require.Equal(t, adminAccepting{Accepting: false, Reason: NotAcceptingFull}, resp)
+
+	r.Close()
+	requireAccepting(t, r, NotAcceptingClosed)
+}
+
+func TestAcceptingCapacity(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	t.Run("eviction", func(t *testing.T) {
+		rc := DefaultResources()
+		rc.MaxReservations = 1
+		r, err := New(relayHost, WithResources(rc), WithReservationEvictionPolicy(EvictLeastRecentlyUsed))
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, err = reserve(t, h, relayHost)
+		require.NoError(t, err)
+		// the reservation can be evicted to make room
+		requireAccepting(t, r, "")
+	})
+
+	t.Run("reserved capacity", func(t *testing.T) {
+		rc := DefaultResources()
+		rc.MaxReservations = 2
+		r, err := New(relayHost, WithResources(rc), WithReservedCapacity([]peer.ID{relayHost.ID()}, 1))
+		require.NoError(t, err)
+		defer r.Close()
+
+		requireAccepting(t, r, "")
+		_, err = reserve(t, h, relayHost)
+		require.NoError(t, err)
+		// only the slot set aside for priority peers is left
+		requireAccepting(t, r, NotAcceptingFull)
+	})
+}
+
+func TestMaintenance(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, reserved, h := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, reserved, relayHost)
+	require.NoError(t, err)
+
+	r.SetMaintenance(true)
+	require.True(t, r.Maintenance())
+	requireAccepting(t, r, NotAcceptingMaintenance)
+	// new reservations are refused, existing ones can be renewed
+	_, err = reserve(t, h, relayHost)
+	require.Error(t, err)
+	require.False(t, r.hasReservation(h.ID()))
+	_, err = reserve(t, reserved, relayHost)
+	require.NoError(t, err)
+
+	r.SetMaintenance(false)
+	requireAccepting(t, r, "")
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+}
@@ -1,6 +1,8 @@
 package relay
 
 import (
+	"fmt"
+
 	"github.com/libp2p/go-libp2p/core/peer"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -15,3 +17,123 @@ type ACLFilter interface {
 	// to a destination peer.
 	AllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) bool
 }
+
+// ACLExplainer is an optional interface for ACLFilters that can report why a request was
+// refused. The relay uses the reason when logging refusals.
+type ACLExplainer interface {
+	// ExplainReserve is like AllowReserve, but also returns the reason for refusing the
+	// reservation.
+	ExplainReserve(p peer.ID, a ma.Multiaddr) (allow bool, reason string)
+	// ExplainConnect is like AllowConnect, but also returns the reason for refusing the
+	// connection.
+	ExplainConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) (allow bool, reason string)
+}
+
+// ChainACL returns an ACLFilter that allows a request only if all filters allow it.
+// Filters are evaluated in order, and evaluation stops at the first filter refusing the request.
+func ChainACL(filters ...ACLFilter) ACLFilter {
+	return &aclChain{filters: filters, any: false}
+}
+
+// OrACL returns an ACLFilter that allows a request if any of the filters allows it.
+// Filters are evaluated in order, and evaluation stops at the first filter allowing the request.
+func OrACL(filters ...ACLFilter) ACLFilter {
+	return &aclChain{filters: filters, any: true}
+}
+
+type aclChain struct {
+	filters []ACLFilter
+	// any selects OR semantics; the default are AND semantics.
+	any bool
+}
+
+var _ ACLExplainer = &aclChain{}
+
+func (c *aclChain) AllowReserve(p peer.ID, a ma.Multiaddr) bool {
+	allow, _ := c.ExplainReserve(p, a)
+	return allow
+}
+
+func (c *aclChain) AllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) bool {
+	allow, _ := c.ExplainConnect(src, srcAddr, dest)
+	return allow
+}
+
+func (c *aclChain) ExplainReserve(p peer.ID, a ma.Multiaddr) (bool, string) {
+	return c.evaluate(func(f ACLFilter) (bool, string) { return explainReserve(f, p, a) })
+}
+
+func (c *aclChain) ExplainConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) (bool, string) {
+	return c.evaluate(func(f ACLFilter) (bool, string) { return explainConnect(f, src, srcAddr, dest) })
+}
+
+func (c *aclChain) evaluate(decide func(ACLFilter) (bool, string)) (bool, string) {
+	if !c.any {
+		for _, f := range c.filters {
+			if allow, reason := decide(f); !allow {
+				return false, reason
+			}
+		}
+		return true, ""
+	}
+
+	reason := "no filter allowed the request"
+	for _, f := range c.filters {
+		allow, r := decide(f)
+		if allow {
+			return true, ""
+		}
+		reason = r
+	}
+	return false, reason
+}
+
+func explainReserve(f ACLFilter, p peer.ID, a ma.Multiaddr) (bool, string) {
+	if e, ok := f.(ACLExplainer); ok {
+		return e.ExplainReserve(p, a)
+	}
+	if f.AllowReserve(p, a) {
+		return true, ""
+	}
+	return false, aclName(f)
+}
+
+func explainConnect(f ACLFilter, src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) (bool, string) {
+	if e, ok := f.(ACLExplainer); ok {
+		return e.ExplainConnect(src, srcAddr, dest)
+	}
+	if f.AllowConnect(src, srcAddr, dest) {
+		return true, ""
+	}
+	return false, aclName(f)
+}
+
+// aclName returns a name identifying an ACLFilter in refusal reasons.
+func aclName(f ACLFilter) string {
+	if s, ok := f.(fmt.Stringer); ok {
+		return fmt.Sprintf("permission denied by %s", s)
+	}
+	return fmt.Sprintf("permission denied by %T", f)
+}
+
+// aclAllowReserve consults the relay's ACL for a reservation and returns the reason for a refusal.
+func (r *Relay) aclAllowReserve(p peer.ID, a ma.Multiaddr) (bool, string) {
+	if r.acl == nil {
+		return true, ""
+	}
+	if e, ok := r.acl.(ACLExplainer); ok {
+		return e.ExplainReserve(p, a)
+	}
+	return r.acl.AllowReserve(p, a), "permission denied"
+}
+
+// aclAllowConnect consults the relay's ACL for a connection and returns the reason for a refusal.
+func (r *Relay) aclAllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) (bool, string) {
+	if r.acl == nil {
+		return true, ""
+	}
+	if e, ok := r.acl.(ACLExplainer); ok {
+		return e.ExplainConnect(src, srcAddr, dest)
+	}
+	return r.acl.AllowConnect(src, srcAddr, dest), "permission denied"
+}
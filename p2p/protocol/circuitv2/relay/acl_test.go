@@ -0,0 +1,86 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type staticACL struct {
+	name  string
+	allow bool
+	calls int
+}
+
+func (a *staticACL) AllowReserve(peer.ID, ma.Multiaddr) bool {
+	a.calls++
+	return a.allow
+}
+
+func (a *staticACL) AllowConnect(peer.ID, ma.Multiaddr, peer.ID) bool {
+	a.calls++
+	return a.allow
+}
+
+func (a *staticACL) String() string { return a.name }
+
+func TestChainACL(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+
+	allow1 := &staticACL{name: "allow1", allow: true}
+	deny := &staticACL{name: "deny", allow: false}
+	allow2 := &staticACL{name: "allow2", allow: true}
+
+	acl := ChainACL(allow1, deny, allow2)
+	allow, reason := acl.(ACLExplainer).ExplainReserve(p, addr)
+	require.False(t, allow)
+	require.Equal(t, "permission denied by deny", reason)
+	require.Equal(t, 1, allow1.calls)
+	require.Equal(t, 1, deny.calls)
+	require.Zero(t, allow2.calls, "expected short-circuit evaluation")
+
+	require.True(t, ChainACL(allow1, allow2).AllowConnect(p, addr, p))
+	require.True(t, ChainACL().AllowReserve(p, addr))
+}
+
+func TestOrACL(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+
+	deny1 := &staticACL{name: "deny1", allow: false}
+	allow := &staticACL{name: "allow", allow: true}
+	deny2 := &staticACL{name: "deny2", allow: false}
+
+	require.True(t, OrACL(deny1, allow, deny2).AllowConnect(p, addr, p))
+	require.Equal(t, 1, deny1.calls)
+	require.Equal(t, 1, allow.calls)
+	require.Zero(t, deny2.calls, "expected short-circuit evaluation")
+
+	ok, reason := OrACL(deny1, deny2).(ACLExplainer).ExplainConnect(p, addr, p)
+	require.False(t, ok)
+	require.Equal(t, "permission denied by deny2", reason)
+
+	// nested chains surface the innermost refusing filter
+	ok, reason = ChainACL(allow, OrACL(deny1)).(ACLExplainer).ExplainReserve(p, addr)
+	require.False(t, ok)
+	require.Equal(t, "permission denied by deny1", reason)
+}
+
+func TestWithMultipleACLs(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	deny := &staticACL{name: "deny", allow: false}
+	r, err := New(relayHost, WithACL(&staticACL{allow: true}, deny))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, h, relayHost)
+	require.Error(t, err)
+	require.Equal(t, 1, deny.calls)
+}
@@ -0,0 +1,28 @@
+package relay
+
+import (
+	"bytes"
+	"slices"
+)
+
+// stableAddrOrder orders the reservation addresses addrs consistently with prev, the addresses
+// sent with the previous reservation of the same peer. Addresses that were in prev come first,
+// in the same order, followed by new addresses in canonical order. This keeps the order stable
+// across renewals while the addresses of the relay don't change, and the order of the remaining
+// addresses stable when they do.
+func stableAddrOrder(prev, addrs [][]byte) [][]byte {
+	res := make([][]byte, 0, len(addrs))
+	for _, a := range prev {
+		if slices.ContainsFunc(addrs, func(b []byte) bool { return bytes.Equal(a, b) }) {
+			res = append(res, a)
+		}
+	}
+	kept := len(res)
+	for _, a := range addrs {
+		if !slices.ContainsFunc(res[:kept], func(b []byte) bool { return bytes.Equal(a, b) }) {
+			res = append(res, a)
+		}
+	}
+	slices.SortFunc(res[kept:], bytes.Compare)
+	return slices.CompactFunc(res, bytes.Equal)
+}
@@ -0,0 +1,102 @@
+package relay
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// addrsHost is a host with a settable address list.
+type addrsHost struct {
+	host.Host
+
+	mx    sync.Mutex
+	addrs []ma.Multiaddr
+}
+
+func (h *addrsHost) Addrs() []ma.Multiaddr {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.addrs
+}
+
+func (h *addrsHost) setAddrs(addrs ...string) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.addrs = h.addrs[:0]
+	for _, a := range addrs {
+		h.addrs = append(h.addrs, ma.StringCast(a))
+	}
+}
+
+func TestStableAddrOrder(t *testing.T) {
+	a, b, c, d := []byte("a"), []byte("b"), []byte("c"), []byte("d")
+	for _, tc := range []struct {
+		prev, addrs, expected [][]byte
+	}{
+		{nil, [][]byte{c, a, b}, [][]byte{a, b, c}},
+		{[][]byte{b, c, a}, [][]byte{a, b, c}, [][]byte{b, c, a}},
+		{[][]byte{b, c, a}, [][]byte{d, a, b}, [][]byte{b, a, d}},
+		{[][]byte{c}, [][]byte{b, a, c, b}, [][]byte{c, a, b}},
+		{[][]byte{a, b}, nil, [][]byte{}},
+	} {
+		require.Equal(t, tc.expected, stableAddrOrder(tc.prev, tc.addrs))
+	}
+}
+
+func TestStableReservationAddrs(t *testing.T) {
+	const (
+		a1 = "/ip4/1.1.1.1/tcp/4001"
+		a2 = "/ip4/2.2.2.2/tcp/4001"
+		a3 = "/ip4/3.3.3.3/tcp/4001"
+		a4 = "/ip4/4.4.4.4/tcp/4001"
+	)
+	for _, stable := range []bool{true, false} {
+		name := "unstable"
+		if stable {
+			name = "stable"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, h := hosts[0], hosts[1]
+
+			rh := &addrsHost{Host: relayHost}
+			opts := []Option{WithReservationAddressFilter(func(ma.Multiaddr) bool { return true })}
+			if stable {
+				opts = append(opts, WithStableReservationAddrs())
+			}
+			r, err := New(rh, opts...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			renew := func(addrs ...string) []string {
+				rh.setAddrs(addrs...)
+				rsvp, err := reserve(t, h, relayHost)
+				require.NoError(t, err)
+				res := make([]string, 0, len(rsvp.Addrs))
+				for _, a := range rsvp.Addrs {
+					addr, _ := ma.SplitLast(a)
+					res = append(res, addr.String())
+				}
+				return res
+			}
+
+			if !stable {
+				require.Equal(t, []string{a3, a1, a2}, renew(a3, a1, a2))
+				require.Equal(t, []string{a2, a3, a1}, renew(a2, a3, a1))
+				return
+			}
+			// the first reservation is in canonical order
+			require.Equal(t, []string{a1, a2, a3}, renew(a3, a1, a2))
+			// reordering the host's addresses doesn't change the order
+			require.Equal(t, []string{a1, a2, a3}, renew(a2, a3, a1))
+			// new addresses are appended, removed ones are dropped
+			require.Equal(t, []string{a1, a3, a4}, renew(a4, a3, a1))
+			require.Equal(t, []string{a1, a3, a4, a2}, renew(a2, a4, a3, a1))
+		})
+	}
+}
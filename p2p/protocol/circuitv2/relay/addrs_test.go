@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestAdditionalReservationAddrs(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	_, err := New(relayHost, WithAdditionalReservationAddrs([]ma.Multiaddr{
+		ma.StringCast("/dnsaddr/relay.example.com/p2p/" + h.ID().String()),
+	}))
+	require.Error(t, err)
+
+	r, err := New(relayHost, WithAdditionalReservationAddrs([]ma.Multiaddr{
+		ma.StringCast("/dnsaddr/relay.example.com"),
+		ma.StringCast("/ip4/127.0.0.1/tcp/4001/p2p/" + relayHost.ID().String()),
+	}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	// the host only listens on loopback addresses, which are rejected by the default filter
+	require.ElementsMatch(t, []ma.Multiaddr{
+		ma.StringCast("/dnsaddr/relay.example.com/p2p/" + relayHost.ID().String()),
+		ma.StringCast("/ip4/127.0.0.1/tcp/4001/p2p/" + relayHost.ID().String()),
+	}, rsvp.Addrs)
+}
+
+func TestFallbackReservationAddrs(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	_, err := New(relayHost, WithFallbackAddrs(nil))
+	require.Error(t, err)
+
+	r, err := New(relayHost, WithFallbackAddrs(func() []ma.Multiaddr {
+		return []ma.Multiaddr{
+			ma.StringCast("/ip4/1.2.3.4/tcp/4001"),
+			ma.StringCast("/ip4/1.2.3.5/tcp/4001/p2p/" + h.ID().String()),
+		}
+	}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// the host only listens on loopback addresses, which are rejected by the default filter
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.Equal(t, []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/4001/p2p/" + relayHost.ID().String()),
+	}, rsvp.Addrs)
+}
+
+func TestFallbackReservationAddrsUnused(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	var called atomic.Bool
+	r, err := New(relayHost,
+		WithReservationAddressFilter(func(ma.Multiaddr) bool { return true }),
+		WithFallbackAddrs(func() []ma.Multiaddr {
+			called.Store(true)
+			return []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/4001")}
+		}),
+	)
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.NotEmpty(t, rsvp.Addrs)
+	require.False(t, called.Load())
+	require.NotContains(t, rsvp.Addrs, ma.StringCast("/ip4/1.2.3.4/tcp/4001/p2p/"+relayHost.ID().String()))
+}
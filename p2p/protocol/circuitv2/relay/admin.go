@@ -0,0 +1,246 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// AdminHandler returns an http.Handler that serves the introspection APIs of the relay as JSON:
+//
+//	GET  /stats                      Stats
+//	GET  /config                     Config
+//	GET  /capacity                   ReservationCapacityRemaining
+//	GET  /accepting                  Accepting
+//	GET  /constraints                ConstraintsSnapshot
+//	GET  /refusals                   RecentRefusals
+//	GET  /ratelimited                RateLimited
+//	GET  /pending                    PendingHandshakes
+//	GET  /peers/{peer}/connects      PeerConnectStats
+//	GET  /reservations               Reservations
+//	GET  /circuits                   Circuits
+//	GET  /maintenance                Maintenance
+//
+// With WithAdminControl, it also serves the control APIs of the relay:
+//
+//	POST /pending/close?older_than=d ClosePendingHandshakes, with d a time.Duration string
+//	POST /reservations/{peer}/revoke RevokeReservation
+//	POST /circuits/{id}/close        CloseCircuit
+//	POST /maintenance?enabled=b      SetMaintenance, with b a bool string
+//
+// The POST endpoints revoking a reservation and closing a relayed connection respond with
+// 204 No Content, or 404 Not Found if there is no such reservation or connection.
+//
+// The handler has no access control of its own; it is meant to be served on an operator only
+// listener, or behind an authenticating handler.
+func (r *Relay) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, r.Stats())
+	})
+	mux.HandleFunc("GET /config", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, r.Config())
+	})
+	mux.HandleFunc("GET /capacity", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, adminCapacity{Remaining: r.ReservationCapacityRemaining()})
+	})
+	mux.HandleFunc("GET /accepting", func(w http.ResponseWriter, _ *http.Request) {
+		accepting, reason := r.Accepting()
+		writeAdminJSON(w, adminAccepting{Accepting: accepting, Reason: reason})
+	})
+	mux.HandleFunc("GET /constraints", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, r.ConstraintsSnapshot())
+	})
+	mux.HandleFunc("GET /refusals", func(w http.ResponseWriter, _ *http.Request) {
+		refusals := r.RecentRefusals()
+		resp := make([]adminRefusal, 0, len(refusals))
+		for _, rec := range refusals {
+			resp = append(resp, makeAdminRefusal(rec))
+		}
+		writeAdminJSON(w, resp)
+	})
+	mux.HandleFunc("GET /ratelimited", func(w http.ResponseWriter, _ *http.Request) {
+		peers := r.RateLimited()
+		if peers == nil {
+			peers = []RateLimitedPeer{}
+		}
+		writeAdminJSON(w, peers)
+	})
+	mux.HandleFunc("GET /pending", func(w http.ResponseWriter, _ *http.Request) {
+		pending := r.PendingHandshakes()
+		resp := make([]adminPending, 0, len(pending))
+		for _, info := range pending {
+			resp = append(resp, makeAdminPending(info))
+		}
+		writeAdminJSON(w, resp)
+	})
+	mux.HandleFunc("GET /peers/{peer}/connects", func(w http.ResponseWriter, req *http.Request) {
+		p, err := peer.Decode(req.PathValue("peer"))
+		if err != nil {
+			http.Error(w, "invalid peer ID", http.StatusBadRequest)
+			return
+		}
+		writeAdminJSON(w, r.PeerConnectStats(p))
+	})
+	mux.HandleFunc("GET /reservations", func(w http.ResponseWriter, _ *http.Request) {
+		reservations := r.Reservations()
+		resp := make([]adminReservation, 0, len(reservations))
+		for _, info := range reservations {
+			resp = append(resp, makeAdminReservation(info))
+		}
+		writeAdminJSON(w, resp)
+	})
+	mux.HandleFunc("GET /circuits", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, r.Circuits())
+	})
+	mux.HandleFunc("GET /maintenance", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, adminMaintenance{Maintenance: r.Maintenance()})
+	})
+	if !r.adminControl {
+		return mux
+	}
+	// control endpoints, only served with WithAdminControl
+	mux.HandleFunc("POST /pending/close", func(w http.ResponseWriter, req *http.Request) {
+		olderThan, err := time.ParseDuration(req.URL.Query().Get("older_than"))
+		if err != nil || olderThan < 0 {
+			http.Error(w, "invalid older_than duration", http.StatusBadRequest)
+			return
+		}
+		writeAdminJSON(w, adminClosed{Closed: r.ClosePendingHandshakes(olderThan)})
+	})
+	mux.HandleFunc("POST /reservations/{peer}/revoke", func(w http.ResponseWriter, req *http.Request) {
+		p, err := peer.Decode(req.PathValue("peer"))
+		if err != nil {
+			http.Error(w, "invalid peer ID", http.StatusBadRequest)
+			return
+		}
+		if err := r.RevokeReservation(p); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /circuits/{id}/close", func(w http.ResponseWriter, req *http.Request) {
+		if err := r.CloseCircuit(req.PathValue("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /maintenance", func(w http.ResponseWriter, req *http.Request) {
+		enabled, err := strconv.ParseBool(req.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "invalid enabled bool", http.StatusBadRequest)
+			return
+		}
+		r.SetMaintenance(enabled)
+		writeAdminJSON(w, adminMaintenance{Maintenance: r.Maintenance()})
+	})
+	return mux
+}
+
+type adminCapacity struct {
+	Remaining int
+}
+
+type adminAccepting struct {
+	Accepting bool
+	Reason    string `json:",omitempty"`
+}
+
+type adminClosed struct {
+	Closed int
+}
+
+type adminMaintenance struct {
+	Maintenance bool
+}
+
+// adminReservation is a ReservationInfo with the address spelled out.
+type adminReservation struct {
+	Peer         peer.ID
+	Addr         string `json:",omitempty"`
+	Granted      time.Time
+	Expire       time.Time
+	Disconnected time.Time
+	Tier         string `json:",omitempty"`
+	Session      string `json:",omitempty"`
+}
+
+func makeAdminReservation(info ReservationInfo) adminReservation {
+	ar := adminReservation{
+		Peer:         info.Peer,
+		Granted:      info.Granted,
+		Expire:       info.Expire,
+		Disconnected: info.Disconnected,
+		Tier:         info.Tier,
+		Session:      info.Session,
+	}
+	if info.Addr != nil {
+		ar.Addr = info.Addr.String()
+	}
+	return ar
+}
+
+// adminRefusal is a RefusalRecord with the protobuf enums spelled out.
+type adminRefusal struct {
+	Time        time.Time
+	Type        string
+	Peer        peer.ID
+	Addr        string  `json:",omitempty"`
+	Destination peer.ID `json:",omitempty"`
+	Status      string
+	Reason      string
+	Constraint  string `json:",omitempty"`
+}
+
+func makeAdminRefusal(rec RefusalRecord) adminRefusal {
+	ar := adminRefusal{
+		Time:        rec.Time,
+		Type:        rec.Type.String(),
+		Peer:        rec.Peer,
+		Destination: rec.Destination,
+		Status:      rec.Status.String(),
+		Reason:      rec.Reason,
+		Constraint:  rec.Constraint,
+	}
+	if rec.Addr != nil {
+		ar.Addr = rec.Addr.String()
+	}
+	return ar
+}
+
+// adminPending is a PendingInfo with the protobuf enums spelled out.
+type adminPending struct {
+	Peer    peer.ID
+	Addr    string `json:",omitempty"`
+	Type    string `json:",omitempty"`
+	Started time.Time
+}
+
+func makeAdminPending(info PendingInfo) adminPending {
+	ap := adminPending{Peer: info.Peer, Started: info.Started}
+	if info.Addr != nil {
+		ap.Addr = info.Addr.String()
+	}
+	if info.Type != nil {
+		ap.Type = pbv2.HopMessage_Type_name[int32(*info.Type)]
+	}
+	return ap
+}
+
+func writeAdminJSON(w http.ResponseWriter, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		log.Debug("error writing admin response", "err", err)
+	}
+}
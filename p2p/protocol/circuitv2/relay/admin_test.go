@@ -0,0 +1,229 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func getAdminJSON(t *testing.T, srv *httptest.Server, path string, v any) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+func TestAdminHandler(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, reserved, src, idle := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 4
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+
+	_, err = reserve(t, reserved, relayHost)
+	require.NoError(t, err)
+	// refused for lack of a reservation
+	_, status := connectRaw(t, src, relayHost, idle.ID())
+	require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+
+	var stats Stats
+	getAdminJSON(t, srv, "/stats", &stats)
+	require.Equal(t, 1, stats.Reservations)
+	require.EqualValues(t, 1, stats.Refusals)
+
+	var capacity adminCapacity
+	getAdminJSON(t, srv, "/capacity", &capacity)
+	require.Equal(t, 3, capacity.Remaining)
+
+	var constraints ConstraintsSnapshot
+	getAdminJSON(t, srv, "/constraints", &constraints)
+	require.Equal(t, 1, constraints.Total)
+
+	var refusals []adminRefusal
+	getAdminJSON(t, srv, "/refusals", &refusals)
+	require.Len(t, refusals, 1)
+	require.Equal(t, "CONNECT", refusals[0].Type)
+	require.Equal(t, "NO_RESERVATION", refusals[0].Status)
+	require.Equal(t, src.ID(), refusals[0].Peer)
+	require.Equal(t, idle.ID(), refusals[0].Destination)
+
+	var connects ConnectStats
+	require.Eventually(t, func() bool {
+		getAdminJSON(t, srv, "/peers/"+src.ID().String()+"/connects", &connects)
+		return connects.NoReservation == 1
+	}, time.Second, 10*time.Millisecond)
+
+	resp, err := http.Get(srv.URL + "/peers/foo/connects")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAdminHandlerPending(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithAdminControl())
+	require.NoError(t, err)
+	defer r.Close()
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Reset()
+	// force the protocol negotiation to complete without sending a hop message
+	_, err = s.Write(nil)
+	require.NoError(t, err)
+
+	var pending []adminPending
+	require.Eventually(t, func() bool {
+		getAdminJSON(t, srv, "/pending", &pending)
+		return len(pending) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, h.ID(), pending[0].Peer)
+	require.Empty(t, pending[0].Type)
+
+	// only POST closes pending handshakes
+	resp, err := http.Get(srv.URL + "/pending/close?older_than=0s")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Post(srv.URL+"/pending/close?older_than=foo", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Post(srv.URL+"/pending/close?older_than=1h", "", nil)
+	require.NoError(t, err)
+	var closed adminClosed
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&closed))
+	resp.Body.Close()
+	require.Zero(t, closed.Closed)
+
+	resp, err = http.Post(srv.URL+"/pending/close?older_than=0s", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&closed))
+	resp.Body.Close()
+	require.Equal(t, 1, closed.Closed)
+	require.Empty(t, r.PendingHandshakes())
+}
+
+func TestAdminHandlerControl(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, dest, h := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	r, err := New(relayHost, WithAdminControl())
+	require.NoError(t, err)
+	defer r.Close()
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+	post := func(path string) int {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+
+	var reservations []adminReservation
+	getAdminJSON(t, srv, "/reservations", &reservations)
+	require.Len(t, reservations, 2)
+	require.NotEmpty(t, reservations[0].Addr)
+
+	// revoke a reservation
+	require.Equal(t, http.StatusBadRequest, post("/reservations/foo/revoke"))
+	require.Equal(t, http.StatusNotFound, post("/reservations/"+src.ID().String()+"/revoke"))
+	require.Equal(t, http.StatusNoContent, post("/reservations/"+h.ID().String()+"/revoke"))
+	require.False(t, r.hasReservation(h.ID()))
+	getAdminJSON(t, srv, "/reservations", &reservations)
+	require.Len(t, reservations, 1)
+	require.Equal(t, dest.ID(), reservations[0].Peer)
+
+	// close a relayed connection
+	s, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	require.NoError(t, echo(t, s))
+	var circuits []CircuitInfo
+	getAdminJSON(t, srv, "/circuits", &circuits)
+	require.Len(t, circuits, 1)
+	require.Equal(t, http.StatusNotFound, post("/circuits/foo/close"))
+	require.Equal(t, http.StatusNoContent, post("/circuits/"+circuits[0].ID+"/close"))
+	_, err = s.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.Eventually(t, func() bool { return len(r.Circuits()) == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// toggle maintenance
+	var maintenance adminMaintenance
+	getAdminJSON(t, srv, "/maintenance", &maintenance)
+	require.False(t, maintenance.Maintenance)
+	require.Equal(t, http.StatusBadRequest, post("/maintenance?enabled=foo"))
+	require.Equal(t, http.StatusOK, post("/maintenance?enabled=true"))
+	getAdminJSON(t, srv, "/maintenance", &maintenance)
+	require.True(t, maintenance.Maintenance)
+	require.True(t, r.Maintenance())
+	_, err = reserve(t, h, relayHost)
+	require.Error(t, err)
+	require.Equal(t, http.StatusOK, post("/maintenance?enabled=false"))
+	require.False(t, r.Maintenance())
+}
+
+func TestAdminHandlerReadOnly(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+	var reservations []adminReservation
+	getAdminJSON(t, srv, "/reservations", &reservations)
+	require.Len(t, reservations, 1)
+
+	// the control endpoints are only served with WithAdminControl
+	for _, path := range []string{
+		"/pending/close?older_than=0s",
+		"/reservations/" + h.ID().String() + "/revoke",
+		"/circuits/foo/close",
+		"/maintenance?enabled=true",
+	} {
+		resp, err := http.Post(srv.URL+path, "", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Contains(t, []int{http.StatusNotFound, http.StatusMethodNotAllowed}, resp.StatusCode, path)
+	}
+	require.True(t, r.hasReservation(h.ID()))
+	require.False(t, r.Maintenance())
+}
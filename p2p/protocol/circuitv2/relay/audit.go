@@ -0,0 +1,271 @@
+package relay
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// auditQueueSize is the number of audit events buffered for the AuditLogger. Events are dropped
+// when the queue is full.
+const auditQueueSize = 1024
+
+// AuditEvent describes a decision taken by the relay on a reservation or connection request.
+type AuditEvent struct {
+	// Time is when the decision was taken.
+	Time time.Time
+	// Peer is the peer that sent the request.
+	Peer peer.ID
+	// Addr is the address of the peer that sent the request.
+	Addr ma.Multiaddr
+	// Destination is the requested destination of a connection, if known.
+	Destination peer.ID
+	// Status is the status the relay responded with.
+	Status pbv2.Status
+	// Reason is a human readable reason for denying the request.
+	Reason string
+	// Limit is the limit the relay enforces on an allowed or established connection, or nil if
+	// the connection is unlimited. It is the value the deadlines and data limits of the
+	// connection are derived from, and must not be modified.
+	Limit *RelayLimit
+	// Expire is when a granted reservation expires.
+	Expire time.Time
+	// Voucher is the marshaled signed envelope of the reservation voucher handed to the peer of
+	// a granted reservation, or nil if sealing the voucher failed. It must not be modified.
+	Voucher []byte
+	// Session is the session ID of the reservation the request was handled with, if any: the
+	// peer's reservation for reservation events, and the destination's reservation for
+	// connection events.
+	Session string
+}
+
+// AuditLogger records the decisions taken by the relay, for an audit trail. Unlike metrics, every
+// decision is recorded individually. The methods are called from a single goroutine, in the order
+// the decisions were taken.
+type AuditLogger interface {
+	// ReservationGranted is called when a reservation is granted or renewed.
+	ReservationGranted(ev AuditEvent)
+	// ReservationDenied is called when a reservation request is refused.
+	ReservationDenied(ev AuditEvent)
+	// ConnectionAllowed is called when a connection request is accepted, before the relay
+	// connects to the destination.
+	ConnectionAllowed(ev AuditEvent)
+	// ConnectionDenied is called when a connection request is refused.
+	ConnectionDenied(ev AuditEvent)
+}
+
+// EstablishedAuditLogger is an optional interface for AuditLoggers that also record relayed
+// connections once they are established.
+type EstablishedAuditLogger interface {
+	AuditLogger
+	// ConnectionEstablished is called when the relay starts relaying data for a connection.
+	// The time of the event is the start of the connection's duration limit.
+	ConnectionEstablished(ev AuditEvent)
+}
+
+// ClosedAuditLogger is an optional interface for AuditLoggers that also record relayed
+// connections once they end.
+type ClosedAuditLogger interface {
+	AuditLogger
+	// ConnectionClosed is called when the relay stops relaying data for a connection in both
+	// directions. The time of the event is when the connection ended.
+	ConnectionClosed(ev AuditEvent)
+}
+
+type auditEventType int
+
+const (
+	auditReservationGranted auditEventType = iota
+	auditReservationDenied
+	auditConnectionAllowed
+	auditConnectionDenied
+	auditConnectionEstablished
+	auditConnectionClosed
+)
+
+type auditEntry struct {
+	typ auditEventType
+	ev  AuditEvent
+}
+
+// auditQueue delivers audit events to the AuditLogger from a background goroutine, so that a slow
+// logger doesn't block the relay.
+type auditQueue struct {
+	logger AuditLogger
+	// established is set if the logger records established connections.
+	established bool
+	// ended is set if the logger records closed connections.
+	ended bool
+
+	mx     sync.RWMutex
+	closed bool
+	queue  chan auditEntry
+	done   chan struct{}
+}
+
+func newAuditQueue(logger AuditLogger, size int) *auditQueue {
+	q := &auditQueue{
+		logger: logger,
+		queue:  make(chan auditEntry, size),
+		done:   make(chan struct{}),
+	}
+	_, q.established = logger.(EstablishedAuditLogger)
+	_, q.ended = logger.(ClosedAuditLogger)
+	go q.run()
+	return q
+}
+
+func (q *auditQueue) run() {
+	defer close(q.done)
+	for e := range q.queue {
+		switch e.typ {
+		case auditReservationGranted:
+			q.logger.ReservationGranted(e.ev)
+		case auditReservationDenied:
+			q.logger.ReservationDenied(e.ev)
+		case auditConnectionAllowed:
+			q.logger.ConnectionAllowed(e.ev)
+		case auditConnectionDenied:
+			q.logger.ConnectionDenied(e.ev)
+		case auditConnectionEstablished:
+			q.logger.(EstablishedAuditLogger).ConnectionEstablished(e.ev)
+		case auditConnectionClosed:
+			q.logger.(ClosedAuditLogger).ConnectionClosed(e.ev)
+		}
+	}
+}
+
+// add queues an event, returning false if it was dropped because the queue is full.
+// Events added after Close are discarded.
+func (q *auditQueue) add(typ auditEventType, ev AuditEvent) bool {
+	q.mx.RLock()
+	defer q.mx.RUnlock()
+	if q.closed || (typ == auditConnectionEstablished && !q.established) || (typ == auditConnectionClosed && !q.ended) {
+		return true
+	}
+	select {
+	case q.queue <- auditEntry{typ: typ, ev: ev}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting events and waits for the queued events to be delivered.
+func (q *auditQueue) Close() {
+	q.mx.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mx.Unlock()
+	<-q.done
+}
+
+func (r *Relay) audit(typ auditEventType, ev AuditEvent) {
+	if r.auditQueue == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if !r.auditQueue.add(typ, ev) {
+		log.Debug("dropped audit event", "remote_peer", ev.Peer)
+		if mt, ok := r.metricsTracer.(FailureMetricsTracer); ok {
+			mt.AuditEventDropped()
+		}
+	}
+}
+
+func (r *Relay) auditRefusal(rec RefusalRecord) {
+	typ := auditReservationDenied
+	if rec.Type == pbv2.HopMessage_CONNECT {
+		typ = auditConnectionDenied
+	}
+	r.audit(typ, AuditEvent{
+		Time:        rec.Time,
+		Peer:        rec.Peer,
+		Addr:        rec.Addr,
+		Destination: rec.Destination,
+		Status:      rec.Status,
+		Reason:      rec.Reason,
+	})
+}
+
+// FileAuditLogger is an AuditLogger appending the events to a file, as JSON objects separated
+// by newlines.
+type FileAuditLogger struct {
+	mx  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+var _ AuditLogger = (*FileAuditLogger)(nil)
+
+// NewFileAuditLogger creates an AuditLogger appending to the file at path, which is created if
+// it doesn't exist. The caller is responsible for closing the logger after closing the relay.
+func NewFileAuditLogger(path string) (*FileAuditLogger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditLogger{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+type fileAuditRecord struct {
+	Time        time.Time  `json:"time"`
+	Event       string     `json:"event"`
+	Peer        string     `json:"peer"`
+	Addr        string     `json:"addr,omitempty"`
+	Destination string     `json:"destination,omitempty"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason,omitempty"`
+	Expire      *time.Time `json:"expire,omitempty"`
+	Voucher     []byte     `json:"voucher,omitempty"`
+	Session     string     `json:"session,omitempty"`
+}
+
+func (l *FileAuditLogger) write(event string, ev AuditEvent) {
+	rec := fileAuditRecord{
+		Time:   ev.Time,
+		Event:  event,
+		Peer:   ev.Peer.String(),
+		Status: ev.Status.String(),
+		Reason: ev.Reason,
+	}
+	if ev.Addr != nil {
+		rec.Addr = ev.Addr.String()
+	}
+	if ev.Destination != "" {
+		rec.Destination = ev.Destination.String()
+	}
+	if !ev.Expire.IsZero() {
+		rec.Expire = &ev.Expire
+	}
+	rec.Voucher = ev.Voucher
+	rec.Session = ev.Session
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if err := l.enc.Encode(rec); err != nil {
+		log.Warn("error writing audit log", "err", err)
+	}
+}
+
+func (l *FileAuditLogger) ReservationGranted(ev AuditEvent) { l.write("reservation_granted", ev) }
+func (l *FileAuditLogger) ReservationDenied(ev AuditEvent)  { l.write("reservation_denied", ev) }
+func (l *FileAuditLogger) ConnectionAllowed(ev AuditEvent)  { l.write("connection_allowed", ev) }
+func (l *FileAuditLogger) ConnectionDenied(ev AuditEvent)   { l.write("connection_denied", ev) }
+
+// Close closes the underlying file.
+func (l *FileAuditLogger) Close() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.f.Close()
+}
@@ -0,0 +1,285 @@
+package relay
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type recordedAuditEvent struct {
+	event string
+	ev    AuditEvent
+}
+
+type recordingAuditLogger struct {
+	mx     sync.Mutex
+	events []recordedAuditEvent
+	// block, if not nil, blocks delivery until closed
+	block chan struct{}
+}
+
+func (l *recordingAuditLogger) record(event string, ev AuditEvent) {
+	if l.block != nil {
+		<-l.block
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.events = append(l.events, recordedAuditEvent{event: event, ev: ev})
+}
+
+func (l *recordingAuditLogger) Events() []recordedAuditEvent {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return append([]recordedAuditEvent(nil), l.events...)
+}
+
+func (l *recordingAuditLogger) ReservationGranted(ev AuditEvent) { l.record("reservation granted", ev) }
+func (l *recordingAuditLogger) ReservationDenied(ev AuditEvent)  { l.record("reservation denied", ev) }
+func (l *recordingAuditLogger) ConnectionAllowed(ev AuditEvent)  { l.record("connection allowed", ev) }
+func (l *recordingAuditLogger) ConnectionDenied(ev AuditEvent)   { l.record("connection denied", ev) }
+
+type establishedAuditLogger struct {
+	recordingAuditLogger
+}
+
+func (l *establishedAuditLogger) ConnectionEstablished(ev AuditEvent) {
+	l.record("connection established", ev)
+}
+
+type auditDropMetricsTracer struct {
+	metricsTracer
+
+	mx      sync.Mutex
+	dropped int
+}
+
+func (mt *auditDropMetricsTracer) AuditEventDropped() {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.dropped++
+}
+
+func TestAuditLogger(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, dest, denied := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	l := &recordingAuditLogger{}
+	rc := DefaultResources()
+	rc.MaxReservations = 1
+	r, err := New(relayHost, WithResources(rc), WithAuditLogger(l))
+	require.NoError(t, err)
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, denied, relayHost)
+	require.Error(t, err)
+
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	_, status = connectRaw(t, src, relayHost, denied.ID())
+	require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+
+	// closing the relay flushes the queued events
+	r.Close()
+	events := l.Events()
+	require.Len(t, events, 4)
+
+	require.Equal(t, "reservation granted", events[0].event)
+	require.Equal(t, dest.ID(), events[0].ev.Peer)
+	require.NotNil(t, events[0].ev.Addr)
+	require.Equal(t, pbv2.Status_OK, events[0].ev.Status)
+
+	require.Equal(t, "reservation denied", events[1].event)
+	require.Equal(t, denied.ID(), events[1].ev.Peer)
+	require.Equal(t, pbv2.Status_RESERVATION_REFUSED, events[1].ev.Status)
+	require.NotEmpty(t, events[1].ev.Reason)
+
+	require.Equal(t, "connection allowed", events[2].event)
+	require.Equal(t, src.ID(), events[2].ev.Peer)
+	require.Equal(t, dest.ID(), events[2].ev.Destination)
+	require.NotNil(t, events[2].ev.Addr)
+
+	require.Equal(t, "connection denied", events[3].event)
+	require.Equal(t, src.ID(), events[3].ev.Peer)
+	require.Equal(t, denied.ID(), events[3].ev.Destination)
+	require.Equal(t, pbv2.Status_NO_RESERVATION, events[3].ev.Status)
+	require.Equal(t, "no reservation", events[3].ev.Reason)
+
+	for i := 1; i < len(events); i++ {
+		require.False(t, events[i].ev.Time.Before(events[i-1].ev.Time))
+	}
+}
+
+func TestAuditConnectionEstablished(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	l := &establishedAuditLogger{}
+	rc := DefaultResources()
+	rc.Limit = &RelayLimit{Duration: 500 * time.Millisecond, Data: 1 << 20}
+	r, err := New(relayHost, WithResources(rc), WithAuditLogger(l))
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	s, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	var established AuditEvent
+	require.Eventually(t, func() bool {
+		events := l.Events()
+		if len(events) != 3 {
+			return false
+		}
+		established = events[2].ev
+		return events[2].event == "connection established"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Same(t, rc.Limit, established.Limit)
+	require.Same(t, rc.Limit, l.Events()[1].ev.Limit)
+
+	// the circuit is closed when the deadline derived from the event's limit passes
+	_, err = s.Read(make([]byte, 1))
+	require.Error(t, err)
+	deadline := established.Time.Add(established.Limit.Duration)
+	require.False(t, time.Now().Before(deadline))
+	require.WithinDuration(t, deadline, time.Now(), time.Second)
+}
+
+func TestAuditQueueDrops(t *testing.T) {
+	l := &recordingAuditLogger{block: make(chan struct{})}
+	mt := &auditDropMetricsTracer{}
+	r := &Relay{metricsTracer: mt, auditQueue: newAuditQueue(l, 2)}
+
+	// the first event is picked up by the delivery goroutine, which blocks on it
+	r.audit(auditReservationGranted, AuditEvent{Reason: "0"})
+	require.Eventually(t, func() bool { return len(r.auditQueue.queue) == 0 }, time.Second, time.Millisecond)
+	for i := 1; i <= 4; i++ {
+		r.audit(auditReservationGranted, AuditEvent{Reason: string(rune('0' + i))})
+	}
+	mt.mx.Lock()
+	require.Equal(t, 2, mt.dropped)
+	mt.mx.Unlock()
+
+	close(l.block)
+	r.auditQueue.Close()
+	var reasons []string
+	for _, e := range l.Events() {
+		reasons = append(reasons, e.ev.Reason)
+	}
+	require.Equal(t, []string{"0", "1", "2"}, reasons)
+
+	// events after closing are discarded
+	r.audit(auditReservationGranted, AuditEvent{})
+	require.Len(t, l.Events(), 3)
+}
+
+func TestFileAuditLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	now := time.Now().UTC()
+
+	write := func() {
+		l, err := NewFileAuditLogger(path)
+		require.NoError(t, err)
+		l.ReservationGranted(AuditEvent{Time: now, Peer: p1, Addr: addr, Status: pbv2.Status_OK})
+		l.ConnectionDenied(AuditEvent{Time: now, Peer: p2, Addr: addr, Destination: p1, Status: pbv2.Status_NO_RESERVATION, Reason: "no reservation"})
+		require.NoError(t, l.Close())
+	}
+	// the log is appended to
+	write()
+	write()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var recs []fileAuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec fileAuditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		recs = append(recs, rec)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, recs, 4)
+
+	require.Equal(t, fileAuditRecord{
+		Time:   now,
+		Event:  "reservation_granted",
+		Peer:   p1.String(),
+		Addr:   addr.String(),
+		Status: "OK",
+	}, recs[0])
+	require.Equal(t, fileAuditRecord{
+		Time:        now,
+		Event:       "connection_denied",
+		Peer:        p2.String(),
+		Addr:        addr.String(),
+		Destination: p1.String(),
+		Status:      "NO_RESERVATION",
+		Reason:      "no reservation",
+	}, recs[1])
+	require.Equal(t, recs[:2], recs[2:])
+}
+
+func TestAuditReservationVoucher(t *testing.T) {
+	for _, sealed := range []bool{true, false} {
+		name := "sealed"
+		if !sealed {
+			name = "seal failed"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, h := hosts[0], hosts[1]
+
+			l := &recordingAuditLogger{}
+			var rh host.Host = relayHost
+			if !sealed {
+				rh = &noKeyHost{Host: relayHost}
+			}
+			r, err := New(rh, WithAuditLogger(l))
+			require.NoError(t, err)
+
+			_, err = reserve(t, h, relayHost)
+			require.NoError(t, err)
+			r.Close()
+
+			events := l.Events()
+			require.Len(t, events, 1)
+			ev := events[0].ev
+			require.Equal(t, "reservation granted", events[0].event)
+			require.False(t, ev.Expire.IsZero())
+			if !sealed {
+				require.Nil(t, ev.Voucher)
+				return
+			}
+
+			// the voucher is signed by the relay, for the reserving peer
+			env, rec, err := record.ConsumeEnvelope(ev.Voucher, proto.RecordDomain)
+			require.NoError(t, err)
+			require.True(t, env.PublicKey.Equals(relayHost.Peerstore().PubKey(relayHost.ID())))
+			voucher, ok := rec.(*proto.ReservationVoucher)
+			require.True(t, ok)
+			require.Equal(t, relayHost.ID(), voucher.Relay)
+			require.Equal(t, h.ID(), voucher.Peer)
+			require.Equal(t, ev.Expire.Unix(), voucher.Expiration.Unix())
+		})
+	}
+}
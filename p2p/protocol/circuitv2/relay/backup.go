@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// makeBackupRelayMsgs returns the backup relays to advertise in reservations. Backups with an
+// invalid peer ID, duplicates, and the relay itself are skipped, as are addresses containing the
+// ID of a different peer. Backups without any address left are skipped altogether.
+func makeBackupRelayMsgs(selfID peer.ID, backups []peer.AddrInfo) []*pbv2.Peer {
+	if len(backups) == 0 {
+		return nil
+	}
+	msgs := make([]*pbv2.Peer, 0, len(backups))
+	seen := make(map[peer.ID]struct{}, len(backups))
+	for _, b := range backups {
+		if err := b.ID.Validate(); err != nil {
+			log.Warn("skipping backup relay", "peer", b.ID, "reason", "invalid peer ID", "err", err)
+			continue
+		}
+		if b.ID == selfID {
+			log.Warn("skipping backup relay", "peer", b.ID, "reason", "backup is this relay")
+			continue
+		}
+		if _, ok := seen[b.ID]; ok {
+			continue
+		}
+
+		addrs := make([]ma.Multiaddr, 0, len(b.Addrs))
+		for _, addr := range b.Addrs {
+			if addr == nil {
+				continue
+			}
+			if id, _ := peer.IDFromP2PAddr(addr); id != "" && id != b.ID {
+				log.Warn("skipping backup relay address", "peer", b.ID, "addr", addr, "reason", "contains an unexpected ID")
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+		if len(addrs) == 0 {
+			log.Warn("skipping backup relay", "peer", b.ID, "reason", "no valid addresses")
+			continue
+		}
+		seen[b.ID] = struct{}{}
+		msgs = append(msgs, util.PeerInfoToPeerV2(peer.AddrInfo{ID: b.ID, Addrs: addrs}))
+	}
+	return msgs
+}
@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestBackupRelays(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	_, backup := genKeyAndID(t)
+	_, other := genKeyAndID(t)
+	backupAddr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	backupP2PAddr := ma.StringCast("/ip4/1.2.3.4/tcp/1235/p2p/" + backup.String())
+	otherP2PAddr := ma.StringCast("/ip4/1.2.3.4/tcp/1236/p2p/" + other.String())
+
+	r, err := New(relayHost, WithBackupRelays([]peer.AddrInfo{
+		{ID: backup, Addrs: []ma.Multiaddr{backupAddr, backupP2PAddr, otherP2PAddr}},
+		// duplicate
+		{ID: backup, Addrs: []ma.Multiaddr{backupAddr}},
+		// invalid peer ID
+		{ID: "", Addrs: []ma.Multiaddr{backupAddr}},
+		// the relay itself
+		{ID: relayHost.ID(), Addrs: relayHost.Addrs()},
+		// only addresses of a different peer
+		{ID: other, Addrs: []ma.Multiaddr{backupP2PAddr}},
+	}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.Len(t, rsvp.BackupRelays, 1)
+	require.Equal(t, backup, rsvp.BackupRelays[0].ID)
+	require.Equal(t, []ma.Multiaddr{backupAddr, backupP2PAddr}, rsvp.BackupRelays[0].Addrs)
+}
+
+func TestNoBackupRelays(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.Empty(t, rsvp.BackupRelays)
+}
@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// BandwidthRecorder is implemented by resource scopes that account for transferred bytes.
+// The scopes of the default resource manager implement it, see rcmgr.ResourceScopeBandwidth.
+type BandwidthRecorder interface {
+	// RecordBandwidth records size bytes transferred in the given direction.
+	RecordBandwidth(dir network.Direction, size int)
+}
+
+// bytesAccounter returns a function accounting for bytes relayed from src to dest, or nil if
+// relayed bytes need no accounting beyond the metrics tracer.
+func (r *Relay) bytesAccounter(src, dest network.Stream) func(n int) {
+	var srcRec, destRec BandwidthRecorder
+	if r.scopeBandwidth {
+		srcRec, _ = src.Scope().(BandwidthRecorder)
+		destRec, _ = dest.Scope().(BandwidthRecorder)
+	}
+	reporter := r.bwReporter
+	if srcRec == nil && destRec == nil && reporter == nil {
+		return nil
+	}
+
+	srcPeer, srcProto := src.Conn().RemotePeer(), src.Protocol()
+	destPeer, destProto := dest.Conn().RemotePeer(), dest.Protocol()
+	return func(n int) {
+		if srcRec != nil {
+			srcRec.RecordBandwidth(network.DirInbound, n)
+		}
+		if destRec != nil {
+			destRec.RecordBandwidth(network.DirOutbound, n)
+		}
+		if reporter != nil {
+			reporter.LogRecvMessage(int64(n))
+			reporter.LogRecvMessageStream(int64(n), srcProto, srcPeer)
+			reporter.LogSentMessage(int64(n))
+			reporter.LogSentMessageStream(int64(n), destProto, destPeer)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package relay
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/stretchr/testify/require"
+)
+
+var _ BandwidthRecorder = rcmgr.ResourceScopeBandwidth(nil)
+
+func TestScopeBandwidthAccounting(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		name := "disabled"
+		if enabled {
+			name = "enabled"
+		}
+		t.Run(name, func(t *testing.T) {
+			rm, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(rcmgr.InfiniteLimits))
+			require.NoError(t, err)
+			defer rm.Close()
+			relayHost := getTestHosts(t, 1, swarmt.WithSwarmOpts(swarm.WithResourceManager(rm)))[0]
+			hosts := getTestHosts(t, 2)
+			src, dest := hosts[0], hosts[1]
+			addCircuitTransport(t, src)
+			addCircuitTransport(t, dest)
+
+			var opts []Option
+			if enabled {
+				opts = append(opts, WithScopeBandwidthAccounting())
+			}
+			r, err := New(relayHost, opts...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			msg := []byte("relayed bytes")
+			done := make(chan struct{})
+			dest.SetStreamHandler("test", func(s network.Stream) {
+				defer close(done)
+				io.ReadAll(s)
+				s.Close()
+			})
+			s, err := openCircuit(t, src, dest, relayHost, "test")
+			require.NoError(t, err)
+			_, err = s.Write(msg)
+			require.NoError(t, err)
+			s.CloseWrite()
+			<-done
+			io.ReadAll(s)
+
+			// relayed bytes are received from src and sent to dest
+			peerBandwidth := func(p peer.ID) (in, out int64) {
+				require.NoError(t, rm.ViewPeer(p, func(s network.PeerScope) error {
+					in, out = s.(rcmgr.ResourceScopeBandwidth).Bandwidth()
+					return nil
+				}))
+				return in, out
+			}
+			if enabled {
+				require.Eventually(t, func() bool {
+					srcIn, _ := peerBandwidth(src.ID())
+					_, destOut := peerBandwidth(dest.ID())
+					return srcIn >= int64(len(msg)) && destOut >= int64(len(msg))
+				}, time.Second, 10*time.Millisecond)
+			} else {
+				srcIn, srcOut := peerBandwidth(src.ID())
+				destIn, destOut := peerBandwidth(dest.ID())
+				require.Zero(t, srcIn+srcOut+destIn+destOut)
+			}
+		})
+	}
+}
+
+func TestBandwidthReporter(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+	addCircuitTransport(t, src)
+	addCircuitTransport(t, dest)
+
+	reporter := metrics.NewBandwidthCounter()
+	r, err := New(relayHost, WithBandwidthReporter(reporter))
+	require.NoError(t, err)
+	defer r.Close()
+
+	msg := []byte("relayed bytes")
+	reply := []byte("relayed reply bytes")
+	dest.SetStreamHandler("test", func(s network.Stream) {
+		io.ReadAll(s)
+		s.Write(reply)
+		s.Close()
+	})
+	s, err := openCircuit(t, src, dest, relayHost, "test")
+	require.NoError(t, err)
+	_, err = s.Write(msg)
+	require.NoError(t, err)
+	s.CloseWrite()
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, reply, b)
+
+	// the relayed connection carries the security handshake and protocol negotiation on top of
+	// the payload
+	require.Eventually(t, func() bool {
+		srcStats := reporter.GetBandwidthForPeer(src.ID())
+		destStats := reporter.GetBandwidthForPeer(dest.ID())
+		hop := reporter.GetBandwidthForProtocol(proto.ProtoIDv2Hop)
+		stop := reporter.GetBandwidthForProtocol(proto.ProtoIDv2Stop)
+		totals := reporter.GetBandwidthTotals()
+		return srcStats.TotalIn >= int64(len(msg)) && srcStats.TotalOut >= int64(len(reply)) &&
+			srcStats.TotalIn == destStats.TotalOut && srcStats.TotalOut == destStats.TotalIn &&
+			hop.TotalIn == srcStats.TotalIn && hop.TotalOut == srcStats.TotalOut &&
+			stop.TotalIn == destStats.TotalIn && stop.TotalOut == destStats.TotalOut &&
+			totals.TotalIn == srcStats.TotalIn+destStats.TotalIn && totals.TotalOut == totals.TotalIn
+	}, 5*time.Second, 50*time.Millisecond)
+}
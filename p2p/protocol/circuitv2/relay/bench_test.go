@@ -0,0 +1,190 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+// The benchmarks in this file measure the relay's handshake and data paths over loopback TCP
+// connections, to catch performance regressions. Run them with
+//
+//	go test -run '^$' -bench 'Reserve|Connect|CircuitThroughput|Disconnect' ./p2p/protocol/circuitv2/relay
+//
+// Baseline numbers, with GOMAXPROCS=1 on an x86-64 Linux VM:
+//
+//	BenchmarkReserve            ~5200 reservations/s   ~190 µs/op   165 allocs/op
+//	BenchmarkConnect            ~4500 circuits/s       ~220 µs/op   254 allocs/op
+//	BenchmarkCircuitThroughput  ~110 MB/s              ~300 µs/op   1 allocs/op (32 KiB echoed per op)
+//	BenchmarkDisconnect/sync                           ~1.6 µs/op   3 allocs/op
+//	BenchmarkDisconnect/batched                        ~0.5 µs/op   1 allocs/op
+
+// getBenchHosts returns n hosts connected to the first one, the relay host.
+func getBenchHosts(b *testing.B, n int) []host.Host {
+	b.Helper()
+	hosts := getTestHosts(b, n)
+	for _, h := range hosts[1:] {
+		if err := h.Connect(context.Background(), peer.AddrInfo{ID: hosts[0].ID(), Addrs: hosts[0].Addrs()}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return hosts
+}
+
+// benchResources returns resources that don't limit the number of circuits set up by a
+// benchmark, as circuits are released asynchronously.
+func benchResources() Resources {
+	rc := DefaultResources()
+	rc.MaxCircuits = 1 << 20
+	return rc
+}
+
+// benchConnect sends a CONNECT message for dest to the relay host on a new stream, and returns
+// the stream and the response status.
+func benchConnect(b *testing.B, src, relayHost host.Host, dest peer.ID) (network.Stream, pbv2.Status) {
+	b.Helper()
+	s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg := &pbv2.HopMessage{
+		Type: pbv2.HopMessage_CONNECT.Enum(),
+		Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest}),
+	}
+	if err := util.NewDelimitedWriter(s).WriteMsg(msg); err != nil {
+		b.Fatal(err)
+	}
+	rd := util.NewDelimitedReader(s, maxMessageSize)
+	defer rd.Close()
+	var resp pbv2.HopMessage
+	if err := rd.ReadMsg(&resp); err != nil {
+		b.Fatal(err)
+	}
+	return s, resp.GetStatus()
+}
+
+func BenchmarkReserve(b *testing.B) {
+	hosts := getBenchHosts(b, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithResources(benchResources()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID()}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := client.Reserve(context.Background(), h, rinfo); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "reservations/s")
+}
+
+func BenchmarkConnect(b *testing.B) {
+	hosts := getBenchHosts(b, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost, WithResources(benchResources()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	handleStopEcho(dest)
+	if _, err := client.Reserve(context.Background(), dest, peer.AddrInfo{ID: relayHost.ID()}); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		s, status := benchConnect(b, src, relayHost, dest.ID())
+		if status != pbv2.Status_OK {
+			b.Fatalf("unexpected status: %s", status)
+		}
+		s.Reset()
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "circuits/s")
+}
+
+func BenchmarkCircuitThroughput(b *testing.B) {
+	const size = 32 << 10
+
+	hosts := getBenchHosts(b, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	rc := benchResources()
+	rc.Limit = nil
+	r, err := New(relayHost, WithResources(rc))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	handleStopEcho(dest)
+	if _, err := client.Reserve(context.Background(), dest, peer.AddrInfo{ID: relayHost.ID()}); err != nil {
+		b.Fatal(err)
+	}
+	s, status := benchConnect(b, src, relayHost, dest.ID())
+	if status != pbv2.Status_OK {
+		b.Fatalf("unexpected status: %s", status)
+	}
+	defer s.Reset()
+
+	data := make([]byte, size)
+	buf := make([]byte, size)
+	b.SetBytes(size)
+	b.ReportAllocs()
+	for b.Loop() {
+		go s.Write(data)
+		if _, err := io.ReadFull(s, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDisconnect measures processing peer disconnects, while the disconnected peers keep
+// reserving again, to compare processing them one by one with batching them.
+func BenchmarkDisconnect(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "sync"},
+		{name: "batched", opts: []Option{WithDisconnectBatching(10 * time.Millisecond)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			h := getTestHosts(b, 1)[0]
+			r, err := New(h, bc.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+
+			ps := r.addChurnReservations(b, 1024)
+			var next atomic.Uint64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					p := ps[next.Add(1)%uint64(len(ps))]
+					r.mx.Lock()
+					r.rsvp[p] = reservation{expire: time.Now().Add(time.Hour)}
+					r.mx.Unlock()
+					r.disconnected(churnNetwork{}, &churnConn{p: p})
+				}
+			})
+		})
+	}
+}
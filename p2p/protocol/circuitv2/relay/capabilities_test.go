@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestReservationCapabilities(t *testing.T) {
+	tcs := []struct {
+		name     string
+		caps     proto.Capabilities
+		expected proto.Capabilities
+	}{
+		{name: "none", caps: 0, expected: 0},
+		{name: "trace ID", caps: proto.CapabilityTraceID, expected: proto.CapabilityTraceID},
+		{name: "unknown", caps: 1 << 40, expected: 0},
+		{name: "known and unknown", caps: proto.CapabilityTraceID | 1<<40, expected: proto.CapabilityTraceID},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			r, err := New(relayHost)
+			require.NoError(t, err)
+			defer r.Close()
+
+			addCircuitTransport(t, dest)
+			rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+			require.NoError(t, dest.Connect(context.Background(), rinfo))
+			rsvp, err := client.Reserve(context.Background(), dest, rinfo, client.WithCapabilities(tc.caps))
+			require.NoError(t, err)
+			require.Equal(t, proto.SupportedCapabilities, rsvp.Capabilities)
+
+			r.mx.Lock()
+			caps := r.rsvp[dest.ID()].caps
+			r.mx.Unlock()
+			require.Equal(t, tc.expected, caps)
+
+			// the trace ID is only forwarded to destinations supporting it
+			require.NoError(t, src.Connect(context.Background(), rinfo))
+			c, err := client.New(src, swarmt.GenUpgrader(t, src.Network().(*swarm.Swarm), nil))
+			require.NoError(t, err)
+			raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", relayHost.ID(), dest.ID()))
+			conn, err := c.Dial(util.ContextWithTraceID(context.Background(), "trace"), raddr, dest.ID())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			require.Eventually(t, func() bool { return len(dest.Network().ConnsToPeer(src.ID())) > 0 }, 5*time.Second, 10*time.Millisecond)
+			traceID, ok := dest.Network().ConnsToPeer(src.ID())[0].Stat().Extra[client.StatTraceID]
+			if tc.expected.Has(proto.CapabilityTraceID) {
+				require.Equal(t, "trace", traceID)
+			} else {
+				require.False(t, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// captureQueueSize is the number of captured chunks queued for writing per circuit. Chunks are
+// dropped rather than blocking the relayed connection when the queue is full.
+const captureQueueSize = 64
+
+const (
+	// MaxConcurrentCaptures is the number of relayed connections captured at the same time.
+	// Relayed connections established while as many are being captured aren't captured.
+	MaxConcurrentCaptures = 16
+	// MaxCaptureFiles is the number of capture files written by a relay. Once reached, no more
+	// relayed connections are captured.
+	MaxCaptureFiles = 1000
+)
+
+// captureConfig configures capturing relayed traffic.
+type captureConfig struct {
+	dir                string
+	maxBytesPerCircuit int
+	maxConcurrent      int32
+	maxFiles           int32
+
+	active atomic.Int32 // captures being written
+	files  atomic.Int32 // capture files created
+}
+
+// CaptureRecord is a chunk of relayed traffic, written as a line of JSON to capture files.
+type CaptureRecord struct {
+	// Time is when the chunk was relayed.
+	Time time.Time
+	// From is the peer that sent the chunk.
+	From peer.ID
+	// To is the peer the chunk was relayed to.
+	To peer.ID
+	// Data is the relayed chunk.
+	Data []byte
+}
+
+// circuitCapture writes the traffic captured from a circuit to a file in the background.
+type circuitCapture struct {
+	cfg     *captureConfig
+	records chan CaptureRecord
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+// captureDirection captures the first bytes relayed in one direction of a circuit. A nil
+// captureDirection captures nothing. It is not safe for concurrent use; each direction is relayed
+// by a single goroutine.
+type captureDirection struct {
+	c         *circuitCapture
+	from, to  peer.ID
+	remaining int
+}
+
+// startCapture starts capturing the traffic of the circuit between src and dest, returning the
+// capture of either direction. It returns nils if capturing is disabled, at its limits, or fails.
+func (r *Relay) startCapture(src, dest peer.ID) (*circuitCapture, *captureDirection, *captureDirection) {
+	cfg := r.capture
+	if cfg == nil {
+		return nil, nil, nil
+	}
+	if cfg.active.Add(1) > cfg.maxConcurrent {
+		cfg.active.Add(-1)
+		log.Debug("not capturing relayed connection", "reason", "too many concurrent captures")
+		return nil, nil, nil
+	}
+	if cfg.files.Add(1) > cfg.maxFiles {
+		cfg.active.Add(-1)
+		log.Debug("not capturing relayed connection", "reason", "too many capture files")
+		return nil, nil, nil
+	}
+	name := fmt.Sprintf("%d-%s-%s.jsonl", time.Now().UnixNano(), src, dest)
+	// the capture contains the traffic of the relay's users, so only the relay's user may read it
+	f, err := os.OpenFile(filepath.Join(cfg.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		cfg.active.Add(-1)
+		cfg.files.Add(-1)
+		log.Warn("failed to create relay capture file", "dir", cfg.dir, "err", err)
+		return nil, nil, nil
+	}
+
+	c := &circuitCapture{
+		cfg:     cfg,
+		records: make(chan CaptureRecord, captureQueueSize),
+		done:    make(chan struct{}),
+	}
+	go c.write(f)
+	size := cfg.maxBytesPerCircuit
+	return c, &captureDirection{c: c, from: src, to: dest, remaining: size},
+		&captureDirection{c: c, from: dest, to: src, remaining: size}
+}
+
+// record captures b, up to the remaining capture size. It never blocks: b is dropped if the
+// writer falls behind.
+func (d *captureDirection) record(b []byte) {
+	if d == nil || d.remaining <= 0 {
+		return
+	}
+	b = b[:min(len(b), d.remaining)]
+	d.remaining -= len(b)
+	select {
+	case d.c.records <- CaptureRecord{Time: time.Now(), From: d.from, To: d.to, Data: bytes.Clone(b)}:
+	default:
+		d.c.dropped.Add(int64(len(b)))
+	}
+}
+
+func (c *circuitCapture) write(f *os.File) {
+	defer close(c.done)
+	defer c.cfg.active.Add(-1)
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for rec := range c.records {
+		if err := enc.Encode(rec); err != nil {
+			log.Warn("failed to write relay capture", "file", f.Name(), "err", err)
+			// keep draining, so that the circuit never blocks
+			continue
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Warn("failed to write relay capture", "file", f.Name(), "err", err)
+	}
+	if n := c.dropped.Load(); n > 0 {
+		log.Debug("dropped relay capture", "file", f.Name(), "bytes", n)
+	}
+}
+
+// close stops the capture once both directions have finished relaying.
+func (c *circuitCapture) close() {
+	if c == nil {
+		return
+	}
+	close(c.records)
+}
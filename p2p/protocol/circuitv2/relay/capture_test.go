@@ -0,0 +1,182 @@
+package relay
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func readCaptures(t *testing.T, dir string) map[string][]CaptureRecord {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	captures := make(map[string][]CaptureRecord, len(entries))
+	for _, e := range entries {
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		require.NoError(t, err)
+		var recs []CaptureRecord
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var rec CaptureRecord
+			require.NoError(t, json.Unmarshal(sc.Bytes(), &rec))
+			recs = append(recs, rec)
+		}
+		require.NoError(t, sc.Err())
+		f.Close()
+		captures[e.Name()] = recs
+	}
+	return captures
+}
+
+func TestCapture(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+	handleStopEcho(dest)
+
+	dir := t.TempDir()
+	r, err := New(relayHost, WithCapture(dir, 10))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	start := time.Now()
+	s, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	for range 5 {
+		_, err := s.Write([]byte("hello"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(s, make([]byte, 5))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.CloseWrite())
+	_, err = io.ReadAll(s)
+	require.NoError(t, err)
+
+	// the capture is written once the circuit is closed
+	captured := func(recs []CaptureRecord) map[peer.ID]string {
+		data := make(map[peer.ID]string)
+		for _, rec := range recs {
+			data[rec.From] += string(rec.Data)
+		}
+		return data
+	}
+	var recs []CaptureRecord
+	require.Eventually(t, func() bool {
+		captures := readCaptures(t, dir)
+		if len(captures) != 1 {
+			return false
+		}
+		for _, c := range captures {
+			recs = c
+		}
+		data := captured(recs)
+		return len(data[src.ID()]) == 10 && len(data[dest.ID()]) == 10
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the capture is only readable by the relay's user
+	if runtime.GOOS != "windows" {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		info, err := entries[0].Info()
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	// only the first 10 bytes of each direction are captured
+	data := captured(recs)
+	require.Equal(t, "hellohello", data[src.ID()])
+	require.Equal(t, "hellohello", data[dest.ID()])
+	for _, rec := range recs {
+		switch rec.From {
+		case src.ID():
+			require.Equal(t, dest.ID(), rec.To)
+		case dest.ID():
+			require.Equal(t, src.ID(), rec.To)
+		default:
+			t.Fatalf("unexpected sender %s", rec.From)
+		}
+		require.False(t, rec.Time.Before(start))
+	}
+}
+
+func TestCaptureNeverBlocks(t *testing.T) {
+	// a capture without a writer
+	c := &circuitCapture{records: make(chan CaptureRecord, 1)}
+	d := &captureDirection{c: c, remaining: 100}
+	for range 3 {
+		d.record([]byte("hello"))
+	}
+	require.Len(t, c.records, 1)
+	require.Equal(t, int64(10), c.dropped.Load())
+	require.Equal(t, 85, d.remaining)
+}
+
+func TestCaptureDisabled(t *testing.T) {
+	hosts := getTestHosts(t, 1)
+	r, err := New(hosts[0])
+	require.NoError(t, err)
+	defer r.Close()
+
+	c, srcCapture, destCapture := r.startCapture("a", "b")
+	require.Nil(t, c)
+	require.Nil(t, srcCapture)
+	require.Nil(t, destCapture)
+
+	buf := make([]byte, 1024)
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		srcCapture.record(buf)
+		c.close()
+	}))
+}
+
+func TestCaptureLimits(t *testing.T) {
+	hosts := getTestHosts(t, 1)
+	dir := t.TempDir()
+	r, err := New(hosts[0], WithCapture(dir, 10))
+	require.NoError(t, err)
+	defer r.Close()
+	r.capture.maxConcurrent = 2
+	r.capture.maxFiles = 3
+
+	c1, _, _ := r.startCapture("a", "b")
+	require.NotNil(t, c1)
+	c2, _, _ := r.startCapture("a", "c")
+	require.NotNil(t, c2)
+	// too many concurrent captures
+	c, _, _ := r.startCapture("a", "d")
+	require.Nil(t, c)
+
+	c1.close()
+	<-c1.done
+	c3, _, _ := r.startCapture("a", "e")
+	require.NotNil(t, c3)
+	c2.close()
+	c3.close()
+	<-c2.done
+	<-c3.done
+
+	// too many capture files
+	c, _, _ = r.startCapture("a", "f")
+	require.Nil(t, c)
+	require.Len(t, readCaptures(t, dir), 3)
+	require.Zero(t, r.capture.active.Load())
+}
+
+func TestCaptureOptionErrors(t *testing.T) {
+	hosts := getTestHosts(t, 1)
+	_, err := New(hosts[0], WithCapture("", 10))
+	require.Error(t, err)
+	_, err = New(hosts[0], WithCapture(t.TempDir(), 0))
+	require.Error(t, err)
+}
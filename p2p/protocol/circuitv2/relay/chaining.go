@@ -0,0 +1,13 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+)
+
+// isHopPeer returns true if p is known to support the relay hop protocol, i.e. it is a relay
+// itself. The supported protocols are recorded in the peerstore by identify.
+func (r *Relay) isHopPeer(p peer.ID) bool {
+	protos, err := r.host.Peerstore().SupportsProtocols(p, proto.ProtoIDv2Hop)
+	return err == nil && len(protos) > 0
+}
@@ -0,0 +1,49 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefuseRelayPeers(t *testing.T) {
+	for _, refuse := range []bool{true, false} {
+		name := "disabled"
+		if refuse {
+			name = "enabled"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, hopPeer, plainPeer := hosts[0], hosts[1], hosts[2]
+
+			r, err := New(relayHost, WithRefuseRelayPeers(refuse))
+			require.NoError(t, err)
+			defer r.Close()
+
+			// identify records the protocols supported by the peer
+			require.NoError(t, relayHost.Peerstore().AddProtocols(hopPeer.ID(), proto.ProtoIDv2Hop, proto.ProtoIDv2Stop))
+			require.NoError(t, relayHost.Peerstore().AddProtocols(plainPeer.ID(), proto.ProtoIDv2Stop))
+
+			_, err = reserve(t, plainPeer, relayHost)
+			require.NoError(t, err)
+
+			_, err = reserve(t, hopPeer, relayHost)
+			if !refuse {
+				require.NoError(t, err)
+				return
+			}
+			var rerr client.ReservationError
+			require.ErrorAs(t, err, &rerr)
+			require.Equal(t, pbv2.Status_PERMISSION_DENIED, rerr.Status)
+			require.False(t, r.hasReservation(hopPeer.ID()))
+
+			refusals := r.RecentRefusals()
+			require.Len(t, refusals, 1)
+			require.Equal(t, hopPeer.ID(), refusals[0].Peer)
+			require.Equal(t, "peer is a relay", refusals[0].Reason)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkSizeMetricsTracer records read chunk sizes.
+type chunkSizeMetricsTracer struct {
+	metricsTracer
+
+	mx    sync.Mutex
+	sizes []int
+}
+
+func (mt *chunkSizeMetricsTracer) ReadChunkSize(n int) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.sizes = append(mt.sizes, n)
+}
+
+func TestCopyWithBufferRecordsChunkSizes(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		mt := &chunkSizeMetricsTracer{}
+		r := &Relay{metricsTracer: mt, metricsChunkSizes: enabled}
+
+		var dst bytes.Buffer
+		_, err := r.copyWithBuffer(&dst, bytes.NewReader(make([]byte, 40)), make([]byte, 16), nil, nil)
+		require.NoError(t, err)
+		if enabled {
+			require.Equal(t, []int{16, 16, 8}, mt.sizes)
+		} else {
+			require.Empty(t, mt.sizes)
+		}
+	}
+}
+
+func BenchmarkCopyWithBufferChunkSizes(b *testing.B) {
+	const size = 2048
+	data := make([]byte, 1<<20)
+	buf := make([]byte, size)
+
+	for _, tc := range []struct {
+		name string
+		r    *Relay
+	}{
+		{"no tracer", &Relay{}},
+		{"disabled", &Relay{metricsTracer: NewMetricsTracer(WithRegisterer(prometheus.NewRegistry()))}},
+		{"enabled", &Relay{metricsTracer: NewMetricsTracer(WithRegisterer(prometheus.NewRegistry())), metricsChunkSizes: true}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				if _, err := tc.r.copyWithBuffer(io.Discard, bytes.NewReader(data), buf, nil, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
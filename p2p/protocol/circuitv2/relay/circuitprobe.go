@@ -0,0 +1,115 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+// handleCircuitProbe checks whether the relay can reach the peer requested in msg, by performing
+// a probe handshake with it, and responds with the result.
+func (r *Relay) handleCircuitProbe(s network.Stream, msg *pbv2.HopMessage) pbv2.Status {
+	src := s.Conn().RemotePeer()
+	a := s.Conn().RemoteMultiaddr()
+	// the peer has been validated by handleHopMessage
+	dest, _ := util.PeerToPeerInfoV2(msg.GetPeer())
+
+	refuse := func(status pbv2.Status, reason string) pbv2.Status {
+		log.Debug("refusing circuit probe",
+			"source_peer", src,
+			"destination_peer", dest.ID,
+			"reason", reason)
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_PROBE, Peer: src, Addr: a, Destination: dest.ID, Status: status, Reason: reason})
+		r.handleError(s, status)
+		return status
+	}
+
+	if r.probeLimiter == nil {
+		return refuse(pbv2.Status_PERMISSION_DENIED, "circuit probes disabled")
+	}
+	if isRelayAddr(a) {
+		return refuse(pbv2.Status_PERMISSION_DENIED, "probe over relay connection")
+	}
+	if allow, reason := r.aclAllowConnect(src, a, dest.ID); !allow {
+		return refuse(pbv2.Status_PERMISSION_DENIED, reason)
+	}
+	if !r.destinationAllowed(dest.ID) {
+		return refuse(pbv2.Status_PERMISSION_DENIED, "destination not allowed")
+	}
+
+	r.mx.Lock()
+	allowed := r.probeLimiter.Allow(src, time.Now())
+	_, reserved := r.rsvp[dest.ID]
+	r.mx.Unlock()
+	if !allowed {
+		return refuse(pbv2.Status_RESOURCE_LIMIT_EXCEEDED, "probe rate limit exceeded")
+	}
+	if !reserved {
+		return refuse(pbv2.Status_NO_RESERVATION, "no reservation")
+	}
+
+	if _, err := r.probeDestination(src, dest.ID); err != nil {
+		log.Debug("circuit probe failed",
+			"source_peer", src,
+			"destination_peer", dest.ID,
+			"err", err)
+		r.handleError(s, pbv2.Status_CONNECTION_FAILED)
+		return pbv2.Status_CONNECTION_FAILED
+	}
+
+	defer s.Close()
+	if err := r.writeResponse(s, pbv2.Status_OK, nil, nil); err != nil {
+		log.Debug("error writing circuit probe response", "err", err)
+		s.Reset()
+		return pbv2.Status_CONNECTION_FAILED
+	}
+	return pbv2.Status_OK
+}
+
+// probeDestination performs a probe handshake with dest on behalf of src, and returns the status
+// dest responded with. Any status response counts as reachable, as peers that don't support
+// probes respond with an error status.
+func (r *Relay) probeDestination(src, dest peer.ID) (pbv2.Status, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, ConnectTimeout)
+	defer cancel()
+	ctx = network.WithNoDial(ctx, "relay circuit probe")
+
+	bs, err := r.host.NewStream(ctx, dest, proto.ProtoIDv2Stop)
+	if err != nil {
+		return 0, err
+	}
+	if err := bs.Scope().SetService(ServiceName); err != nil {
+		bs.Reset()
+		return 0, err
+	}
+	bs.SetDeadline(time.Now().Add(r.rc.stopHandshakeTimeout()))
+
+	rd := util.NewDelimitedReader(bs, maxMessageSize)
+	defer rd.Close()
+
+	var stopmsg pbv2.StopMessage
+	stopmsg.Type = pbv2.StopMessage_PROBE.Enum()
+	stopmsg.Peer = util.PeerInfoToPeerV2(peer.AddrInfo{ID: src})
+	if err := util.NewDelimitedWriter(bs).WriteMsg(&stopmsg); err != nil {
+		bs.Reset()
+		return 0, err
+	}
+
+	stopmsg.Reset()
+	if err := rd.ReadMsg(&stopmsg); err != nil {
+		bs.Reset()
+		return 0, err
+	}
+	bs.Close()
+
+	if t := stopmsg.GetType(); t != pbv2.StopMessage_STATUS {
+		return 0, fmt.Errorf("unexpected stop response: %s", t)
+	}
+	return stopmsg.GetStatus(), nil
+}
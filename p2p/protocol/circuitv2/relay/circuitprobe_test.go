@@ -0,0 +1,91 @@
+package relay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitProbe(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, reachable, unreachable := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	r, err := New(relayHost, WithCircuitProbes(RateLimit{RPS: 10, Burst: 10}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// reachable has a circuit transport that answers probes; unreachable has a reservation
+	// but doesn't handle the stop protocol
+	addCircuitTransport(t, reachable)
+	_, err = reserve(t, reachable, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, unreachable, relayHost)
+	require.NoError(t, err)
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, src.Connect(context.Background(), rinfo))
+
+	require.NoError(t, client.ProbeCircuit(context.Background(), src, rinfo, reachable.ID()))
+	// probing doesn't establish a connection
+	require.Empty(t, reachable.Network().ConnsToPeer(src.ID()))
+
+	err = client.ProbeCircuit(context.Background(), src, rinfo, unreachable.ID())
+	require.ErrorContains(t, err, "CONNECTION_FAILED")
+
+	err = client.ProbeCircuit(context.Background(), src, rinfo, src.ID())
+	require.ErrorContains(t, err, "NO_RESERVATION")
+
+	refusals := r.RecentRefusals()
+	require.NotEmpty(t, refusals)
+	last := refusals[len(refusals)-1]
+	require.Equal(t, pbv2.HopMessage_PROBE, last.Type)
+	require.Equal(t, pbv2.Status_NO_RESERVATION, last.Status)
+}
+
+func TestCircuitProbeDisabled(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	addCircuitTransport(t, dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, src.Connect(context.Background(), rinfo))
+	err = client.ProbeCircuit(context.Background(), src, rinfo, dest.ID())
+	require.ErrorContains(t, err, "PERMISSION_DENIED")
+}
+
+func TestCircuitProbeRateLimit(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, other, dest := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	r, err := New(relayHost, WithCircuitProbes(RateLimit{RPS: 0.01, Burst: 2}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	addCircuitTransport(t, dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, src.Connect(context.Background(), rinfo))
+	require.NoError(t, other.Connect(context.Background(), rinfo))
+
+	for range 2 {
+		require.NoError(t, client.ProbeCircuit(context.Background(), src, rinfo, dest.ID()))
+	}
+	err = client.ProbeCircuit(context.Background(), src, rinfo, dest.ID())
+	require.ErrorContains(t, err, "RESOURCE_LIMIT_EXCEEDED")
+
+	// the limit applies per source
+	require.NoError(t, client.ProbeCircuit(context.Background(), other, rinfo, dest.ID()))
+}
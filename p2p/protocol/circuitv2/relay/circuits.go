@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"errors"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ErrUnknownCircuit is returned by CloseCircuit if there is no active relayed connection with
+// the given ID.
+var ErrUnknownCircuit = errors.New("unknown circuit")
+
+// CircuitInfo describes an active relayed connection.
+type CircuitInfo struct {
+	// ID identifies the relayed connection for CloseCircuit. It is unique for the lifetime of
+	// the relay.
+	ID string
+	// Source is the peer that requested the relayed connection.
+	Source peer.ID
+	// Destination is the peer the relayed connection leads to.
+	Destination peer.ID
+	// Established is the time the relayed connection was established.
+	Established time.Time
+	// TraceID is the trace ID of the connection request.
+	TraceID string
+	// Session is the session ID of the destination's reservation, if any.
+	Session string
+}
+
+// Circuits returns the active relayed connections.
+func (r *Relay) Circuits() []CircuitInfo {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	res := make([]CircuitInfo, 0, len(r.circuits))
+	for _, c := range r.circuits {
+		res = append(res, CircuitInfo{
+			ID:          c.id,
+			Source:      c.srcPeer,
+			Destination: c.destPeer,
+			Established: c.established,
+			TraceID:     c.traceID,
+			Session:     c.session,
+		})
+	}
+	return res
+}
+
+// CloseCircuit resets both streams of the active relayed connection with the given ID, leaving
+// the other connections of its peers alone. The resources of the connection are released once
+// relaying stops. It returns ErrUnknownCircuit if there is no such connection.
+func (r *Relay) CloseCircuit(id string) error {
+	r.mx.Lock()
+	c, ok := r.circuits[id]
+	r.mx.Unlock()
+	if !ok {
+		return ErrUnknownCircuit
+	}
+	log.Debug("closing relayed connection",
+		"circuit", id,
+		"source_peer", c.srcPeer,
+		"destination_peer", c.destPeer)
+	c.reset()
+	return nil
+}
@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseCircuit(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	s1, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	require.NoError(t, echo(t, s1))
+	circuits := r.Circuits()
+	require.Len(t, circuits, 1)
+	first := circuits[0]
+	require.Equal(t, src.ID(), first.Source)
+	require.Equal(t, dest.ID(), first.Destination)
+
+	s2, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	require.NoError(t, echo(t, s2))
+	require.Len(t, r.Circuits(), 2)
+
+	require.NoError(t, r.CloseCircuit(first.ID))
+	_, err = s1.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.NoError(t, echo(t, s2))
+
+	require.Eventually(t, func() bool {
+		circuits := r.Circuits()
+		return len(circuits) == 1 && circuits[0].ID != first.ID
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		return r.conns[src.ID()] == 1 && r.conns[dest.ID()] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.ErrorIs(t, r.CloseCircuit(first.ID), ErrUnknownCircuit)
+}
@@ -0,0 +1,101 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DefaultCloseDrainTimeout is the default of Resources.CloseDrainTimeout.
+const DefaultCloseDrainTimeout = 30 * time.Second
+
+// CloseCircuitBehavior is what happens to active relayed connections when the relay is closed.
+type CloseCircuitBehavior int
+
+const (
+	// CloseCircuitsLeave leaves active relayed connections running until they end on their own,
+	// by either peer closing them or reaching the limits of the connection.
+	CloseCircuitsLeave CloseCircuitBehavior = iota
+	// CloseCircuitsReset resets all active relayed connections when the relay is closed.
+	CloseCircuitsReset
+	// CloseCircuitsDrain lets active relayed connections continue for Resources.CloseDrainTimeout
+	// after the relay is closed, and then resets the connections that are still open.
+	CloseCircuitsDrain
+)
+
+func (b CloseCircuitBehavior) String() string {
+	switch b {
+	case CloseCircuitsLeave:
+		return "leave"
+	case CloseCircuitsReset:
+		return "reset"
+	case CloseCircuitsDrain:
+		return "drain"
+	default:
+		return "unknown"
+	}
+}
+
+// activeCircuit is the pair of streams of a relayed connection.
+type activeCircuit struct {
+	id                string
+	src, dest         network.Stream
+	srcPeer, destPeer peer.ID
+	established       time.Time
+	traceID           string
+	session           string
+}
+
+func (c *activeCircuit) reset() {
+	c.src.Reset()
+	c.dest.Reset()
+}
+
+// trackCircuit registers an established relayed connection until it ends. A connection
+// established while the relay is closing is reset right away, unless CloseCircuitsLeave is set.
+func (r *Relay) trackCircuit(c *activeCircuit) {
+	r.mx.Lock()
+	closed := r.closed
+	r.circuits[c.id] = c
+	r.mx.Unlock()
+
+	if closed && r.rc.CloseCircuitBehavior != CloseCircuitsLeave {
+		c.reset()
+	}
+}
+
+func (r *Relay) untrackCircuit(c *activeCircuit) {
+	r.mx.Lock()
+	delete(r.circuits, c.id)
+	r.mx.Unlock()
+}
+
+// closeCircuits acts on the active relayed connections according to CloseCircuitBehavior when
+// the relay is closed.
+func (r *Relay) closeCircuits() {
+	switch r.rc.CloseCircuitBehavior {
+	case CloseCircuitsReset:
+		r.resetCircuits()
+	case CloseCircuitsDrain:
+		timeout := r.rc.CloseDrainTimeout
+		if timeout <= 0 {
+			timeout = DefaultCloseDrainTimeout
+		}
+		time.AfterFunc(timeout, r.resetCircuits)
+	}
+}
+
+// resetCircuits resets all active relayed connections.
+func (r *Relay) resetCircuits() {
+	r.mx.Lock()
+	circuits := make([]*activeCircuit, 0, len(r.circuits))
+	for _, c := range r.circuits {
+		circuits = append(circuits, c)
+	}
+	r.mx.Unlock()
+
+	for _, c := range circuits {
+		c.reset()
+	}
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/stretchr/testify/require"
+)
+
+// echo checks that the relayed connection s echoes back what is written to it.
+func echo(t *testing.T, s network.Stream) error {
+	t.Helper()
+	if _, err := s.Write([]byte("ping")); err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(s, buf); err != nil {
+		return err
+	}
+	require.Equal(t, "ping", string(buf))
+	return nil
+}
+
+func TestCloseCircuitBehavior(t *testing.T) {
+	const drainTimeout = 300 * time.Millisecond
+
+	for _, behavior := range []CloseCircuitBehavior{CloseCircuitsLeave, CloseCircuitsReset, CloseCircuitsDrain} {
+		t.Run(behavior.String(), func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			rc := DefaultResources()
+			rc.CloseCircuitBehavior = behavior
+			rc.CloseDrainTimeout = drainTimeout
+			r, err := New(relayHost, WithResources(rc))
+			require.NoError(t, err)
+
+			handleStopEcho(dest)
+			_, err = reserve(t, dest, relayHost)
+			require.NoError(t, err)
+			s, status := connectRaw(t, src, relayHost, dest.ID())
+			require.Equal(t, pbv2.Status_OK, status)
+			require.NoError(t, echo(t, s))
+
+			// the circuit is idle when the relay closes
+			closed := time.Now()
+			require.NoError(t, r.Close())
+
+			switch behavior {
+			case CloseCircuitsLeave:
+				require.NoError(t, echo(t, s))
+				r.mx.Lock()
+				require.Len(t, r.circuits, 1)
+				r.mx.Unlock()
+			case CloseCircuitsReset:
+				_, err := s.Read(make([]byte, 1))
+				require.Error(t, err)
+				require.Less(t, time.Since(closed), drainTimeout)
+			case CloseCircuitsDrain:
+				require.NoError(t, echo(t, s))
+				_, err := s.Read(make([]byte, 1))
+				require.Error(t, err)
+				require.GreaterOrEqual(t, time.Since(closed), drainTimeout)
+			}
+			if behavior != CloseCircuitsLeave {
+				require.Eventually(t, func() bool {
+					r.mx.Lock()
+					defer r.mx.Unlock()
+					return len(r.circuits) == 0
+				}, 5*time.Second, 10*time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// propagateClose closes dest for writing once src reached EOF. With WithCloseWriteFlush, data
+// buffered by dest is flushed first, if it implements Flush. If flushing fails or times out,
+// both streams are reset instead, so the destination doesn't mistake truncated data for a clean
+// close.
+func (r *Relay) propagateClose(src, dest network.Stream) {
+	if r.closeWriteFlush > 0 {
+		if f, ok := dest.(interface{ Flush() error }); ok {
+			// no more writes follow in this direction, so the deadline needn't be restored
+			dest.SetWriteDeadline(time.Now().Add(r.closeWriteFlush))
+			if err := f.Flush(); err != nil {
+				log.Debug("error flushing relayed stream", "err", err)
+				src.Reset()
+				dest.Reset()
+				return
+			}
+		}
+	}
+	dest.CloseWrite()
+}
@@ -0,0 +1,117 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/require"
+)
+
+// readerStream is the source side of a relayed connection, reading from r.
+type readerStream struct {
+	network.Stream
+	r     io.Reader
+	reset bool
+}
+
+func (s *readerStream) Read(b []byte) (int, error) { return s.r.Read(b) }
+func (s *readerStream) Reset() error               { s.reset = true; return nil }
+
+// batchingStream is the destination side of a relayed connection on a muxer that batches
+// writes: it only sends full batches, and drops a partial batch on CloseWrite unless flushed.
+type batchingStream struct {
+	network.Stream
+	batch    int
+	flushErr error
+
+	mx          sync.Mutex
+	pending     bytes.Buffer
+	sent        bytes.Buffer
+	closedWrite bool
+	reset       bool
+}
+
+func (s *batchingStream) Write(b []byte) (int, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.pending.Write(b)
+	for s.pending.Len() >= s.batch {
+		s.sent.Write(s.pending.Next(s.batch))
+	}
+	return len(b), nil
+}
+
+func (s *batchingStream) Flush() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.flushErr != nil {
+		return s.flushErr
+	}
+	s.sent.Write(s.pending.Next(s.pending.Len()))
+	return nil
+}
+
+func (s *batchingStream) SetWriteDeadline(time.Time) error { return nil }
+
+func (s *batchingStream) CloseWrite() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.closedWrite = true
+	return nil
+}
+
+func (s *batchingStream) Reset() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.reset = true
+	return nil
+}
+
+func TestCloseWriteFlush(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, tc := range []struct {
+		name     string
+		flush    time.Duration
+		flushErr error
+	}{
+		{name: "disabled"},
+		{name: "enabled", flush: time.Second},
+		{name: "flush fails", flush: time.Second, flushErr: errors.New("flush failed")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Relay{rc: DefaultResources(), closeWriteFlush: tc.flush}
+			src := &readerStream{r: bytes.NewReader(data)}
+			dest := &batchingStream{batch: 64, flushErr: tc.flushErr}
+
+			r.relayUnlimited(src, dest, "", "", nil, nil, func() {})
+
+			switch {
+			case tc.flush == 0:
+				// the destination sees a clean close of truncated data
+				require.True(t, dest.closedWrite)
+				require.Less(t, dest.sent.Len(), len(data))
+			case tc.flushErr != nil:
+				// the destination sees an error rather than a clean close
+				require.False(t, dest.closedWrite)
+				require.True(t, dest.reset)
+				require.True(t, src.reset)
+			default:
+				require.True(t, dest.closedWrite)
+				require.Equal(t, data, dest.sent.Bytes())
+			}
+		})
+	}
+}
+
+func TestWithCloseWriteFlush(t *testing.T) {
+	r := &Relay{}
+	require.Error(t, WithCloseWriteFlush(0)(r))
+	require.NoError(t, WithCloseWriteFlush(time.Second)(r))
+	require.Equal(t, time.Second, r.closeWriteFlush)
+}
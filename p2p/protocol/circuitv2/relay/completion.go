@@ -0,0 +1,34 @@
+package relay
+
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// CompletionErrorFunc decides whether an error reading from one side of a relayed connection is
+// an expected way for that peer to end its transfer, e.g. by resetting its stream once it sent
+// all its data. Whether it is depends on the application protocol.
+type CompletionErrorFunc func(err error) bool
+
+// ResetIsCompletion is a CompletionErrorFunc that treats a peer resetting its stream as the end
+// of its transfer.
+func ResetIsCompletion(err error) bool {
+	return errors.Is(err, network.ErrReset)
+}
+
+// sourceError is an error reading from the source of a relayed stream, as opposed to an error
+// writing to its destination.
+type sourceError struct {
+	err error
+}
+
+func (e *sourceError) Error() string { return e.err.Error() }
+func (e *sourceError) Unwrap() error { return e.err }
+
+// completionError returns true if err, returned by copying a relayed stream, is the source
+// ending its transfer according to the CompletionErrorFunc set with WithCompletionErrors.
+func (r *Relay) completionError(err error) bool {
+	var se *sourceError
+	return r.isCompletion != nil && errors.As(err, &se) && r.isCompletion(se.err)
+}
@@ -0,0 +1,72 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenStream is the destination side of a relayed connection that fails all writes.
+type brokenStream struct {
+	*batchingStream
+}
+
+func (s brokenStream) Write([]byte) (int, error) { return 0, errors.New("injected write failure") }
+
+func TestCompletionErrors(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, relay := range []struct {
+		name string
+		run  func(r *Relay, src, dest network.Stream)
+	}{
+		{name: "unlimited", run: func(r *Relay, src, dest network.Stream) {
+			r.relayUnlimited(src, dest, "", "", nil, nil, func() {})
+		}},
+		{name: "limited", run: func(r *Relay, src, dest network.Stream) {
+			r.relayLimited(src, dest, "", "", 1<<20, nil, nil, nil, func() {})
+		}},
+	} {
+		for _, tc := range []struct {
+			name         string
+			isCompletion CompletionErrorFunc
+			readErr      error
+			brokenDest   bool
+			clean        bool
+		}{
+			{name: "reset after transfer", readErr: network.ErrReset},
+			{name: "reset after transfer, completion", isCompletion: ResetIsCompletion, readErr: network.ErrReset, clean: true},
+			{name: "other read error, completion", isCompletion: ResetIsCompletion, readErr: errors.New("read failure")},
+			{name: "write failure, completion", isCompletion: ResetIsCompletion, readErr: network.ErrReset, brokenDest: true},
+		} {
+			t.Run(relay.name+"/"+tc.name, func(t *testing.T) {
+				r := &Relay{rc: DefaultResources(), isCompletion: tc.isCompletion}
+				src := &readerStream{r: io.MultiReader(bytes.NewReader(data), iotest.ErrReader(tc.readErr))}
+				dest := &batchingStream{batch: 1}
+
+				if tc.brokenDest {
+					relay.run(r, src, brokenStream{dest})
+				} else {
+					relay.run(r, src, dest)
+				}
+
+				if tc.clean {
+					// the destination sees all data followed by a clean close
+					require.Equal(t, data, dest.sent.Bytes())
+					require.True(t, dest.closedWrite)
+					require.False(t, dest.reset)
+					require.False(t, src.reset)
+				} else {
+					require.False(t, dest.closedWrite)
+					require.True(t, dest.reset)
+					require.True(t, src.reset)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package relay
+
+// Config returns a copy of the resources the relay was configured with, after applying the
+// options passed to New. Compare it with DefaultResources to find the settings that differ from
+// the defaults.
+func (r *Relay) Config() Resources {
+	return r.rc.clone()
+}
+
+// clone returns a deep copy of rc.
+func (rc *Resources) clone() Resources {
+	c := *rc
+	if rc.Limit != nil {
+		limit := *rc.Limit
+		c.Limit = &limit
+	}
+	if rc.ConnectRateLimit != nil {
+		rate := *rc.ConnectRateLimit
+		c.ConnectRateLimit = &rate
+	}
+	return c
+}
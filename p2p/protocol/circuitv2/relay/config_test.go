@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+
+	r, err := New(h)
+	require.NoError(t, err)
+	require.Equal(t, DefaultResources(), r.Config())
+	r.Close()
+
+	rc := DefaultResources()
+	rc.MaxReservations = 7
+	rc.ConnectRateLimit = &RateLimit{RPS: 1, Burst: 2}
+	limit := &RelayLimit{Duration: time.Minute, Data: 1 << 10}
+	r, err = New(h, WithResources(rc), WithLimit(limit))
+	require.NoError(t, err)
+	defer r.Close()
+
+	cfg := r.Config()
+	require.Equal(t, 7, cfg.MaxReservations)
+	require.Equal(t, limit, cfg.Limit)
+	require.Equal(t, rc.ConnectRateLimit, cfg.ConnectRateLimit)
+
+	// the copy doesn't alias the relay's configuration
+	cfg.Limit.Data = 0
+	cfg.ConnectRateLimit.Burst = 0
+	require.Equal(t, int64(1<<10), r.Config().Limit.Data)
+	require.Equal(t, 2, r.Config().ConnectRateLimit.Burst)
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+	var resp Resources
+	getAdminJSON(t, srv, "/config", &resp)
+	require.Equal(t, r.Config(), resp)
+}
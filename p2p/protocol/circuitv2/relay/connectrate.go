@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit is the configuration of a token bucket rate limiter. The bucket holds up to Burst
+// tokens, and is refilled at RPS tokens per second.
+type RateLimit struct {
+	// RPS is the steady state rate of requests per second.
+	RPS float64
+	// Burst is the number of requests allowed in a burst.
+	Burst int
+}
+
+// connectRateLimiter limits the rate of connect requests from each source peer.
+// The methods are *not* thread-safe; the relay lock must be held.
+type connectRateLimiter struct {
+	limit RateLimit
+	peers map[peer.ID]*rate.Limiter
+	// throttled are the peers with requests refused within the last RateLimitedWindow.
+	throttled map[peer.ID]*RateLimitedPeer
+}
+
+func newConnectRateLimiter(limit RateLimit) *connectRateLimiter {
+	return &connectRateLimiter{
+		limit:     limit,
+		peers:     make(map[peer.ID]*rate.Limiter),
+		throttled: make(map[peer.ID]*RateLimitedPeer),
+	}
+}
+
+// Allow returns true if a connect request from p is within the rate limit.
+func (l *connectRateLimiter) Allow(p peer.ID, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	lim, ok := l.peers[p]
+	if !ok {
+		lim = rate.NewLimiter(rate.Limit(l.limit.RPS), l.limit.Burst)
+		l.peers[p] = lim
+	}
+	if lim.AllowN(now, 1) {
+		return true
+	}
+	l.recordThrottled(p, now)
+	return false
+}
+
+// cleanupPeer removes the state of p. Its record of throttled requests is kept until it ages
+// out, so that peers reconnecting to evade the limit remain visible.
+func (l *connectRateLimiter) cleanupPeer(p peer.ID) {
+	if l == nil {
+		return
+	}
+	delete(l.peers, p)
+}
+
+// gc removes the state of peers whose bucket has refilled, as it is equivalent to a new bucket.
+func (l *connectRateLimiter) gc(now time.Time) {
+	if l == nil {
+		return
+	}
+	for p, lim := range l.peers {
+		if lim.TokensAt(now) >= float64(l.limit.Burst) {
+			delete(l.peers, p)
+		}
+	}
+	for p, t := range l.throttled {
+		if t.agedOut(now) {
+			delete(l.throttled, p)
+		}
+	}
+}
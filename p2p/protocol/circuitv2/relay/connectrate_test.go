@@ -0,0 +1,86 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/test"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectRateLimiter(t *testing.T) {
+	l := newConnectRateLimiter(RateLimit{RPS: 1, Burst: 2})
+	p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	now := time.Now()
+
+	require.True(t, l.Allow(p1, now))
+	require.True(t, l.Allow(p1, now))
+	require.False(t, l.Allow(p1, now))
+	// other peers have their own bucket
+	require.True(t, l.Allow(p2, now))
+
+	// the bucket refills over time
+	require.True(t, l.Allow(p1, now.Add(time.Second)))
+	require.False(t, l.Allow(p1, now.Add(time.Second)))
+
+	// full buckets are garbage collected
+	l.gc(now.Add(time.Second))
+	require.Len(t, l.peers, 1)
+	require.Contains(t, l.peers, p1)
+	l.gc(now.Add(time.Minute))
+	require.Empty(t, l.peers)
+
+	require.True(t, l.Allow(p1, now))
+	l.cleanupPeer(p1)
+	require.Empty(t, l.peers)
+
+	// a nil limiter allows everything
+	var nl *connectRateLimiter
+	require.True(t, nl.Allow(p1, now))
+	nl.cleanupPeer(p1)
+	nl.gc(now)
+}
+
+func TestConnectRateLimit(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, other, dest := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	rc := DefaultResources()
+	rc.ConnectRateLimit = &RateLimit{RPS: 0.01, Burst: 3}
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	// open and close circuits faster than the limit allows
+	for range 3 {
+		s, status := connectRaw(t, src, relayHost, dest.ID())
+		require.Equal(t, pbv2.Status_OK, status)
+		s.Reset()
+	}
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+
+	refusals := r.RecentRefusals()
+	require.NotEmpty(t, refusals)
+	require.Equal(t, "connect rate limit exceeded", refusals[len(refusals)-1].Reason)
+
+	// other sources are not affected
+	_, status = connectRaw(t, other, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	// the state of the source is reaped when it disconnects
+	require.NoError(t, src.Network().ClosePeer(relayHost.ID()))
+	require.Eventually(t, func() bool {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		_, ok := r.connectLimiter.peers[src.ID()]
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	_, status = connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+}
@@ -0,0 +1,178 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+const (
+	// ConnectStatsWindow is the period covered by ConnectStats.
+	ConnectStatsWindow = 10 * time.Minute
+	// connectStatsBuckets is the number of buckets the window is divided into. The window
+	// slides by a bucket at a time.
+	connectStatsBuckets = 10
+)
+
+// ConnectStats counts the outcomes of connection requests over the last ConnectStatsWindow.
+type ConnectStats struct {
+	// Succeeded is the number of requests that established a relayed connection.
+	Succeeded int
+	// NoReservation is the number of requests refused as the destination, or the source if the
+	// relay requires it, had no reservation.
+	NoReservation int
+	// ResourceLimitExceeded is the number of requests refused for exceeding a resource limit.
+	ResourceLimitExceeded int
+	// ConnectionFailed is the number of requests that failed to connect to the destination.
+	ConnectionFailed int
+	// Other is the number of requests that failed for other reasons, such as denied permission
+	// or malformed requests.
+	Other int
+}
+
+// Total returns the number of connection requests.
+func (s ConnectStats) Total() int {
+	return s.Succeeded + s.Failed()
+}
+
+// Failed returns the number of failed connection requests.
+func (s ConnectStats) Failed() int {
+	return s.NoReservation + s.ResourceLimitExceeded + s.ConnectionFailed + s.Other
+}
+
+// SuccessRate returns the fraction of connection requests that succeeded. It is 1 if there
+// were no requests.
+func (s ConnectStats) SuccessRate() float64 {
+	total := s.Total()
+	if total == 0 {
+		return 1
+	}
+	return float64(s.Succeeded) / float64(total)
+}
+
+func (s *ConnectStats) add(status pbv2.Status) {
+	switch status {
+	case pbv2.Status_OK:
+		s.Succeeded++
+	case pbv2.Status_NO_RESERVATION:
+		s.NoReservation++
+	case pbv2.Status_RESOURCE_LIMIT_EXCEEDED:
+		s.ResourceLimitExceeded++
+	case pbv2.Status_CONNECTION_FAILED:
+		s.ConnectionFailed++
+	default:
+		s.Other++
+	}
+}
+
+func (s *ConnectStats) merge(o ConnectStats) {
+	s.Succeeded += o.Succeeded
+	s.NoReservation += o.NoReservation
+	s.ResourceLimitExceeded += o.ResourceLimitExceeded
+	s.ConnectionFailed += o.ConnectionFailed
+	s.Other += o.Other
+}
+
+// connectBucket holds the outcomes of the requests within one bucket interval.
+type connectBucket struct {
+	epoch int64
+	stats ConnectStats
+}
+
+// connectCounter is a sliding window of connection request outcomes, as a ring of buckets.
+type connectCounter [connectStatsBuckets]connectBucket
+
+func (c *connectCounter) add(epoch int64, status pbv2.Status) {
+	b := &c[epoch%connectStatsBuckets]
+	if b.epoch != epoch {
+		*b = connectBucket{epoch: epoch}
+	}
+	b.stats.add(status)
+}
+
+// sum returns the outcomes within the window ending with the bucket of epoch.
+func (c *connectCounter) sum(epoch int64) ConnectStats {
+	var s ConnectStats
+	for _, b := range c {
+		if b.epoch > epoch-connectStatsBuckets && b.epoch <= epoch {
+			s.merge(b.stats)
+		}
+	}
+	return s
+}
+
+// connectStats tracks the outcomes of connection requests relay wide and per source peer.
+type connectStats struct {
+	bucket time.Duration
+
+	mx    sync.Mutex
+	total connectCounter
+	peers map[peer.ID]*connectCounter
+}
+
+func newConnectStats(window time.Duration) *connectStats {
+	return &connectStats{
+		bucket: window / connectStatsBuckets,
+		peers:  make(map[peer.ID]*connectCounter),
+	}
+}
+
+func (s *connectStats) epoch(now time.Time) int64 {
+	// offset so that no bucket is in the window at the zero epoch
+	return now.UnixNano()/int64(s.bucket) + connectStatsBuckets
+}
+
+func (s *connectStats) record(src peer.ID, now time.Time, status pbv2.Status) {
+	epoch := s.epoch(now)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.total.add(epoch, status)
+	c, ok := s.peers[src]
+	if !ok {
+		c = new(connectCounter)
+		s.peers[src] = c
+	}
+	c.add(epoch, status)
+}
+
+func (s *connectStats) relay(now time.Time) ConnectStats {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.total.sum(s.epoch(now))
+}
+
+func (s *connectStats) peer(p peer.ID, now time.Time) ConnectStats {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	c, ok := s.peers[p]
+	if !ok {
+		return ConnectStats{}
+	}
+	return c.sum(s.epoch(now))
+}
+
+// gc forgets peers without requests in the window.
+func (s *connectStats) gc(now time.Time) {
+	epoch := s.epoch(now)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for p, c := range s.peers {
+		if c.sum(epoch).Total() == 0 {
+			delete(s.peers, p)
+		}
+	}
+}
+
+func (s *connectStats) cleanupPeer(p peer.ID) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.peers, p)
+}
+
+// PeerConnectStats returns the outcomes of the connection requests from p over the last
+// ConnectStatsWindow. Requests are forgotten once p disconnects from the relay.
+func (r *Relay) PeerConnectStats(p peer.ID) ConnectStats {
+	return r.connectStats.peer(p, time.Now())
+}
@@ -0,0 +1,79 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectStats(t *testing.T) {
+	hosts := getTestHosts(t, 5)
+	relayHost, src, dest, unreachable, unreserved := hosts[0], hosts[1], hosts[2], hosts[3], hosts[4]
+	handleStopEcho(dest)
+
+	rc := DefaultResources()
+	rc.MaxCircuits = 1
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	// unreachable holds a reservation but doesn't speak the stop protocol
+	_, err = reserve(t, unreachable, relayHost)
+	require.NoError(t, err)
+
+	_, status := connectRaw(t, src, relayHost, unreachable.ID())
+	require.Equal(t, pbv2.Status_CONNECTION_FAILED, status)
+	for range 2 {
+		_, status = connectRaw(t, src, relayHost, unreserved.ID())
+		require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+	}
+	_, status = connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	// the only circuit allowed for src is in use
+	_, status = connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+
+	expected := ConnectStats{Succeeded: 1, NoReservation: 2, ResourceLimitExceeded: 1, ConnectionFailed: 1}
+	// outcomes are recorded after the response is sent
+	require.Eventually(t, func() bool { return r.Stats().Connects == expected }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 5, expected.Total())
+	require.Equal(t, 4, expected.Failed())
+	require.InDelta(t, 0.2, expected.SuccessRate(), 1e-9)
+
+	require.Equal(t, expected, r.PeerConnectStats(src.ID()))
+	require.Equal(t, ConnectStats{}, r.PeerConnectStats(dest.ID()))
+}
+
+func TestConnectStatsWindow(t *testing.T) {
+	s := newConnectStats(10 * time.Second)
+	p1, p2 := peer.ID("p1"), peer.ID("p2")
+	start := time.Now()
+
+	s.record(p1, start, pbv2.Status_OK)
+	s.record(p1, start, pbv2.Status_CONNECTION_FAILED)
+	s.record(p2, start.Add(5*time.Second), pbv2.Status_PERMISSION_DENIED)
+
+	require.Equal(t, ConnectStats{Succeeded: 1, ConnectionFailed: 1, Other: 1}, s.relay(start.Add(5*time.Second)))
+	require.Equal(t, ConnectStats{Succeeded: 1, ConnectionFailed: 1}, s.peer(p1, start.Add(5*time.Second)))
+	require.Equal(t, 0.5, s.peer(p1, start).SuccessRate())
+
+	// the first requests slide out of the window
+	later := start.Add(12 * time.Second)
+	require.Equal(t, ConnectStats{Other: 1}, s.relay(later))
+	require.Equal(t, ConnectStats{}, s.peer(p1, later))
+	require.Equal(t, 1.0, s.peer(p1, later).SuccessRate())
+
+	// peers without requests in the window are forgotten
+	s.gc(later)
+	require.NotContains(t, s.peers, p1)
+	require.Contains(t, s.peers, p2)
+
+	s.cleanupPeer(p2)
+	require.Equal(t, ConnectStats{}, s.peer(p2, later))
+	require.Equal(t, ConnectStats{Other: 1}, s.relay(later))
+}
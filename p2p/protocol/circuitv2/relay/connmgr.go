@@ -0,0 +1,40 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// tagPeer tags the peer in the host's connection manager, unless tagging is disabled.
+func (r *Relay) tagPeer(p peer.ID, tag string, weight int) {
+	if !r.connManagerTagging {
+		return
+	}
+	cm := r.host.ConnManager()
+	if cm == nil {
+		return
+	}
+	defer r.recoverConnManagerPanic(p, tag)
+	cm.TagPeer(p, tag, weight)
+}
+
+// untagPeer removes the tag from the peer in the host's connection manager, unless tagging is
+// disabled.
+func (r *Relay) untagPeer(p peer.ID, tag string) {
+	if !r.connManagerTagging {
+		return
+	}
+	cm := r.host.ConnManager()
+	if cm == nil {
+		return
+	}
+	defer r.recoverConnManagerPanic(p, tag)
+	cm.UntagPeer(p, tag)
+}
+
+// recoverConnManagerPanic prevents a faulty connection manager from taking down the relay;
+// tags are best effort.
+func (r *Relay) recoverConnManagerPanic(p peer.ID, tag string) {
+	if rerr := recover(); rerr != nil {
+		log.Error("connection manager panicked", "peer", p, "tag", tag, "panic", rerr)
+	}
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+type connManagerHost struct {
+	host.Host
+	cm connmgr.ConnManager
+}
+
+func (h *connManagerHost) ConnManager() connmgr.ConnManager { return h.cm }
+
+type recordingConnManager struct {
+	connmgr.NullConnMgr
+
+	mx    sync.Mutex
+	tags  int
+	panic bool
+}
+
+func (cm *recordingConnManager) TagPeer(peer.ID, string, int) {
+	cm.mx.Lock()
+	cm.tags++
+	cm.mx.Unlock()
+	if cm.panic {
+		panic("unknown tag")
+	}
+}
+
+func (cm *recordingConnManager) UntagPeer(peer.ID, string) {
+	if cm.panic {
+		panic("unknown tag")
+	}
+}
+
+func (cm *recordingConnManager) Tags() int {
+	cm.mx.Lock()
+	defer cm.mx.Unlock()
+	return cm.tags
+}
+
+func TestConnManagerTagging(t *testing.T) {
+	tcs := []struct {
+		name     string
+		cm       *recordingConnManager
+		opts     []Option
+		wantTags bool
+	}{
+		{name: "enabled", cm: &recordingConnManager{}, wantTags: true},
+		{name: "disabled", cm: &recordingConnManager{}, opts: []Option{WithConnManagerTagging(false)}},
+		{name: "panicking conn manager", cm: &recordingConnManager{panic: true}, wantTags: true},
+		{name: "nil conn manager"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			h := &connManagerHost{Host: relayHost}
+			if tc.cm != nil {
+				h.cm = tc.cm
+			}
+			r, err := New(h, tc.opts...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			addCircuitTransport(t, src)
+			addCircuitTransport(t, dest)
+			dest.SetStreamHandler("test", func(s network.Stream) { s.Close() })
+
+			s, err := openCircuit(t, src, dest, relayHost, "test")
+			require.NoError(t, err)
+			s.Close()
+
+			if tc.cm != nil {
+				if tc.wantTags {
+					require.NotZero(t, tc.cm.Tags())
+				} else {
+					require.Zero(t, tc.cm.Tags())
+				}
+			}
+		})
+	}
+}
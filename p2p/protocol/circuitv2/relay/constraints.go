@@ -2,6 +2,7 @@ package relay
 
 import (
 	"errors"
+	"net"
 	"slices"
 	"sync"
 	"time"
@@ -27,6 +28,11 @@ type peerWithExpiry struct {
 // constraints implements various reservation constraints
 type constraints struct {
 	rc *Resources
+	// asnLookup maps IP addresses to ASNs; if nil, only IPv6 addresses are mapped, using the
+	// embedded ASN database.
+	asnLookup func(net.IP) uint32
+	// reserved is the capacity set aside for priority peers; it is nil if there is none.
+	reserved *reservedCapacity
 
 	mutex sync.Mutex
 	total []peerWithExpiry
@@ -48,15 +54,46 @@ func newConstraints(rc *Resources) *constraints {
 // Reserve adds a reservation for a given peer with a given multiaddr.
 // If adding this reservation violates IP, ASN, or total reservation constraints, an error is returned.
 func (c *constraints) Reserve(p peer.ID, a ma.Multiaddr, expiry time.Time) error {
+	return c.reserve(p, a, expiry, false)
+}
+
+// Restore adds a reservation restored from a handoff token for a given peer with a given
+// multiaddr. Only the total reservation constraint is enforced; the reservation still counts
+// against the IP and ASN constraints of later reservations.
+func (c *constraints) Restore(p peer.ID, a ma.Multiaddr, expiry time.Time) error {
+	return c.reserve(p, a, expiry, true)
+}
+
+// ReserveReplacing adds a reservation for a given peer with a given multiaddr in place of the
+// reservation of victim, like Reserve, or like Restore if capacityOnly is set. The reservation of
+// victim is only removed if the reservation for p is added.
+func (c *constraints) ReserveReplacing(p, victim peer.ID, a ma.Multiaddr, expiry time.Time, capacityOnly bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := c.peerReservations(victim)
+	c.cleanupPeer(victim)
+	if err := c.reserveLocked(p, a, expiry, capacityOnly); err != nil {
+		c.restorePeer(removed)
+		return err
+	}
+	return nil
+}
+
+func (c *constraints) reserve(p peer.ID, a ma.Multiaddr, expiry time.Time, capacityOnly bool) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	return c.reserveLocked(p, a, expiry, capacityOnly)
+}
 
+// reserveLocked adds a reservation; c.mutex must be held.
+func (c *constraints) reserveLocked(p peer.ID, a ma.Multiaddr, expiry time.Time, capacityOnly bool) error {
 	now := time.Now()
 	c.cleanup(now)
 	// To handle refreshes correctly, remove the existing reservation for the peer.
 	c.cleanupPeer(p)
 
-	if len(c.total) >= c.rc.MaxReservations {
+	if len(c.total) >= c.rc.MaxReservations || c.reservedCapacityExceeded(p) {
 		return errTooManyReservations
 	}
 
@@ -66,19 +103,16 @@ func (c *constraints) Reserve(p peer.ID, a ma.Multiaddr, expiry time.Time) error
 	}
 
 	ipReservations := c.ips[ip.String()]
-	if len(ipReservations) >= c.rc.MaxReservationsPerIP {
+	if !capacityOnly && len(ipReservations) >= c.rc.MaxReservationsPerIP {
 		return errTooManyReservationsForIP
 	}
 
 	var asnReservations []peerWithExpiry
-	var asn uint32
-	if ip.To4() == nil {
-		asn = asnutil.AsnForIPv6(ip)
-		if asn != 0 {
-			asnReservations = c.asns[asn]
-			if len(asnReservations) >= c.rc.MaxReservationsPerASN {
-				return errTooManyReservationsForASN
-			}
+	asn := c.lookupASN(ip)
+	if asn != 0 {
+		asnReservations = c.asns[asn]
+		if !capacityOnly && len(asnReservations) >= c.rc.MaxReservationsPerASN {
+			return errTooManyReservationsForASN
 		}
 	}
 
@@ -94,6 +128,17 @@ func (c *constraints) Reserve(p peer.ID, a ma.Multiaddr, expiry time.Time) error
 	return nil
 }
 
+// lookupASN returns the ASN of ip, or 0 if it is unknown.
+func (c *constraints) lookupASN(ip net.IP) uint32 {
+	if c.asnLookup != nil {
+		return c.asnLookup(ip)
+	}
+	if ip.To4() == nil {
+		return asnutil.AsnForIPv6(ip)
+	}
+	return 0
+}
+
 func (c *constraints) cleanup(now time.Time) {
 	expireFunc := func(pe peerWithExpiry) bool {
 		return pe.Expiry.Before(now)
@@ -131,3 +176,112 @@ func (c *constraints) cleanupPeer(p peer.ID) {
 		}
 	}
 }
+
+// peerReservations are the entries of the reservation of a peer.
+type peerReservations struct {
+	total []peerWithExpiry
+	ips   map[string][]peerWithExpiry
+	asns  map[uint32][]peerWithExpiry
+}
+
+// peerReservations returns the entries of the reservation of p, so that they can be restored
+// with restorePeer after cleanupPeer removed them.
+func (c *constraints) peerReservations(p peer.ID) peerReservations {
+	pick := func(pes []peerWithExpiry) []peerWithExpiry {
+		var res []peerWithExpiry
+		for _, pe := range pes {
+			if pe.Peer == p {
+				res = append(res, pe)
+			}
+		}
+		return res
+	}
+	res := peerReservations{
+		total: pick(c.total),
+		ips:   make(map[string][]peerWithExpiry),
+		asns:  make(map[uint32][]peerWithExpiry),
+	}
+	for k, ipReservations := range c.ips {
+		if pes := pick(ipReservations); len(pes) > 0 {
+			res.ips[k] = pes
+		}
+	}
+	for k, asnReservations := range c.asns {
+		if pes := pick(asnReservations); len(pes) > 0 {
+			res.asns[k] = pes
+		}
+	}
+	return res
+}
+
+// restorePeer adds back the reservation entries returned by peerReservations.
+func (c *constraints) restorePeer(res peerReservations) {
+	c.total = append(c.total, res.total...)
+	for k, pes := range res.ips {
+		c.ips[k] = append(c.ips[k], pes...)
+	}
+	for k, pes := range res.asns {
+		c.asns[k] = append(c.asns[k], pes...)
+	}
+}
+
+// ConstraintsSnapshot is a copy of the reservation counts tracked to enforce the reservation
+// constraints in Resources.
+type ConstraintsSnapshot struct {
+	// Total is the number of reservations counted against MaxReservations.
+	Total int
+	// IPs is the number of reservations per IP address, counted against MaxReservationsPerIP.
+	IPs map[string]int
+	// ASNs is the number of reservations per ASN, counted against MaxReservationsPerASN.
+	// Only IPv6 addresses are attributed to an ASN, unless an ASN lookup is set with WithASNLookup.
+	ASNs map[uint32]int
+}
+
+// snapshot returns the current reservation counts, ignoring expired reservations.
+func (c *constraints) snapshot(now time.Time) ConstraintsSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	count := func(pes []peerWithExpiry) int {
+		n := 0
+		for _, pe := range pes {
+			if !pe.Expiry.Before(now) {
+				n++
+			}
+		}
+		return n
+	}
+	snap := ConstraintsSnapshot{
+		Total: count(c.total),
+		IPs:   make(map[string]int, len(c.ips)),
+		ASNs:  make(map[uint32]int, len(c.asns)),
+	}
+	for ip, pes := range c.ips {
+		if n := count(pes); n > 0 {
+			snap.IPs[ip] = n
+		}
+	}
+	for asn, pes := range c.asns {
+		if n := count(pes); n > 0 {
+			snap.ASNs[asn] = n
+		}
+	}
+	return snap
+}
+
+// full returns true if a reservation by an ordinary peer would exceed MaxReservations, or take
+// up capacity set aside for priority peers.
+func (c *constraints) full(now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cleanup(now)
+	return len(c.total) >= c.rc.MaxReservations || c.reservedCapacityExceeded("")
+}
+
+// ConstraintsSnapshot returns a copy of the reservation counts the relay tracks to enforce the
+// per IP and per ASN reservation limits. It is meant for diagnosing refused reservations.
+func (r *Relay) ConstraintsSnapshot() ConstraintsSnapshot {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.constraints.snapshot(time.Now())
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
 
 	ma "github.com/multiformats/go-multiaddr"
 )
@@ -117,6 +118,32 @@ func TestConstraints(t *testing.T) {
 			t.Fatalf("expected reservation for different IP to be possible, got %v", err)
 		}
 	})
+
+	t.Run("reservations per ASN with lookup", func(t *testing.T) {
+		asns := map[string]uint32{
+			"192.0.2.1":    64500,
+			"192.0.2.2":    64500,
+			"198.51.100.1": 64500,
+			"203.0.113.1":  64501,
+		}
+		res := infResources()
+		res.MaxReservationsPerASN = 2
+		c := newConstraints(res)
+		c.asnLookup = func(ip net.IP) uint32 { return asns[ip.String()] }
+
+		addr := func(ip string) ma.Multiaddr { return ma.StringCast("/ip4/" + ip + "/tcp/1234") }
+		require.NoError(t, c.Reserve(test.RandPeerIDFatal(t), addr("192.0.2.1"), expiry))
+		require.NoError(t, c.Reserve(test.RandPeerIDFatal(t), addr("192.0.2.2"), expiry))
+		// a different IP in the same ASN
+		require.Equal(t, errTooManyReservationsForASN, c.Reserve(test.RandPeerIDFatal(t), addr("198.51.100.1"), expiry))
+		// other ASNs and IPs with an unknown ASN aren't affected
+		require.NoError(t, c.Reserve(test.RandPeerIDFatal(t), addr("203.0.113.1"), expiry))
+		require.NoError(t, c.Reserve(test.RandPeerIDFatal(t), addr("233.252.0.1"), expiry))
+		require.NoError(t, c.Reserve(test.RandPeerIDFatal(t), addr("233.252.0.1"), expiry))
+
+		snap := c.snapshot(time.Now())
+		require.Equal(t, map[uint32]int{64500: 2, 64501: 1}, snap.ASNs)
+	})
 }
 
 func TestConstraintsCleanup(t *testing.T) {
@@ -144,3 +171,101 @@ func TestConstraintsCleanup(t *testing.T) {
 		t.Fatalf("expected old reservations to have been garbage collected, %v", err)
 	}
 }
+
+func TestConstraintsSnapshot(t *testing.T) {
+	res := &Resources{
+		MaxReservations:        math.MaxInt32,
+		MaxReservationsPerPeer: math.MaxInt32,
+		MaxReservationsPerIP:   math.MaxInt32,
+		MaxReservationsPerASN:  math.MaxInt32,
+	}
+	c := newConstraints(res)
+	now := time.Now()
+	expiry := now.Add(time.Hour)
+
+	ip1 := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	ip2 := ma.StringCast("/ip4/5.6.7.8/udp/1234/quic-v1")
+	ip3 := ma.StringCast("/ip6/2a03:2880:f003:c07:face:b00c::1/tcp/1234")
+	p1, p2, p3, p4 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	require.NoError(t, c.Reserve(p1, ip1, expiry))
+	require.NoError(t, c.Reserve(p2, ip1, expiry))
+	require.NoError(t, c.Reserve(p3, ip2, expiry))
+	require.NoError(t, c.Reserve(p4, ip3, expiry))
+
+	snap := c.snapshot(now)
+	require.Equal(t, 4, snap.Total)
+	require.Equal(t, map[string]int{
+		"1.2.3.4":                          2,
+		"5.6.7.8":                          1,
+		"2a03:2880:f003:c07:face:b00c:0:1": 1,
+	}, snap.IPs)
+	require.Len(t, snap.ASNs, 1)
+	for _, n := range snap.ASNs {
+		require.Equal(t, 1, n)
+	}
+
+	// the snapshot is a copy
+	snap.IPs["1.2.3.4"] = 42
+	require.Equal(t, 2, c.snapshot(now).IPs["1.2.3.4"])
+
+	c.cleanupPeer(p1)
+	c.cleanupPeer(p4)
+	snap = c.snapshot(now)
+	require.Equal(t, 2, snap.Total)
+	require.Equal(t, map[string]int{"1.2.3.4": 1, "5.6.7.8": 1}, snap.IPs)
+	require.Empty(t, snap.ASNs)
+
+	// expired reservations are not counted
+	snap = c.snapshot(expiry.Add(time.Second))
+	require.Zero(t, snap.Total)
+	require.Empty(t, snap.IPs)
+}
+
+func TestRelayConstraintsSnapshot(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, h1, h2 := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, h1, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, h2, relayHost)
+	require.NoError(t, err)
+
+	snap := r.ConstraintsSnapshot()
+	require.Equal(t, 2, snap.Total)
+	require.Equal(t, map[string]int{"127.0.0.1": 2}, snap.IPs)
+
+	// disconnecting drops the reservation along with its constraints
+	require.NoError(t, h1.Network().ClosePeer(relayHost.ID()))
+	require.Eventually(t, func() bool { return r.ConstraintsSnapshot().Total == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, map[string]int{"127.0.0.1": 1}, r.ConstraintsSnapshot().IPs)
+}
+
+func TestASNLookup(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, h1, h2, h3 := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	rc := DefaultResources()
+	rc.MaxReservationsPerASN = 2
+	r, err := New(relayHost, WithResources(rc), WithRecentRefusals(8), WithASNLookup(func(net.IP) uint32 { return 64500 }))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, h1, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, h2, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, h3, relayHost)
+	require.Error(t, err)
+
+	refusals := r.RecentRefusals()
+	require.Len(t, refusals, 1)
+	require.Equal(t, h3.ID(), refusals[0].Peer)
+	require.Equal(t, errTooManyReservationsForASN.Error(), refusals[0].Constraint)
+
+	_, err = New(relayHost, WithASNLookup(nil))
+	require.Error(t, err)
+}
@@ -0,0 +1,27 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// CircuitCostFunc returns the cost of a relayed connection from src to dest, allowing cheap
+// and expensive classes of connections to share the per peer budget.
+// Costs below 1 are treated as 1.
+type CircuitCostFunc func(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) int
+
+func (r *Relay) circuitCost(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) int {
+	if r.circuitCostFunc == nil {
+		return 1
+	}
+	return max(r.circuitCostFunc(src, srcAddr, dest), 1)
+}
+
+// circuitCostBudget returns the maximum sum of the circuit costs of a peer.
+func (r *Relay) circuitCostBudget() int {
+	if r.rc.MaxCircuitCostPerPeer > 0 {
+		return r.rc.MaxCircuitCostPerPeer
+	}
+	return r.rc.MaxCircuits
+}
@@ -0,0 +1,105 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// connectRaw sends a connection request for dest to the relay, returning the hop stream and the
+// status of the response.
+func connectRaw(t *testing.T, h, relayHost host.Host, dest peer.ID) (network.Stream, pbv2.Status) {
+	t.Helper()
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Reset() })
+
+	msg := &pbv2.HopMessage{
+		Type: pbv2.HopMessage_CONNECT.Enum(),
+		Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest}),
+	}
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(msg))
+	var resp pbv2.HopMessage
+	require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+	return s, resp.GetStatus()
+}
+
+func TestCircuitCost(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, cheap, heavy := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	rc := DefaultResources()
+	rc.MaxCircuitCostPerPeer = 6
+	r, err := New(relayHost, WithResources(rc), WithCircuitCost(func(_ peer.ID, _ ma.Multiaddr, dest peer.ID) int {
+		if dest == heavy.ID() {
+			return 5
+		}
+		return 1
+	}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	for _, h := range []host.Host{cheap, heavy} {
+		handleStopEcho(h)
+		_, err := reserve(t, h, relayHost)
+		require.NoError(t, err)
+	}
+
+	heavyStream, status := connectRaw(t, src, relayHost, heavy.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	_, status = connectRaw(t, src, relayHost, cheap.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	// the budget of the source is exhausted
+	_, status = connectRaw(t, src, relayHost, cheap.ID())
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+	_, status = connectRaw(t, src, relayHost, heavy.ID())
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+
+	// closing the heavy circuit frees its cost
+	heavyStream.Reset()
+	require.Eventually(t, func() bool {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		return r.conns[src.ID()] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	for range 5 {
+		_, status = connectRaw(t, src, relayHost, cheap.ID())
+		require.Equal(t, pbv2.Status_OK, status)
+	}
+	_, status = connectRaw(t, src, relayHost, cheap.ID())
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+}
+
+func TestCircuitCostDefault(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.MaxCircuits = 2
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	for range 2 {
+		_, status := connectRaw(t, src, relayHost, dest.ID())
+		require.Equal(t, pbv2.Status_OK, status)
+	}
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+}
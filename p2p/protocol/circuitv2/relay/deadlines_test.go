@@ -0,0 +1,103 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+// deadlineStream records the write deadlines set on it.
+type deadlineStream struct {
+	network.Stream
+
+	buf            bytes.Buffer
+	writeDeadlines []time.Time
+}
+
+func (s *deadlineStream) SetWriteDeadline(t time.Time) error {
+	s.writeDeadlines = append(s.writeDeadlines, t)
+	return nil
+}
+
+func (s *deadlineStream) Write(b []byte) (int, error) {
+	return s.buf.Write(b)
+}
+
+func TestReserveReadTimeout(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	rc := DefaultResources()
+	rc.ReserveReadTimeout = 100 * time.Millisecond
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Reset()
+	// make sure the stream is opened on the relay without sending a request
+	_, err = s.Write(nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	var resp pbv2.HopMessage
+	require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+	require.Equal(t, pbv2.Status_MALFORMED_MESSAGE, resp.GetStatus())
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestStopHandshakeTimeout(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.StopHandshakeTimeout = 100 * time.Millisecond
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// the destination never answers the stop handshake
+	unblock := make(chan struct{})
+	defer close(unblock)
+	dest.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		defer s.Reset()
+		<-unblock
+	})
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_CONNECTION_FAILED, status)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestResponseWriteTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		r := &Relay{rc: Resources{ResponseWriteTimeout: timeout}}
+		s := &deadlineStream{}
+		start := time.Now()
+		require.NoError(t, r.writeResponse(s, pbv2.Status_OK, nil, nil))
+		require.NotZero(t, s.buf.Len())
+
+		expected := timeout
+		if expected == 0 {
+			expected = StreamTimeout
+		}
+		require.Len(t, s.writeDeadlines, 2)
+		require.WithinDuration(t, start.Add(expected), s.writeDeadlines[0], time.Second/2)
+		// the deadline is cleared after the write
+		require.True(t, s.writeDeadlines[1].IsZero())
+	}
+}
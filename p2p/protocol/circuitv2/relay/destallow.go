@@ -0,0 +1,38 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// destinationAllowlist is a set of peers that may be the destination of relayed connections.
+type destinationAllowlist map[peer.ID]struct{}
+
+func newDestinationAllowlist(peers []peer.ID) destinationAllowlist {
+	allow := make(destinationAllowlist, len(peers))
+	for _, p := range peers {
+		allow[p] = struct{}{}
+	}
+	return allow
+}
+
+// SetDestinationAllowlist replaces the destination allowlist of the relay (see
+// WithDestinationAllowlist). It applies to connection requests received after it returns. A nil
+// or empty list removes the allowlist, allowing any destination.
+func (r *Relay) SetDestinationAllowlist(peers []peer.ID) {
+	if len(peers) == 0 {
+		r.destAllowlist.Store(nil)
+		return
+	}
+	allow := newDestinationAllowlist(peers)
+	r.destAllowlist.Store(&allow)
+}
+
+// destinationAllowed returns whether dest may be the destination of a relayed connection.
+func (r *Relay) destinationAllowed(dest peer.ID) bool {
+	allow := r.destAllowlist.Load()
+	if allow == nil {
+		return true
+	}
+	_, ok := (*allow)[dest]
+	return ok
+}
@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestinationAllowlist(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, service, other := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	r, err := New(relayHost, WithDestinationAllowlist([]peer.ID{service.ID()}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	for _, h := range hosts[2:] {
+		handleStopEcho(h)
+		_, err := reserve(t, h, relayHost)
+		require.NoError(t, err)
+	}
+
+	_, status := connectRaw(t, src, relayHost, service.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	_, status = connectRaw(t, src, relayHost, other.ID())
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, status)
+
+	refusals := r.RecentRefusals()
+	require.NotEmpty(t, refusals)
+	last := refusals[len(refusals)-1]
+	require.Equal(t, other.ID(), last.Destination)
+	require.Equal(t, "destination allowlist", last.Constraint)
+
+	// swap the allowlist at runtime
+	r.SetDestinationAllowlist([]peer.ID{other.ID()})
+	_, status = connectRaw(t, src, relayHost, other.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	_, status = connectRaw(t, src, relayHost, service.ID())
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, status)
+
+	// and remove it
+	r.SetDestinationAllowlist(nil)
+	_, status = connectRaw(t, src, relayHost, service.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+}
+
+func TestWithDestinationAllowlistEmpty(t *testing.T) {
+	require.Error(t, WithDestinationAllowlist(nil)(&Relay{}))
+}
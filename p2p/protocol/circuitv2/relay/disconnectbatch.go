@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// disconnectBatch coalesces the disconnects of peers over a window, so that they are processed
+// together with WithDisconnectBatching.
+type disconnectBatch struct {
+	window time.Duration
+
+	mx     sync.Mutex
+	closed bool
+	peers  map[peer.ID]struct{}
+	// timer flushes the batch; it is nil if the batch is empty.
+	timer *time.Timer
+}
+
+// queueDisconnect adds p to the current batch of disconnected peers, starting a new batch if
+// there is none.
+func (r *Relay) queueDisconnect(p peer.ID) {
+	b := r.disconnectBatch
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.closed {
+		return
+	}
+	if b.peers == nil {
+		b.peers = make(map[peer.ID]struct{})
+	}
+	b.peers[p] = struct{}{}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, r.flushDisconnects)
+	}
+}
+
+// flushDisconnects processes the current batch of disconnected peers. Peers that reconnected
+// since they were added to the batch are skipped.
+func (r *Relay) flushDisconnects() {
+	b := r.disconnectBatch
+	b.mx.Lock()
+	peers := b.peers
+	b.peers = nil
+	b.timer = nil
+	b.mx.Unlock()
+
+	ps := make([]peer.ID, 0, len(peers))
+	for p := range peers {
+		if r.host.Network().Connectedness(p) != network.Connected {
+			ps = append(ps, p)
+		}
+	}
+	if len(ps) > 0 {
+		r.peersDisconnected(ps)
+	}
+}
+
+// close stops batching; the pending batch is discarded, as closing the relay drops all
+// reservations anyway.
+func (b *disconnectBatch) close() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.closed = true
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.peers = nil
+}
@@ -0,0 +1,116 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	"github.com/stretchr/testify/require"
+)
+
+// churnNetwork is a network to which no peer is connected.
+type churnNetwork struct {
+	network.Network
+}
+
+func (churnNetwork) Connectedness(peer.ID) network.Connectedness { return network.NotConnected }
+
+// churnConn is a closed connection to p.
+type churnConn struct {
+	network.Conn
+	p peer.ID
+}
+
+func (c *churnConn) RemotePeer() peer.ID { return c.p }
+
+// addChurnReservations adds reservations for n random peers, and returns the peers.
+func (r *Relay) addChurnReservations(t testing.TB, n int) []peer.ID {
+	ps := make([]peer.ID, 0, n)
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for range n {
+		p := test.RandPeerIDFatal(t)
+		r.rsvp[p] = reservation{expire: time.Now().Add(time.Hour)}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+func (r *Relay) reservationCount() int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return len(r.rsvp)
+}
+
+func TestDisconnectBatchingChurn(t *testing.T) {
+	const n = 1000
+
+	h := getTestHosts(t, 1)[0]
+	r, err := New(h, WithDisconnectBatching(20*time.Millisecond))
+	require.NoError(t, err)
+	defer r.Close()
+
+	ps := r.addChurnReservations(t, n)
+	var wg sync.WaitGroup
+	for _, p := range ps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// several connections of a peer may close
+			r.disconnected(churnNetwork{}, &churnConn{p: p})
+			r.disconnected(churnNetwork{}, &churnConn{p: p})
+		}()
+	}
+	wg.Wait()
+
+	// no reservation is leaked
+	require.Eventually(t, func() bool { return r.reservationCount() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDisconnectBatchingReconnect(t *testing.T) {
+	const window = 300 * time.Millisecond
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		kept bool
+	}{
+		{name: "not batched"},
+		{name: "batched", opts: []Option{WithDisconnectBatching(window)}, kept: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, h := hosts[0], hosts[1]
+
+			r, err := New(relayHost, tc.opts...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			_, err = reserve(t, h, relayHost)
+			require.NoError(t, err)
+
+			// the peer reconnects right after disconnecting
+			require.NoError(t, relayHost.Network().ClosePeer(h.ID()))
+			require.Eventually(t, func() bool {
+				return relayHost.Network().Connectedness(h.ID()) != network.Connected &&
+					h.Network().Connectedness(relayHost.ID()) != network.Connected
+			}, 5*time.Second, time.Millisecond)
+			require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+
+			time.Sleep(2 * window)
+			require.Equal(t, tc.kept, r.hasReservation(h.ID()))
+		})
+	}
+}
+
+func TestWithDisconnectBatching(t *testing.T) {
+	r := &Relay{}
+	require.Error(t, WithDisconnectBatching(0)(r))
+	require.NoError(t, WithDisconnectBatching(time.Second)(r))
+	require.Equal(t, time.Second, r.disconnectBatch.window)
+}
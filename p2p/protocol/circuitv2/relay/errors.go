@@ -0,0 +1,36 @@
+package relay
+
+import (
+	"fmt"
+)
+
+// OptionError is the error returned by New when an option fails to apply.
+type OptionError struct {
+	// Index is the position of the failing option among the options passed to New.
+	Index int
+	// Err is the error returned by the option.
+	Err error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("error applying relay option: %s", e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// ResourceScopeError is the error returned by New when the resource manager refuses the scope of
+// the relay service.
+type ResourceScopeError struct {
+	// Err is the error returned by the resource manager.
+	Err error
+}
+
+func (e *ResourceScopeError) Error() string {
+	return fmt.Sprintf("error opening relay service scope: %s", e.Err)
+}
+
+func (e *ResourceScopeError) Unwrap() error {
+	return e.Err
+}
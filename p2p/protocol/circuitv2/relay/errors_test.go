@@ -0,0 +1,48 @@
+package relay
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/stretchr/testify/require"
+)
+
+var errRefusedService = errors.New("service refused")
+
+// refusingResourceManager refuses to provide a service scope.
+type refusingResourceManager struct {
+	network.NullResourceManager
+}
+
+func (rm *refusingResourceManager) ViewService(string, func(network.ServiceScope) error) error {
+	return errRefusedService
+}
+
+func TestNewOptionError(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+
+	_, err := New(h, WithInfiniteLimits(), WithRecentRefusals(-1))
+	var oerr *OptionError
+	require.ErrorAs(t, err, &oerr)
+	require.Equal(t, 1, oerr.Index)
+	require.ErrorContains(t, err, "error applying relay option")
+
+	var serr *ResourceScopeError
+	require.False(t, errors.As(err, &serr))
+}
+
+func TestNewResourceScopeError(t *testing.T) {
+	rm := &refusingResourceManager{}
+	h := getTestHosts(t, 1, swarmt.WithSwarmOpts(swarm.WithResourceManager(rm)))[0]
+
+	_, err := New(h)
+	var serr *ResourceScopeError
+	require.ErrorAs(t, err, &serr)
+	require.ErrorIs(t, err, errRefusedService)
+
+	var oerr *OptionError
+	require.False(t, errors.As(err, &oerr))
+}
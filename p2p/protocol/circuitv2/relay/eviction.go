@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ReservationEvictionPolicy selects the reservation to evict when a new reservation would
+// exceed MaxReservations.
+type ReservationEvictionPolicy int
+
+const (
+	// EvictNone never evicts reservations; new reservations are refused at capacity.
+	EvictNone ReservationEvictionPolicy = iota
+	// EvictSoonestExpiring evicts the reservation closest to its expiration.
+	EvictSoonestExpiring
+	// EvictLeastRecentlyUsed evicts the reservation that was least recently renewed or used
+	// as the destination of a relayed connection.
+	EvictLeastRecentlyUsed
+)
+
+func (p ReservationEvictionPolicy) String() string {
+	switch p {
+	case EvictNone:
+		return "none"
+	case EvictSoonestExpiring:
+		return "soonest-expiring"
+	case EvictLeastRecentlyUsed:
+		return "least-recently-used"
+	default:
+		return "unknown"
+	}
+}
+
+// evictionCandidate selects the reservation to evict according to the eviction policy to make
+// room for a reservation by p. Reservations with active circuits and reservations of priority
+// peers set with WithReservedCapacity are never evicted.
+// It returns the empty peer ID if no reservation can be evicted.
+// r.mx must be held.
+func (r *Relay) evictionCandidate(p peer.ID) peer.ID {
+	var victim peer.ID
+	var victimRsvp reservation
+	for q, rsvp := range r.rsvp {
+		if q == p || r.conns[q] > 0 || r.reservedCapacity.isPriority(q) {
+			continue
+		}
+		if victim == "" || r.evictBefore(rsvp, victimRsvp) {
+			victim, victimRsvp = q, rsvp
+		}
+	}
+	return victim
+}
+
+// evictReservation removes the reservation of victim, once its entry in the reservation
+// constraints has been taken over with constraints.ReserveReplacing.
+// r.mx must be held.
+func (r *Relay) evictReservation(victim peer.ID) {
+	victimRsvp := r.rsvp[victim]
+	delete(r.rsvp, victim)
+	r.untagPeer(victim, "relay-reservation")
+	r.reservationEnded(victimRsvp, ReservationEndEvicted, time.Now())
+	if r.metricsTracer != nil {
+		r.metricsTracer.ReservationClosed(1)
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			mt.PeerReservationClosed(victim)
+		}
+	}
+}
+
+// evictBefore returns true if a should be evicted before b.
+func (r *Relay) evictBefore(a, b reservation) bool {
+	switch r.evictionPolicy {
+	case EvictSoonestExpiring:
+		return a.expire.Before(b.expire)
+	case EvictLeastRecentlyUsed:
+		return a.lastUsed.Before(b.lastUsed)
+	default:
+		return false
+	}
+}
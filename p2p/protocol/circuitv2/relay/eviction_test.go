@@ -0,0 +1,155 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func newEvictionTestRelay(t *testing.T, policy ReservationEvictionPolicy) (*Relay, host.Host, []host.Host) {
+	t.Helper()
+	hosts := getTestHosts(t, 4)
+	rc := DefaultResources()
+	rc.MaxReservations = 2
+	r, err := New(hosts[0], WithResources(rc), WithReservationEvictionPolicy(policy))
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return r, hosts[0], hosts[1:]
+}
+
+func reserveWithTTL(t *testing.T, h, relayHost host.Host, ttl time.Duration) error {
+	t.Helper()
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, h.Connect(context.Background(), rinfo))
+	_, err := client.Reserve(context.Background(), h, rinfo, client.WithReservationTTL(ttl))
+	return err
+}
+
+func TestReservationEvictionNone(t *testing.T) {
+	r, relayHost, hosts := newEvictionTestRelay(t, EvictNone)
+
+	for _, h := range hosts[:2] {
+		_, err := reserve(t, h, relayHost)
+		require.NoError(t, err)
+	}
+	_, err := reserve(t, hosts[2], relayHost)
+	require.Error(t, err)
+	require.True(t, r.hasReservation(hosts[0].ID()))
+	require.True(t, r.hasReservation(hosts[1].ID()))
+}
+
+func TestReservationEvictionSoonestExpiring(t *testing.T) {
+	r, relayHost, hosts := newEvictionTestRelay(t, EvictSoonestExpiring)
+
+	require.NoError(t, reserveWithTTL(t, hosts[0], relayHost, time.Hour))
+	require.NoError(t, reserveWithTTL(t, hosts[1], relayHost, time.Minute))
+	require.NoError(t, reserveWithTTL(t, hosts[2], relayHost, time.Hour))
+
+	require.True(t, r.hasReservation(hosts[0].ID()))
+	require.False(t, r.hasReservation(hosts[1].ID()))
+	require.True(t, r.hasReservation(hosts[2].ID()))
+}
+
+func TestReservationEvictionLeastRecentlyUsed(t *testing.T) {
+	r, relayHost, hosts := newEvictionTestRelay(t, EvictLeastRecentlyUsed)
+
+	_, err := reserve(t, hosts[0], relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, hosts[1], relayHost)
+	require.NoError(t, err)
+	// renewing marks the reservation as used
+	_, err = reserve(t, hosts[0], relayHost)
+	require.NoError(t, err)
+
+	_, err = reserve(t, hosts[2], relayHost)
+	require.NoError(t, err)
+
+	require.True(t, r.hasReservation(hosts[0].ID()))
+	require.False(t, r.hasReservation(hosts[1].ID()))
+	require.True(t, r.hasReservation(hosts[2].ID()))
+}
+
+func TestReservationEvictionSkipsActiveCircuits(t *testing.T) {
+	r, relayHost, hosts := newEvictionTestRelay(t, EvictSoonestExpiring)
+	src, dest, other := hosts[0], hosts[1], hosts[2]
+
+	addCircuitTransport(t, src)
+	addCircuitTransport(t, dest)
+	dest.SetStreamHandler("test", func(s network.Stream) {})
+
+	// dest's reservation expires soonest, but has an active circuit
+	require.NoError(t, reserveWithTTL(t, dest, relayHost, time.Minute))
+	s, err := openCircuit(t, src, dest, relayHost, "test")
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, reserveWithTTL(t, other, relayHost, time.Hour))
+
+	// src holds no reservation, so both existing reservations are candidates; only other's
+	// reservation can be evicted
+	require.NoError(t, reserveWithTTL(t, src, relayHost, time.Hour))
+	require.True(t, r.hasReservation(dest.ID()))
+	require.False(t, r.hasReservation(other.ID()))
+	require.True(t, r.hasReservation(src.ID()))
+}
+
+func TestReservationEvictionRefusedNewcomer(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, a, b := hosts[0], hosts[1], hosts[2]
+	rc := DefaultResources()
+	rc.MaxReservations = 2
+	rc.MaxReservationsPerIP = 1
+	r, err := New(relayHost, WithResources(rc), WithReservationEvictionPolicy(EvictSoonestExpiring))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, a, relayHost)
+	require.NoError(t, err)
+	// the soonest expiring reservation is held from another IP address
+	victim := test.RandPeerIDFatal(t)
+	victimAddr := ma.StringCast("/ip4/192.0.2.1/tcp/1234")
+	expire := time.Now().Add(time.Minute)
+	r.mx.Lock()
+	require.NoError(t, r.constraints.Reserve(victim, victimAddr, expire))
+	r.rsvp[victim] = reservation{expire: expire, granted: time.Now(), addr: victimAddr}
+	r.mx.Unlock()
+
+	// b shares a's IP address, so evicting the victim wouldn't make room for it
+	_, err = reserve(t, b, relayHost)
+	require.Error(t, err)
+	require.False(t, r.hasReservation(b.ID()))
+	require.True(t, r.hasReservation(victim))
+	snap := r.ConstraintsSnapshot()
+	require.Equal(t, 2, snap.Total)
+	require.Equal(t, map[string]int{"127.0.0.1": 1, "192.0.2.1": 1}, snap.IPs)
+}
+
+func TestReservationEvictionSkipsPriorityPeers(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, prio, a, b := hosts[0], hosts[1], hosts[2], hosts[3]
+	rc := DefaultResources()
+	rc.MaxReservations = 2
+	r, err := New(relayHost,
+		WithResources(rc),
+		WithReservedCapacity([]peer.ID{prio.ID()}, 1),
+		WithReservationEvictionPolicy(EvictSoonestExpiring),
+	)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// the priority peer's reservation expires soonest, but isn't evicted
+	require.NoError(t, reserveWithTTL(t, prio, relayHost, time.Minute))
+	require.NoError(t, reserveWithTTL(t, a, relayHost, time.Hour))
+	require.NoError(t, reserveWithTTL(t, b, relayHost, time.Hour))
+	require.True(t, r.hasReservation(prio.ID()))
+	require.False(t, r.hasReservation(a.ID()))
+	require.True(t, r.hasReservation(b.ID()))
+}
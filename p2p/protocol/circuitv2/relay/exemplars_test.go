@@ -0,0 +1,118 @@
+package relay
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func findMetric(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue metrics
+				}
+			}
+			return m
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return nil
+}
+
+func exemplarTraceID(e *dto.Exemplar) string {
+	for _, l := range e.GetLabel() {
+		if l.GetName() == "trace_id" {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestMetricsExemplars(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mt := NewMetricsTracer(WithRegisterer(reg), WithExemplars()).(ExemplarMetricsTracer)
+
+	mt.ConnectionOpenedWithTraceID("opened-trace")
+	mt.ConnectionClosedWithTraceID(time.Second, "closed-trace")
+
+	opened := findMetric(t, reg, "libp2p_relaysvc_connections_total", map[string]string{"type": "opened"})
+	require.Equal(t, "opened-trace", exemplarTraceID(opened.GetCounter().GetExemplar()))
+	closed := findMetric(t, reg, "libp2p_relaysvc_connections_total", map[string]string{"type": "closed"})
+	require.Equal(t, "closed-trace", exemplarTraceID(closed.GetCounter().GetExemplar()))
+
+	duration := findMetric(t, reg, "libp2p_relaysvc_connection_duration_seconds", nil)
+	var traceIDs []string
+	for _, b := range duration.GetHistogram().GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			traceIDs = append(traceIDs, exemplarTraceID(e))
+		}
+	}
+	require.Contains(t, traceIDs, "closed-trace")
+}
+
+func TestMetricsExemplarsInvalidTraceID(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mt := NewMetricsTracer(WithRegisterer(reg), WithExemplars()).(ExemplarMetricsTracer)
+
+	for _, traceID := range []string{strings.Repeat("a", prometheus.ExemplarMaxRunes), "trace-\xff"} {
+		require.NotPanics(t, func() {
+			mt.ConnectionOpenedWithTraceID(traceID)
+			mt.ConnectionClosedWithTraceID(time.Second, traceID)
+		})
+		opened := findMetric(t, reg, "libp2p_relaysvc_connections_total", map[string]string{"type": "opened"})
+		require.NotEqual(t, traceID, exemplarTraceID(opened.GetCounter().GetExemplar()))
+	}
+}
+
+func TestConnectExemplarsOversizedTraceID(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	reg := prometheus.NewRegistry()
+	r, err := New(relayHost, WithMetricsTracer(NewMetricsTracer(WithRegisterer(reg), WithExemplars())))
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Reset()
+	oversized := strings.Repeat("a", 200)
+	msg := &pbv2.HopMessage{
+		Type:    pbv2.HopMessage_CONNECT.Enum(),
+		Peer:    util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest.ID()}),
+		TraceID: &oversized,
+	}
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(msg))
+	var resp pbv2.HopMessage
+	require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+	require.Equal(t, pbv2.Status_OK, resp.GetStatus())
+
+	// the relay replaced the trace ID, and uses its own one as the exemplar
+	opened := findMetric(t, reg, "libp2p_relaysvc_connections_total", map[string]string{"type": "opened"})
+	traceID := exemplarTraceID(opened.GetCounter().GetExemplar())
+	require.True(t, util.ValidTraceID(traceID))
+	require.NotEqual(t, oversized, traceID)
+}
@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"golang.org/x/time/rate"
+)
+
+// SourceWeightFunc returns the weight of a source peer in the fair sharing of the relay's
+// bandwidth. Weights below 1 are treated as 1.
+type SourceWeightFunc func(src peer.ID) int
+
+// fairShare divides a total bandwidth budget between the source peers with active relayed
+// connections, in proportion to their weights. All relayed connections of a source peer share a
+// token bucket, in both directions, so that opening more connections doesn't earn a peer a
+// larger share. The shares are adjusted as source peers come and go.
+type fairShare struct {
+	rate   float64
+	weight SourceWeightFunc
+	// burst is the size of the token buckets; it must be at least the size of a read from a
+	// relayed stream.
+	burst int
+
+	mx          sync.Mutex
+	peers       map[peer.ID]*fairSharePeer
+	totalWeight int
+}
+
+type fairSharePeer struct {
+	limiter  *rate.Limiter
+	weight   int
+	circuits int
+}
+
+func newFairShare(bytesPerSecond float64, weight SourceWeightFunc) *fairShare {
+	return &fairShare{
+		rate:   bytesPerSecond,
+		weight: weight,
+		peers:  make(map[peer.ID]*fairSharePeer),
+	}
+}
+
+// add accounts for a relayed connection from src, and returns the token bucket it shares with
+// the other connections from src. A nil fairShare returns a nil limiter.
+func (fs *fairShare) add(src peer.ID) *rate.Limiter {
+	if fs == nil {
+		return nil
+	}
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	if p, ok := fs.peers[src]; ok {
+		p.circuits++
+		return p.limiter
+	}
+	w := 1
+	if fs.weight != nil {
+		w = max(fs.weight(src), 1)
+	}
+	p := &fairSharePeer{limiter: rate.NewLimiter(0, fs.burst), weight: w, circuits: 1}
+	fs.peers[src] = p
+	fs.totalWeight += w
+	fs.rebalance()
+	return p.limiter
+}
+
+// remove releases a relayed connection from src.
+func (fs *fairShare) remove(src peer.ID) {
+	if fs == nil {
+		return
+	}
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	p, ok := fs.peers[src]
+	if !ok {
+		return
+	}
+	p.circuits--
+	if p.circuits > 0 {
+		return
+	}
+	delete(fs.peers, src)
+	fs.totalWeight -= p.weight
+	fs.rebalance()
+}
+
+// rebalance sets the rate of every source peer to its share of the budget. The lock must be
+// held.
+func (fs *fairShare) rebalance() {
+	for _, p := range fs.peers {
+		p.limiter.SetLimit(rate.Limit(fs.rate * float64(p.weight) / float64(fs.totalWeight)))
+	}
+}
+
+// throttledReader delays reads from a relayed stream until the bytes read fit in the share of
+// its source peer.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// throttle returns rd throttled by limiter, or rd itself if limiter is nil.
+func (r *Relay) throttle(rd io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return rd
+	}
+	return &throttledReader{ctx: r.ctx, r: rd, limiter: limiter}
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	if len(b) > t.limiter.Burst() {
+		b = b[:t.limiter.Burst()]
+	}
+	n, err := t.r.Read(b)
+	if n > 0 {
+		if werr := t.limiter.WaitN(t.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,145 @@
+package relay
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestFairShareRebalance(t *testing.T) {
+	light, heavy := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	fs := newFairShare(4000, func(p peer.ID) int {
+		if p == heavy {
+			return 3
+		}
+		return 0
+	})
+	fs.burst = 1024
+
+	l1 := fs.add(light)
+	require.Equal(t, rate.Limit(4000), l1.Limit())
+	// more connections from the same peer share its bucket
+	require.Same(t, l1, fs.add(light))
+
+	l2 := fs.add(heavy)
+	require.Equal(t, rate.Limit(1000), l1.Limit())
+	require.Equal(t, rate.Limit(3000), l2.Limit())
+
+	fs.remove(heavy)
+	require.Equal(t, rate.Limit(4000), l1.Limit())
+	fs.remove(light)
+	require.Len(t, fs.peers, 1)
+	fs.remove(light)
+	require.Empty(t, fs.peers)
+	require.Zero(t, fs.totalWeight)
+}
+
+// handleStopCount counts the bytes relayed to h by source peer.
+func handleStopCount(h host.Host) func(peer.ID) int64 {
+	var mx sync.Mutex
+	counts := make(map[peer.ID]*atomic.Int64)
+	h.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		rd := util.NewDelimitedReader(s, maxMessageSize)
+		defer rd.Close()
+		var msg pbv2.StopMessage
+		if err := rd.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		src, err := peer.IDFromBytes(msg.GetPeer().GetId())
+		if err != nil {
+			s.Reset()
+			return
+		}
+		msg.Reset()
+		msg.Type = pbv2.StopMessage_STATUS.Enum()
+		msg.Status = pbv2.Status_OK.Enum()
+		if err := util.NewDelimitedWriter(s).WriteMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		mx.Lock()
+		count, ok := counts[src]
+		if !ok {
+			count = new(atomic.Int64)
+			counts[src] = count
+		}
+		mx.Unlock()
+		buf := make([]byte, 4096)
+		for {
+			n, err := s.Read(buf)
+			count.Add(int64(n))
+			if err != nil {
+				s.Reset()
+				return
+			}
+		}
+	})
+	return func(p peer.ID) int64 {
+		mx.Lock()
+		defer mx.Unlock()
+		if c, ok := counts[p]; ok {
+			return c.Load()
+		}
+		return 0
+	}
+}
+
+func TestFairBandwidthShare(t *testing.T) {
+	const budget = 64 << 10
+
+	hosts := getTestHosts(t, 4)
+	relayHost, greedy, modest, dest := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	_, err := New(relayHost, WithFairBandwidthShare(0, nil))
+	require.Error(t, err)
+
+	r, err := New(relayHost, WithInfiniteLimits(), WithFairBandwidthShare(budget, nil))
+	require.NoError(t, err)
+	defer r.Close()
+
+	relayed := handleStopCount(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	// the greedy source opens three relayed connections, the modest source only one
+	var streams []network.Stream
+	for range 3 {
+		s, status := connectRaw(t, greedy, relayHost, dest.ID())
+		require.Equal(t, pbv2.Status_OK, status)
+		streams = append(streams, s)
+	}
+	s, status := connectRaw(t, modest, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	streams = append(streams, s)
+
+	for _, s := range streams {
+		go io.Copy(s, zeroReader{})
+	}
+	time.Sleep(time.Second)
+
+	g, m := relayed(greedy.ID()), relayed(modest.ID())
+	total := g + m
+	require.Less(t, total, int64(2*budget))
+	require.InDelta(t, 0.5, float64(g)/float64(total), 0.15)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
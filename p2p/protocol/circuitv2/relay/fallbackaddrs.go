@@ -0,0 +1,31 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// fallbackReservationAddrs returns the operator supplied addresses to advertise in reservations
+// when none of the host's addresses pass the reservation address filter. Addresses without a peer
+// ID get the relay's peer ID appended; addresses with any other peer ID are skipped.
+func (r *Relay) fallbackReservationAddrs() []ma.Multiaddr {
+	fallback := r.fallbackAddrs()
+	addrs := make([]ma.Multiaddr, 0, len(fallback))
+	for _, addr := range fallback {
+		if len(addr) == 0 {
+			continue
+		}
+		id, _ := peer.IDFromP2PAddr(addr)
+		switch id {
+		case "":
+			addr = addr.Encapsulate(r.selfAddr)
+		case r.host.ID():
+		default:
+			log.Warn("skipping fallback address", "addr", addr, "reason", "contains an unexpected ID")
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
@@ -0,0 +1,103 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisconnectGracePeriod(t *testing.T) {
+	const grace = 500 * time.Millisecond
+
+	newRelay := func(t *testing.T) (r *Relay, h, relayHost host.Host) {
+		hosts := getTestHosts(t, 2)
+		relayHost, h = hosts[0], hosts[1]
+
+		rc := DefaultResources()
+		rc.DisconnectGracePeriod = grace
+		r, err := New(relayHost, WithResources(rc))
+		require.NoError(t, err)
+		t.Cleanup(func() { r.Close() })
+
+		_, err = reserve(t, h, relayHost)
+		require.NoError(t, err)
+		require.True(t, r.hasReservation(h.ID()))
+		return r, h, relayHost
+	}
+	inGracePeriod := func(r *Relay, p peer.ID) bool {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		rsvp, ok := r.rsvp[p]
+		return ok && !rsvp.disconnected.IsZero()
+	}
+
+	t.Run("reconnect within grace period", func(t *testing.T) {
+		r, h, relayHost := newRelay(t)
+
+		require.NoError(t, h.Network().ClosePeer(relayHost.ID()))
+		require.Eventually(t, func() bool { return inGracePeriod(r, h.ID()) }, grace/2, 10*time.Millisecond)
+		require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+
+		time.Sleep(2 * grace)
+		require.True(t, r.hasReservation(h.ID()))
+		require.False(t, inGracePeriod(r, h.ID()))
+	})
+
+	graceTimers := func(r *Relay) int {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		return len(r.graceTimers)
+	}
+
+	t.Run("reconnect stops the timer", func(t *testing.T) {
+		r, h, relayHost := newRelay(t)
+		rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+
+		for range 2 {
+			require.NoError(t, h.Network().ClosePeer(relayHost.ID()))
+			require.Eventually(t, func() bool { return inGracePeriod(r, h.ID()) }, grace/2, 10*time.Millisecond)
+			require.Equal(t, 1, graceTimers(r))
+			require.NoError(t, h.Connect(context.Background(), rinfo))
+			require.Eventually(t, func() bool { return !inGracePeriod(r, h.ID()) }, grace/2, 10*time.Millisecond)
+			require.Zero(t, graceTimers(r))
+		}
+	})
+
+	t.Run("close stops the timers", func(t *testing.T) {
+		r, h, relayHost := newRelay(t)
+
+		require.NoError(t, h.Network().ClosePeer(relayHost.ID()))
+		require.Eventually(t, func() bool { return inGracePeriod(r, h.ID()) }, grace/2, 10*time.Millisecond)
+		require.NoError(t, r.Close())
+		require.Zero(t, graceTimers(r))
+	})
+
+	t.Run("reconnect after grace period", func(t *testing.T) {
+		r, h, relayHost := newRelay(t)
+
+		require.NoError(t, h.Network().ClosePeer(relayHost.ID()))
+		require.Eventually(t, func() bool { return inGracePeriod(r, h.ID()) }, grace/2, 10*time.Millisecond)
+
+		require.Eventually(t, func() bool { return !r.hasReservation(h.ID()) }, 5*grace, 10*time.Millisecond)
+		require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+		require.False(t, r.hasReservation(h.ID()))
+	})
+
+	t.Run("no grace period", func(t *testing.T) {
+		hosts := getTestHosts(t, 2)
+		relayHost, h := hosts[0], hosts[1]
+
+		r, err := New(relayHost)
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, err = reserve(t, h, relayHost)
+		require.NoError(t, err)
+		require.NoError(t, h.Network().ClosePeer(relayHost.ID()))
+		require.Eventually(t, func() bool { return !r.hasReservation(h.ID()) }, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,73 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+)
+
+// HandoffWindow is how long after it starts a relay honors handoff tokens issued before it
+// restarted.
+const HandoffWindow = 5 * time.Minute
+
+var (
+	errHandoffTokenExpired      = errors.New("handoff token expired")
+	errHandoffTokenSameInstance = errors.New("handoff token issued since the relay started")
+	errHandoffWindowClosed      = errors.New("handoff window closed")
+)
+
+// makeHandoffToken returns a handoff token for the reservation of p expiring at expire, issued
+// by the relay instance started at relayStart, as a serialized record envelope signed with
+// signingKey.
+func makeHandoffToken(signingKey crypto.PrivKey, selfID, p peer.ID, expire, relayStart time.Time) ([]byte, error) {
+	if signingKey == nil {
+		return nil, errNoSigningKey
+	}
+	token := &proto.HandoffToken{Relay: selfID, Peer: p, Expiration: expire, RelayStart: relayStart}
+	env, err := record.Seal(token, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return env.Marshal()
+}
+
+// verifyHandoffToken checks that a handoff token presented by p was issued by this relay for p,
+// before it last restarted, and hasn't expired, and returns the expiration of the reservation it
+// was issued with. Tokens are only honored for HandoffWindow after the relay starts, so that they
+// can't be used to get around the per IP and per ASN limits while the relay is running.
+func (r *Relay) verifyHandoffToken(p peer.ID, b []byte, now time.Time) (time.Time, error) {
+	env, rec, err := record.ConsumeEnvelope(b, proto.HandoffRecordDomain)
+	if err != nil {
+		return time.Time{}, err
+	}
+	token, ok := rec.(*proto.HandoffToken)
+	if !ok {
+		return time.Time{}, fmt.Errorf("unexpected record type %T", rec)
+	}
+	signer, err := peer.IDFromPublicKey(env.PublicKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	self := r.host.ID()
+	if signer != self || token.Relay != self {
+		return time.Time{}, fmt.Errorf("handoff token issued by %s", signer)
+	}
+	if token.Peer != p {
+		return time.Time{}, fmt.Errorf("handoff token issued for %s", token.Peer)
+	}
+	if !token.Expiration.After(now) {
+		return time.Time{}, errHandoffTokenExpired
+	}
+	if token.RelayStart.IsZero() || !token.RelayStart.Before(r.started) {
+		return time.Time{}, errHandoffTokenSameInstance
+	}
+	if now.Sub(r.started) > r.handoffWindow {
+		return time.Time{}, errHandoffWindowClosed
+	}
+	return token.Expiration, nil
+}
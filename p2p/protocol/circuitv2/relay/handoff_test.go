@@ -0,0 +1,177 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/stretchr/testify/require"
+)
+
+// restartRelay closes r and starts a new relay on the same host, as if the relay restarted.
+func restartRelay(t *testing.T, r *Relay, opts ...Option) *Relay {
+	t.Helper()
+	require.NoError(t, r.Close())
+	r, err := New(r.host, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestHandoffTokens(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, a, b := hosts[0], hosts[1], hosts[2]
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+
+	// all hosts share an IP address, so only one of them can reserve a slot by default
+	rc := DefaultResources()
+	rc.MaxReservationsPerIP = 1
+	opts := []Option{WithResources(rc), WithHandoffTokens()}
+
+	r, err := New(relayHost, opts...)
+	require.NoError(t, err)
+	rsvp, err := reserve(t, a, relayHost)
+	require.NoError(t, err)
+	require.NotEmpty(t, rsvp.HandoffToken)
+	token := rsvp.HandoffToken
+
+	relayKey := relayHost.Peerstore().PrivKey(relayHost.ID())
+	expired, err := makeHandoffToken(relayKey, relayHost.ID(), a.ID(), time.Now().Add(-time.Minute), time.Now())
+	require.NoError(t, err)
+	forgerKey, _ := genKeyAndID(t)
+	forged, err := makeHandoffToken(forgerKey, relayHost.ID(), a.ID(), rsvp.Expiration, time.Now())
+	require.NoError(t, err)
+
+	// after the restart, b takes the only slot for the shared IP address
+	r = restartRelay(t, r, opts...)
+	require.False(t, r.hasReservation(a.ID()))
+	_, err = reserve(t, b, relayHost)
+	require.NoError(t, err)
+
+	reserveWithToken := func(h host.Host, token []byte) (*client.Reservation, error) {
+		return client.Reserve(context.Background(), h, rinfo, client.WithHandoffToken(token))
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		_, err := reserveWithToken(a, expired)
+		require.Error(t, err)
+		require.False(t, r.hasReservation(a.ID()))
+	})
+
+	t.Run("forged", func(t *testing.T) {
+		_, err := reserveWithToken(a, forged)
+		require.Error(t, err)
+		require.False(t, r.hasReservation(a.ID()))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := reserveWithToken(a, []byte("not a token"))
+		require.Error(t, err)
+		require.False(t, r.hasReservation(a.ID()))
+	})
+
+	t.Run("issued for another peer", func(t *testing.T) {
+		bToken, err := makeHandoffToken(relayKey, relayHost.ID(), b.ID(), rsvp.Expiration, time.Now())
+		require.NoError(t, err)
+		_, err = reserveWithToken(a, bToken)
+		require.Error(t, err)
+		require.False(t, r.hasReservation(a.ID()))
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		restored, err := reserveWithToken(a, token)
+		require.NoError(t, err)
+		require.True(t, r.hasReservation(a.ID()))
+		// the restored reservation doesn't outlive the original one
+		require.Equal(t, rsvp.Expiration, restored.Expiration)
+		require.NotEmpty(t, restored.HandoffToken)
+		require.Equal(t, 2, r.ConstraintsSnapshot().IPs["127.0.0.1"])
+	})
+}
+
+func TestHandoffTokensCapacity(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, a, b := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 1
+	opts := []Option{WithResources(rc), WithHandoffTokens()}
+
+	r, err := New(relayHost, opts...)
+	require.NoError(t, err)
+	rsvp, err := reserve(t, a, relayHost)
+	require.NoError(t, err)
+
+	r = restartRelay(t, r, opts...)
+	_, err = reserve(t, b, relayHost)
+	require.NoError(t, err)
+
+	// handoff tokens don't bypass the relay's capacity
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	_, err = client.Reserve(context.Background(), a, rinfo, client.WithHandoffToken(rsvp.HandoffToken))
+	require.Error(t, err)
+	require.False(t, r.hasReservation(a.ID()))
+}
+
+func TestHandoffTokensSameInstance(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, a, b := hosts[0], hosts[1], hosts[2]
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+
+	rc := DefaultResources()
+	rc.MaxReservationsPerIP = 1
+	r, err := New(relayHost, WithResources(rc), WithHandoffTokens())
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, a, relayHost)
+	require.NoError(t, err)
+	require.NoError(t, r.RevokeReservation(a.ID()))
+	_, err = reserve(t, b, relayHost)
+	require.NoError(t, err)
+
+	// a token issued by the running relay doesn't bypass the per IP limit
+	_, err = client.Reserve(context.Background(), a, rinfo, client.WithHandoffToken(rsvp.HandoffToken))
+	require.Error(t, err)
+	require.False(t, r.hasReservation(a.ID()))
+}
+
+func TestHandoffTokensWindow(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, a, b := hosts[0], hosts[1], hosts[2]
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+
+	rc := DefaultResources()
+	rc.MaxReservationsPerIP = 1
+	opts := []Option{WithResources(rc), WithHandoffTokens()}
+	r, err := New(relayHost, opts...)
+	require.NoError(t, err)
+	rsvp, err := reserve(t, a, relayHost)
+	require.NoError(t, err)
+
+	r = restartRelay(t, r, opts...)
+	_, err = reserve(t, b, relayHost)
+	require.NoError(t, err)
+
+	// tokens from before the restart are only honored shortly after it
+	r.started = time.Now().Add(-HandoffWindow - time.Second)
+	_, err = client.Reserve(context.Background(), a, rinfo, client.WithHandoffToken(rsvp.HandoffToken))
+	require.Error(t, err)
+	require.False(t, r.hasReservation(a.ID()))
+}
+
+func TestHandoffTokensDisabled(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, a := hosts[0], hosts[1]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, a, relayHost)
+	require.NoError(t, err)
+	require.Empty(t, rsvp.HandoffToken)
+}
@@ -0,0 +1,67 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConcurrentHandshakes(t *testing.T) {
+	const maxHandshakes = 4
+
+	hosts := getTestHosts(t, 3)
+	relayHost, attacker, h := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.MaxConcurrentHandshakes = maxHandshakes
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, attacker.Connect(context.Background(), rinfo))
+
+	// open hop streams that never send a request, stalling the handshake
+	stalled := make([]network.Stream, 0, maxHandshakes)
+	for range maxHandshakes {
+		s, err := attacker.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+		require.NoError(t, err)
+		// force the stream to be negotiated, so that the relay handles it
+		_, err = s.Write(nil)
+		require.NoError(t, err)
+		stalled = append(stalled, s)
+	}
+	require.Eventually(t, func() bool { return len(r.PendingHandshakes()) == maxHandshakes }, 5*time.Second, 10*time.Millisecond)
+
+	// further requests are refused right away instead of queueing behind the stalled ones
+	start := time.Now()
+	_, err = reserve(t, h, relayHost)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), StreamTimeout/2)
+	require.False(t, r.hasReservation(h.ID()))
+
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Reset()
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{Type: pbv2.HopMessage_RESERVE.Enum()}))
+	var resp pbv2.HopMessage
+	require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, resp.GetStatus())
+
+	// the slots are released when the stalled handshakes end
+	for _, s := range stalled {
+		s.Reset()
+	}
+	require.Eventually(t, func() bool {
+		_, err := reserve(t, h, relayHost)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	require.True(t, r.hasReservation(h.ID()))
+}
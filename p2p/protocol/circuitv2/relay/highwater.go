@@ -0,0 +1,55 @@
+package relay
+
+import (
+	"time"
+)
+
+const (
+	// reservationLowWaterMargin is the fraction of Resources.MaxReservations the reservations
+	// must drop below the high water mark for it to be cleared, so that the relay doesn't warn
+	// repeatedly while the number of reservations hovers around the mark.
+	reservationLowWaterMargin = 0.1
+	// highWaterLogInterval is the minimum time between warnings about reaching the high water
+	// mark.
+	highWaterLogInterval = time.Minute
+)
+
+// highWaterMark tracks whether the reservations have reached the high water mark set with
+// WithReservationHighWater. The methods are *not* thread-safe; the relay lock must be held.
+type highWaterMark struct {
+	fraction float64
+	reached  bool
+	logged   time.Time
+}
+
+// checkHighWater updates the high water state with the current number of reservations, reporting
+// the transitions. r.mx must be held.
+func (r *Relay) checkHighWater(now time.Time) {
+	hw := r.highWater
+	if hw == nil || r.rc.MaxReservations <= 0 {
+		return
+	}
+
+	usage := float64(len(r.rsvp)) / float64(r.rc.MaxReservations)
+	switch {
+	case !hw.reached && usage >= hw.fraction:
+		hw.reached = true
+		if now.Sub(hw.logged) >= highWaterLogInterval {
+			hw.logged = now
+			log.Warn("relay reservations reached the high water mark",
+				"reservations", len(r.rsvp),
+				"max_reservations", r.rc.MaxReservations)
+		}
+		if mt, ok := r.metricsTracer.(ReservationMetricsTracer); ok {
+			mt.ReservationHighWaterReached()
+		}
+	case hw.reached && usage < hw.fraction-reservationLowWaterMargin:
+		hw.reached = false
+		log.Info("relay reservations dropped below the low water mark",
+			"reservations", len(r.rsvp),
+			"max_reservations", r.rc.MaxReservations)
+		if mt, ok := r.metricsTracer.(ReservationMetricsTracer); ok {
+			mt.ReservationHighWaterCleared()
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package relay
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type highWaterMetricsTracer struct {
+	metricsTracer
+
+	reached, cleared atomic.Int32
+}
+
+func (mt *highWaterMetricsTracer) ReservationHighWaterReached() { mt.reached.Add(1) }
+func (mt *highWaterMetricsTracer) ReservationHighWaterCleared() { mt.cleared.Add(1) }
+
+func TestReservationHighWater(t *testing.T) {
+	hosts := getTestHosts(t, 7)
+	relayHost, peers := hosts[0], hosts[1:]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 10
+	mt := &highWaterMetricsTracer{}
+	r, err := New(relayHost, WithResources(rc), WithReservationHighWater(0.5), WithMetricsTracer(mt))
+	require.NoError(t, err)
+	defer r.Close()
+
+	requireMarks := func(reached, cleared int32) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			return mt.reached.Load() == reached && mt.cleared.Load() == cleared
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	disconnect := func(i int) {
+		t.Helper()
+		require.NoError(t, relayHost.Network().ClosePeer(peers[i].ID()))
+		require.Eventually(t, func() bool { return !r.hasReservation(peers[i].ID()) }, 5*time.Second, 10*time.Millisecond)
+	}
+
+	for i := range 4 {
+		_, err := reserve(t, peers[i], relayHost)
+		require.NoError(t, err)
+	}
+	requireMarks(0, 0)
+
+	// reaching 5 of 10 reservations reaches the high water mark, once
+	for i := 4; i < 6; i++ {
+		_, err := reserve(t, peers[i], relayHost)
+		require.NoError(t, err)
+	}
+	requireMarks(1, 0)
+
+	// the mark is cleared below the low water mark of 4 reservations only
+	disconnect(5)
+	disconnect(4)
+	requireMarks(1, 0)
+	disconnect(3)
+	requireMarks(1, 1)
+
+	// and is reached again
+	for i := 3; i < 5; i++ {
+		_, err := reserve(t, peers[i], relayHost)
+		require.NoError(t, err)
+	}
+	requireMarks(2, 1)
+}
+
+func TestReservationHighWaterFraction(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+	for _, fraction := range []float64{0, -0.5, 1.5} {
+		_, err := New(h, WithReservationHighWater(fraction))
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,118 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandleHopMessage(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+
+	tcs := []struct {
+		name   string
+		msg    *pbv2.HopMessage
+		status pbv2.Status
+		action hopAction
+	}{{
+		name:   "reserve",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_RESERVE.Enum()},
+		status: pbv2.Status_OK,
+		action: hopActionReserve,
+	}, {
+		name:   "connect",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_CONNECT.Enum(), Peer: &pbv2.Peer{Id: []byte(p)}},
+		status: pbv2.Status_OK,
+		action: hopActionConnect,
+	}, {
+		name:   "connect without peer",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_CONNECT.Enum()},
+		status: pbv2.Status_MALFORMED_MESSAGE,
+		action: hopActionRefuse,
+	}, {
+		name:   "connect with invalid peer",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_CONNECT.Enum(), Peer: &pbv2.Peer{Id: []byte("foo")}},
+		status: pbv2.Status_MALFORMED_MESSAGE,
+		action: hopActionRefuse,
+	}, {
+		name:   "reserve connect",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_RESERVE_CONNECT.Enum(), Peer: &pbv2.Peer{Id: []byte(p)}},
+		status: pbv2.Status_OK,
+		action: hopActionReserveConnect,
+	}, {
+		name:   "reserve connect without peer",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_RESERVE_CONNECT.Enum()},
+		status: pbv2.Status_MALFORMED_MESSAGE,
+		action: hopActionRefuse,
+	}, {
+		name:   "query",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_QUERY.Enum()},
+		status: pbv2.Status_OK,
+		action: hopActionQuery,
+	}, {
+		name:   "probe",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_PROBE.Enum(), Peer: &pbv2.Peer{Id: []byte(p)}},
+		status: pbv2.Status_OK,
+		action: hopActionProbe,
+	}, {
+		name:   "probe without peer",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_PROBE.Enum()},
+		status: pbv2.Status_MALFORMED_MESSAGE,
+		action: hopActionRefuse,
+	}, {
+		name:   "status",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_STATUS.Enum()},
+		status: pbv2.Status_MALFORMED_MESSAGE,
+		action: hopActionRefuse,
+	}, {
+		name:   "unknown type",
+		msg:    &pbv2.HopMessage{Type: pbv2.HopMessage_Type(42).Enum()},
+		status: pbv2.Status_MALFORMED_MESSAGE,
+		action: hopActionRefuse,
+	}}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			status, action := handleHopMessage(tc.msg)
+			require.Equal(t, tc.action, action)
+			if action == hopActionRefuse {
+				require.Equal(t, tc.status, status)
+			}
+		})
+	}
+}
+
+func FuzzHandleHopMessage(f *testing.F) {
+	p := test.RandPeerIDFatal(f)
+	for _, msg := range []*pbv2.HopMessage{
+		{Type: pbv2.HopMessage_RESERVE.Enum()},
+		{Type: pbv2.HopMessage_CONNECT.Enum(), Peer: &pbv2.Peer{Id: []byte(p)}},
+		{Type: pbv2.HopMessage_RESERVE_CONNECT.Enum(), Peer: &pbv2.Peer{Id: []byte(p)}},
+		{Type: pbv2.HopMessage_QUERY.Enum()},
+		{Type: pbv2.HopMessage_PROBE.Enum(), Peer: &pbv2.Peer{Id: []byte(p)}},
+		{Type: pbv2.HopMessage_STATUS.Enum(), Status: pbv2.Status_OK.Enum()},
+	} {
+		b, err := proto.Marshal(msg)
+		require.NoError(f, err)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var msg pbv2.HopMessage
+		if err := proto.Unmarshal(data, &msg); err != nil {
+			return
+		}
+		status, action := handleHopMessage(&msg)
+		switch action {
+		case hopActionReserve, hopActionConnect, hopActionReserveConnect, hopActionQuery, hopActionProbe:
+		case hopActionRefuse:
+			if _, ok := pbv2.Status_name[int32(status)]; !ok || status == pbv2.Status_OK {
+				t.Fatalf("invalid refusal status %d", status)
+			}
+		default:
+			t.Fatalf("invalid action %d", action)
+		}
+	})
+}
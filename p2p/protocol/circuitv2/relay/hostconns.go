@@ -0,0 +1,10 @@
+package relay
+
+// hostConnsExceeded returns true if the relay host has reached the connection count above which
+// new reservations are refused.
+func (r *Relay) hostConnsExceeded() bool {
+	if r.maxHostConns <= 0 {
+		return false
+	}
+	return len(r.host.Network().Conns()) >= r.maxHostConns
+}
@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxHostConnections(t *testing.T) {
+	hosts := getTestHosts(t, 6)
+	relayHost, existing, newcomer, fillers := hosts[0], hosts[1], hosts[2], hosts[3:]
+
+	r, err := New(relayHost, WithMaxHostConnections(4))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, existing, relayHost)
+	require.NoError(t, err)
+	requireAccepting(t, r, "")
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	for _, h := range fillers {
+		require.NoError(t, h.Connect(context.Background(), rinfo))
+	}
+	requireAccepting(t, r, NotAcceptingConnections)
+
+	_, err = reserve(t, newcomer, relayHost)
+	var rerr client.ReservationError
+	require.ErrorAs(t, err, &rerr)
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, rerr.Status)
+	require.False(t, r.hasReservation(newcomer.ID()))
+
+	// existing reservations can be renewed
+	_, err = reserve(t, existing, relayHost)
+	require.NoError(t, err)
+
+	for _, h := range fillers {
+		require.NoError(t, h.Network().ClosePeer(relayHost.ID()))
+	}
+	require.Eventually(t, func() bool { return len(relayHost.Network().Conns()) < 4 }, time.Second, 10*time.Millisecond)
+	_, err = reserve(t, newcomer, relayHost)
+	require.NoError(t, err)
+
+	_, err = New(getTestHosts(t, 1)[0], WithMaxHostConnections(0))
+	require.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package relay
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// keepAlive configures extending the duration limit of relayed connections that carry traffic.
+type keepAlive struct {
+	// minBytes is the number of bytes a relayed connection must carry within a window to have
+	// its deadline extended.
+	minBytes int64
+	window   time.Duration
+}
+
+// circuitKeepAlive tracks the traffic of a relayed connection and extends its deadline while
+// it stays active. A nil circuitKeepAlive does nothing.
+type circuitKeepAlive struct {
+	bytes atomic.Int64
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// keepCircuitAlive starts extending the deadline of the relayed connection between src and
+// dest by the duration of its limit whenever it carried at least the configured number of bytes
+// within a window. It returns nil if keep-alive is disabled or there is no duration limit.
+func (r *Relay) keepCircuitAlive(src, dest network.Stream, limit *RelayLimit) *circuitKeepAlive {
+	if r.keepAlive == nil || limit == nil || limit.Duration <= 0 {
+		return nil
+	}
+	ka := &circuitKeepAlive{done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(r.keepAlive.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if ka.bytes.Swap(0) < r.keepAlive.minBytes {
+					// idle in this window; the deadline set last stays in place
+					continue
+				}
+				deadline := time.Now().Add(limit.Duration)
+				src.SetDeadline(deadline)
+				dest.SetDeadline(deadline)
+			case <-ka.done:
+				return
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+	return ka
+}
+
+// accounter returns a function counting relayed bytes towards the keep-alive before passing
+// them on to account, which may be nil.
+func (ka *circuitKeepAlive) accounter(account func(n int)) func(n int) {
+	if ka == nil {
+		return account
+	}
+	return func(n int) {
+		ka.bytes.Add(int64(n))
+		if account != nil {
+			account(n)
+		}
+	}
+}
+
+// stop stops extending the deadline.
+func (ka *circuitKeepAlive) stop() {
+	if ka == nil {
+		return
+	}
+	ka.stopOnce.Do(func() { close(ka.done) })
+}
@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAlive(t *testing.T) {
+	tcs := []struct {
+		name      string
+		keepAlive bool
+		heartbeat bool
+		alive     bool
+	}{
+		{name: "heartbeat", keepAlive: true, heartbeat: true, alive: true},
+		{name: "silent", keepAlive: true, heartbeat: false, alive: false},
+		{name: "heartbeat without keep-alive", keepAlive: false, heartbeat: true, alive: false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+			handleStopEcho(dest)
+
+			rc := DefaultResources()
+			rc.Limit = &RelayLimit{Duration: 300 * time.Millisecond, Data: 1 << 20}
+			opts := []Option{WithResources(rc)}
+			if tc.keepAlive {
+				opts = append(opts, WithKeepAlive(1, 50*time.Millisecond))
+			}
+			r, err := New(relayHost, opts...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			_, err = reserve(t, dest, relayHost)
+			require.NoError(t, err)
+			s, status := connectRaw(t, src, relayHost, dest.ID())
+			require.Equal(t, pbv2.Status_OK, status)
+
+			ping := func() error {
+				s.SetDeadline(time.Now().Add(time.Second))
+				if _, err := s.Write([]byte{1}); err != nil {
+					return err
+				}
+				_, err := io.ReadFull(s, make([]byte, 1))
+				return err
+			}
+
+			// run well past the duration limit
+			end := time.Now().Add(time.Second)
+			if tc.heartbeat {
+				for time.Now().Before(end) {
+					if err = ping(); err != nil {
+						break
+					}
+					time.Sleep(20 * time.Millisecond)
+				}
+			} else {
+				time.Sleep(time.Until(end))
+				err = ping()
+			}
+			if tc.alive {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestKeepAliveOptionErrors(t *testing.T) {
+	hosts := getTestHosts(t, 1)
+	_, err := New(hosts[0], WithKeepAlive(0, time.Second))
+	require.Error(t, err)
+	_, err = New(hosts[0], WithKeepAlive(1, 0))
+	require.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package relay
+
+import (
+	"time"
+)
+
+// ReservationEndReason is the reason a reservation ended, reported with its lifetime to
+// ReservationMetricsTracer.ReservationLifetime.
+type ReservationEndReason int
+
+const (
+	// ReservationEndRenewed means the peer renewed the reservation. The renewed reservation
+	// starts a new lifetime.
+	ReservationEndRenewed ReservationEndReason = iota
+	// ReservationEndExpired means the reservation expired without being renewed.
+	ReservationEndExpired
+	// ReservationEndDisconnected means the reservation was dropped because the peer
+	// disconnected, at the end of the disconnect grace period if there is one.
+	ReservationEndDisconnected
+	// ReservationEndEvicted means the reservation was evicted to make room for another one.
+	ReservationEndEvicted
+	// ReservationEndPruned means the reservation was pruned because probing found the peer
+	// unreachable.
+	ReservationEndPruned
+	// ReservationEndRetracted means the reservation was retracted because the connection
+	// requested along with it failed.
+	ReservationEndRetracted
+	// ReservationEndRelayClosed means the relay was closed.
+	ReservationEndRelayClosed
+	// ReservationEndMigrated means the reservation was moved to another relay with
+	// MigrateReservation.
+	ReservationEndMigrated
+	// ReservationEndRevoked means the reservation was revoked with RevokeReservation.
+	ReservationEndRevoked
+)
+
+func (r ReservationEndReason) String() string {
+	switch r {
+	case ReservationEndRenewed:
+		return "renewed"
+	case ReservationEndExpired:
+		return "expired"
+	case ReservationEndDisconnected:
+		return "disconnected"
+	case ReservationEndEvicted:
+		return "evicted"
+	case ReservationEndPruned:
+		return "pruned"
+	case ReservationEndRetracted:
+		return "retracted"
+	case ReservationEndRelayClosed:
+		return "relay closed"
+	case ReservationEndMigrated:
+		return "migrated"
+	case ReservationEndRevoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+// involuntary returns true if the relay removed the reservation before its expiration while the
+// peer was still connected.
+func (r ReservationEndReason) involuntary() bool {
+	switch r {
+	case ReservationEndEvicted, ReservationEndPruned, ReservationEndRetracted, ReservationEndMigrated,
+		ReservationEndRevoked:
+		return true
+	default:
+		return false
+	}
+}
+
+// reservationEnded reports the lifetime of rsvp, from the time it was granted until now, and
+// reports involuntary removals as evictions.
+func (r *Relay) reservationEnded(rsvp reservation, reason ReservationEndReason, now time.Time) {
+	if mt, ok := r.metricsTracer.(ReservationMetricsTracer); ok {
+		mt.ReservationLifetime(now.Sub(rsvp.granted), reason)
+		if reason.involuntary() {
+			mt.ReservationEvicted(reason)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package relay
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/stretchr/testify/require"
+)
+
+// lifetimeMetricsTracer records reservation lifetimes and evictions by end reason, and the number
+// of closed reservations.
+type lifetimeMetricsTracer struct {
+	metricsTracer
+
+	mx        sync.Mutex
+	lifetimes map[ReservationEndReason][]time.Duration
+	evictions map[ReservationEndReason]int
+	closed    int
+}
+
+func (mt *lifetimeMetricsTracer) ReservationEvicted(reason ReservationEndReason) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.evictions[reason]++
+}
+
+func (mt *lifetimeMetricsTracer) ReservationClosed(cnt int) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.closed += cnt
+}
+
+func (mt *lifetimeMetricsTracer) ReservationLifetime(d time.Duration, reason ReservationEndReason) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.lifetimes[reason] = append(mt.lifetimes[reason], d)
+}
+
+func (mt *lifetimeMetricsTracer) reasons() map[ReservationEndReason]int {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	reasons := make(map[ReservationEndReason]int)
+	for reason, ds := range mt.lifetimes {
+		reasons[reason] = len(ds)
+	}
+	return reasons
+}
+
+func TestReservationLifetime(t *testing.T) {
+	for _, tc := range []struct {
+		reason ReservationEndReason
+		opts   []Option
+		rc     func(*Resources)
+		end    func(t *testing.T, r *Relay, relayHost host.Host, hosts []host.Host)
+	}{
+		{
+			reason: ReservationEndRenewed,
+			end: func(t *testing.T, _ *Relay, relayHost host.Host, hosts []host.Host) {
+				_, err := reserve(t, hosts[0], relayHost)
+				require.NoError(t, err)
+			},
+		},
+		{
+			reason: ReservationEndExpired,
+			end: func(_ *testing.T, r *Relay, _ host.Host, hosts []host.Host) {
+				r.mx.Lock()
+				rsvp := r.rsvp[hosts[0].ID()]
+				rsvp.expire = time.Now().Add(-time.Second)
+				r.rsvp[hosts[0].ID()] = rsvp
+				r.mx.Unlock()
+				r.gc()
+			},
+		},
+		{
+			reason: ReservationEndDisconnected,
+			end: func(t *testing.T, _ *Relay, relayHost host.Host, hosts []host.Host) {
+				require.NoError(t, hosts[0].Network().ClosePeer(relayHost.ID()))
+			},
+		},
+		{
+			reason: ReservationEndDisconnected,
+			rc:     func(rc *Resources) { rc.DisconnectGracePeriod = 50 * time.Millisecond },
+			end: func(t *testing.T, _ *Relay, relayHost host.Host, hosts []host.Host) {
+				require.NoError(t, hosts[0].Network().ClosePeer(relayHost.ID()))
+			},
+		},
+		{
+			reason: ReservationEndEvicted,
+			opts:   []Option{WithReservationEvictionPolicy(EvictSoonestExpiring)},
+			rc:     func(rc *Resources) { rc.MaxReservations = 1 },
+			end: func(t *testing.T, _ *Relay, relayHost host.Host, hosts []host.Host) {
+				_, err := reserve(t, hosts[1], relayHost)
+				require.NoError(t, err)
+			},
+		},
+		{
+			reason: ReservationEndPruned,
+			opts:   []Option{WithReservationProbing(time.Hour, 10, false)},
+			end: func(t *testing.T, r *Relay, relayHost host.Host, hosts []host.Host) {
+				// simulate a missed disconnect notification
+				relayHost.Network().StopNotify(r.notifiee)
+				require.NoError(t, relayHost.Network().ClosePeer(hosts[0].ID()))
+				r.probeReservations()
+			},
+		},
+		{
+			reason: ReservationEndRetracted,
+			end: func(_ *testing.T, r *Relay, _ host.Host, hosts []host.Host) {
+				r.retractReservation(hosts[0].ID())
+			},
+		},
+		{
+			reason: ReservationEndRelayClosed,
+			end: func(_ *testing.T, r *Relay, _ host.Host, _ []host.Host) {
+				r.Close()
+			},
+		},
+	} {
+		t.Run(tc.reason.String(), func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost := hosts[0]
+
+			rc := DefaultResources()
+			if tc.rc != nil {
+				tc.rc(&rc)
+			}
+			mt := &lifetimeMetricsTracer{
+				lifetimes: make(map[ReservationEndReason][]time.Duration),
+				evictions: make(map[ReservationEndReason]int),
+			}
+			r, err := New(relayHost, append([]Option{WithResources(rc), WithMetricsTracer(mt)}, tc.opts...)...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			_, err = reserve(t, hosts[1], relayHost)
+			require.NoError(t, err)
+			time.Sleep(10 * time.Millisecond)
+
+			tc.end(t, r, relayHost, hosts[1:])
+			require.Eventually(t, func() bool {
+				return mt.reasons()[tc.reason] == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			require.Equal(t, map[ReservationEndReason]int{tc.reason: 1}, mt.reasons())
+
+			mt.mx.Lock()
+			defer mt.mx.Unlock()
+			d := mt.lifetimes[tc.reason][0]
+			require.GreaterOrEqual(t, d, 10*time.Millisecond)
+			require.Less(t, d, 5*time.Second)
+
+			switch tc.reason {
+			case ReservationEndEvicted, ReservationEndPruned, ReservationEndRetracted:
+				require.Equal(t, map[ReservationEndReason]int{tc.reason: 1}, mt.evictions)
+			default:
+				require.Empty(t, mt.evictions)
+			}
+			if tc.reason == ReservationEndRenewed {
+				require.Zero(t, mt.closed)
+			} else {
+				require.Equal(t, 1, mt.closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package relay
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+)
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// handleStopRead accepts relayed connections on h and reports what was read from them.
+func handleStopRead(h host.Host) <-chan readResult {
+	results := make(chan readResult, 1)
+	h.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		rd := util.NewDelimitedReader(s, maxMessageSize)
+		defer rd.Close()
+		var msg pbv2.StopMessage
+		if err := rd.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		msg.Reset()
+		msg.Type = pbv2.StopMessage_STATUS.Enum()
+		msg.Status = pbv2.Status_OK.Enum()
+		if err := util.NewDelimitedWriter(s).WriteMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		b, err := io.ReadAll(s)
+		results <- readResult{n: len(b), err: err}
+		s.Reset()
+	})
+	return results
+}
+
+func TestLimitExhaustedBehavior(t *testing.T) {
+	const limit = 1024
+
+	for _, tc := range []struct {
+		name     string
+		behavior LimitExhaustedBehavior
+	}{
+		{name: "close", behavior: LimitExhaustedClose},
+		{name: "reset", behavior: LimitExhaustedReset},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			rc := DefaultResources()
+			rc.Limit = &RelayLimit{Duration: time.Minute, Data: limit}
+			rc.LimitExhaustedBehavior = tc.behavior
+			r, err := New(relayHost, WithResources(rc))
+			require.NoError(t, err)
+			defer r.Close()
+
+			results := handleStopRead(dest)
+			_, err = reserve(t, dest, relayHost)
+			require.NoError(t, err)
+
+			s, status := connectRaw(t, src, relayHost, dest.ID())
+			require.Equal(t, pbv2.Status_OK, status)
+			// write past the limit; writes fail once the relay stops reading
+			go s.Write(make([]byte, 4*limit))
+
+			var res readResult
+			select {
+			case res = <-results:
+			case <-time.After(5 * time.Second):
+				t.Fatal("relayed connection didn't end")
+			}
+			switch tc.behavior {
+			case LimitExhaustedClose:
+				require.NoError(t, res.err)
+				require.Equal(t, limit, res.n)
+			case LimitExhaustedReset:
+				require.ErrorIs(t, res.err, network.ErrReset)
+				require.LessOrEqual(t, res.n, limit)
+			}
+		})
+	}
+}
+
+func TestDirectionalDataLimits(t *testing.T) {
+	const (
+		upload   = 512
+		download = 4096
+		size     = 4 * download
+	)
+
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.Limit = &RelayLimit{Duration: time.Minute, Data: 1024, DataSrcToDest: upload, DataDestToSrc: download}
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+	// the single advertised data limit is the stricter one
+	require.Equal(t, uint64(upload), r.makeLimitMsg(rc.Limit).GetData())
+
+	results := make(chan int, 1)
+	dest.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		defer s.Reset()
+		rd := util.NewDelimitedReader(s, maxMessageSize)
+		defer rd.Close()
+		var msg pbv2.StopMessage
+		if err := rd.ReadMsg(&msg); err != nil {
+			return
+		}
+		msg.Reset()
+		msg.Type = pbv2.StopMessage_STATUS.Enum()
+		msg.Status = pbv2.Status_OK.Enum()
+		if err := util.NewDelimitedWriter(s).WriteMsg(&msg); err != nil {
+			return
+		}
+		go func() {
+			s.Write(make([]byte, size))
+			s.CloseWrite()
+		}()
+		b, _ := io.ReadAll(s)
+		results <- len(b)
+	})
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	s, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	go func() {
+		s.Write(make([]byte, size))
+		s.CloseWrite()
+	}()
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Len(t, b, download)
+
+	select {
+	case n := <-results:
+		require.Equal(t, upload, n)
+	case <-time.After(5 * time.Second):
+		t.Fatal("relayed connection didn't end")
+	}
+}
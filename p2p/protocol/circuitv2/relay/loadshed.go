@@ -0,0 +1,39 @@
+package relay
+
+import (
+	"sync"
+	"time"
+)
+
+// loadShedInterval is how long the result of the load shedder is reused before consulting it
+// again.
+const loadShedInterval = time.Second
+
+// loadShedder caches the result of an operator supplied load signal, so that it is consulted at
+// most once per interval. A nil loadShedder never sheds load.
+type loadShedder struct {
+	shed     func() bool
+	interval time.Duration
+
+	mx      sync.Mutex
+	checked time.Time
+	result  bool
+}
+
+func newLoadShedder(shed func() bool) *loadShedder {
+	return &loadShedder{shed: shed, interval: loadShedInterval}
+}
+
+// Shed returns true if new requests should be refused.
+func (l *loadShedder) Shed(now time.Time) bool {
+	if l == nil {
+		return false
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.checked.IsZero() || now.Sub(l.checked) >= l.interval {
+		l.result = l.shed()
+		l.checked = now
+	}
+	return l.result
+}
@@ -0,0 +1,83 @@
+package relay
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadShedderInterval(t *testing.T) {
+	var calls int
+	var shed bool
+	l := newLoadShedder(func() bool {
+		calls++
+		return shed
+	})
+	now := time.Now()
+
+	require.False(t, l.Shed(now))
+	require.Equal(t, 1, calls)
+	// the result is reused within the interval
+	shed = true
+	require.False(t, l.Shed(now.Add(loadShedInterval/2)))
+	require.Equal(t, 1, calls)
+	require.True(t, l.Shed(now.Add(loadShedInterval)))
+	require.Equal(t, 2, calls)
+
+	// a nil shedder never sheds
+	var nl *loadShedder
+	require.False(t, nl.Shed(now))
+}
+
+func TestLoadShedder(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, dest, other := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	var shed atomic.Bool
+	r, err := New(relayHost, WithLoadShedder(shed.Load), WithRecentRefusals(8))
+	require.NoError(t, err)
+	defer r.Close()
+	r.loadShedder.interval = 0
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	s, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	shed.Store(true)
+	_, err = reserve(t, other, relayHost)
+	var rerr client.ReservationError
+	require.ErrorAs(t, err, &rerr)
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, rerr.Status)
+	_, status = connectRaw(t, other, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+
+	refusals := r.RecentRefusals()
+	require.Len(t, refusals, 2)
+	for _, rec := range refusals {
+		require.Equal(t, "load shed", rec.Reason)
+	}
+
+	// existing circuits continue
+	msg := []byte("still relayed")
+	_, err = s.Write(msg)
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(s, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+
+	// requests are accepted again once the load drops
+	shed.Store(false)
+	_, err = reserve(t, other, relayHost)
+	require.NoError(t, err)
+
+	_, err = New(relayHost, WithLoadShedder(nil))
+	require.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// localAddrRecordingHost records the preferred local address of the stop streams it opens.
+type localAddrRecordingHost struct {
+	host.Host
+
+	mx    sync.Mutex
+	addrs []ma.Multiaddr
+}
+
+func (h *localAddrRecordingHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	if len(pids) == 1 && pids[0] == proto.ProtoIDv2Stop {
+		addr, _ := network.GetPreferredLocalAddr(ctx)
+		h.mx.Lock()
+		h.addrs = append(h.addrs, addr)
+		h.mx.Unlock()
+	}
+	return h.Host.NewStream(ctx, p, pids...)
+}
+
+func (h *localAddrRecordingHost) recorded() []ma.Multiaddr {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.addrs
+}
+
+func TestStopStreamLocalAddr(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+	handleStopEcho(dest)
+
+	local := ma.StringCast("/ip4/127.0.0.1")
+	rh := &localAddrRecordingHost{Host: relayHost}
+	r, err := New(rh, WithStopStreamLocalAddr(local))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	require.Equal(t, []ma.Multiaddr{local}, rh.recorded())
+}
+
+func TestStopStreamLocalAddrDefault(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+	handleStopEcho(dest)
+
+	rh := &localAddrRecordingHost{Host: relayHost}
+	r, err := New(rh)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	require.Equal(t, []ma.Multiaddr{nil}, rh.recorded())
+}
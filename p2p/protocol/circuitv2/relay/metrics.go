@@ -2,7 +2,9 @@ package relay
 
 import (
 	"time"
+	"unicode/utf8"
 
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/p2p/metricshelper"
 	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 	"github.com/prometheus/client_golang/prometheus"
@@ -19,6 +21,22 @@ var (
 		},
 	)
 
+	reachable = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "reachable",
+			Help:      "Relay Publicly Reachable",
+		},
+	)
+
+	reservationHighWater = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "reservation_high_water",
+			Help:      "Relay Reservations Above High Water Mark",
+		},
+	)
+
 	reservationsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: metricNamespace,
@@ -43,6 +61,22 @@ var (
 		},
 		[]string{"reason"},
 	)
+	reservationsPrunedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "reservations_pruned_total",
+			Help:      "Relay Reservations Pruned By Probing",
+		},
+		[]string{"reason"},
+	)
+	reservationsEvictedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "reservations_evicted_total",
+			Help:      "Relay Reservations Removed Before Expiry While The Peer Was Connected",
+		},
+		[]string{"reason"},
+	)
 
 	connectionsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -76,6 +110,31 @@ var (
 		},
 	)
 
+	reservationsPerPeerTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "peer_reservations_total",
+			Help:      "Relay Reservations Per Peer",
+		},
+		[]string{"peer", "type"},
+	)
+	connectionsPerPeerTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "peer_connections_total",
+			Help:      "Relay Connections Per Peer",
+		},
+		[]string{"peer", "role", "type"},
+	)
+
+	hopStreamReadErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "hop_stream_read_errors_total",
+			Help:      "Hop Streams Without A Valid Hop Message",
+		},
+	)
+
 	dataTransferredBytesTotal = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: metricNamespace,
@@ -84,16 +143,110 @@ var (
 		},
 	)
 
+	voucherSealFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "voucher_seal_failures_total",
+			Help:      "Reservation Vouchers That Could Not Be Sealed",
+		},
+	)
+
+	responseWriteShortTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "response_write_short_total",
+			Help:      "Hop Stream Responses Only Partially Written",
+		},
+	)
+
+	connectResponseWriteFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "connect_response_write_failures_total",
+			Help:      "Connection Responses That Could Not Be Written To The Source",
+		},
+	)
+
+	auditEventsDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "audit_events_dropped_total",
+			Help:      "Audit Events Dropped Due To A Full Queue",
+		},
+	)
+
+	circuitStallDurationSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "circuit_stall_duration_seconds",
+			Help:      "Relay Destination Writes Blocked Beyond The Stall Threshold",
+			Buckets:   []float64{1, 2, 5, 10, 30, 60},
+		},
+	)
+
+	copyStallsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "copy_stalls_total",
+			Help:      "Relayed Connections Aborted After Repeated Empty Reads",
+		},
+	)
+
+	reservationLifetimeSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "reservation_lifetime_seconds",
+			Help:      "Relay Reservation Lifetime Until Renewed Or Dropped",
+			Buckets:   []float64{10, 30, 60, 300, 600, 1200, 1800, 2700, 3600, 7200},
+		},
+		[]string{"reason"},
+	)
+
+	readChunkSizeBytes = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "read_chunk_size_bytes",
+			Help:      "Sizes Of Reads From Relayed Streams",
+			Buckets:   prometheus.ExponentialBuckets(16, 2, 13),
+		},
+	)
+
+	hopMessageIODurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "hop_message_io_duration_seconds",
+			Help:      "Time To Read Or Write Hop And Stop Control Messages",
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+		},
+		[]string{"op"},
+	)
+
 	collectors = []prometheus.Collector{
 		status,
+		reachable,
+		reservationHighWater,
 		reservationsTotal,
 		reservationRequestResponseStatusTotal,
 		reservationRejectionsTotal,
+		reservationsPrunedTotal,
+		reservationsEvictedTotal,
 		connectionsTotal,
 		connectionRequestResponseStatusTotal,
 		connectionRejectionsTotal,
 		connectionDurationSeconds,
+		reservationsPerPeerTotal,
+		connectionsPerPeerTotal,
+		hopStreamReadErrorsTotal,
 		dataTransferredBytesTotal,
+		circuitStallDurationSeconds,
+		copyStallsTotal,
+		auditEventsDroppedTotal,
+		connectResponseWriteFailuresTotal,
+		responseWriteShortTotal,
+		voucherSealFailuresTotal,
+		reservationLifetimeSeconds,
+		readChunkSizeBytes,
+		hopMessageIODurationSeconds,
 	}
 )
 
@@ -126,12 +279,123 @@ type MetricsTracer interface {
 	BytesTransferred(cnt int)
 }
 
-type metricsTracer struct{}
+// ReachabilityMetricsTracer is a MetricsTracer that tracks the reachability of the relay.
+// If the MetricsTracer passed to WithMetricsTracer implements it, the relay reports
+// reachability changes to it.
+type ReachabilityMetricsTracer interface {
+	MetricsTracer
+
+	// RelayReachable tracks whether the relay is publicly reachable
+	RelayReachable(reachable bool)
+}
+
+// ReservationMetricsTracer is a MetricsTracer that tracks how reservations end.
+// If the MetricsTracer passed to WithMetricsTracer implements it, the relay calls these methods
+// in addition to ReservationClosed.
+type ReservationMetricsTracer interface {
+	MetricsTracer
+
+	// ReservationPruned tracks metrics on retracting a reservation of an unreachable peer
+	ReservationPruned(reason string)
+	// ReservationLifetime tracks how long a reservation lived, from being granted or last
+	// renewed until it was renewed again or dropped for reason
+	ReservationLifetime(d time.Duration, reason ReservationEndReason)
+	// ReservationEvicted tracks a reservation the relay removed before its expiration while the
+	// peer was still connected: evicted, pruned, retracted, migrated or revoked. The removal is
+	// counted by ReservationClosed as well
+	ReservationEvicted(reason ReservationEndReason)
+	// ReservationHighWaterReached tracks the number of reservations reaching the high water mark
+	// set with WithReservationHighWater
+	ReservationHighWaterReached()
+	// ReservationHighWaterCleared tracks the number of reservations dropping below the low water
+	// mark after reaching the high water mark
+	ReservationHighWaterCleared()
+}
+
+// PeerMetricsTracer is a MetricsTracer that tracks reservations and connections per peer.
+// The relay only calls these methods when enabled with WithMetricsPeerLabels and the
+// MetricsTracer passed to WithMetricsTracer implements it.
+type PeerMetricsTracer interface {
+	MetricsTracer
+
+	// PeerReservationAllowed tracks opening or renewing the reservation of a specific peer
+	PeerReservationAllowed(p peer.ID, isRenewal bool)
+	// PeerReservationClosed tracks closing the reservation of a specific peer
+	PeerReservationClosed(p peer.ID)
+	// PeerConnectionOpened tracks opening a relay connection between specific peers
+	PeerConnectionOpened(src, dest peer.ID)
+	// PeerConnectionClosed tracks closing a relay connection between specific peers
+	PeerConnectionClosed(src, dest peer.ID)
+}
+
+// TransferMetricsTracer is a MetricsTracer that tracks the data transfer and control messages
+// of relayed connections. If the MetricsTracer passed to WithMetricsTracer implements it, the
+// relay calls these methods in addition to BytesTransferred.
+type TransferMetricsTracer interface {
+	MetricsTracer
+
+	// ReadChunkSize tracks the size of a read from a relayed stream. It is only called when
+	// enabled with WithMetricsChunkSizes.
+	ReadChunkSize(n int)
+	// HopMessageIOLatency tracks how long reading or writing a hop or stop control message
+	// took, to tell slow handshakes apart from slow data transfer
+	HopMessageIOLatency(op MessageIOOp, d time.Duration)
+	// CircuitStalled tracks a write to the destination of a relayed connection that blocked
+	// for longer than the stall threshold
+	CircuitStalled(d time.Duration)
+	// CopyStall tracks relayed connections aborted because their source repeatedly returned no
+	// data and no error
+	CopyStall()
+}
+
+// FailureMetricsTracer is a MetricsTracer that tracks failures the relay recovers from without
+// a request status to report them. If the MetricsTracer passed to WithMetricsTracer implements
+// it, the relay reports these failures to it.
+type FailureMetricsTracer interface {
+	MetricsTracer
+
+	// HopStreamReadError tracks hop streams on which no valid hop message could be read
+	HopStreamReadError()
+	// VoucherSealFailed tracks reservations for which the voucher could not be sealed
+	VoucherSealFailed()
+	// ConnectResponseWriteFailed tracks connections that were established with the destination
+	// but failed because the response could not be written to the source
+	ConnectResponseWriteFailed()
+	// ResponseWriteShort tracks hop stream responses of which only part could be written, after
+	// which the stream is reset
+	ResponseWriteShort()
+	// AuditEventDropped tracks audit events dropped because the audit logger fell behind
+	AuditEventDropped()
+}
+
+// ExemplarMetricsTracer is a MetricsTracer that can link connection metrics to circuit trace IDs.
+// If the MetricsTracer passed to WithMetricsTracer implements it, the relay calls these methods
+// instead of ConnectionOpened and ConnectionClosed.
+type ExemplarMetricsTracer interface {
+	MetricsTracer
+
+	// ConnectionOpenedWithTraceID tracks metrics on opening a relay connection with the given trace ID
+	ConnectionOpenedWithTraceID(traceID string)
+	// ConnectionClosedWithTraceID tracks metrics on closing a relay connection with the given trace ID
+	ConnectionClosedWithTraceID(d time.Duration, traceID string)
+}
+
+type metricsTracer struct {
+	exemplars bool
+}
 
-var _ MetricsTracer = &metricsTracer{}
+var (
+	_ ExemplarMetricsTracer     = &metricsTracer{}
+	_ ReachabilityMetricsTracer = &metricsTracer{}
+	_ ReservationMetricsTracer  = &metricsTracer{}
+	_ PeerMetricsTracer         = &metricsTracer{}
+	_ TransferMetricsTracer     = &metricsTracer{}
+	_ FailureMetricsTracer      = &metricsTracer{}
+)
 
 type metricsTracerSetting struct {
-	reg prometheus.Registerer
+	reg       prometheus.Registerer
+	exemplars bool
 }
 
 type MetricsTracerOption func(*metricsTracerSetting)
@@ -144,13 +408,21 @@ func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
 	}
 }
 
+// WithExemplars attaches the circuit trace ID as an exemplar to the connection metrics.
+// Exemplars are only exposed to scrapers negotiating the OpenMetrics format.
+func WithExemplars() MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		s.exemplars = true
+	}
+}
+
 func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
 	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
 	for _, opt := range opts {
 		opt(setting)
 	}
 	metricshelper.RegisterCollectors(setting.reg, collectors...)
-	return &metricsTracer{}
+	return &metricsTracer{exemplars: setting.exemplars}
 }
 
 func (mt *metricsTracer) RelayStatus(enabled bool) {
@@ -161,6 +433,14 @@ func (mt *metricsTracer) RelayStatus(enabled bool) {
 	}
 }
 
+func (mt *metricsTracer) RelayReachable(isReachable bool) {
+	if isReachable {
+		reachable.Set(1)
+	} else {
+		reachable.Set(0)
+	}
+}
+
 func (mt *metricsTracer) ConnectionOpened() {
 	tags := metricshelper.GetStringSlice()
 	defer metricshelper.PutStringSlice(tags)
@@ -178,6 +458,67 @@ func (mt *metricsTracer) ConnectionClosed(d time.Duration) {
 	connectionDurationSeconds.Observe(d.Seconds())
 }
 
+func (mt *metricsTracer) ConnectionOpenedWithTraceID(traceID string) {
+	if !mt.exemplars {
+		mt.ConnectionOpened()
+		return
+	}
+	exemplar := exemplarLabels(traceID)
+	if exemplar == nil {
+		mt.ConnectionOpened()
+		return
+	}
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, "opened")
+
+	addWithExemplar(connectionsTotal.WithLabelValues(*tags...), 1, exemplar)
+}
+
+func (mt *metricsTracer) ConnectionClosedWithTraceID(d time.Duration, traceID string) {
+	if !mt.exemplars {
+		mt.ConnectionClosed(d)
+		return
+	}
+	exemplar := exemplarLabels(traceID)
+	if exemplar == nil {
+		mt.ConnectionClosed(d)
+		return
+	}
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, "closed")
+
+	addWithExemplar(connectionsTotal.WithLabelValues(*tags...), 1, exemplar)
+	if eo, ok := connectionDurationSeconds.(prometheus.ExemplarObserver); ok {
+		eo.ObserveWithExemplar(d.Seconds(), exemplar)
+	} else {
+		connectionDurationSeconds.Observe(d.Seconds())
+	}
+}
+
+// exemplarTraceIDLabel is the name of the exemplar label carrying the circuit trace ID.
+const exemplarTraceIDLabel = "trace_id"
+
+// exemplarLabels returns the exemplar labels for traceID, or nil if it can't be attached as an
+// exemplar: client_golang panics on exemplar labels that aren't valid UTF-8 or exceed
+// prometheus.ExemplarMaxRunes.
+func exemplarLabels(traceID string) prometheus.Labels {
+	if traceID == "" || !utf8.ValidString(traceID) ||
+		utf8.RuneCountInString(exemplarTraceIDLabel)+utf8.RuneCountInString(traceID) > prometheus.ExemplarMaxRunes {
+		return nil
+	}
+	return prometheus.Labels{exemplarTraceIDLabel: traceID}
+}
+
+func addWithExemplar(c prometheus.Counter, v float64, exemplar prometheus.Labels) {
+	if ea, ok := c.(prometheus.ExemplarAdder); ok {
+		ea.AddWithExemplar(v, exemplar)
+	} else {
+		c.Add(v)
+	}
+}
+
 func (mt *metricsTracer) ConnectionRequestHandled(status pbv2.Status) {
 	tags := metricshelper.GetStringSlice()
 	defer metricshelper.PutStringSlice(tags)
@@ -228,10 +569,122 @@ func (mt *metricsTracer) ReservationRequestHandled(status pbv2.Status) {
 	}
 }
 
+func (mt *metricsTracer) ReservationHighWaterReached() {
+	reservationHighWater.Set(1)
+}
+
+func (mt *metricsTracer) ReservationHighWaterCleared() {
+	reservationHighWater.Set(0)
+}
+
+func (mt *metricsTracer) ReservationPruned(reason string) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, reason)
+
+	reservationsPrunedTotal.WithLabelValues(*tags...).Add(1)
+}
+
+func (mt *metricsTracer) ReservationLifetime(d time.Duration, reason ReservationEndReason) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, reason.String())
+
+	reservationLifetimeSeconds.WithLabelValues(*tags...).Observe(d.Seconds())
+}
+
+func (mt *metricsTracer) ReservationEvicted(reason ReservationEndReason) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, reason.String())
+
+	reservationsEvictedTotal.WithLabelValues(*tags...).Add(1)
+}
+
+func (mt *metricsTracer) PeerReservationAllowed(p peer.ID, isRenewal bool) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, p.String())
+	if isRenewal {
+		*tags = append(*tags, "renewed")
+	} else {
+		*tags = append(*tags, "opened")
+	}
+
+	reservationsPerPeerTotal.WithLabelValues(*tags...).Add(1)
+}
+
+func (mt *metricsTracer) PeerReservationClosed(p peer.ID) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, p.String(), "closed")
+
+	reservationsPerPeerTotal.WithLabelValues(*tags...).Add(1)
+}
+
+func (mt *metricsTracer) PeerConnectionOpened(src, dest peer.ID) {
+	mt.peerConnection(src, dest, "opened")
+}
+
+func (mt *metricsTracer) PeerConnectionClosed(src, dest peer.ID) {
+	mt.peerConnection(src, dest, "closed")
+}
+
+func (mt *metricsTracer) peerConnection(src, dest peer.ID, typ string) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, src.String(), "source", typ)
+	connectionsPerPeerTotal.WithLabelValues(*tags...).Add(1)
+	*tags = (*tags)[:0]
+	*tags = append(*tags, dest.String(), "destination", typ)
+	connectionsPerPeerTotal.WithLabelValues(*tags...).Add(1)
+}
+
+func (mt *metricsTracer) HopStreamReadError() {
+	hopStreamReadErrorsTotal.Inc()
+}
+
 func (mt *metricsTracer) BytesTransferred(cnt int) {
 	dataTransferredBytesTotal.Add(float64(cnt))
 }
 
+func (mt *metricsTracer) ReadChunkSize(n int) {
+	readChunkSizeBytes.Observe(float64(n))
+}
+
+func (mt *metricsTracer) HopMessageIOLatency(op MessageIOOp, d time.Duration) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, op.String())
+
+	hopMessageIODurationSeconds.WithLabelValues(*tags...).Observe(d.Seconds())
+}
+
+func (mt *metricsTracer) CircuitStalled(d time.Duration) {
+	circuitStallDurationSeconds.Observe(d.Seconds())
+}
+
+func (mt *metricsTracer) CopyStall() {
+	copyStallsTotal.Inc()
+}
+
+func (mt *metricsTracer) VoucherSealFailed() {
+	voucherSealFailuresTotal.Inc()
+}
+
+func (mt *metricsTracer) ConnectResponseWriteFailed() {
+	connectResponseWriteFailuresTotal.Inc()
+}
+
+func (mt *metricsTracer) ResponseWriteShort() {
+	responseWriteShortTotal.Inc()
+}
+
+func (mt *metricsTracer) AuditEventDropped() {
+	auditEventsDroppedTotal.Inc()
+}
+
 func getResponseStatus(status pbv2.Status) string {
 	responseStatus := "unknown"
 	switch status {
@@ -0,0 +1,128 @@
+package relay
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+type peerMetricsTracer struct {
+	metricsTracer
+
+	mx     sync.Mutex
+	events []string
+}
+
+func (mt *peerMetricsTracer) record(ev string) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.events = append(mt.events, ev)
+}
+
+func (mt *peerMetricsTracer) Events() []string {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	return append([]string(nil), mt.events...)
+}
+
+func (mt *peerMetricsTracer) PeerReservationAllowed(p peer.ID, _ bool) {
+	mt.record("reservation allowed " + p.String())
+}
+
+func (mt *peerMetricsTracer) PeerReservationClosed(p peer.ID) {
+	mt.record("reservation closed " + p.String())
+}
+
+func (mt *peerMetricsTracer) PeerConnectionOpened(src, dest peer.ID) {
+	mt.record("connection opened " + src.String() + " " + dest.String())
+}
+
+func (mt *peerMetricsTracer) PeerConnectionClosed(src, dest peer.ID) {
+	mt.record("connection closed " + src.String() + " " + dest.String())
+}
+
+func TestMetricsPeerLabels(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		name := "disabled"
+		if enabled {
+			name = "enabled"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			mt := &peerMetricsTracer{}
+			r, err := New(relayHost, WithMetricsTracer(mt), WithMetricsPeerLabels(enabled))
+			require.NoError(t, err)
+			defer r.Close()
+
+			addCircuitTransport(t, src)
+			addCircuitTransport(t, dest)
+			dest.SetStreamHandler("test", func(s network.Stream) { s.Close() })
+
+			s, err := openCircuit(t, src, dest, relayHost, "test")
+			require.NoError(t, err)
+			s.Close()
+			src.Network().ClosePeer(dest.ID())
+			dest.Network().ClosePeer(relayHost.ID())
+
+			if !enabled {
+				time.Sleep(100 * time.Millisecond)
+				require.Empty(t, mt.Events())
+				return
+			}
+			require.Eventually(t, func() bool { return len(mt.Events()) == 4 }, 5*time.Second, 10*time.Millisecond)
+			require.ElementsMatch(t, []string{
+				"reservation allowed " + dest.ID().String(),
+				"connection opened " + src.ID().String() + " " + dest.ID().String(),
+				"connection closed " + src.ID().String() + " " + dest.ID().String(),
+				"reservation closed " + dest.ID().String(),
+			}, mt.Events())
+		})
+	}
+}
+
+// baseMetricsTracer implements MetricsTracer but none of the optional metrics tracer interfaces.
+type baseMetricsTracer struct {
+	MetricsTracer
+}
+
+func TestMetricsTracerWithoutOptionalInterfaces(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	mt := baseMetricsTracer{&metricsTracer{}}
+	_, ok := MetricsTracer(mt).(PeerMetricsTracer)
+	require.False(t, ok)
+	r, err := New(relayHost,
+		WithMetricsTracer(mt),
+		WithMetricsPeerLabels(true),
+		WithMetricsChunkSizes(true),
+		WithStallThreshold(time.Nanosecond),
+		WithReservationHighWater(0.001),
+	)
+	require.NoError(t, err)
+	defer r.Close()
+
+	addCircuitTransport(t, src)
+	addCircuitTransport(t, dest)
+	dest.SetStreamHandler("test", func(s network.Stream) {
+		defer s.Close()
+		io.Copy(s, s)
+	})
+
+	s, err := openCircuit(t, src, dest, relayHost, "test")
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Write([]byte("ping"))
+	require.NoError(t, err)
+	require.NoError(t, s.CloseWrite())
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(b))
+}
@@ -17,16 +17,38 @@ func TestNoCoverNoAlloc(t *testing.T) {
 		pbv2.Status_RESOURCE_LIMIT_EXCEEDED,
 		pbv2.Status_PERMISSION_DENIED,
 	}
-	mt := NewMetricsTracer()
+	mt := NewMetricsTracer().(*metricsTracer)
 	tests := map[string]func(){
-		"RelayStatus":               func() { mt.RelayStatus(rand.Intn(2) == 1) },
-		"ConnectionOpened":          func() { mt.ConnectionOpened() },
-		"ConnectionClosed":          func() { mt.ConnectionClosed(time.Duration(rand.Intn(10)) * time.Second) },
-		"ConnectionRequestHandled":  func() { mt.ConnectionRequestHandled(statuses[rand.Intn(len(statuses))]) },
-		"ReservationAllowed":        func() { mt.ReservationAllowed(rand.Intn(2) == 1) },
-		"ReservationClosed":         func() { mt.ReservationClosed(rand.Intn(10)) },
-		"ReservationRequestHandled": func() { mt.ReservationRequestHandled(statuses[rand.Intn(len(statuses))]) },
-		"BytesTransferred":          func() { mt.BytesTransferred(rand.Intn(1000)) },
+		"RelayStatus":                 func() { mt.RelayStatus(rand.Intn(2) == 1) },
+		"RelayReachable":              func() { mt.RelayReachable(rand.Intn(2) == 1) },
+		"ConnectionOpened":            func() { mt.ConnectionOpened() },
+		"ConnectionClosed":            func() { mt.ConnectionClosed(time.Duration(rand.Intn(10)) * time.Second) },
+		"ConnectionRequestHandled":    func() { mt.ConnectionRequestHandled(statuses[rand.Intn(len(statuses))]) },
+		"ConnectionOpenedWithTraceID": func() { mt.ConnectionOpenedWithTraceID("trace") },
+		"ConnectionClosedWithTraceID": func() {
+			mt.ConnectionClosedWithTraceID(time.Duration(rand.Intn(10))*time.Second, "trace")
+		},
+		"ReservationAllowed":          func() { mt.ReservationAllowed(rand.Intn(2) == 1) },
+		"ReservationClosed":           func() { mt.ReservationClosed(rand.Intn(10)) },
+		"ReservationRequestHandled":   func() { mt.ReservationRequestHandled(statuses[rand.Intn(len(statuses))]) },
+		"ReservationPruned":           func() { mt.ReservationPruned("disconnected") },
+		"ReservationHighWaterReached": func() { mt.ReservationHighWaterReached() },
+		"ReservationHighWaterCleared": func() { mt.ReservationHighWaterCleared() },
+		"HopStreamReadError":          func() { mt.HopStreamReadError() },
+		"BytesTransferred":            func() { mt.BytesTransferred(rand.Intn(1000)) },
+		"AuditEventDropped":           func() { mt.AuditEventDropped() },
+		"ConnectResponseWriteFailed":  func() { mt.ConnectResponseWriteFailed() },
+		"ResponseWriteShort":          func() { mt.ResponseWriteShort() },
+		"VoucherSealFailed":           func() { mt.VoucherSealFailed() },
+		"CircuitStalled":              func() { mt.CircuitStalled(time.Duration(rand.Intn(10)) * time.Second) },
+		"CopyStall":                   func() { mt.CopyStall() },
+		"ReadChunkSize":               func() { mt.ReadChunkSize(rand.Intn(2048)) },
+		"ReservationLifetime": func() {
+			mt.ReservationLifetime(time.Duration(rand.Intn(3600))*time.Second, ReservationEndReason(rand.Intn(9)))
+		},
+		"HopMessageIOLatency": func() {
+			mt.HopMessageIOLatency(MessageIOOp(rand.Intn(4)), time.Duration(rand.Intn(1000))*time.Millisecond)
+		},
 	}
 	for method, f := range tests {
 		allocs := testing.AllocsPerRun(1000, f)
@@ -0,0 +1,135 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+var (
+	// ErrNoReservation is returned by MigrateReservation and RevokeReservation if the peer has no
+	// reservation with the relay.
+	ErrNoReservation = errors.New("no reservation")
+	// ErrRelayClosed is returned by MigrateReservation if either relay is closed.
+	ErrRelayClosed = errors.New("relay closed")
+
+	// errReservationRenewed is returned by MigrateReservation if the reservation was renewed
+	// with the source relay while it was being migrated.
+	errReservationRenewed = errors.New("reservation renewed during migration")
+)
+
+// migrateMx serializes migrations, so that locking both relays can't deadlock.
+var migrateMx sync.Mutex
+
+// MigrateReservation moves the reservation of p from one relay instance to another in the same
+// process, for example to rebalance peers between per tenant relays. The reservation keeps its
+// expiration and negotiated capabilities, and is accounted for in the reservation constraints of
+// the target relay instead of the source relay; if the target's constraints don't allow it, the
+// reservation is left with the source relay.
+//
+// The move is atomic: connection requests to p are served by exactly one of the relays at any
+// time. Relayed connections to and from p stay with the source relay until they close.
+// The target relay only relays connections to p if its host is connected to p.
+//
+// Unless both relays share a host, the client notices the move: the voucher and relay addresses
+// it announces were issued by the source relay. MigrateReservation returns the reservation
+// re-issued by the target relay, with a voucher signed by the target and the target's addresses;
+// the caller must deliver it to the client, which must announce the new addresses in place of
+// the old ones for other peers to reach it through the target relay.
+func MigrateReservation(from, to *Relay, p peer.ID) (*pbv2.Reservation, error) {
+	if from == to {
+		return nil, errors.New("cannot migrate a reservation to the same relay")
+	}
+
+	from.mx.Lock()
+	rsvp, ok := from.rsvp[p]
+	closed := from.closed
+	from.mx.Unlock()
+	if closed {
+		return nil, ErrRelayClosed
+	}
+	if !ok {
+		return nil, ErrNoReservation
+	}
+
+	// the reservation message is built without holding the locks, as it calls into the host and
+	// the fallback addresses callback of the target relay
+	var nonce []byte
+	if to.singleUseVouchers {
+		nonce = newVoucherNonce()
+	}
+	now := time.Now()
+	expire := rsvp.expire
+	msg, err := makeReservationMsg(to.reservationMsgOpts(nonce), p, expire)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue reservation with the target relay: %w", err)
+	}
+	if len(msg.Addrs) == 0 && to.fallbackAddrs != nil {
+		appendReservationAddrs(msg, to.fallbackReservationAddrs())
+	}
+	appendReservationAddrs(msg, to.additionalReservationAddrs)
+	if renew, ok := renewAfter(now, expire, to.rc.ReservationRenewFraction); ok {
+		renewUnix := uint64(renew.Unix())
+		msg.RenewAfter = &renewUnix
+	}
+
+	migrateMx.Lock()
+	defer migrateMx.Unlock()
+	from.mx.Lock()
+	defer from.mx.Unlock()
+	to.mx.Lock()
+	defer to.mx.Unlock()
+
+	if from.closed || to.closed {
+		return nil, ErrRelayClosed
+	}
+	rsvp, ok = from.rsvp[p]
+	if !ok {
+		return nil, ErrNoReservation
+	}
+	if !rsvp.expire.Equal(expire) {
+		return nil, errReservationRenewed
+	}
+	if _, ok := to.rsvp[p]; ok {
+		return nil, fmt.Errorf("peer %s already has a reservation with the target relay", p)
+	}
+	if err := to.constraints.Reserve(p, rsvp.addr, rsvp.expire); err != nil {
+		return nil, fmt.Errorf("target relay refused reservation: %w", err)
+	}
+
+	now = time.Now()
+	delete(from.rsvp, p)
+	from.constraints.cleanupPeer(p)
+	from.untagPeer(p, "relay-reservation")
+	from.checkHighWater(now)
+	from.reservationEnded(rsvp, ReservationEndMigrated, now)
+	if from.metricsTracer != nil {
+		from.metricsTracer.ReservationClosed(1)
+		if mt, ok := from.metricsTracer.(PeerMetricsTracer); ok && from.metricsPeerLabels {
+			mt.PeerReservationClosed(p)
+		}
+	}
+
+	rsvp.granted = now
+	rsvp.voucherNonce = nonce
+	rsvp.addrs = nil
+	if to.stableReservationAddrs {
+		rsvp.addrs = msg.Addrs
+	}
+	to.rsvp[p] = rsvp
+	to.tagPeer(p, "relay-reservation", ReservationTagWeight)
+	to.checkHighWater(now)
+	if to.metricsTracer != nil {
+		to.metricsTracer.ReservationAllowed(false)
+		if mt, ok := to.metricsTracer.(PeerMetricsTracer); ok && to.metricsPeerLabels {
+			mt.PeerReservationAllowed(p, false)
+		}
+	}
+
+	log.Debug("migrated relay reservation", "remote_peer", p, "target_relay", to.host.ID())
+	return msg, nil
+}
@@ -0,0 +1,129 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateReservation(t *testing.T) {
+	hosts := getTestHosts(t, 5)
+	fromHost, toHost, fullHost, src, dest := hosts[0], hosts[1], hosts[2], hosts[3], hosts[4]
+
+	from, err := New(fromHost)
+	require.NoError(t, err)
+	defer from.Close()
+	to, err := New(toHost, WithReservationAddressFilter(func(ma.Multiaddr) bool { return true }))
+	require.NoError(t, err)
+	defer to.Close()
+	rc := DefaultResources()
+	rc.MaxReservations = 0
+	full, err := New(fullHost, WithResources(rc))
+	require.NoError(t, err)
+	defer full.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, fromHost)
+	require.NoError(t, err)
+	require.NoError(t, dest.Connect(context.Background(), peer.AddrInfo{ID: toHost.ID(), Addrs: toHost.Addrs()}))
+
+	_, err = MigrateReservation(from, from, dest.ID())
+	require.Error(t, err)
+	_, err = MigrateReservation(from, to, src.ID())
+	require.ErrorIs(t, err, ErrNoReservation)
+	// the target's constraints are enforced, and the reservation stays with the source on failure
+	_, err = MigrateReservation(from, full, dest.ID())
+	require.ErrorIs(t, err, errTooManyReservations)
+	require.True(t, from.hasReservation(dest.ID()))
+
+	from.mx.Lock()
+	expire := from.rsvp[dest.ID()].expire
+	from.mx.Unlock()
+	rsvp, err := MigrateReservation(from, to, dest.ID())
+	require.NoError(t, err)
+	require.False(t, from.hasReservation(dest.ID()))
+	require.True(t, to.hasReservation(dest.ID()))
+	require.Zero(t, from.ConstraintsSnapshot().Total)
+	require.Equal(t, 1, to.ConstraintsSnapshot().Total)
+
+	// the reservation is re-issued by the target relay, with the same expiration
+	require.Equal(t, uint64(expire.Unix()), rsvp.GetExpire())
+	require.NotEmpty(t, rsvp.GetAddrs())
+	for _, b := range rsvp.GetAddrs() {
+		addr, err := ma.NewMultiaddrBytes(b)
+		require.NoError(t, err)
+		id, err := peer.IDFromP2PAddr(addr)
+		require.NoError(t, err)
+		require.Equal(t, toHost.ID(), id)
+	}
+	env, rec, err := record.ConsumeEnvelope(rsvp.GetVoucher(), proto.RecordDomain)
+	require.NoError(t, err)
+	require.True(t, env.PublicKey.Equals(toHost.Peerstore().PubKey(toHost.ID())))
+	voucher := rec.(*proto.ReservationVoucher)
+	require.Equal(t, toHost.ID(), voucher.Relay)
+	require.Equal(t, dest.ID(), voucher.Peer)
+
+	_, status := connectRaw(t, src, toHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	_, status = connectRaw(t, src, fromHost, dest.ID())
+	require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+
+	to.Close()
+	_, err = MigrateReservation(to, from, dest.ID())
+	require.ErrorIs(t, err, ErrRelayClosed)
+}
+
+func TestMigrateReservationMetrics(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	fromHost, toHost, dest := hosts[0], hosts[1], hosts[2]
+
+	mt := &lifetimeMetricsTracer{
+		lifetimes: make(map[ReservationEndReason][]time.Duration),
+		evictions: make(map[ReservationEndReason]int),
+	}
+	from, err := New(fromHost, WithMetricsTracer(mt))
+	require.NoError(t, err)
+	defer from.Close()
+	to, err := New(toHost)
+	require.NoError(t, err)
+	defer to.Close()
+
+	_, err = reserve(t, dest, fromHost)
+	require.NoError(t, err)
+	_, err = MigrateReservation(from, to, dest.ID())
+	require.NoError(t, err)
+
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	require.Equal(t, map[ReservationEndReason]int{ReservationEndMigrated: 1}, mt.evictions)
+	require.Equal(t, 1, mt.closed)
+}
+
+func TestMigrateReservationHighWater(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	fromHost, toHost, dest := hosts[0], hosts[1], hosts[2]
+
+	from, err := New(fromHost)
+	require.NoError(t, err)
+	defer from.Close()
+	rc := DefaultResources()
+	rc.MaxReservations = 1
+	mt := &highWaterMetricsTracer{}
+	to, err := New(toHost, WithResources(rc), WithReservationHighWater(0.5), WithMetricsTracer(mt))
+	require.NoError(t, err)
+	defer to.Close()
+
+	_, err = reserve(t, dest, fromHost)
+	require.NoError(t, err)
+	_, err = MigrateReservation(from, to, dest.ID())
+	require.NoError(t, err)
+	require.Equal(t, int32(1), mt.reached.Load())
+}
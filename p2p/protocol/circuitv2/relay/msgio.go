@@ -0,0 +1,77 @@
+package relay
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/multiformats/go-varint"
+	"google.golang.org/protobuf/proto"
+)
+
+// MessageIOOp is a read or write of a control message on a hop or stop stream, reported with
+// its latency to TransferMetricsTracer.HopMessageIOLatency.
+type MessageIOOp int
+
+const (
+	// HopMessageRead is reading the request from a hop stream.
+	HopMessageRead MessageIOOp = iota
+	// HopMessageWrite is writing a response to a hop stream.
+	HopMessageWrite
+	// StopMessageWrite is writing the connection request to the stop stream of the destination.
+	StopMessageWrite
+	// StopMessageRead is reading the response from the stop stream of the destination.
+	StopMessageRead
+)
+
+func (op MessageIOOp) String() string {
+	switch op {
+	case HopMessageRead:
+		return "hop read"
+	case HopMessageWrite:
+		return "hop write"
+	case StopMessageWrite:
+		return "stop write"
+	case StopMessageRead:
+		return "stop read"
+	default:
+		return "unknown"
+	}
+}
+
+// messageIODone reports the latency of a control message read or write that started at start.
+// Failed reads and writes are reported too, as a peer that is too slow to complete them is what
+// the latency is meant to surface.
+func (r *Relay) messageIODone(op MessageIOOp, start time.Time) {
+	if mt, ok := r.metricsTracer.(TransferMetricsTracer); ok {
+		mt.HopMessageIOLatency(op, time.Since(start))
+	}
+}
+
+// writeHopMsg writes msg to w as a single length-prefixed frame. A write accepting only part of
+// the frame fails, even if the writer doesn't report an error, and is reported to
+// FailureMetricsTracer.ResponseWriteShort: the stream must then be reset rather than closed, so
+// that the peer doesn't read a truncated frame.
+func (r *Relay) writeHopMsg(w io.Writer, msg *pbv2.HopMessage) error {
+	size := proto.Size(msg)
+	frame := make([]byte, varint.UvarintSize(uint64(size)), varint.UvarintSize(uint64(size))+size)
+	varint.PutUvarint(frame, uint64(size))
+	frame, err := proto.MarshalOptions{}.MarshalAppend(frame, msg)
+	if err != nil {
+		return err
+	}
+
+	n, err := w.Write(frame)
+	if n > 0 && n < len(frame) {
+		if mt, ok := r.metricsTracer.(FailureMetricsTracer); ok {
+			mt.ResponseWriteShort()
+		}
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return fmt.Errorf("wrote %d of %d bytes of hop message: %w", n, len(frame), err)
+	}
+	return err
+}
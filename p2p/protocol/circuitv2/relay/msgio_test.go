@@ -0,0 +1,102 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+type messageIOMetricsTracer struct {
+	metricsTracer
+
+	mx        sync.Mutex
+	latencies map[MessageIOOp][]time.Duration
+}
+
+func (mt *messageIOMetricsTracer) HopMessageIOLatency(op MessageIOOp, d time.Duration) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	if mt.latencies == nil {
+		mt.latencies = make(map[MessageIOOp][]time.Duration)
+	}
+	mt.latencies[op] = append(mt.latencies[op], d)
+}
+
+func (mt *messageIOMetricsTracer) Latencies(op MessageIOOp) []time.Duration {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	return append([]time.Duration(nil), mt.latencies[op]...)
+}
+
+func TestHopMessageIOLatency(t *testing.T) {
+	const delay = 200 * time.Millisecond
+
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	mt := &messageIOMetricsTracer{}
+	r, err := New(relayHost, WithMetricsTracer(mt))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	// the destination is slow to respond to the stop handshake
+	dest.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		defer s.Close()
+		rd := util.NewDelimitedReader(s, maxMessageSize)
+		defer rd.Close()
+		var msg pbv2.StopMessage
+		if err := rd.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		time.Sleep(delay)
+		msg.Reset()
+		msg.Type = pbv2.StopMessage_STATUS.Enum()
+		msg.Status = pbv2.Status_OK.Enum()
+		util.NewDelimitedWriter(s).WriteMsg(&msg)
+	})
+
+	// the source is slow to send its connection request
+	var req bytes.Buffer
+	require.NoError(t, util.NewDelimitedWriter(&req).WriteMsg(&pbv2.HopMessage{
+		Type: pbv2.HopMessage_CONNECT.Enum(),
+		Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest.ID()}),
+	}))
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Reset()
+	_, err = s.Write(req.Bytes()[:2])
+	require.NoError(t, err)
+	time.Sleep(delay)
+	_, err = s.Write(req.Bytes()[2:])
+	require.NoError(t, err)
+
+	var resp pbv2.HopMessage
+	require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+	require.Equal(t, pbv2.Status_OK, resp.GetStatus())
+
+	for _, op := range []MessageIOOp{HopMessageRead, StopMessageRead} {
+		latencies := mt.Latencies(op)
+		require.NotEmpty(t, latencies, op.String())
+		require.GreaterOrEqual(t, latencies[len(latencies)-1], delay, op.String())
+	}
+	for _, op := range []MessageIOOp{StopMessageWrite, HopMessageWrite} {
+		require.Eventually(t, func() bool {
+			latencies := mt.Latencies(op)
+			return len(latencies) > 0 && latencies[len(latencies)-1] < delay
+		}, time.Second, 10*time.Millisecond, op.String())
+	}
+}
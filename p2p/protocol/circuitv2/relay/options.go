@@ -1,6 +1,17 @@
 package relay
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/peer"
+
 	"github.com/multiformats/go-multiaddr"
 )
 
@@ -43,9 +54,32 @@ func WithInfiniteLimits() Option {
 }
 
 // WithACL is a Relay option that supplies an ACLFilter for access control.
-func WithACL(acl ACLFilter) Option {
+// If multiple filters are supplied, a request is only allowed if all filters allow it (see ChainACL).
+func WithACL(acls ...ACLFilter) Option {
 	return func(r *Relay) error {
-		r.acl = acl
+		switch len(acls) {
+		case 0:
+			r.acl = nil
+		case 1:
+			r.acl = acls[0]
+		default:
+			r.acl = ChainACL(acls...)
+		}
+		return nil
+	}
+}
+
+// WithDestinationAllowlist is a Relay option that restricts the destinations of relayed
+// connections to the given peers, regardless of which peers hold reservations; connection
+// requests to other peers are refused with PERMISSION_DENIED. It is meant for relays dedicated
+// to fronting a known set of services. The allowlist is checked in addition to the ACL, and can
+// be replaced at runtime with Relay.SetDestinationAllowlist.
+func WithDestinationAllowlist(peers []peer.ID) Option {
+	return func(r *Relay) error {
+		if len(peers) == 0 {
+			return errors.New("destination allowlist must not be empty")
+		}
+		r.SetDestinationAllowlist(peers)
 		return nil
 	}
 }
@@ -57,3 +91,728 @@ func WithMetricsTracer(mt MetricsTracer) Option {
 		return nil
 	}
 }
+
+// WithMetricsPeerLabels enables metrics labelled with the peer IDs of reserving and connecting
+// peers. This is disabled by default, as the cardinality of these metrics grows with the number
+// of peers using the relay. The metrics tracer must implement PeerMetricsTracer.
+func WithMetricsPeerLabels(enable bool) Option {
+	return func(r *Relay) error {
+		r.metricsPeerLabels = enable
+		return nil
+	}
+}
+
+// WithMetricsChunkSizes enables a metric of the sizes of the reads from relayed streams, which
+// shows how the BufferSize of the relay chunks the messages of relayed protocols. This is
+// disabled by default, as it's recorded on every read of every relayed connection. The metrics
+// tracer must implement TransferMetricsTracer.
+func WithMetricsChunkSizes(enable bool) Option {
+	return func(r *Relay) error {
+		r.metricsChunkSizes = enable
+		return nil
+	}
+}
+
+// WithAgentVersionFilter is a Relay option that refuses reservations from clients whose agent
+// version, as recorded in the peerstore by identify, is rejected by the filter.
+// allowUnknown controls whether clients with an unknown agent version may reserve.
+func WithAgentVersionFilter(filter AgentVersionFilter, allowUnknown bool) Option {
+	return func(r *Relay) error {
+		if filter == nil {
+			return errors.New("agent version filter must not be nil")
+		}
+		r.versionGate = newAgentVersionGate(filter, allowUnknown)
+		return nil
+	}
+}
+
+// WithRefuseRelayPeers is a Relay option that refuses reservations from peers that support the
+// relay hop protocol themselves, as recorded in the peerstore by identify, to avoid chains of
+// relays.
+func WithRefuseRelayPeers(refuse bool) Option {
+	return func(r *Relay) error {
+		r.refuseHopPeers = refuse
+		return nil
+	}
+}
+
+// WithReservationProbing is a Relay option that enables proactive probing of reserved peers.
+// Every interval, up to sampleSize reservations are checked, and the reservations of peers that
+// are no longer connected are retracted. If ping is true, connected peers are also pinged, and
+// their reservation is retracted if the ping fails.
+func WithReservationProbing(interval time.Duration, sampleSize int, ping bool) Option {
+	return func(r *Relay) error {
+		if interval <= 0 {
+			return errors.New("reservation probe interval must be positive")
+		}
+		if sampleSize <= 0 {
+			return errors.New("reservation probe sample size must be positive")
+		}
+		r.probe = &reservationProbe{
+			interval:   interval,
+			sampleSize: sampleSize,
+			ping:       ping,
+		}
+		return nil
+	}
+}
+
+// WithScopeBandwidthAccounting is a Relay option that reports relayed bytes to the stream scopes
+// of the relayed streams, if they implement BandwidthRecorder. It is disabled by default, to
+// avoid double counting for users who already account for relayed bytes elsewhere.
+func WithScopeBandwidthAccounting() Option {
+	return func(r *Relay) error {
+		r.scopeBandwidth = true
+		return nil
+	}
+}
+
+// WithProtocolScopes is a Relay option that accounts the resources of a relayed connection,
+// such as its buffers, in the resource manager scope of the application protocol that the source
+// announced in its connect request, so that per-protocol limits apply to relayed connections.
+// Relayed connections without an announced protocol are accounted in the relay service scope.
+func WithProtocolScopes() Option {
+	return func(r *Relay) error {
+		r.protocolScopes = true
+		return nil
+	}
+}
+
+// WithBandwidthReporter is a Relay option that reports relayed bytes to reporter, as received
+// from the source and sent to the destination of each relayed connection, under the protocol of
+// the respective relay stream. The host's own bandwidth reporter, if any, already counts the
+// bytes of relay streams, so reporter should be a separate instance to avoid double counting.
+// It is independent of WithScopeBandwidthAccounting.
+func WithBandwidthReporter(reporter metrics.Reporter) Option {
+	return func(r *Relay) error {
+		r.bwReporter = reporter
+		return nil
+	}
+}
+
+// WithHopReadErrorLimit is a Relay option that blocks hop streams from IP addresses that opened
+// maxErrors hop streams without sending a valid hop message within window. Hop streams from a
+// blocked IP address are reset without being read until the window expires.
+func WithHopReadErrorLimit(maxErrors int, window time.Duration) Option {
+	return func(r *Relay) error {
+		if maxErrors <= 0 || window <= 0 {
+			return errors.New("hop read error limit and window must be positive")
+		}
+		r.readErrLimiter = newHopReadErrorLimiter(maxErrors, window)
+		return nil
+	}
+}
+
+// WithBufferPrewarm is a Relay option that allocates n relay buffers into the buffer pool when the
+// relay is constructed, so that the first relayed connections don't pay the allocation cost.
+// Every relayed connection uses two buffers. The number of buffers is reduced if the resource
+// manager doesn't allow reserving the memory. It is a no-op if n <= 0.
+func WithBufferPrewarm(n int) Option {
+	return func(r *Relay) error {
+		r.prewarm = n
+		return nil
+	}
+}
+
+// WithTraceHook sets a hook invoked for every circuit the relay attempts to establish, allowing
+// the circuit trace ID to be bridged to a tracing system.
+func WithTraceHook(hook TraceHook) Option {
+	return func(r *Relay) error {
+		r.traceHook = hook
+		return nil
+	}
+}
+
+// WithRequireSourceReservation makes the relay refuse connection requests from peers that do not
+// hold a reservation themselves, so that only reserving peers can initiate relayed connections.
+func WithRequireSourceReservation(require bool) Option {
+	return func(r *Relay) error {
+		r.requireSourceReservation = require
+		return nil
+	}
+}
+
+// WithStableReservationAddrs is a Relay option that keeps the order of the relay addresses sent
+// with a peer's reservation stable across renewals. Addresses sent with the previous reservation
+// keep their order, and new addresses follow in canonical order, so clients that prefer the first
+// address don't switch addresses as the host's address list is reordered.
+func WithStableReservationAddrs() Option {
+	return func(r *Relay) error {
+		r.stableReservationAddrs = true
+		return nil
+	}
+}
+
+// WithAdditionalReservationAddrs adds addresses the relay is reachable at to the reservations it
+// grants, e.g. a stable /dnsaddr the host does not listen on directly.
+// These addresses bypass the reservation address filter. Addresses without a peer ID get the
+// relay's peer ID appended; addresses with any other peer ID are rejected.
+func WithAdditionalReservationAddrs(addrs []multiaddr.Multiaddr) Option {
+	return func(r *Relay) error {
+		selfID := r.host.ID()
+		selfP2PAddr, err := multiaddr.NewComponent("p2p", selfID.String())
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			id, _ := peer.IDFromP2PAddr(addr)
+			switch id {
+			case "":
+				addr = addr.Encapsulate(selfP2PAddr)
+			case selfID:
+			default:
+				return fmt.Errorf("reservation address %s contains a foreign peer ID", addr)
+			}
+			r.additionalReservationAddrs = append(r.additionalReservationAddrs, addr)
+		}
+		return nil
+	}
+}
+
+// WithFallbackAddrs is a Relay option that sets a function supplying the addresses advertised
+// in reservations when none of the host's addresses pass the reservation address filter, for
+// example before the host has learned its public addresses. Like the host's addresses, fallback
+// addresses without a peer ID get the relay's peer ID appended, and addresses with any other peer
+// ID are skipped.
+func WithFallbackAddrs(fallback func() []multiaddr.Multiaddr) Option {
+	return func(r *Relay) error {
+		if fallback == nil {
+			return errors.New("fallback addresses function must not be nil")
+		}
+		r.fallbackAddrs = fallback
+		return nil
+	}
+}
+
+// WithConnManagerTagging enables or disables tagging of reserving and relaying peers in the
+// host's connection manager. Tagging is enabled by default.
+func WithConnManagerTagging(enable bool) Option {
+	return func(r *Relay) error {
+		r.connManagerTagging = enable
+		return nil
+	}
+}
+
+// WithRecentRefusals sets the number of refused requests retained for RecentRefusals, which
+// defaults to DefaultRecentRefusals. A size of 0 disables recording refusals.
+func WithRecentRefusals(size int) Option {
+	return func(r *Relay) error {
+		if size < 0 {
+			return errors.New("number of recent refusals must not be negative")
+		}
+		if size == 0 {
+			r.refusals = nil
+			return nil
+		}
+		r.refusals = newRefusalLog(size)
+		return nil
+	}
+}
+
+// WithReservationEvictionPolicy sets the policy for evicting an existing reservation when a new
+// reservation would exceed MaxReservations. By default, no reservations are evicted.
+// Reservations with active circuits and reservations of priority peers set with
+// WithReservedCapacity are never evicted, and a reservation is only evicted if the new
+// reservation is then granted.
+func WithReservationEvictionPolicy(policy ReservationEvictionPolicy) Option {
+	return func(r *Relay) error {
+		switch policy {
+		case EvictNone, EvictSoonestExpiring, EvictLeastRecentlyUsed:
+		default:
+			return fmt.Errorf("unknown reservation eviction policy: %d", policy)
+		}
+		r.evictionPolicy = policy
+		return nil
+	}
+}
+
+// WithCircuitCost sets the function computing the cost of relayed connections, which is
+// accounted against Resources.MaxCircuitCostPerPeer. By default, every connection costs 1.
+func WithCircuitCost(f CircuitCostFunc) Option {
+	return func(r *Relay) error {
+		r.circuitCostFunc = f
+		return nil
+	}
+}
+
+// WithReachabilityGating makes the relay refuse reservations while the host is known to be
+// privately reachable, as the addresses handed out in reservations would be useless.
+func WithReachabilityGating(enable bool) Option {
+	return func(r *Relay) error {
+		r.reachabilityGating = enable
+		return nil
+	}
+}
+
+// WithReachabilityCallback sets a callback invoked when the relay becomes publicly unreachable,
+// or reachable again.
+func WithReachabilityCallback(f func(reachable bool)) Option {
+	return func(r *Relay) error {
+		r.reachabilityCallback = f
+		return nil
+	}
+}
+
+// WithStallThreshold sets how long a write to the destination of a relayed connection may block
+// before it is reported to the metrics tracer as a stall; defaults to DefaultStallThreshold.
+// A threshold of 0 disables stall tracking.
+func WithStallThreshold(d time.Duration) Option {
+	return func(r *Relay) error {
+		if d < 0 {
+			return errors.New("stall threshold must not be negative")
+		}
+		r.stallThreshold = d
+		return nil
+	}
+}
+
+// WithMaxEmptyReads sets the number of consecutive reads from the source of a relayed connection
+// returning no data and no error after which relaying it is aborted with io.ErrNoProgress and
+// reported to the metrics tracer, so that a misbehaving transport can't spin the copy loop. bufio
+// applies a limit of 100 to the readers it wraps. The check is disabled by default, or with a
+// limit of 0.
+func WithMaxEmptyReads(n int) Option {
+	return func(r *Relay) error {
+		if n < 0 {
+			return errors.New("maximum empty reads must not be negative")
+		}
+		r.maxEmptyReads = n
+		return nil
+	}
+}
+
+// WithAuditLogger sets an AuditLogger recording every reservation and connection decision.
+// Events are queued for the logger; if it falls behind and the queue fills up, events are dropped
+// and counted by the metrics tracer.
+func WithAuditLogger(l AuditLogger) Option {
+	return func(r *Relay) error {
+		r.auditLogger = l
+		return nil
+	}
+}
+
+// WithConnectResponseRetry makes the relay retry writing the response to a successful connection
+// request once, with a fresh write deadline, if the write times out before writing anything,
+// instead of resetting the circuit right away. Other write failures are not retried.
+func WithConnectResponseRetry(retry bool) Option {
+	return func(r *Relay) error {
+		r.retryConnectResponse = retry
+		return nil
+	}
+}
+
+// WithStrictVouchers makes the relay refuse reservations if it fails to seal the reservation
+// voucher, instead of granting a reservation without a voucher.
+func WithStrictVouchers(strict bool) Option {
+	return func(r *Relay) error {
+		r.strictVouchers = strict
+		return nil
+	}
+}
+
+// WithSingleUseVouchers is a Relay option that embeds a random nonce in every reservation voucher
+// and accepts each voucher only once in ConsumeVoucher.
+// Vouchers name the relay and the reserving peer and are signed by the relay, so they can't be
+// presented to other relays or by other peers, but nothing else binds them to a single use: an
+// application that accepts vouchers as proof of a reservation would accept a leaked voucher any
+// number of times until it expires. With single use vouchers, only the latest voucher issued for
+// a peer's current reservation is accepted, and only once; renewing the reservation supersedes
+// the previous voucher. This doesn't stop the reserving peer itself from using its voucher first,
+// and vouchers issued before the relay restarted are no longer accepted.
+func WithSingleUseVouchers() Option {
+	return func(r *Relay) error {
+		r.singleUseVouchers = true
+		return nil
+	}
+}
+
+// WithCircuitProbes is a Relay option that enables circuit probes, with which clients check
+// whether the relay can reach a peer before connecting to it. Probing a peer involves a
+// handshake with it, so probes are rate limited per source peer by limit.
+func WithCircuitProbes(limit RateLimit) Option {
+	return func(r *Relay) error {
+		r.probeLimiter = newConnectRateLimiter(limit)
+		return nil
+	}
+}
+
+// WithDestinationVerification is a Relay option that makes the relay ask destinations without a
+// reservation whether they expect relayed connections before refusing to connect to them, which
+// avoids refusals when the relay's view of the reservations lags behind, e.g. while the relay
+// restarts or after a reservation was migrated from another relay. The destination is asked with
+// a probe handshake on the stop protocol, and is only asked if the relay is connected to it.
+// Destinations that confirm are connected to with the relay's default limit. Verifications are
+// rate limited by limit across all destinations.
+func WithDestinationVerification(limit RateLimit) Option {
+	return func(r *Relay) error {
+		r.destVerifyLimiter = newDestVerifyLimiter(limit)
+		return nil
+	}
+}
+
+// WithAllowTwoHop is a Relay option that allows connecting to destinations without a reservation
+// through another relay, when the destination advertises a relay address of a relay that this
+// relay is connected to. maxHops is the maximum number of relays in a circuit through this relay,
+// which must be at least 2; connect requests that have traversed maxHops relays already are
+// refused, preventing relaying loops. Data and duration limits of both relays apply.
+func WithAllowTwoHop(maxHops int) Option {
+	return func(r *Relay) error {
+		if maxHops < 2 {
+			return fmt.Errorf("max hops must be at least 2, got %d", maxHops)
+		}
+		r.maxHops = maxHops
+		return nil
+	}
+}
+
+// WithLoadShedder is a Relay option that refuses new reservation and connection requests with
+// RESOURCE_LIMIT_EXCEEDED while shed returns true, for example when the host is under memory or
+// CPU pressure. Existing reservations and relayed connections are not affected. shed is
+// consulted at most once per second, and its result is reused in between.
+func WithLoadShedder(shed func() bool) Option {
+	return func(r *Relay) error {
+		if shed == nil {
+			return errors.New("load shedder must not be nil")
+		}
+		r.loadShedder = newLoadShedder(shed)
+		return nil
+	}
+}
+
+// WithQualityHints is a Relay option that includes a quality hint in reservation responses,
+// carrying the share of the relay's circuit capacity in use and the median latency of recent stop
+// handshakes. Clients can use it to balance their reservations over several relays.
+func WithQualityHints(enable bool) Option {
+	return func(r *Relay) error {
+		if enable {
+			r.handshakeLatency = newLatencyWindow()
+		} else {
+			r.handshakeLatency = nil
+		}
+		return nil
+	}
+}
+
+// WithBackupRelays is a Relay option that advertises other relays to reserving peers, so that
+// they can fail over to them without discovering relays anew. Addresses must either not contain a
+// peer ID or contain the ID of their backup relay; other addresses are not advertised, and neither
+// are backups without any valid address.
+func WithBackupRelays(backups []peer.AddrInfo) Option {
+	return func(r *Relay) error {
+		r.backupRelays = slices.Clone(backups)
+		return nil
+	}
+}
+
+// WithStatsFile is a Relay option that writes the relay's Stats as JSON to the file at path
+// every interval, and once more when the relay is closed, for deployments without a metrics
+// scraper. The file is replaced atomically. Failures to write it are logged and otherwise
+// ignored.
+func WithStatsFile(path string, interval time.Duration) Option {
+	return func(r *Relay) error {
+		if path == "" {
+			return errors.New("stats file path must not be empty")
+		}
+		if interval <= 0 {
+			return fmt.Errorf("stats file interval must be positive: %s", interval)
+		}
+		r.statsFile = &statsFile{path: path, interval: interval, done: make(chan struct{})}
+		return nil
+	}
+}
+
+// WithReservationHighWater is a Relay option that warns, by logging and with the
+// ReservationHighWaterReached metric, when the number of reservations reaches fraction of
+// Resources.MaxReservations, to leave time to scale out before reservations are refused. The
+// warning is cleared with ReservationHighWaterCleared once the reservations drop 10 percentage
+// points below the mark, and is logged at most once a minute. The reservations are checked when a
+// reservation is granted, when a peer with a reservation disconnects, and when expired
+// reservations are collected.
+func WithReservationHighWater(fraction float64) Option {
+	return func(r *Relay) error {
+		if fraction <= 0 || fraction > 1 {
+			return fmt.Errorf("reservation high water fraction must be in (0, 1]: %v", fraction)
+		}
+		r.highWater = &highWaterMark{fraction: fraction}
+		return nil
+	}
+}
+
+// WithScopeGauges is a Relay option that publishes the number of active reservations and
+// circuits every interval as the ScopeGaugeReservations and ScopeGaugeCircuits gauges of the
+// relay's resource manager service scope, so that they are exported with the resource manager's
+// metrics without a relay MetricsTracer. Both gauges are set to zero when the relay is closed.
+// This has no effect if the host's resource manager doesn't implement
+// rcmgr.ServiceScopeGauges. It can be combined with WithMetricsTracer, whose metrics are
+// separate.
+func WithScopeGauges(interval time.Duration) Option {
+	return func(r *Relay) error {
+		if interval <= 0 {
+			return fmt.Errorf("scope gauges interval must be positive: %s", interval)
+		}
+		r.scopeGauges = &scopeGauges{interval: interval, done: make(chan struct{})}
+		return nil
+	}
+}
+
+// WithHandoffTokens is a Relay option that issues a signed handoff token with every reservation.
+// Within HandoffWindow of the relay restarting with the same identity, a peer presenting a valid
+// token issued for it before the restart gets its reservation restored until the token expires,
+// subject only to Resources.MaxReservations rather than to the per IP and per ASN limits. This
+// avoids refusing reservations to a stampede of clients reserving again after a restart. Tokens
+// issued since the relay started are ignored.
+func WithHandoffTokens() Option {
+	return func(r *Relay) error {
+		r.handoffTokens = true
+		return nil
+	}
+}
+
+// WithKeepAlive is a Relay option that turns the duration limit of relayed connections into a
+// limit on their inactivity: every window, a relayed connection that carried at least minBytes
+// in both directions combined within the window has its deadline pushed back to
+// Resources.Limit.Duration from then. Connections that stay silent are still closed once their
+// deadline passes, and the data limit is unaffected. It has no effect without a duration limit.
+func WithKeepAlive(minBytes int64, window time.Duration) Option {
+	return func(r *Relay) error {
+		if minBytes <= 0 {
+			return fmt.Errorf("keep-alive byte threshold must be positive: %d", minBytes)
+		}
+		if window <= 0 {
+			return fmt.Errorf("keep-alive window must be positive: %s", window)
+		}
+		r.keepAlive = &keepAlive{minBytes: minBytes, window: window}
+		return nil
+	}
+}
+
+// WithCloseWriteFlush is a Relay option that flushes the data buffered by a relayed stream
+// before propagating the close of the other side, for streams of muxers that batch writes and
+// implement Flush. If the flush doesn't complete within timeout, both streams are reset rather
+// than closed, so the receiving peer sees an error instead of a truncated stream.
+func WithCloseWriteFlush(timeout time.Duration) Option {
+	return func(r *Relay) error {
+		if timeout <= 0 {
+			return fmt.Errorf("close write flush timeout must be positive: %s", timeout)
+		}
+		r.closeWriteFlush = timeout
+		return nil
+	}
+}
+
+// WithDisconnectBatching is a Relay option that coalesces the disconnects of peers over window,
+// and processes them together, reducing the contention of high churn with the handling of
+// reservation and connect requests. Reservations of disconnected peers are dropped, or start
+// their Resources.DisconnectGracePeriod, up to window later. Peers that reconnect within the
+// window are not processed as disconnected.
+func WithDisconnectBatching(window time.Duration) Option {
+	return func(r *Relay) error {
+		if window <= 0 {
+			return fmt.Errorf("disconnect batching window must be positive: %s", window)
+		}
+		r.disconnectBatch = &disconnectBatch{window: window}
+		return nil
+	}
+}
+
+// WithCompletionErrors is a Relay option that treats the errors reading from one side of a
+// relayed connection for which isCompletion returns true as the end of that side's transfer: the
+// other side's stream is closed for writing, as if the first side had closed its stream, instead
+// of resetting both streams. This avoids signaling errors to peers of application protocols in
+// which peers may reset their stream once they are done, e.g. with ResetIsCompletion. Errors
+// writing to the other side always reset both streams.
+func WithCompletionErrors(isCompletion CompletionErrorFunc) Option {
+	return func(r *Relay) error {
+		r.isCompletion = isCompletion
+		return nil
+	}
+}
+
+// WithStopStreamLocalAddr is a Relay option that prefers connections whose local address is, or
+// starts with, addr when opening streams to the destinations of relayed connections, for routing
+// or policy reasons on multi-homed hosts. For example, /ip4/192.0.2.1 prefers connections on that
+// local IP address. The relay only opens these streams on existing connections, so the preference
+// is ignored if there is no connection on addr to the destination.
+func WithStopStreamLocalAddr(addr multiaddr.Multiaddr) Option {
+	return func(r *Relay) error {
+		if len(addr) == 0 {
+			return errors.New("stop stream local address must not be empty")
+		}
+		r.stopLocalAddr = addr
+		return nil
+	}
+}
+
+// WithCapture is a Relay option that captures the first maxBytesPerCircuit bytes relayed in
+// each direction of every relayed connection, for debugging. The traffic of each relayed
+// connection is written to its own file in dir, as lines of JSON encoded CaptureRecords with the
+// peer IDs and time of each chunk. Capturing never blocks relayed connections; chunks are dropped
+// if the capture falls behind.
+//
+// Captured traffic may contain sensitive data of the relay's users, and the capture files are not
+// cleaned up. The files are only readable by the relay's user. At most MaxConcurrentCaptures
+// relayed connections are captured at a time, and at most MaxCaptureFiles overall; relayed
+// connections beyond these limits aren't captured. Only enable it temporarily to debug a specific
+// issue.
+func WithCapture(dir string, maxBytesPerCircuit int) Option {
+	return func(r *Relay) error {
+		if dir == "" {
+			return errors.New("capture directory must not be empty")
+		}
+		if maxBytesPerCircuit <= 0 {
+			return fmt.Errorf("capture size must be positive: %d", maxBytesPerCircuit)
+		}
+		r.capture = &captureConfig{
+			dir:                dir,
+			maxBytesPerCircuit: maxBytesPerCircuit,
+			maxConcurrent:      MaxConcurrentCaptures,
+			maxFiles:           MaxCaptureFiles,
+		}
+		return nil
+	}
+}
+
+// WithReservedCapacity is a Relay option that sets aside slots of Resources.MaxReservations for
+// the given priority peers, so that they can reserve even when the relay is otherwise full.
+// Ordinary peers are refused once only the reserved slots are left. Priority peers take up the
+// reserved slots first, and can also take up the remaining capacity like ordinary peers.
+func WithReservedCapacity(priorityPeers []peer.ID, slots int) Option {
+	return func(r *Relay) error {
+		if slots <= 0 {
+			return fmt.Errorf("invalid number of reserved slots: %d", slots)
+		}
+		if len(priorityPeers) == 0 {
+			return errors.New("no priority peers")
+		}
+		rc := &reservedCapacity{peers: make(map[peer.ID]struct{}, len(priorityPeers)), slots: slots}
+		for _, p := range priorityPeers {
+			rc.peers[p] = struct{}{}
+		}
+		r.reservedCapacity = rc
+		return nil
+	}
+}
+
+// WithFairBandwidthShare is a Relay option that limits the bandwidth of all relayed connections
+// combined to bytesPerSecond, shared fairly between the source peers with active relayed
+// connections, so that a greedy source can't starve the others. All relayed connections of a
+// source peer, in both directions, share its part of the budget, which is in proportion to the
+// weight of the peer among the active source peers. A nil weight gives every source peer the same
+// share. The shares are adjusted as relayed connections are opened and closed.
+func WithFairBandwidthShare(bytesPerSecond int, weight SourceWeightFunc) Option {
+	return func(r *Relay) error {
+		if bytesPerSecond <= 0 {
+			return fmt.Errorf("bandwidth budget must be positive: %d", bytesPerSecond)
+		}
+		r.fairShare = newFairShare(float64(bytesPerSecond), weight)
+		return nil
+	}
+}
+
+// WithAdminControl is a Relay option that makes the handler returned by AdminHandler also serve
+// the control APIs, which close pending handshakes and relayed connections, revoke reservations
+// and toggle the maintenance mode. Without it, the handler is read only.
+func WithAdminControl() Option {
+	return func(r *Relay) error {
+		r.adminControl = true
+		return nil
+	}
+}
+
+// WithReservationWebhook is a Relay option that consults an HTTP webhook at url before granting
+// a reservation, for central policy control across a fleet of relays. The relay POSTs a JSON
+// encoded ReservationWebhookRequest, and expects a JSON encoded ReservationWebhookResponse with
+// status 200, which allows or refuses the reservation, and may shorten it. If the webhook fails
+// or doesn't respond within timeout, the reservation is allowed if failOpen is true, and refused
+// otherwise. The webhook is consulted after the ACL, while the reserving peer holds one of
+// Resources.MaxConcurrentHandshakes. Redirects aren't followed, unless a client that follows them
+// is set with WithReservationWebhookClient.
+func WithReservationWebhook(url string, timeout time.Duration, failOpen bool) Option {
+	return func(r *Relay) error {
+		if url == "" {
+			return errors.New("reservation webhook URL must not be empty")
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("reservation webhook timeout must be positive: %s", timeout)
+		}
+		r.webhook = &reservationWebhook{
+			url:      url,
+			timeout:  timeout,
+			failOpen: failOpen,
+			client:   newWebhookClient(timeout),
+		}
+		return nil
+	}
+}
+
+// WithReservationWebhookClient is a Relay option that sets the HTTP client used to consult the
+// reservation webhook set with WithReservationWebhook, for example to authenticate to it. The
+// webhook timeout still applies to every request.
+func WithReservationWebhookClient(c *http.Client) Option {
+	return func(r *Relay) error {
+		if c == nil {
+			return errors.New("reservation webhook client must not be nil")
+		}
+		r.webhookClient = c
+		return nil
+	}
+}
+
+// WithReservationPSK is a Relay option that only grants reservations to peers proving knowledge
+// of the pre-shared key psk, for relays serving a private group of peers. The relay challenges
+// reserving peers with a random nonce, which they must answer with a proto.PSKResponse; clients
+// answer it with client.WithPSK. Peers that don't advertise proto.CapabilityPSK in their reserve
+// message are refused with PERMISSION_DENIED instead of being sent a challenge they wouldn't
+// understand. The challenge is issued after the ACL, before consulting the
+// reservation webhook.
+func WithReservationPSK(psk []byte) Option {
+	return func(r *Relay) error {
+		if len(psk) == 0 {
+			return errors.New("reservation pre-shared key must not be empty")
+		}
+		r.psk = bytes.Clone(psk)
+		return nil
+	}
+}
+
+// WithMaxHostConnections is a Relay option that refuses new reservations while the relay host
+// has maxConns or more open connections, e.g. when it nears its connection manager's high water
+// mark, as reservations encourage peers to stay connected. Existing reservations can still be
+// renewed.
+func WithMaxHostConnections(maxConns int) Option {
+	return func(r *Relay) error {
+		if maxConns <= 0 {
+			return fmt.Errorf("max host connections must be positive: %d", maxConns)
+		}
+		r.maxHostConns = maxConns
+		return nil
+	}
+}
+
+// WithReservationSchedule is a Relay option that restricts relay service to peers to the
+// schedule returned by schedule, which returns nil for peers that may use the relay at any time.
+// Outside their schedule, peers are refused reservations with RESERVATION_REFUSED, and connect
+// requests to them are refused with NO_RESERVATION, even if they hold a reservation.
+func WithReservationSchedule(schedule func(p peer.ID) Schedule) Option {
+	return func(r *Relay) error {
+		if schedule == nil {
+			return errors.New("reservation schedule must not be nil")
+		}
+		r.schedule = schedule
+		return nil
+	}
+}
+
+// WithASNLookup is a Relay option that sets the function used to map the IP addresses of
+// reserving peers to their ASN, for enforcing Resources.MaxReservationsPerASN. lookup returns 0
+// for addresses with an unknown ASN, which are not limited per ASN. By default, only IPv6
+// addresses are mapped, using an embedded ASN database.
+func WithASNLookup(lookup func(net.IP) uint32) Option {
+	return func(r *Relay) error {
+		if lookup == nil {
+			return errors.New("ASN lookup must not be nil")
+		}
+		r.asnLookup = lookup
+		return nil
+	}
+}
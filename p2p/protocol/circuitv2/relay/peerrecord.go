@@ -0,0 +1,34 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var errPeerRecordMismatch = errors.New("signed peer record doesn't match the remote peer")
+
+// verifyPeerRecord verifies the signed peer record sent by p in a reserve message and returns its
+// certified addresses.
+func verifyPeerRecord(p peer.ID, b []byte) ([]ma.Multiaddr, error) {
+	env, rec, err := record.ConsumeEnvelope(b, peer.PeerRecordEnvelopeDomain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signed peer record: %w", err)
+	}
+	pr, ok := rec.(*peer.PeerRecord)
+	if !ok {
+		return nil, errors.New("invalid signed peer record: not a peer record")
+	}
+	signer, err := peer.IDFromPublicKey(env.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signed peer record: %w", err)
+	}
+	if signer != p || pr.PeerID != p {
+		return nil, errPeerRecordMismatch
+	}
+	return pr.Addrs, nil
+}
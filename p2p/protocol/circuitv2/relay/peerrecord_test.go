@@ -0,0 +1,117 @@
+package relay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// signedPeerRecord returns a peer record for signer's ID and addrs, signed by signer's key.
+func signedPeerRecord(t *testing.T, signer host.Host, id peer.ID, addrs []ma.Multiaddr) *record.Envelope {
+	t.Helper()
+	rec := peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: id, Addrs: addrs})
+	env, err := record.Seal(rec, signer.Peerstore().PrivKey(signer.ID()))
+	require.NoError(t, err)
+	return env
+}
+
+// connectResponse sends a connection request for dest to the relay and returns the response.
+func connectResponse(t *testing.T, h, relayHost host.Host, dest peer.ID) *pbv2.HopMessage {
+	t.Helper()
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Reset() })
+
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{
+		Type: pbv2.HopMessage_CONNECT.Enum(),
+		Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest}),
+	}))
+	var resp pbv2.HopMessage
+	require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+	return &resp
+}
+
+func TestReserveSignedPeerRecord(t *testing.T) {
+	certified := []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1234"),
+		ma.StringCast("/ip4/1.2.3.4/udp/1234/quic-v1"),
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		hosts := getTestHosts(t, 3)
+		relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+		r, err := New(relayHost)
+		require.NoError(t, err)
+		defer r.Close()
+
+		handleStopEcho(dest)
+		rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+		require.NoError(t, dest.Connect(context.Background(), rinfo))
+		_, err = client.Reserve(context.Background(), dest, rinfo, client.WithSignedPeerRecord(signedPeerRecord(t, dest, dest.ID(), certified)))
+		require.NoError(t, err)
+
+		resp := connectResponse(t, src, relayHost, dest.ID())
+		require.Equal(t, pbv2.Status_OK, resp.GetStatus())
+		ai, err := util.PeerToPeerInfoV2(resp.GetPeer())
+		require.NoError(t, err)
+		require.Equal(t, dest.ID(), ai.ID)
+		require.Equal(t, certified, ai.Addrs)
+	})
+
+	t.Run("mismatched", func(t *testing.T) {
+		hosts := getTestHosts(t, 3)
+		relayHost, other, dest := hosts[0], hosts[1], hosts[2]
+		r, err := New(relayHost)
+		require.NoError(t, err)
+		defer r.Close()
+
+		rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+		require.NoError(t, dest.Connect(context.Background(), rinfo))
+		for _, env := range []*record.Envelope{
+			// a valid record of another peer
+			signedPeerRecord(t, other, other.ID(), certified),
+			// a record for dest signed by another peer
+			signedPeerRecord(t, other, dest.ID(), certified),
+		} {
+			_, err = client.Reserve(context.Background(), dest, rinfo, client.WithSignedPeerRecord(env))
+			var rerr client.ReservationError
+			require.ErrorAs(t, err, &rerr)
+			require.Equal(t, pbv2.Status_PERMISSION_DENIED, rerr.Status)
+			require.False(t, r.hasReservation(dest.ID()))
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		hosts := getTestHosts(t, 3)
+		relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+		r, err := New(relayHost)
+		require.NoError(t, err)
+		defer r.Close()
+
+		handleStopEcho(dest)
+		_, err = reserve(t, dest, relayHost)
+		require.NoError(t, err)
+
+		resp := connectResponse(t, src, relayHost, dest.ID())
+		require.Equal(t, pbv2.Status_OK, resp.GetStatus())
+		require.Nil(t, resp.GetPeer())
+	})
+}
+
+func TestVerifyPeerRecordMalformed(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+	_, err := verifyPeerRecord(h.ID(), []byte("not an envelope"))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, errPeerRecordMismatch)
+}
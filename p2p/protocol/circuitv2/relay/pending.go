@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PendingInfo describes a hop stream whose handshake has not completed yet.
+type PendingInfo struct {
+	// Peer is the remote peer of the hop stream.
+	Peer peer.ID
+	// Addr is the remote multiaddr of the connection the hop stream was opened on.
+	Addr ma.Multiaddr
+	// Type is the type of the request, or nil if no request has been read yet.
+	Type *pbv2.HopMessage_Type
+	// Started is the time the stream was accepted.
+	Started time.Time
+}
+
+type pendingHandshake struct {
+	info PendingInfo
+	s    network.Stream
+}
+
+// pendingHandshakes tracks hop streams from the time they are accepted until their handler
+// returns.
+type pendingHandshakes struct {
+	mx      sync.Mutex
+	streams map[network.Stream]*pendingHandshake
+}
+
+func newPendingHandshakes() *pendingHandshakes {
+	return &pendingHandshakes{streams: make(map[network.Stream]*pendingHandshake)}
+}
+
+func (ph *pendingHandshakes) add(s network.Stream) {
+	ph.mx.Lock()
+	defer ph.mx.Unlock()
+	ph.streams[s] = &pendingHandshake{
+		info: PendingInfo{
+			Peer:    s.Conn().RemotePeer(),
+			Addr:    s.Conn().RemoteMultiaddr(),
+			Started: time.Now(),
+		},
+		s: s,
+	}
+}
+
+func (ph *pendingHandshakes) setType(s network.Stream, t pbv2.HopMessage_Type) {
+	ph.mx.Lock()
+	defer ph.mx.Unlock()
+	if h, ok := ph.streams[s]; ok {
+		h.info.Type = t.Enum()
+	}
+}
+
+func (ph *pendingHandshakes) remove(s network.Stream) {
+	ph.mx.Lock()
+	defer ph.mx.Unlock()
+	delete(ph.streams, s)
+}
+
+// PendingHandshakes returns the hop streams whose handshake is in progress.
+func (r *Relay) PendingHandshakes() []PendingInfo {
+	r.pending.mx.Lock()
+	defer r.pending.mx.Unlock()
+	res := make([]PendingInfo, 0, len(r.pending.streams))
+	for _, h := range r.pending.streams {
+		res = append(res, h.info)
+	}
+	return res
+}
+
+// ClosePendingHandshakes resets the hop streams whose handshake has been in progress for longer
+// than olderThan, and returns the number of streams reset.
+func (r *Relay) ClosePendingHandshakes(olderThan time.Duration) int {
+	var stale []network.Stream
+	now := time.Now()
+	r.pending.mx.Lock()
+	for s, h := range r.pending.streams {
+		if now.Sub(h.info.Started) > olderThan {
+			stale = append(stale, s)
+			delete(r.pending.streams, s)
+		}
+	}
+	r.pending.mx.Unlock()
+
+	for _, s := range stale {
+		log.Debug("resetting stalled relay handshake", "remote_peer", s.Conn().RemotePeer())
+		s.Reset()
+	}
+	return len(stale)
+}
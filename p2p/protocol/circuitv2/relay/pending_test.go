@@ -0,0 +1,49 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingHandshakes(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	// force the protocol negotiation to complete without sending a hop message
+	_, err = s.Write(nil)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(r.PendingHandshakes()) == 1 }, time.Second, 10*time.Millisecond)
+	info := r.PendingHandshakes()[0]
+	require.Equal(t, h.ID(), info.Peer)
+	require.Nil(t, info.Type)
+
+	require.Zero(t, r.ClosePendingHandshakes(time.Hour))
+	require.Len(t, r.PendingHandshakes(), 1)
+
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, 1, r.ClosePendingHandshakes(time.Millisecond))
+	require.Empty(t, r.PendingHandshakes())
+
+	s.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = s.Read(make([]byte, 1))
+	require.ErrorIs(t, err, network.ErrReset)
+
+	// completed handshakes are no longer tracked
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(r.PendingHandshakes()) == 0 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// precheckConnect makes the checks of a connect request from src, connected from a, that don't
+// need any resources to be reserved for the circuit, so that doomed requests are refused before
+// the relay begins a resource span and reserves the relay buffers. The checks are ordered from
+// the cheapest to the most expensive. It returns the destination of the request, whether the
+// destination has no reservation but confirmed that it expects relayed connections when asked
+// with WithDestinationVerification, and the refusal to record if the request is refused, which is
+// nil otherwise.
+//
+// The destination's reservation is checked again when the circuit's resources are accounted, as
+// it may have expired in the meantime.
+func (r *Relay) precheckConnect(src peer.ID, a ma.Multiaddr, msg *pbv2.HopMessage) (peer.AddrInfo, bool, *RefusalRecord) {
+	refuse := func(dest peer.ID, status pbv2.Status, reason, constraint string) (peer.AddrInfo, bool, *RefusalRecord) {
+		return peer.AddrInfo{}, false, &RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest, Status: status, Reason: reason, Constraint: constraint}
+	}
+
+	if isRelayAddr(a) {
+		return refuse("", pbv2.Status_PERMISSION_DENIED, "connection attempt over relay connection", "")
+	}
+	if r.maxHops > 0 && int(msg.GetHops()) >= r.maxHops {
+		return refuse("", pbv2.Status_PERMISSION_DENIED, "hop limit exceeded", fmt.Sprintf("max hops %d", r.maxHops))
+	}
+
+	dest, err := util.PeerToPeerInfoV2(msg.GetPeer())
+	if err != nil {
+		return refuse("", pbv2.Status_MALFORMED_MESSAGE, "malformed destination peer", "")
+	}
+	if dest.ID == src {
+		return refuse(dest.ID, pbv2.Status_PERMISSION_DENIED, "connection to self", "")
+	}
+	if !r.destinationAllowed(dest.ID) {
+		return refuse(dest.ID, pbv2.Status_PERMISSION_DENIED, "destination not allowed", "destination allowlist")
+	}
+
+	// destinations without a reservation are the most common reason for refusing connect
+	// requests, e.g. from peers trying stale relay addresses
+	var unreserved bool
+	if !r.allowNextHop(msg.GetHops()) {
+		r.mx.Lock()
+		_, ok := r.rsvp[dest.ID]
+		r.mx.Unlock()
+		if !ok && r.destVerifyLimiter == nil {
+			return refuse(dest.ID, pbv2.Status_NO_RESERVATION, "no reservation", "")
+		}
+		unreserved = !ok
+	}
+
+	if !r.scheduleOpen(dest.ID, time.Now()) {
+		return refuse(dest.ID, pbv2.Status_NO_RESERVATION, "outside reservation schedule", "reservation schedule")
+	}
+
+	if allow, reason := r.aclAllowConnect(src, a, dest.ID); !allow {
+		return refuse(dest.ID, pbv2.Status_PERMISSION_DENIED, reason, "acl")
+	}
+
+	// asking the destination takes a round trip, so it's done last
+	if unreserved {
+		if ok, constraint := r.verifyDestination(src, dest.ID); !ok {
+			return refuse(dest.ID, pbv2.Status_NO_RESERVATION, "no reservation", constraint)
+		}
+	}
+	return dest, unreserved, nil
+}
@@ -0,0 +1,131 @@
+package relay
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// countingScope counts the spans begun and ended and the memory reserved in them.
+type countingScope struct {
+	network.NullScope
+	spans    atomic.Int32
+	ended    atomic.Int32
+	reserved atomic.Int64
+}
+
+func (s *countingScope) BeginSpan() (network.ResourceScopeSpan, error) {
+	s.spans.Add(1)
+	return &countingSpan{scope: s}, nil
+}
+
+type countingSpan struct {
+	network.NullScope
+	scope *countingScope
+}
+
+func (s *countingSpan) ReserveMemory(size int, _ uint8) error {
+	s.scope.reserved.Add(int64(size))
+	return nil
+}
+
+func (s *countingSpan) Done() {
+	s.scope.ended.Add(1)
+}
+
+// denyDestinationACL allows everything but circuits to a single destination.
+type denyDestinationACL struct {
+	dest peer.ID
+}
+
+func (a *denyDestinationACL) AllowReserve(peer.ID, ma.Multiaddr) bool { return true }
+
+func (a *denyDestinationACL) AllowConnect(_ peer.ID, _ ma.Multiaddr, dest peer.ID) bool {
+	return dest != a.dest
+}
+
+func TestPrecheckConnectReservesNoMemory(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, dest, denied := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	rc := DefaultResources()
+	r, err := New(relayHost, WithResources(rc), WithACL(&denyDestinationACL{dest: denied.ID()}))
+	require.NoError(t, err)
+	defer r.Close()
+	scope := &countingScope{}
+	r.scope = scope
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, denied, relayHost)
+	require.NoError(t, err)
+
+	_, status := connectRaw(t, src, relayHost, test.RandPeerIDFatal(t))
+	require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+	_, status = connectRaw(t, src, relayHost, denied.ID())
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, status)
+	require.Zero(t, scope.spans.Load())
+	require.Zero(t, scope.reserved.Load())
+
+	_, status = connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	require.Equal(t, int32(1), scope.spans.Load())
+	require.Equal(t, int64(2*rc.BufferSize), scope.reserved.Load())
+}
+
+func TestPrecheckConnect(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, dest := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithACL(&denyDestinationACL{dest: dest.ID()}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	src := test.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	connectMsg := func(dest peer.ID) *pbv2.HopMessage {
+		return &pbv2.HopMessage{
+			Type: pbv2.HopMessage_CONNECT.Enum(),
+			Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest}),
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		addr   ma.Multiaddr
+		msg    *pbv2.HopMessage
+		status pbv2.Status
+	}{
+		{"over relay connection", addr.Encapsulate(ma.StringCast("/p2p-circuit")), connectMsg(dest.ID()), pbv2.Status_PERMISSION_DENIED},
+		{"malformed destination", addr, &pbv2.HopMessage{Type: pbv2.HopMessage_CONNECT.Enum()}, pbv2.Status_MALFORMED_MESSAGE},
+		{"self", addr, connectMsg(src), pbv2.Status_PERMISSION_DENIED},
+		// the reservation is checked before the ACL
+		{"no reservation", addr, connectMsg(dest.ID()), pbv2.Status_NO_RESERVATION},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, refusal := r.precheckConnect(src, tc.addr, tc.msg)
+			require.NotNil(t, refusal)
+			require.Equal(t, tc.status, refusal.Status)
+		})
+	}
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	_, _, refusal := r.precheckConnect(src, addr, connectMsg(dest.ID()))
+	require.NotNil(t, refusal)
+	require.Equal(t, "acl", refusal.Constraint)
+
+	r.acl = nil
+	info, _, refusal := r.precheckConnect(src, addr, connectMsg(dest.ID()))
+	require.Nil(t, refusal)
+	require.Equal(t, dest.ID(), info.ID)
+}
@@ -0,0 +1,34 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/network"
+
+	pool "github.com/libp2p/go-buffer-pool"
+)
+
+// prewarmBuffers allocates n buffers of the given size and returns them to the buffer pool, so
+// that subsequent Gets don't need to allocate.
+// The memory is reserved in the relay's service scope while allocating; if the reservation fails,
+// fewer buffers are allocated. Note that the pool may still release the buffers on garbage
+// collection.
+func (r *Relay) prewarmBuffers(bp *pool.BufferPool, n, size int) int {
+	for n > 0 {
+		if err := r.scope.ReserveMemory(n*size, network.ReservationPriorityLow); err == nil {
+			break
+		}
+		n /= 2
+	}
+	if n <= 0 {
+		return 0
+	}
+	defer r.scope.ReleaseMemory(n * size)
+
+	bufs := make([][]byte, 0, n)
+	for range n {
+		bufs = append(bufs, bp.Get(size))
+	}
+	for _, buf := range bufs {
+		bp.Put(buf)
+	}
+	return n
+}
@@ -0,0 +1,154 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+const (
+	pruneReasonDisconnected = "disconnected"
+	pruneReasonPingFailed   = "ping failed"
+
+	// probeConcurrency is the maximum number of peers probed at the same time in a round.
+	probeConcurrency = 8
+)
+
+// probePingTimeout is how long a reserved peer has to respond to a probe ping.
+var probePingTimeout = 10 * time.Second
+
+// reservationProbe configures proactive reachability probing of reserved peers.
+type reservationProbe struct {
+	// interval is the time between probe rounds.
+	interval time.Duration
+	// sampleSize is the maximum number of reservations probed per round; it bounds the
+	// load a single round can generate.
+	sampleSize int
+	// ping enables pinging connected peers in addition to checking connectedness.
+	ping bool
+	// running is set while a probe round is in progress, so that slow rounds don't pile up.
+	running atomic.Bool
+}
+
+// startProbeRound starts a probe round in the background, unless one is still in progress.
+// Rounds run separately from the reservation GC, as pinging unresponsive peers is slow.
+func (r *Relay) startProbeRound() {
+	if !r.probe.running.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer r.probe.running.Store(false)
+		r.probeReservations()
+	}()
+}
+
+// probeReservations checks the reachability of a sample of the current reservations and
+// retracts the reservations of peers that have become unreachable.
+func (r *Relay) probeReservations() {
+	type sample struct {
+		p      peer.ID
+		expire time.Time
+	}
+
+	r.mx.Lock()
+	if r.closed {
+		r.mx.Unlock()
+		return
+	}
+	samples := make([]sample, 0, r.probe.sampleSize)
+	// map iteration order is random, which gives us a random sample.
+	for p, rsvp := range r.rsvp {
+		if len(samples) >= r.probe.sampleSize {
+			break
+		}
+		if !rsvp.disconnected.IsZero() {
+			// kept for the disconnect grace period, which drops it unless the peer reconnects
+			continue
+		}
+		samples = append(samples, sample{p: p, expire: rsvp.expire})
+	}
+	r.mx.Unlock()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, probeConcurrency)
+	for _, s := range samples {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if reason := r.probePeer(s.p); reason != "" {
+				r.pruneReservation(s.p, s.expire, reason)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// pruneReservation retracts the reservation of p found unreachable by a probe, unless it was
+// refreshed since it was sampled with the given expiration.
+func (r *Relay) pruneReservation(p peer.ID, expire time.Time, reason string) {
+	now := time.Now()
+	r.mx.Lock()
+	rsvp, ok := r.rsvp[p]
+	// only retract the reservation if it hasn't been refreshed while we were probing, nor
+	// entered the disconnect grace period
+	if r.closed || !ok || !rsvp.expire.Equal(expire) || !rsvp.disconnected.IsZero() {
+		r.mx.Unlock()
+		return
+	}
+	delete(r.rsvp, p)
+	r.constraints.cleanupPeer(p)
+	r.untagPeer(p, "relay-reservation")
+	r.checkHighWater(now)
+	r.mx.Unlock()
+
+	log.Debug("pruned relay reservation", "remote_peer", p, "reason", reason)
+	r.reservationEnded(rsvp, ReservationEndPruned, now)
+	if r.metricsTracer != nil {
+		if mt, ok := r.metricsTracer.(ReservationMetricsTracer); ok {
+			mt.ReservationPruned(reason)
+		}
+		r.metricsTracer.ReservationClosed(1)
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			mt.PeerReservationClosed(p)
+		}
+	}
+}
+
+// probePeer returns the reason for considering the peer unreachable, or the empty string if
+// the peer is reachable.
+func (r *Relay) probePeer(p peer.ID) string {
+	if r.host.Network().Connectedness(p) != network.Connected {
+		return pruneReasonDisconnected
+	}
+	if !r.probe.ping {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, probePingTimeout)
+	defer cancel()
+	ctx = network.WithNoDial(ctx, "relay reservation probe")
+
+	res, ok := <-ping.Ping(ctx, r.host, p)
+	if !ok {
+		// ping closes the channel without a result when the context expires
+		res.Error = ctx.Err()
+	}
+	if res.Error != nil {
+		if r.ctx.Err() != nil {
+			// the relay is shutting down
+			return ""
+		}
+		log.Debug("error pinging reserved peer", "remote_peer", p, "err", res.Error)
+		return pruneReasonPingFailed
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservationProbingPing(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, pingable, unpingable := hosts[0], hosts[1], hosts[2]
+	ping.NewPingService(pingable)
+
+	r, err := New(relayHost, WithReservationProbing(50*time.Millisecond, 10, true))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, pingable, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, unpingable, relayHost)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return !r.hasReservation(unpingable.ID()) }, 5*time.Second, 10*time.Millisecond)
+	require.True(t, r.hasReservation(pingable.ID()))
+	require.Equal(t, network.Connected, relayHost.Network().Connectedness(unpingable.ID()))
+}
+
+func TestReservationProbingDisconnected(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithReservationProbing(time.Hour, 10, false))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+
+	r.probeReservations()
+	require.True(t, r.hasReservation(h.ID()))
+
+	// simulate a missed disconnect notification
+	relayHost.Network().StopNotify(r.notifiee)
+	require.NoError(t, relayHost.Network().ClosePeer(h.ID()))
+	require.True(t, r.hasReservation(h.ID()))
+
+	r.probeReservations()
+	require.False(t, r.hasReservation(h.ID()))
+}
+
+func TestReservationProbingGracePeriod(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	rc := DefaultResources()
+	rc.DisconnectGracePeriod = time.Hour
+	r, err := New(relayHost, WithResources(rc), WithReservationProbing(time.Hour, 10, false))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+
+	require.NoError(t, relayHost.Network().ClosePeer(h.ID()))
+	require.Eventually(t, func() bool {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		return !r.rsvp[h.ID()].disconnected.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the reservation is kept for the grace period, even though the peer is disconnected
+	r.probeReservations()
+	require.True(t, r.hasReservation(h.ID()))
+}
+
+func TestReservationProbingConcurrent(t *testing.T) {
+	const n = 2 * probeConcurrency
+	timeout := probePingTimeout
+	probePingTimeout = 500 * time.Millisecond
+	defer func() { probePingTimeout = timeout }()
+
+	hosts := getTestHosts(t, n+1)
+	relayHost, peers := hosts[0], hosts[1:]
+
+	rc := DefaultResources()
+	rc.MaxReservationsPerIP = n
+	r, err := New(relayHost, WithResources(rc), WithReservationProbing(time.Hour, n, true))
+	require.NoError(t, err)
+	defer r.Close()
+
+	for _, h := range peers {
+		// accept pings, but never answer them
+		h.SetStreamHandler(ping.ID, func(s network.Stream) {
+			<-r.ctx.Done()
+			s.Reset()
+		})
+		_, err := reserve(t, h, relayHost)
+		require.NoError(t, err)
+	}
+
+	start := time.Now()
+	r.startProbeRound()
+	// a round is already in progress
+	r.startProbeRound()
+	require.Eventually(t, func() bool { return !r.probe.running.Load() }, 5*time.Second, 10*time.Millisecond)
+	// the peers are probed probeConcurrency at a time, not one after another
+	require.Less(t, time.Since(start), n*probePingTimeout/2)
+	for _, h := range peers {
+		require.False(t, r.hasReservation(h.ID()))
+	}
+}
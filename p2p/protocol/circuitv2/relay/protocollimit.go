@@ -0,0 +1,53 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// peerProtocol identifies the relayed connections of a peer that run a protocol.
+type peerProtocol struct {
+	peer  peer.ID
+	proto protocol.ID
+}
+
+// protocolLimitExceeded returns the peer of a relayed connection between src and dest that
+// already has the maximum number of relayed connections running proto, if any.
+// r.mx must be held.
+func (r *Relay) protocolLimitExceeded(src, dest peer.ID, proto protocol.ID) (peer.ID, bool) {
+	limit := r.rc.MaxCircuitsPerPeerProtocol
+	if limit <= 0 || proto == "" {
+		return "", false
+	}
+	for _, p := range []peer.ID{src, dest} {
+		if r.protoConns[peerProtocol{p, proto}] >= limit {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// addProtocolConn counts a relayed connection between src and dest running proto.
+// r.mx must be held.
+func (r *Relay) addProtocolConn(src, dest peer.ID, proto protocol.ID) {
+	if r.rc.MaxCircuitsPerPeerProtocol <= 0 || proto == "" {
+		return
+	}
+	r.protoConns[peerProtocol{src, proto}]++
+	r.protoConns[peerProtocol{dest, proto}]++
+}
+
+// rmProtocolConn releases a relayed connection counted with addProtocolConn.
+// r.mx must be held.
+func (r *Relay) rmProtocolConn(src, dest peer.ID, proto protocol.ID) {
+	if r.rc.MaxCircuitsPerPeerProtocol <= 0 || proto == "" {
+		return
+	}
+	for _, key := range []peerProtocol{{src, proto}, {dest, proto}} {
+		if n := r.protoConns[key] - 1; n > 0 {
+			r.protoConns[key] = n
+		} else {
+			delete(r.protoConns, key)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestMaxCircuitsPerPeerProtocol(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.MaxCircuitsPerPeerProtocol = 2
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	addCircuitTransport(t, dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	c, err := client.New(src, swarmt.GenUpgrader(t, src.Network().(*swarm.Swarm), nil))
+	require.NoError(t, err)
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", relayHost.ID(), dest.ID()))
+
+	dial := func(proto protocol.ID) (transport.CapableConn, error) {
+		ctx := context.Background()
+		if proto != "" {
+			ctx = util.ContextWithProtocol(ctx, proto)
+		}
+		return c.Dial(ctx, raddr, dest.ID())
+	}
+
+	var conns []transport.CapableConn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for range 2 {
+		conn, err := dial("/test/a")
+		require.NoError(t, err)
+		conns = append(conns, conn)
+	}
+
+	// the reservation is at the limit for /test/a
+	_, err = dial("/test/a")
+	require.Error(t, err)
+	require.Len(t, r.RecentRefusals(), 1)
+	require.Equal(t, "too many connections for protocol", r.RecentRefusals()[0].Reason)
+
+	// but other protocols, and connections without an announced protocol, are not limited
+	for _, proto := range []protocol.ID{"/test/b", "/test/b", "", "", ""} {
+		conn, err := dial(proto)
+		require.NoError(t, err)
+		conns = append(conns, conn)
+	}
+	_, err = dial("/test/b")
+	require.Error(t, err)
+
+	// closing a connection makes room for another one
+	require.NoError(t, conns[0].Close())
+	require.Eventually(t, func() bool {
+		conn, err := dial("/test/a")
+		if err != nil {
+			return false
+		}
+		conns = append(conns, conn)
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,25 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// circuitSpan begins the resource scope span for a relayed connection requested by msg. With
+// WithProtocolScopes, the span belongs to the scope of the protocol announced in msg, if any.
+// Otherwise, it belongs to the relay service scope.
+func (r *Relay) circuitSpan(msg *pbv2.HopMessage) (network.ResourceScopeSpan, error) {
+	proto := protocol.ID(msg.GetProtocol())
+	if !r.protocolScopes || proto == "" {
+		return r.scope.BeginSpan()
+	}
+
+	var span network.ResourceScopeSpan
+	err := r.host.Network().ResourceManager().ViewProtocol(proto, func(s network.ProtocolScope) error {
+		var err error
+		span, err = s.BeginSpan()
+		return err
+	})
+	return span, err
+}
@@ -0,0 +1,125 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// protocolResourceManager records the memory reserved in protocol and service scopes.
+type protocolResourceManager struct {
+	network.NullResourceManager
+	mx     sync.Mutex
+	memory map[string]int
+}
+
+func (rm *protocolResourceManager) ViewProtocol(proto protocol.ID, f func(network.ProtocolScope) error) error {
+	return f(&recordingScope{rm: rm, name: "protocol:" + string(proto)})
+}
+
+func (rm *protocolResourceManager) ViewService(svc string, f func(network.ServiceScope) error) error {
+	return f(&recordingScope{rm: rm, name: "service:" + svc})
+}
+
+func (rm *protocolResourceManager) reserved(name string) int {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+	return rm.memory[name]
+}
+
+type recordingScope struct {
+	network.NullScope
+	rm       *protocolResourceManager
+	name     string
+	reserved int
+}
+
+func (s *recordingScope) BeginSpan() (network.ResourceScopeSpan, error) {
+	return &recordingScope{rm: s.rm, name: s.name}, nil
+}
+
+func (s *recordingScope) ReserveMemory(size int, _ uint8) error {
+	s.rm.mx.Lock()
+	defer s.rm.mx.Unlock()
+	s.rm.memory[s.name] += size
+	s.reserved += size
+	return nil
+}
+
+func (s *recordingScope) Done() {
+	s.rm.mx.Lock()
+	defer s.rm.mx.Unlock()
+	s.rm.memory[s.name] -= s.reserved
+	s.reserved = 0
+}
+
+func TestProtocolScopes(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		name := "disabled"
+		if enabled {
+			name = "enabled"
+		}
+		t.Run(name, func(t *testing.T) {
+			rm := &protocolResourceManager{memory: make(map[string]int)}
+			relayHost := getTestHosts(t, 1, swarmt.WithSwarmOpts(swarm.WithResourceManager(rm)))[0]
+			hosts := getTestHosts(t, 2)
+			src, dest := hosts[0], hosts[1]
+
+			var opts []Option
+			if enabled {
+				opts = append(opts, WithProtocolScopes())
+			}
+			r, err := New(relayHost, opts...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			addCircuitTransport(t, dest)
+			_, err = reserve(t, dest, relayHost)
+			require.NoError(t, err)
+
+			require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+			c, err := client.New(src, swarmt.GenUpgrader(t, src.Network().(*swarm.Swarm), nil))
+			require.NoError(t, err)
+			raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", relayHost.ID(), dest.ID()))
+
+			buffers := 2 * DefaultResources().BufferSize
+			protoScope := "protocol:/test/app"
+			serviceScope := "service:" + ServiceName
+
+			// the protocol announced by the source
+			conn, err := c.Dial(util.ContextWithProtocol(context.Background(), "/test/app"), raddr, dest.ID())
+			require.NoError(t, err)
+			if enabled {
+				require.Equal(t, buffers, rm.reserved(protoScope))
+				require.Zero(t, rm.reserved(serviceScope))
+			} else {
+				require.Zero(t, rm.reserved(protoScope))
+				require.Equal(t, buffers, rm.reserved(serviceScope))
+			}
+			conn.Close()
+			require.Eventually(t, func() bool {
+				return rm.reserved(protoScope) == 0 && rm.reserved(serviceScope) == 0
+			}, time.Second, 10*time.Millisecond)
+
+			// no announced protocol
+			conn, err = c.Dial(context.Background(), raddr, dest.ID())
+			require.NoError(t, err)
+			defer conn.Close()
+			require.Zero(t, rm.reserved(protoScope))
+			require.Equal(t, buffers, rm.reserved(serviceScope))
+		})
+	}
+}
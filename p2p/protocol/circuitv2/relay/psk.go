@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+// pskChallenge challenges the remote peer of s to prove knowledge of the pre-shared key, if
+// reservations are gated by one. Peers that don't advertise proto.CapabilityPSK in their reserve
+// message are refused without a challenge, which they wouldn't understand. It returns the status
+// to refuse the reservation with, and the reason for refusing it, unless the status is OK.
+func (r *Relay) pskChallenge(s network.Stream, reserve *pbv2.HopMessage) (pbv2.Status, string) {
+	if r.psk == nil {
+		return pbv2.Status_OK, ""
+	}
+	if !proto.Capabilities(reserve.GetCapabilities()).Has(proto.CapabilityPSK) {
+		return pbv2.Status_PERMISSION_DENIED, "pre-shared key not supported by peer"
+	}
+
+	challenge := make([]byte, proto.PSKChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		log.Error("error generating pre-shared key challenge", "err", err)
+		return pbv2.Status_CONNECTION_FAILED, "error generating pre-shared key challenge"
+	}
+
+	var msg pbv2.HopMessage
+	msg.Type = pbv2.HopMessage_CHALLENGE.Enum()
+	msg.PskChallenge = challenge
+
+	s.SetWriteDeadline(time.Now().Add(r.rc.responseWriteTimeout()))
+	start := time.Now()
+	err := r.writeHopMsg(s, &msg)
+	r.messageIODone(HopMessageWrite, start)
+	s.SetWriteDeadline(time.Time{})
+	if err != nil {
+		s.Reset()
+		return pbv2.Status_CONNECTION_FAILED, "error writing pre-shared key challenge"
+	}
+
+	rd := util.NewDelimitedReader(s, maxMessageSize)
+	defer rd.Close()
+
+	msg.Reset()
+	s.SetReadDeadline(time.Now().Add(r.rc.reserveReadTimeout()))
+	start = time.Now()
+	err = rd.ReadMsg(&msg)
+	r.messageIODone(HopMessageRead, start)
+	s.SetReadDeadline(time.Time{})
+	if err != nil {
+		return pbv2.Status_MALFORMED_MESSAGE, "error reading pre-shared key response"
+	}
+	if msg.GetType() != pbv2.HopMessage_RESERVE {
+		return pbv2.Status_MALFORMED_MESSAGE, "unexpected pre-shared key response"
+	}
+	if len(msg.GetPskResponse()) == 0 {
+		return pbv2.Status_PERMISSION_DENIED, "missing pre-shared key response"
+	}
+
+	expected := proto.PSKResponse(r.psk, challenge, r.host.ID(), s.Conn().RemotePeer())
+	if !hmac.Equal(msg.GetPskResponse(), expected) {
+		return pbv2.Status_PERMISSION_DENIED, "invalid pre-shared key response"
+	}
+	return pbv2.Status_OK, ""
+}
@@ -0,0 +1,133 @@
+package relay
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservationPSK(t *testing.T) {
+	psk := []byte("correct horse battery staple")
+
+	for _, tc := range []struct {
+		name  string
+		psk   []byte
+		allow bool
+	}{
+		{name: "correct", psk: psk, allow: true},
+		{name: "wrong", psk: []byte("incorrect horse battery staple")},
+		{name: "none"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, h := hosts[0], hosts[1]
+
+			r, err := New(relayHost, WithReservationPSK(psk))
+			require.NoError(t, err)
+			defer r.Close()
+
+			rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+			require.NoError(t, h.Connect(context.Background(), rinfo))
+			_, err = client.Reserve(context.Background(), h, rinfo, client.WithPSK(tc.psk))
+			if !tc.allow {
+				var rerr client.ReservationError
+				require.ErrorAs(t, err, &rerr)
+				require.Equal(t, pbv2.Status_PERMISSION_DENIED, rerr.Status)
+				require.False(t, r.hasReservation(h.ID()))
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, r.hasReservation(h.ID()))
+		})
+	}
+
+	_, err := New(getTestHosts(t, 1)[0], WithReservationPSK(nil))
+	require.Error(t, err)
+}
+
+func TestReservationPSKMissingResponse(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithReservationPSK([]byte("secret")))
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Close()
+
+	rd := util.NewDelimitedReader(s, maxMessageSize)
+	defer rd.Close()
+	wr := util.NewDelimitedWriter(s)
+
+	var msg pbv2.HopMessage
+	msg.Type = pbv2.HopMessage_RESERVE.Enum()
+	caps := uint64(proto.CapabilityPSK)
+	msg.Capabilities = &caps
+	require.NoError(t, wr.WriteMsg(&msg))
+
+	msg.Reset()
+	require.NoError(t, rd.ReadMsg(&msg))
+	require.Equal(t, pbv2.HopMessage_CHALLENGE, msg.GetType())
+	require.Len(t, msg.GetPskChallenge(), proto.PSKChallengeSize)
+
+	msg.Reset()
+	msg.Type = pbv2.HopMessage_RESERVE.Enum()
+	require.NoError(t, wr.WriteMsg(&msg))
+
+	msg.Reset()
+	require.NoError(t, rd.ReadMsg(&msg))
+	require.Equal(t, pbv2.HopMessage_STATUS, msg.GetType())
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, msg.GetStatus())
+	require.False(t, r.hasReservation(h.ID()))
+
+	refusals := r.RecentRefusals()
+	require.Len(t, refusals, 1)
+	require.Equal(t, "missing pre-shared key response", refusals[0].Reason)
+	require.Equal(t, "pre-shared key", refusals[0].Constraint)
+}
+
+func TestReservationPSKLegacyClient(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithReservationPSK([]byte("secret")))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// a client that doesn't know about pre-shared keys advertises no capabilities
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Close()
+
+	rd := util.NewDelimitedReader(s, maxMessageSize)
+	defer rd.Close()
+	var msg pbv2.HopMessage
+	msg.Type = pbv2.HopMessage_RESERVE.Enum()
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(&msg))
+
+	// it is refused right away rather than sent a challenge
+	msg.Reset()
+	require.NoError(t, rd.ReadMsg(&msg))
+	require.Equal(t, pbv2.HopMessage_STATUS, msg.GetType())
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, msg.GetStatus())
+	require.False(t, r.hasReservation(h.ID()))
+
+	// the same goes for clients of this module opting out of the capability
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	_, err = client.Reserve(context.Background(), h, rinfo, client.WithCapabilities(proto.CapabilityTraceID))
+	var rerr client.ReservationError
+	require.ErrorAs(t, err, &rerr)
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, rerr.Status)
+	require.Equal(t, "reservation failed", rerr.Reason)
+}
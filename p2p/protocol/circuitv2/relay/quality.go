@@ -0,0 +1,84 @@
+package relay
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// latencyWindowSize is the number of recent stop handshake latencies the quality hint is
+// computed from.
+const latencyWindowSize = 32
+
+// latencyWindow keeps the most recent stop handshake latencies. A nil latencyWindow records
+// nothing.
+type latencyWindow struct {
+	mx      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func newLatencyWindow() *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, 0, latencyWindowSize)}
+}
+
+// Add records a handshake latency, replacing the oldest one if the window is full.
+func (w *latencyWindow) Add(d time.Duration) {
+	if w == nil {
+		return
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// Median returns the median of the recorded latencies, and false if there are none.
+func (w *latencyWindow) Median() (time.Duration, bool) {
+	if w == nil {
+		return 0, false
+	}
+	w.mx.Lock()
+	sorted := slices.Clone(w.samples)
+	w.mx.Unlock()
+	if len(sorted) == 0 {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2], true
+}
+
+// makeQualityMsg returns the quality hint sent with reservations.
+// It must be called with r.mx held.
+func (r *Relay) makeQualityMsg() *pbv2.ReservationQuality {
+	utilization := r.circuitUtilization()
+	q := &pbv2.ReservationQuality{CircuitUtilization: &utilization}
+	if median, ok := r.handshakeLatency.Median(); ok {
+		ms := uint32(median.Milliseconds())
+		q.HandshakeLatency = &ms
+	}
+	return q
+}
+
+// circuitUtilization returns the percentage of the relay's circuit capacity in use. The capacity
+// is that of every reservation slot being used to the per peer circuit limit.
+// It must be called with r.mx held.
+func (r *Relay) circuitUtilization() uint32 {
+	capacity := r.rc.MaxReservations * r.circuitCostBudget()
+	if capacity <= 0 {
+		return 0
+	}
+	var used int
+	for _, c := range r.conns {
+		used += c
+	}
+	// every circuit is accounted to both its source and its destination
+	used /= 2
+	return uint32(min(used*100/capacity, 100))
+}
@@ -0,0 +1,101 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQualityHints(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 2
+	rc.MaxCircuits = 5
+	r, err := New(relayHost, WithResources(rc), WithQualityHints(true))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.NotNil(t, rsvp.Quality)
+	require.Zero(t, rsvp.Quality.CircuitUtilization)
+	require.Zero(t, rsvp.Quality.HandshakeLatency)
+
+	// synthetic load: 5 circuits out of a capacity of 2 reservations with 5 circuits each
+	r.mx.Lock()
+	r.conns[peer.ID("a")] = 5
+	r.conns[peer.ID("b")] = 5
+	r.mx.Unlock()
+	for _, d := range []time.Duration{10, 30, 20} {
+		r.handshakeLatency.Add(d * time.Millisecond)
+	}
+
+	rsvp, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.NotNil(t, rsvp.Quality)
+	require.Equal(t, 50, rsvp.Quality.CircuitUtilization)
+	require.Equal(t, 20*time.Millisecond, rsvp.Quality.HandshakeLatency)
+}
+
+func TestQualityHintsDisabled(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.Nil(t, rsvp.Quality)
+}
+
+func TestQualityHintsHandshakeLatency(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+	addCircuitTransport(t, src)
+	addCircuitTransport(t, dest)
+	dest.SetStreamHandler("/test", func(s network.Stream) { s.Close() })
+
+	r, err := New(relayHost, WithQualityHints(true))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = openCircuit(t, src, dest, relayHost, "/test")
+	require.NoError(t, err)
+
+	median, ok := r.handshakeLatency.Median()
+	require.True(t, ok)
+	require.Positive(t, median)
+}
+
+func TestLatencyWindow(t *testing.T) {
+	var nilWindow *latencyWindow
+	nilWindow.Add(time.Second)
+	_, ok := nilWindow.Median()
+	require.False(t, ok)
+
+	w := newLatencyWindow()
+	_, ok = w.Median()
+	require.False(t, ok)
+
+	for range latencyWindowSize {
+		w.Add(time.Second)
+	}
+	median, ok := w.Median()
+	require.True(t, ok)
+	require.Equal(t, time.Second, median)
+
+	// once full, new samples replace the oldest ones
+	for range latencyWindowSize/2 + 1 {
+		w.Add(time.Millisecond)
+	}
+	median, ok = w.Median()
+	require.True(t, ok)
+	require.Equal(t, time.Millisecond, median)
+}
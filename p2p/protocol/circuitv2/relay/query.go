@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// handleQuery responds with the relay's current limits, without reserving a slot.
+func (r *Relay) handleQuery(s network.Stream) {
+	defer s.Close()
+
+	s.SetWriteDeadline(time.Now().Add(r.rc.responseWriteTimeout()))
+	defer s.SetWriteDeadline(time.Time{})
+
+	var msg pbv2.HopMessage
+	msg.Type = pbv2.HopMessage_STATUS.Enum()
+	msg.Status = pbv2.Status_OK.Enum()
+	msg.Limit = r.makeLimitMsg(r.peerLimit(s.Conn().RemotePeer()))
+	msg.Info = r.makeRelayInfo()
+
+	start := time.Now()
+	err := r.writeHopMsg(s, &msg)
+	r.messageIODone(HopMessageWrite, start)
+	if err != nil {
+		log.Debug("error writing query response", "remote_peer", s.Conn().RemotePeer(), "err", err)
+		s.Reset()
+	}
+}
+
+func (r *Relay) makeRelayInfo() *pbv2.RelayInfo {
+	ttl := uint32(r.rc.ReservationTTL / time.Second)
+	maxCircuits := uint32(r.rc.MaxCircuits)
+	capacity := uint32(r.ReservationCapacityRemaining())
+	return &pbv2.RelayInfo{
+		ReservationTTL:      &ttl,
+		ReservationCapacity: &capacity,
+		MaxCircuits:         &maxCircuits,
+	}
+}
+
+// ReservationCapacityRemaining returns the number of additional reservations the relay currently
+// accepts, which is 0 if it doesn't accept reservations at all.
+// This is the global headroom left by Resources.MaxReservations; it ignores the per IP and per
+// ASN limits, so reservations from a crowded IP address or ASN may be refused even if it is
+// positive. Capacity set aside for priority peers with WithReservedCapacity is included.
+func (r *Relay) ReservationCapacityRemaining() int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.closed || (r.reachabilityGating && !r.reachable.Load()) {
+		return 0
+	}
+	active := r.constraints.snapshot(time.Now()).Total
+	return max(r.rc.MaxReservations-active, 0)
+}
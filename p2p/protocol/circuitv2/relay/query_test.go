@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, h1, h2 := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 2
+	rc.MaxCircuits = 3
+	rc.ReservationTTL = 30 * time.Minute
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, h1.Connect(context.Background(), rinfo))
+	info, err := client.Query(context.Background(), h1, rinfo)
+	require.NoError(t, err)
+	require.Equal(t, &client.RelayInfo{
+		ReservationTTL:      30 * time.Minute,
+		ReservationCapacity: 2,
+		MaxCircuits:         3,
+		LimitDuration:       rc.Limit.Duration,
+		LimitData:           uint64(rc.Limit.Data),
+	}, info)
+	// querying doesn't reserve a slot
+	require.False(t, r.hasReservation(h1.ID()))
+
+	_, err = reserve(t, h2, relayHost)
+	require.NoError(t, err)
+	info, err = client.Query(context.Background(), h1, rinfo)
+	require.NoError(t, err)
+	require.Equal(t, 1, info.ReservationCapacity)
+
+	_, err = reserve(t, h1, relayHost)
+	require.NoError(t, err)
+	info, err = client.Query(context.Background(), h1, rinfo)
+	require.NoError(t, err)
+	require.Zero(t, info.ReservationCapacity)
+}
+
+func TestQueryInfiniteLimits(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithInfiniteLimits())
+	require.NoError(t, err)
+	defer r.Close()
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, h.Connect(context.Background(), rinfo))
+	info, err := client.Query(context.Background(), h, rinfo)
+	require.NoError(t, err)
+	require.Zero(t, info.LimitDuration)
+	require.Zero(t, info.LimitData)
+}
+
+func TestReservationCapacityRemaining(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, h1, h2, h3 := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 2
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	require.Equal(t, 2, r.ReservationCapacityRemaining())
+
+	_, err = reserve(t, h1, relayHost)
+	require.NoError(t, err)
+	require.Equal(t, 1, r.ReservationCapacityRemaining())
+	// renewing doesn't take another slot
+	_, err = reserve(t, h1, relayHost)
+	require.NoError(t, err)
+	require.Equal(t, 1, r.ReservationCapacityRemaining())
+
+	_, err = reserve(t, h2, relayHost)
+	require.NoError(t, err)
+	require.Zero(t, r.ReservationCapacityRemaining())
+	_, err = reserve(t, h3, relayHost)
+	require.Error(t, err)
+	require.Zero(t, r.ReservationCapacityRemaining())
+
+	// slots are freed when peers disconnect
+	require.NoError(t, h1.Network().ClosePeer(relayHost.ID()))
+	require.Eventually(t, func() bool { return r.ReservationCapacityRemaining() == 1 }, time.Second, 10*time.Millisecond)
+
+	// a closed relay doesn't accept reservations
+	r.Close()
+	require.Zero(t, r.ReservationCapacityRemaining())
+}
@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// RateLimitedWindow is how long a peer is reported by RateLimited after its last request
+// refused by a rate limit.
+const RateLimitedWindow = 10 * time.Minute
+
+// RateLimitedPeer is a peer with requests recently refused by a rate limit.
+type RateLimitedPeer struct {
+	Peer peer.ID
+	// Throttled is the number of requests refused since First.
+	Throttled int
+	// First is the time of the first refused request. Requests refused before the peer last
+	// aged out are not counted.
+	First time.Time
+	// Last is the time of the last refused request.
+	Last time.Time
+}
+
+func (t *RateLimitedPeer) agedOut(now time.Time) bool {
+	return now.Sub(t.Last) > RateLimitedWindow
+}
+
+// recordThrottled records a request from p refused by the limiter.
+func (l *connectRateLimiter) recordThrottled(p peer.ID, now time.Time) {
+	t, ok := l.throttled[p]
+	if !ok || t.agedOut(now) {
+		t = &RateLimitedPeer{Peer: p, First: now}
+		l.throttled[p] = t
+	}
+	t.Throttled++
+	t.Last = now
+}
+
+// appendThrottled merges the peers throttled within the last RateLimitedWindow into peers.
+func (l *connectRateLimiter) appendThrottled(peers []RateLimitedPeer, now time.Time) []RateLimitedPeer {
+	if l == nil {
+		return peers
+	}
+	for _, t := range l.throttled {
+		if t.agedOut(now) {
+			continue
+		}
+		i := slices.IndexFunc(peers, func(rp RateLimitedPeer) bool { return rp.Peer == t.Peer })
+		if i < 0 {
+			peers = append(peers, *t)
+			continue
+		}
+		peers[i].Throttled += t.Throttled
+		if t.First.Before(peers[i].First) {
+			peers[i].First = t.First
+		}
+		if t.Last.After(peers[i].Last) {
+			peers[i].Last = t.Last
+		}
+	}
+	return peers
+}
+
+// RateLimited returns the peers with connect or circuit probe requests refused by a rate limit
+// within the last RateLimitedWindow, most recently throttled first.
+func (r *Relay) RateLimited() []RateLimitedPeer {
+	return r.rateLimited(time.Now())
+}
+
+func (r *Relay) rateLimited(now time.Time) []RateLimitedPeer {
+	r.mx.Lock()
+	peers := r.connectLimiter.appendThrottled(nil, now)
+	peers = r.probeLimiter.appendThrottled(peers, now)
+	r.mx.Unlock()
+
+	slices.SortFunc(peers, func(a, b RateLimitedPeer) int { return b.Last.Compare(a.Last) })
+	return peers
+}
@@ -0,0 +1,83 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/test"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectRateLimiterThrottled(t *testing.T) {
+	l := newConnectRateLimiter(RateLimit{RPS: 1, Burst: 1})
+	p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	now := time.Now()
+
+	require.True(t, l.Allow(p1, now))
+	require.True(t, l.Allow(p2, now))
+	require.Empty(t, l.appendThrottled(nil, now))
+
+	require.False(t, l.Allow(p1, now))
+	require.False(t, l.Allow(p1, now.Add(100*time.Millisecond)))
+	throttled := l.appendThrottled(nil, now)
+	require.Len(t, throttled, 1)
+	require.Equal(t, RateLimitedPeer{Peer: p1, Throttled: 2, First: now, Last: now.Add(100 * time.Millisecond)}, throttled[0])
+
+	// the record survives the peer disconnecting
+	l.cleanupPeer(p1)
+	require.Len(t, l.appendThrottled(nil, now), 1)
+
+	// and ages out
+	later := now.Add(100*time.Millisecond + RateLimitedWindow + time.Second)
+	require.Empty(t, l.appendThrottled(nil, later))
+	l.gc(later)
+	require.Empty(t, l.throttled)
+
+	// counting starts over once aged out
+	require.True(t, l.Allow(p1, later))
+	require.False(t, l.Allow(p1, later))
+	throttled = l.appendThrottled(nil, later)
+	require.Len(t, throttled, 1)
+	require.Equal(t, 1, throttled[0].Throttled)
+	require.Equal(t, later, throttled[0].First)
+}
+
+func TestRateLimited(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, other, dest := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	rc := DefaultResources()
+	rc.ConnectRateLimit = &RateLimit{RPS: 0.01, Burst: 1}
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	_, status := connectRaw(t, other, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	_, status = connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	for range 3 {
+		_, status = connectRaw(t, src, relayHost, dest.ID())
+		require.Equal(t, pbv2.Status_RESOURCE_LIMIT_EXCEEDED, status)
+	}
+
+	rl := r.RateLimited()
+	require.Len(t, rl, 1)
+	require.Equal(t, src.ID(), rl[0].Peer)
+	require.Equal(t, 3, rl[0].Throttled)
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+	var adminRL []RateLimitedPeer
+	getAdminJSON(t, srv, "/ratelimited", &adminRL)
+	require.Len(t, adminRL, 1)
+	require.Equal(t, src.ID(), adminRL[0].Peer)
+
+	require.Empty(t, r.rateLimited(time.Now().Add(RateLimitedWindow+time.Second)))
+}
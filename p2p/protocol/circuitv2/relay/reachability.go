@@ -0,0 +1,47 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+)
+
+// watchReachability tracks the host's reachability until the relay is closed.
+func (r *Relay) watchReachability() error {
+	sub, err := r.host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged), eventbus.Name("relay"))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case ev, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				r.reachabilityChanged(ev.(event.EvtLocalReachabilityChanged).Reachability)
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Relay) reachabilityChanged(reachability network.Reachability) {
+	// only a host known to be private is considered unreachable, as reachability is unknown
+	// until AutoNAT has run.
+	reachable := reachability != network.ReachabilityPrivate
+	if r.reachable.Swap(reachable) == reachable {
+		return
+	}
+
+	log.Info("relay reachability changed", "reachable", reachable)
+	if mt, ok := r.metricsTracer.(ReachabilityMetricsTracer); ok {
+		mt.RelayReachable(reachable)
+	}
+	if r.reachabilityCallback != nil {
+		r.reachabilityCallback(reachable)
+	}
+}
@@ -0,0 +1,121 @@
+package relay
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReachabilityGating(t *testing.T) {
+	for _, gating := range []bool{true, false} {
+		name := "without gating"
+		if gating {
+			name = "with gating"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, h := hosts[0], hosts[1]
+
+			changes := make(chan bool, 10)
+			r, err := New(relayHost,
+				WithReachabilityGating(gating),
+				WithReachabilityCallback(func(reachable bool) { changes <- reachable }))
+			require.NoError(t, err)
+			defer r.Close()
+
+			em, err := relayHost.EventBus().Emitter(new(event.EvtLocalReachabilityChanged))
+			require.NoError(t, err)
+			defer em.Close()
+
+			// reachability is unknown initially, which doesn't prevent reservations
+			_, err = reserve(t, h, relayHost)
+			require.NoError(t, err)
+
+			require.NoError(t, em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPrivate}))
+			select {
+			case reachable := <-changes:
+				require.False(t, reachable)
+			case <-time.After(5 * time.Second):
+				t.Fatal("callback not invoked")
+			}
+			_, err = reserve(t, h, relayHost)
+			if gating {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}))
+			select {
+			case reachable := <-changes:
+				require.True(t, reachable)
+			case <-time.After(5 * time.Second):
+				t.Fatal("callback not invoked")
+			}
+			_, err = reserve(t, h, relayHost)
+			require.NoError(t, err)
+
+			// repeated events don't invoke the callback
+			require.NoError(t, em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityUnknown}))
+			select {
+			case <-changes:
+				t.Fatal("callback invoked without a reachability change")
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// brokenBusHost is a host whose event bus refuses subscriptions, and whose resource manager hands
+// out the given service scope.
+type brokenBusHost struct {
+	host.Host
+	scope *countingScope
+}
+
+func (h *brokenBusHost) EventBus() event.Bus { return brokenBus{h.Host.EventBus()} }
+
+func (h *brokenBusHost) Network() network.Network {
+	return scopeNetwork{Network: h.Host.Network(), scope: h.scope}
+}
+
+type brokenBus struct {
+	event.Bus
+}
+
+func (brokenBus) Subscribe(any, ...event.SubscriptionOpt) (event.Subscription, error) {
+	return nil, errors.New("event bus closed")
+}
+
+type scopeNetwork struct {
+	network.Network
+	scope *countingScope
+}
+
+func (n scopeNetwork) ResourceManager() network.ResourceManager {
+	return scopeResourceManager{ResourceManager: n.Network.ResourceManager(), scope: n.scope}
+}
+
+type scopeResourceManager struct {
+	network.ResourceManager
+	scope *countingScope
+}
+
+func (rm scopeResourceManager) ViewService(_ string, f func(network.ServiceScope) error) error {
+	return f(rm.scope)
+}
+
+func TestWatchReachabilityFailureReleasesScope(t *testing.T) {
+	scope := &countingScope{}
+	h := &brokenBusHost{Host: getTestHosts(t, 1)[0], scope: scope}
+
+	_, err := New(h)
+	require.Error(t, err)
+	require.EqualValues(t, 1, scope.spans.Load())
+	require.EqualValues(t, 1, scope.ended.Load())
+}
@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// hopReadErrorLimiter blocks hop streams from IP addresses that repeatedly open hop streams
+// without sending a valid hop message, which is typical of scanners and probes.
+type hopReadErrorLimiter struct {
+	maxErrors int
+	window    time.Duration
+
+	mx  sync.Mutex
+	ips map[string]*readErrorWindow
+}
+
+type readErrorWindow struct {
+	start time.Time
+	count int
+}
+
+func newHopReadErrorLimiter(maxErrors int, window time.Duration) *hopReadErrorLimiter {
+	return &hopReadErrorLimiter{
+		maxErrors: maxErrors,
+		window:    window,
+		ips:       make(map[string]*readErrorWindow),
+	}
+}
+
+// Blocked returns true if hop streams from the address should be refused.
+func (l *hopReadErrorLimiter) Blocked(a ma.Multiaddr, now time.Time) bool {
+	ip, err := manet.ToIP(a)
+	if err != nil {
+		return false
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	w, ok := l.ips[ip.String()]
+	if !ok || now.Sub(w.start) > l.window {
+		return false
+	}
+	return w.count >= l.maxErrors
+}
+
+// RecordError records a hop stream read error from the address.
+func (l *hopReadErrorLimiter) RecordError(a ma.Multiaddr, now time.Time) {
+	ip, err := manet.ToIP(a)
+	if err != nil {
+		return
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	w, ok := l.ips[ip.String()]
+	if !ok || now.Sub(w.start) > l.window {
+		w = &readErrorWindow{start: now}
+		l.ips[ip.String()] = w
+	}
+	w.count++
+}
+
+// gc removes expired error windows.
+func (l *hopReadErrorLimiter) gc(now time.Time) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	for ip, w := range l.ips {
+		if now.Sub(w.start) > l.window {
+			delete(l.ips, ip)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestHopReadErrorLimiter(t *testing.T) {
+	l := newHopReadErrorLimiter(2, time.Minute)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	otherAddr := ma.StringCast("/ip4/1.2.3.5/tcp/1234")
+	now := time.Now()
+
+	require.False(t, l.Blocked(addr, now))
+	l.RecordError(addr, now)
+	require.False(t, l.Blocked(addr, now))
+	l.RecordError(addr, now)
+	require.True(t, l.Blocked(addr, now))
+	require.False(t, l.Blocked(otherAddr, now))
+
+	later := now.Add(time.Minute + time.Second)
+	require.False(t, l.Blocked(addr, later))
+	l.gc(later)
+	require.Empty(t, l.ips)
+}
+
+func TestHopReadErrorBlocking(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithHopReadErrorLimit(1, time.Minute))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+
+	// a message length exceeding the maximum message size
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	_, err = s.Write([]byte{0xff, 0xff, 0x03})
+	require.NoError(t, err)
+	s.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = s.Read(make([]byte, 64))
+	require.NoError(t, err, "expected a status response")
+	s.Close()
+
+	// subsequent hop streams from the same IP are reset
+	_, err = client.Reserve(context.Background(), h, peer.AddrInfo{ID: relayHost.ID()})
+	require.ErrorIs(t, err, network.ErrReset)
+}
@@ -0,0 +1,88 @@
+package relay
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// DefaultRecentRefusals is the default number of refusals retained for RecentRefusals.
+const DefaultRecentRefusals = 128
+
+// RefusalRecord describes a reservation or connection request refused by the relay.
+type RefusalRecord struct {
+	// Time is when the request was refused.
+	Time time.Time
+	// Type is the type of the refused request, RESERVE, CONNECT or PROBE.
+	Type pbv2.HopMessage_Type
+	// Peer is the peer that sent the request.
+	Peer peer.ID
+	// Addr is the address of the peer that sent the request.
+	Addr ma.Multiaddr
+	// Destination is the requested destination of a connection, if known.
+	Destination peer.ID
+	// Status is the status the relay responded with.
+	Status pbv2.Status
+	// Reason is a human readable reason for the refusal.
+	Reason string
+	// Constraint describes the limit or constraint that caused the refusal, if any.
+	Constraint string
+}
+
+// refusalLog is a fixed size ring buffer of refusal records.
+type refusalLog struct {
+	mx   sync.Mutex
+	buf  []RefusalRecord
+	next int
+	full bool
+}
+
+func newRefusalLog(size int) *refusalLog {
+	return &refusalLog{buf: make([]RefusalRecord, size)}
+}
+
+func (l *refusalLog) add(rec RefusalRecord) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.buf[l.next] = rec
+	l.next++
+	if l.next == len(l.buf) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// records returns the records, oldest first.
+func (l *refusalLog) records() []RefusalRecord {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if !l.full {
+		return append([]RefusalRecord(nil), l.buf[:l.next]...)
+	}
+	recs := make([]RefusalRecord, 0, len(l.buf))
+	recs = append(recs, l.buf[l.next:]...)
+	return append(recs, l.buf[:l.next]...)
+}
+
+// RecentRefusals returns the most recent refused reservation and connection requests, oldest first.
+// The number of records retained is set with WithRecentRefusals.
+func (r *Relay) RecentRefusals() []RefusalRecord {
+	if r.refusals == nil {
+		return nil
+	}
+	return r.refusals.records()
+}
+
+func (r *Relay) recordRefusal(rec RefusalRecord) {
+	rec.Time = time.Now()
+	r.stats.refusals.Add(1)
+	r.auditRefusal(rec)
+	if r.refusals == nil {
+		return
+	}
+	r.refusals.add(rec)
+}
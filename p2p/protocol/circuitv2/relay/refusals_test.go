@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestRefusalLog(t *testing.T) {
+	l := newRefusalLog(3)
+	require.Empty(t, l.records())
+
+	reasons := func() []string {
+		var rs []string
+		for _, rec := range l.records() {
+			rs = append(rs, rec.Reason)
+		}
+		return rs
+	}
+
+	l.add(RefusalRecord{Reason: "1"})
+	l.add(RefusalRecord{Reason: "2"})
+	require.Equal(t, []string{"1", "2"}, reasons())
+	l.add(RefusalRecord{Reason: "3"})
+	require.Equal(t, []string{"1", "2", "3"}, reasons())
+	l.add(RefusalRecord{Reason: "4"})
+	l.add(RefusalRecord{Reason: "5"})
+	require.Equal(t, []string{"3", "4", "5"}, reasons())
+}
+
+func TestRecentRefusals(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 0
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.Error(t, err)
+
+	addCircuitTransport(t, src)
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit", relayHost.ID()))
+	require.Error(t, src.Connect(context.Background(), peer.AddrInfo{ID: dest.ID(), Addrs: []ma.Multiaddr{raddr}}))
+
+	refusals := r.RecentRefusals()
+	require.Len(t, refusals, 2)
+	rec := refusals[0]
+	require.Equal(t, pbv2.HopMessage_RESERVE, rec.Type)
+	require.Equal(t, dest.ID(), rec.Peer)
+	require.Equal(t, pbv2.Status_RESERVATION_REFUSED, rec.Status)
+	require.Equal(t, errTooManyReservations.Error(), rec.Constraint)
+	require.False(t, rec.Time.IsZero())
+
+	rec = refusals[1]
+	require.Equal(t, pbv2.HopMessage_CONNECT, rec.Type)
+	require.Equal(t, src.ID(), rec.Peer)
+	require.Equal(t, dest.ID(), rec.Destination)
+	require.Equal(t, pbv2.Status_NO_RESERVATION, rec.Status)
+	require.Equal(t, "no reservation", rec.Reason)
+
+	r2, err := New(hosts[1], WithRecentRefusals(0))
+	require.NoError(t, err)
+	defer r2.Close()
+	require.Nil(t, r2.RecentRefusals())
+}
@@ -1,18 +1,26 @@
 package relay
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/metrics"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/core/record"
 	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
@@ -22,6 +30,7 @@ import (
 	logging "github.com/libp2p/go-libp2p/gologshim"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -41,52 +50,240 @@ const (
 
 var log = logging.Logger("relay")
 
+var errNoSigningKey = errors.New("no signing key")
+
+// reservation is a slot reserved by a peer in the relay.
+type reservation struct {
+	expire time.Time
+	// granted is the time the reservation was granted or last renewed.
+	granted time.Time
+	// caps are the capabilities negotiated with the peer in the reserve handshake.
+	caps proto.Capabilities
+	// lastUsed is the last time the reservation was renewed or used for a relayed connection.
+	lastUsed time.Time
+	// certifiedAddrs are the addresses of the peer's signed peer record, if it sent one.
+	certifiedAddrs []ma.Multiaddr
+	// disconnected is the time the peer disconnected while the reservation is kept for the
+	// disconnect grace period; it is zero while the peer is connected.
+	disconnected time.Time
+	// addrs are the relay addresses sent with the reservation, in order. They are only kept
+	// with WithStableReservationAddrs.
+	addrs [][]byte
+	// addr is the address the peer reserved from, which the reservation is accounted for in
+	// the constraints.
+	addr ma.Multiaddr
+	// tier is the name of the tier granted by the ACL, if any.
+	tier string
+	// limit is the limit of the connections relayed to the peer granted by its tier; nil if
+	// Resources.Limit applies.
+	limit *RelayLimit
+	// voucherNonce is the nonce of the voucher issued with the reservation, until the voucher is
+	// consumed. It is only set with WithSingleUseVouchers.
+	voucherNonce []byte
+	// session is the session ID assigned to the reservation by the ACL or the reservation
+	// webhook, if any.
+	session string
+}
+
 // Relay is the (limited) relay service object.
 type Relay struct {
 	ctx    context.Context
 	cancel func()
+	// started is the time the relay started, which tells handoff tokens issued before a
+	// restart apart from the ones issued since
+	started time.Time
 
 	reservationAddrFilter ReservationAddressFilterFunc
 
 	host        host.Host
 	rc          Resources
 	acl         ACLFilter
+	versionGate *agentVersionGate
 	constraints *constraints
 	scope       network.ResourceScopeSpan
 	notifiee    network.Notifiee
 
 	mx     sync.Mutex
-	rsvp   map[peer.ID]time.Time
+	rsvp   map[peer.ID]reservation
 	conns  map[peer.ID]int
 	closed bool
+	// graceTimers drop the reservations of disconnected peers at the end of the disconnect
+	// grace period.
+	graceTimers map[peer.ID]graceTimer
+	// protoConns counts the relayed connections of each peer by announced protocol; it is only
+	// maintained if Resources.MaxCircuitsPerPeerProtocol is set.
+	protoConns map[peerProtocol]int
+	// circuits are the active relayed connections by ID, to act on them according to
+	// Resources.CloseCircuitBehavior when the relay is closed, and to close them individually.
+	circuits map[string]*activeCircuit
+	// circuitSeq numbers relayed connections for their IDs.
+	circuitSeq atomic.Uint64
 
 	selfAddr ma.Multiaddr
-
-	metricsTracer MetricsTracer
+	// additionalReservationAddrs are operator supplied addresses, including our peer ID, that are
+	// advertised in reservations regardless of the reservation address filter.
+	additionalReservationAddrs []ma.Multiaddr
+	// fallbackAddrs supplies the addresses advertised in reservations when none of the host's
+	// addresses pass the reservation address filter; it is nil if there is no fallback.
+	fallbackAddrs func() []ma.Multiaddr
+
+	pending *pendingHandshakes
+	// sourceWatch aborts connection requests whose source disconnects.
+	sourceWatch *connWatch
+	// handshakes limits the number of concurrent hop stream handshakes; it is nil if unlimited.
+	handshakes chan struct{}
+	// stopStreams limits the number of stop streams opened concurrently; it is nil if unlimited.
+	stopStreams chan struct{}
+
+	probe          *reservationProbe
+	scopeBandwidth bool
+	protocolScopes bool
+	bwReporter     metrics.Reporter
+	readErrLimiter *hopReadErrorLimiter
+	connectLimiter *connectRateLimiter
+	probeLimiter   *connectRateLimiter
+	loadShedder    *loadShedder
+	asnLookup      func(net.IP) uint32
+	prewarm        int
+	traceHook      TraceHook
+	// destVerifyLimiter limits the verifications of destinations without a reservation; it is
+	// nil if destinations are not verified.
+	destVerifyLimiter *rate.Limiter
+
+	requireSourceReservation bool
+	refuseHopPeers           bool
+	connManagerTagging       bool
+	retryConnectResponse     bool
+	strictVouchers           bool
+	handoffTokens            bool
+	handoffWindow            time.Duration
+	singleUseVouchers        bool
+	stableReservationAddrs   bool
+	refusals                 *refusalLog
+	auditLogger              AuditLogger
+	auditQueue               *auditQueue
+	evictionPolicy           ReservationEvictionPolicy
+	circuitCostFunc          CircuitCostFunc
+
+	reachable            atomic.Bool
+	reachabilityGating   bool
+	reachabilityCallback func(reachable bool)
+
+	// maintenance is set with SetMaintenance to refuse new reservations.
+	maintenance atomic.Bool
+	// adminControl makes AdminHandler serve the control APIs.
+	adminControl bool
+
+	stallThreshold time.Duration
+	// maxEmptyReads is the number of consecutive empty reads from the source of a relayed
+	// connection after which relaying it is aborted; 0 disables the check.
+	maxEmptyReads int
+	// maxHops is the maximum number of relays in a circuit through this relay; 0 disables
+	// two-hop circuits.
+	maxHops int
+	// handshakeLatency records stop handshake latencies for quality hints; it is nil if quality
+	// hints are disabled.
+	handshakeLatency *latencyWindow
+	// backupRelays are advertised to reserving peers as relays to fail over to.
+	backupRelays []peer.AddrInfo
+	// keepAlive extends the duration limit of active relayed connections; it is nil if disabled.
+	keepAlive *keepAlive
+	// stopLocalAddr is the preferred local address of the connections stop streams are opened on.
+	stopLocalAddr ma.Multiaddr
+	// closeWriteFlush bounds flushing relayed streams before closing them for writing; 0
+	// disables flushing.
+	closeWriteFlush time.Duration
+	// isCompletion decides which errors reading from a relayed stream end the transfer cleanly;
+	// if nil, all errors reset both streams.
+	isCompletion CompletionErrorFunc
+	// destAllowlist restricts the destinations of relayed connections; it is nil if any
+	// destination is allowed.
+	destAllowlist atomic.Pointer[destinationAllowlist]
+	// reservedCapacity is reservation capacity set aside for priority peers; it is nil if there
+	// is none.
+	reservedCapacity *reservedCapacity
+	// capture configures capturing relayed traffic for debugging; it is nil if disabled.
+	capture *captureConfig
+	// webhook is consulted before granting reservations; it is nil if there is none.
+	webhook *reservationWebhook
+	// webhookClient replaces the default HTTP client of the webhook, if set.
+	webhookClient *http.Client
+	// fairShare divides the bandwidth budget between source peers; it is nil if relayed
+	// bandwidth is not limited.
+	fairShare *fairShare
+	// psk is the pre-shared key reserving peers must prove knowledge of; it is nil if
+	// reservations are not gated by a pre-shared key.
+	psk []byte
+	// maxHostConns is the host connection count at which new reservations are refused; 0 if
+	// reservations are not limited by the host's connection count.
+	maxHostConns int
+	// schedule returns the schedule of relay service of a peer; it is nil if relay service is
+	// always available.
+	schedule func(peer.ID) Schedule
+	// highWater tracks the reservations reaching a high water mark; it is nil if the relay
+	// doesn't watch for it.
+	highWater *highWaterMark
+	// disconnectBatch coalesces peer disconnects; it is nil if they are processed one by one.
+	disconnectBatch *disconnectBatch
+
+	stats        relayStats
+	statsFile    *statsFile
+	scopeGauges  *scopeGauges
+	connectStats *connectStats
+
+	metricsTracer     MetricsTracer
+	metricsPeerLabels bool
+	metricsChunkSizes bool
 }
 
 // New constructs a new limited relay that can provide relay services in the given host.
+// Contradictory configurations are refused with ErrKeepAliveWithoutDurationLimit,
+// ErrReservedCapacityExceedsMax, ErrLimitBehaviorWithoutDataLimit or
+// ErrWebhookClientWithoutWebhook.
 func New(h host.Host, opts ...Option) (*Relay, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	r := &Relay{
-		ctx:    ctx,
-		cancel: cancel,
-		host:   h,
-		rc:     DefaultResources(),
-		acl:    nil,
-		rsvp:   make(map[peer.ID]time.Time),
-		conns:  make(map[peer.ID]int),
+		ctx:     ctx,
+		cancel:  cancel,
+		started: time.Now(),
+		host:    h,
+		rc:      DefaultResources(),
+		acl:     nil,
+		rsvp:    make(map[peer.ID]reservation),
+		conns:   make(map[peer.ID]int),
+
+		graceTimers: make(map[peer.ID]graceTimer),
+
+		protoConns: make(map[peerProtocol]int),
+		circuits:   make(map[string]*activeCircuit),
+
+		pending:      newPendingHandshakes(),
+		sourceWatch:  newConnWatch(),
+		connectStats: newConnectStats(ConnectStatsWindow),
+
+		connManagerTagging: true,
+		refusals:           newRefusalLog(DefaultRecentRefusals),
+		stallThreshold:     DefaultStallThreshold,
+		handoffWindow:      HandoffWindow,
 
 		reservationAddrFilter: manet.IsPublicAddr,
 	}
 
-	for _, opt := range opts {
+	for i, opt := range opts {
 		err := opt(r)
 		if err != nil {
-			return nil, fmt.Errorf("error applying relay option: %w", err)
+			cancel()
+			return nil, &OptionError{Index: i, Err: err}
 		}
 	}
+	if err := r.validateConfig(); err != nil {
+		cancel()
+		return nil, err
+	}
+	if r.webhookClient != nil {
+		r.webhook.client = r.webhookClient
+	}
 
 	// get a scope for memory reservations at service level
 	err := h.Network().ResourceManager().ViewService(ServiceName,
@@ -96,20 +293,58 @@ func New(h host.Host, opts ...Option) (*Relay, error) {
 			return err
 		})
 	if err != nil {
-		return nil, err
+		cancel()
+		return nil, &ResourceScopeError{Err: err}
+	}
+
+	if r.prewarm > 0 {
+		n := r.prewarmBuffers(pool.GlobalPool, r.prewarm, r.rc.BufferSize)
+		log.Debug("prewarmed relay buffers", "count", n)
+	}
+
+	if r.fairShare != nil {
+		r.fairShare.burst = r.rc.BufferSize
 	}
 
 	r.constraints = newConstraints(&r.rc)
+	r.constraints.asnLookup = r.asnLookup
+	r.constraints.reserved = r.reservedCapacity
+	if r.rc.MaxConcurrentHandshakes > 0 {
+		r.handshakes = make(chan struct{}, r.rc.MaxConcurrentHandshakes)
+	}
+	if r.rc.MaxConcurrentStopStreams > 0 {
+		r.stopStreams = make(chan struct{}, r.rc.MaxConcurrentStopStreams)
+	}
+	if r.rc.ConnectRateLimit != nil {
+		r.connectLimiter = newConnectRateLimiter(*r.rc.ConnectRateLimit)
+	}
 	r.selfAddr = ma.StringCast(fmt.Sprintf("/p2p/%s", h.ID()))
 
+	r.reachable.Store(true)
+	if err := r.watchReachability(); err != nil {
+		cancel()
+		r.scope.Done()
+		return nil, err
+	}
+
+	if r.auditLogger != nil {
+		r.auditQueue = newAuditQueue(r.auditLogger, auditQueueSize)
+	}
+
 	h.SetStreamHandler(proto.ProtoIDv2Hop, r.handleStream)
-	r.notifiee = &network.NotifyBundle{DisconnectedF: r.disconnected}
+	r.notifiee = &network.NotifyBundle{ConnectedF: r.connected, DisconnectedF: r.disconnected}
 	h.Network().Notify(r.notifiee)
 
 	if r.metricsTracer != nil {
 		r.metricsTracer.RelayStatus(true)
 	}
 	go r.background()
+	if r.statsFile != nil {
+		go r.runStatsFile(r.statsFile)
+	}
+	if r.scopeGauges != nil {
+		go r.runScopeGauges(r.scopeGauges)
+	}
 
 	return r, nil
 }
@@ -118,13 +353,32 @@ func (r *Relay) Close() error {
 	r.mx.Lock()
 	if !r.closed {
 		r.closed = true
+		for p, gt := range r.graceTimers {
+			gt.Stop()
+			delete(r.graceTimers, p)
+		}
 		r.mx.Unlock()
 
 		r.host.RemoveStreamHandler(proto.ProtoIDv2Hop)
 		r.host.Network().StopNotify(r.notifiee)
+		if r.disconnectBatch != nil {
+			r.disconnectBatch.close()
+		}
 		defer r.scope.Done()
 		r.cancel()
 		r.gc()
+		r.closeCircuits()
+		if r.statsFile != nil {
+			<-r.statsFile.done
+			r.writeStatsFile(r.statsFile.path)
+		}
+		if r.scopeGauges != nil {
+			<-r.scopeGauges.done
+			r.setScopeGauges(0, 0)
+		}
+		if r.auditQueue != nil {
+			r.auditQueue.Close()
+		}
 		if r.metricsTracer != nil {
 			r.metricsTracer.RelayStatus(false)
 		}
@@ -137,6 +391,26 @@ func (r *Relay) Close() error {
 func (r *Relay) handleStream(s network.Stream) {
 	log.Info("new relay stream", "remote_peer", s.Conn().RemotePeer())
 
+	r.pending.add(s)
+	defer r.pending.remove(s)
+
+	if r.readErrLimiter != nil && r.readErrLimiter.Blocked(s.Conn().RemoteMultiaddr(), time.Now()) {
+		log.Debug("refusing relay stream",
+			"remote_peer", s.Conn().RemotePeer(),
+			"reason", "too many hop stream read errors")
+		s.Reset()
+		return
+	}
+
+	if !r.acquireHandshake() {
+		log.Debug("refusing relay stream",
+			"remote_peer", s.Conn().RemotePeer(),
+			"reason", "too many concurrent handshakes")
+		r.handleError(s, pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		return
+	}
+	defer r.releaseHandshake()
+
 	if err := s.Scope().SetService(ServiceName); err != nil {
 		log.Debug("error attaching stream to relay service", "err", err)
 		s.Reset()
@@ -153,53 +427,326 @@ func (r *Relay) handleStream(s network.Stream) {
 	rd := util.NewDelimitedReader(s, maxMessageSize)
 	defer rd.Close()
 
-	s.SetReadDeadline(time.Now().Add(StreamTimeout))
+	s.SetReadDeadline(time.Now().Add(r.rc.reserveReadTimeout()))
 
 	var msg pbv2.HopMessage
 
+	start := time.Now()
 	err := rd.ReadMsg(&msg)
+	r.messageIODone(HopMessageRead, start)
 	if err != nil {
+		// We couldn't even read a hop message. This is distinct from a hop message with invalid
+		// contents, and typically caused by scanners and probes rather than client bugs.
+		log.Debug("error reading hop message", "remote_peer", s.Conn().RemotePeer(), "err", err)
+		if mt, ok := r.metricsTracer.(FailureMetricsTracer); ok {
+			mt.HopStreamReadError()
+		}
+		if r.readErrLimiter != nil {
+			r.readErrLimiter.RecordError(s.Conn().RemoteMultiaddr(), time.Now())
+		}
 		r.handleError(s, pbv2.Status_MALFORMED_MESSAGE)
 		return
 	}
 	// reset stream deadline as message has been read
 	s.SetReadDeadline(time.Time{})
-	switch msg.GetType() {
-	case pbv2.HopMessage_RESERVE:
-		status := r.handleReserve(s)
+	r.pending.setType(s, msg.GetType())
+
+	status, action := handleHopMessage(&msg)
+	switch action {
+	case hopActionReserve:
+		status = r.handleReserve(s, &msg)
 		if r.metricsTracer != nil {
 			r.metricsTracer.ReservationRequestHandled(status)
 		}
-	case pbv2.HopMessage_CONNECT:
-		status := r.handleConnect(s, &msg)
+	case hopActionConnect:
+		status = r.handleConnect(s, &msg)
+		r.connectStats.record(s.Conn().RemotePeer(), time.Now(), status)
 		if r.metricsTracer != nil {
 			r.metricsTracer.ConnectionRequestHandled(status)
 		}
+	case hopActionQuery:
+		r.handleQuery(s)
+	case hopActionProbe:
+		r.handleCircuitProbe(s, &msg)
+	case hopActionReserveConnect:
+		reserveStatus, connectStatus := r.handleReserveConnect(s, &msg)
+		if reserveStatus == pbv2.Status_OK {
+			r.connectStats.record(s.Conn().RemotePeer(), time.Now(), connectStatus)
+		}
+		if r.metricsTracer != nil {
+			r.metricsTracer.ReservationRequestHandled(reserveStatus)
+			if reserveStatus == pbv2.Status_OK {
+				r.metricsTracer.ConnectionRequestHandled(connectStatus)
+			}
+		}
 	default:
-		r.handleError(s, pbv2.Status_MALFORMED_MESSAGE)
+		r.handleError(s, status)
+		if msg.GetType() == pbv2.HopMessage_CONNECT {
+			r.connectStats.record(s.Conn().RemotePeer(), time.Now(), status)
+			if r.metricsTracer != nil {
+				r.metricsTracer.ConnectionRequestHandled(status)
+			}
+		}
+	}
+}
+
+// acquireHandshake takes a handshake slot, returning false without blocking if there is none.
+func (r *Relay) acquireHandshake() bool {
+	if r.handshakes == nil {
+		return true
+	}
+	select {
+	case r.handshakes <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Relay) releaseHandshake() {
+	if r.handshakes != nil {
+		<-r.handshakes
 	}
 }
 
-func (r *Relay) handleReserve(s network.Stream) pbv2.Status {
+// acquireStopStream takes a stop stream slot, waiting for one until ctx is done.
+func (r *Relay) acquireStopStream(ctx context.Context) bool {
+	if r.stopStreams == nil {
+		return true
+	}
+	select {
+	case r.stopStreams <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (r *Relay) releaseStopStream() {
+	if r.stopStreams != nil {
+		<-r.stopStreams
+	}
+}
+
+// hopAction is the action the relay takes in response to a hop message.
+type hopAction int
+
+const (
+	// hopActionRefuse refuses the request by responding with the returned status.
+	hopActionRefuse hopAction = iota
+	// hopActionReserve handles the message as a reservation request.
+	hopActionReserve
+	// hopActionConnect handles the message as a connection request.
+	hopActionConnect
+	// hopActionReserveConnect handles the message as a combined reservation and connection request.
+	hopActionReserveConnect
+	// hopActionQuery responds with the relay's current limits.
+	hopActionQuery
+	// hopActionProbe checks whether the relay can reach the requested peer.
+	hopActionProbe
+)
+
+// handleHopMessage validates a decoded hop message and decides how it should be handled.
+// It is independent of the stream the message was read from, so it never performs any I/O.
+// The returned status is only meaningful for hopActionRefuse.
+func handleHopMessage(msg *pbv2.HopMessage) (pbv2.Status, hopAction) {
+	switch msg.GetType() {
+	case pbv2.HopMessage_RESERVE:
+		return pbv2.Status_OK, hopActionReserve
+	case pbv2.HopMessage_CONNECT:
+		if _, err := util.PeerToPeerInfoV2(msg.GetPeer()); err != nil {
+			return pbv2.Status_MALFORMED_MESSAGE, hopActionRefuse
+		}
+		return pbv2.Status_OK, hopActionConnect
+	case pbv2.HopMessage_RESERVE_CONNECT:
+		if _, err := util.PeerToPeerInfoV2(msg.GetPeer()); err != nil {
+			return pbv2.Status_MALFORMED_MESSAGE, hopActionRefuse
+		}
+		return pbv2.Status_OK, hopActionReserveConnect
+	case pbv2.HopMessage_QUERY:
+		return pbv2.Status_OK, hopActionQuery
+	case pbv2.HopMessage_PROBE:
+		if _, err := util.PeerToPeerInfoV2(msg.GetPeer()); err != nil {
+			return pbv2.Status_MALFORMED_MESSAGE, hopActionRefuse
+		}
+		return pbv2.Status_OK, hopActionProbe
+	default:
+		return pbv2.Status_MALFORMED_MESSAGE, hopActionRefuse
+	}
+}
+
+func (r *Relay) handleReserve(s network.Stream, msg *pbv2.HopMessage) pbv2.Status {
 	defer s.Close()
 	p := s.Conn().RemotePeer()
+
+	rsvp, _, status := r.reserve(s, msg)
+	if status != pbv2.Status_OK {
+		r.handleError(s, status)
+		return status
+	}
+
+	// Delivery of the reservation might fail for a number of reasons.
+	// For example, the stream might be reset or the connection might be closed before the reservation is received.
+	// In that case, the reservation will just be garbage collected later.
+	if err := r.writeResponse(s, pbv2.Status_OK, rsvp, r.makeLimitMsg(r.peerLimit(p))); err != nil {
+		log.Debug("error writing reservation response",
+			"remote_peer", p,
+			"reason", "retracting reservation")
+		s.Reset()
+		return pbv2.Status_CONNECTION_FAILED
+	}
+	return pbv2.Status_OK
+}
+
+// reserve reserves a slot for the remote peer of s and returns the reservation to send to it,
+// and whether an existing reservation was renewed. It does not respond to the peer.
+func (r *Relay) reserve(s network.Stream, msg *pbv2.HopMessage) (rsvp *pbv2.Reservation, renewed bool, status pbv2.Status) {
+	p := s.Conn().RemotePeer()
 	a := s.Conn().RemoteMultiaddr()
 
+	if r.loadShedder.Shed(time.Now()) {
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", "load shed")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "load shed", Constraint: "load shedder"})
+		return nil, false, pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+	}
+
 	if isRelayAddr(a) {
 		log.Debug("refusing relay reservation",
 			"remote_peer", p,
 			"reason", "reservation attempt over relay connection")
-		r.handleError(s, pbv2.Status_PERMISSION_DENIED)
-		return pbv2.Status_PERMISSION_DENIED
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_PERMISSION_DENIED, Reason: "reservation attempt over relay connection"})
+		return nil, false, pbv2.Status_PERMISSION_DENIED
+	}
+
+	if allow, reason := r.aclAllowReserve(p, a); !allow {
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", reason)
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_PERMISSION_DENIED, Reason: reason, Constraint: "acl"})
+		return nil, false, pbv2.Status_PERMISSION_DENIED
+	}
+
+	if r.versionGate != nil && !r.versionGate.Allow(r.host.Peerstore(), p) {
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", "unsupported client version")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_PERMISSION_DENIED, Reason: "unsupported client version", Constraint: "agent version filter"})
+		return nil, false, pbv2.Status_PERMISSION_DENIED
+	}
+
+	if r.refuseHopPeers && r.isHopPeer(p) {
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", "peer is a relay")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_PERMISSION_DENIED, Reason: "peer is a relay", Constraint: "relay chaining policy"})
+		return nil, false, pbv2.Status_PERMISSION_DENIED
+	}
+
+	if status, reason := r.pskChallenge(s, msg); status != pbv2.Status_OK {
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", reason)
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: status, Reason: reason, Constraint: "pre-shared key"})
+		return nil, false, status
+	}
+
+	allow, ttlOverride, webhookSession := r.webhookAllowReserve(p, a, msg)
+	if !allow {
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", "refused by reservation webhook")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_PERMISSION_DENIED, Reason: "refused by reservation webhook", Constraint: "reservation webhook"})
+		return nil, false, pbv2.Status_PERMISSION_DENIED
+	}
+
+	var certifiedAddrs []ma.Multiaddr
+	if b := msg.GetSignedPeerRecord(); len(b) > 0 {
+		addrs, err := verifyPeerRecord(p, b)
+		if err != nil {
+			status := pbv2.Status_MALFORMED_MESSAGE
+			if errors.Is(err, errPeerRecordMismatch) {
+				status = pbv2.Status_PERMISSION_DENIED
+			}
+			log.Debug("refusing relay reservation",
+				"remote_peer", p,
+				"reason", "invalid signed peer record",
+				"error", err)
+			r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: status, Reason: "invalid signed peer record", Constraint: err.Error()})
+			return nil, false, status
+		}
+		certifiedAddrs = addrs
+	}
+
+	tier, _ := r.reservationTier(p, a)
+	session := r.reservationSession(p, a)
+	if webhookSession != "" {
+		session = webhookSession
 	}
 
-	if r.acl != nil && !r.acl.AllowReserve(p, a) {
+	now := time.Now()
+	if !r.scheduleOpen(p, now) {
 		log.Debug("refusing relay reservation",
 			"remote_peer", p,
-			"reason", "permission denied")
-		r.handleError(s, pbv2.Status_PERMISSION_DENIED)
-		return pbv2.Status_PERMISSION_DENIED
+			"reason", "outside reservation schedule")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_RESERVATION_REFUSED, Reason: "outside reservation schedule", Constraint: "reservation schedule"})
+		return nil, false, pbv2.Status_RESERVATION_REFUSED
+	}
+
+	ttl := r.reservationTTL(msg)
+	if tier.TTL > 0 {
+		ttl = tier.TTL
+	}
+	if ttlOverride > 0 && ttlOverride < ttl {
+		ttl = ttlOverride
 	}
+	expire := now.Add(ttl)
+
+	var restored bool
+	if b := msg.GetHandoffToken(); r.handoffTokens && len(b) > 0 {
+		tokenExpire, err := r.verifyHandoffToken(p, b, now)
+		if err != nil {
+			log.Debug("ignoring handoff token",
+				"remote_peer", p,
+				"error", err)
+		} else {
+			// a restored reservation doesn't outlive the one the token was issued with
+			if tokenExpire.Before(expire) {
+				expire = tokenExpire
+			}
+			restored = true
+		}
+	}
+
+	var nonce []byte
+	if r.singleUseVouchers {
+		nonce = newVoucherNonce()
+	}
+	rsvp, err := makeReservationMsg(r.reservationMsgOpts(nonce), p, expire)
+	if err != nil {
+		if mt, ok := r.metricsTracer.(FailureMetricsTracer); ok {
+			mt.VoucherSealFailed()
+		}
+		if r.strictVouchers {
+			log.Debug("refusing relay reservation",
+				"remote_peer", p,
+				"reason", "failed to seal reservation voucher",
+				"error", err)
+			r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_RESERVATION_REFUSED, Reason: "failed to seal reservation voucher", Constraint: err.Error()})
+			return nil, false, pbv2.Status_RESERVATION_REFUSED
+		}
+	}
+	if len(rsvp.Addrs) == 0 && r.fallbackAddrs != nil {
+		appendReservationAddrs(rsvp, r.fallbackReservationAddrs())
+	}
+	appendReservationAddrs(rsvp, r.additionalReservationAddrs)
+	if renew, ok := renewAfter(now, expire, r.rc.ReservationRenewFraction); ok {
+		renewUnix := uint64(renew.Unix())
+		rsvp.RenewAfter = &renewUnix
+	}
+
+	hostConnsExceeded := r.hostConnsExceeded()
 
 	r.mx.Lock()
 	// Check if relay is still active. Otherwise ConnManager.UnTagPeer will not be called if this block runs after
@@ -209,60 +756,194 @@ func (r *Relay) handleReserve(s network.Stream) pbv2.Status {
 		log.Debug("refusing relay reservation",
 			"remote_peer", p,
 			"reason", "relay closed")
-		r.handleError(s, pbv2.Status_PERMISSION_DENIED)
-		return pbv2.Status_PERMISSION_DENIED
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_PERMISSION_DENIED, Reason: "relay closed"})
+		return nil, false, pbv2.Status_PERMISSION_DENIED
 	}
-	now := time.Now()
-	expire := now.Add(r.rc.ReservationTTL)
-
-	_, exists := r.rsvp[p]
-	if err := r.constraints.Reserve(p, a, expire); err != nil {
+	if r.reachabilityGating && !r.reachable.Load() {
+		r.mx.Unlock()
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", "relay not publicly reachable")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_RESERVATION_REFUSED, Reason: "relay not publicly reachable", Constraint: "reachability gating"})
+		return nil, false, pbv2.Status_RESERVATION_REFUSED
+	}
+	prev, exists := r.rsvp[p]
+	if r.maintenance.Load() && !exists {
+		r.mx.Unlock()
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", "relay in maintenance")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_RESERVATION_REFUSED, Reason: "relay in maintenance"})
+		return nil, false, pbv2.Status_RESERVATION_REFUSED
+	}
+	if hostConnsExceeded && !exists {
+		r.mx.Unlock()
+		log.Debug("refusing relay reservation",
+			"remote_peer", p,
+			"reason", "too many host connections")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "too many host connections", Constraint: "host connection limit"})
+		return nil, false, pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+	}
+	reserveConstraints := r.constraints.Reserve
+	if restored {
+		reserveConstraints = r.constraints.Restore
+	}
+	err = reserveConstraints(p, a, expire)
+	if errors.Is(err, errTooManyReservations) && r.evictionPolicy != EvictNone {
+		// the victim only loses its reservation if the new one takes its place
+		if victim := r.evictionCandidate(p); victim != "" {
+			err = r.constraints.ReserveReplacing(p, victim, a, expire, restored)
+			if err == nil {
+				r.evictReservation(victim)
+				log.Debug("evicted relay reservation",
+					"remote_peer", victim,
+					"policy", r.evictionPolicy,
+					"reason", "making room for new reservation")
+			}
+		}
+	}
+	if err != nil {
 		r.mx.Unlock()
 		log.Debug("refusing relay reservation",
 			"remote_peer", p,
 			"reason", "IP constraint violation",
 			"error", err)
-		r.handleError(s, pbv2.Status_RESERVATION_REFUSED)
-		return pbv2.Status_RESERVATION_REFUSED
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_RESERVE, Peer: p, Addr: a, Status: pbv2.Status_RESERVATION_REFUSED, Reason: "IP constraint violation", Constraint: err.Error()})
+		return nil, false, pbv2.Status_RESERVATION_REFUSED
 	}
 
-	r.rsvp[p] = expire
-	r.host.ConnManager().TagPeer(p, "relay-reservation", ReservationTagWeight)
+	var addrs [][]byte
+	if r.stableReservationAddrs && rsvp != nil {
+		rsvp.Addrs = stableAddrOrder(prev.addrs, rsvp.Addrs)
+		addrs = rsvp.Addrs
+	}
+	r.rsvp[p] = reservation{
+		expire:         expire,
+		granted:        now,
+		caps:           proto.Capabilities(msg.GetCapabilities()) & proto.SupportedCapabilities,
+		lastUsed:       now,
+		certifiedAddrs: certifiedAddrs,
+		addrs:          addrs,
+		addr:           a,
+		tier:           tier.Name,
+		limit:          tier.Limit,
+		voucherNonce:   nonce,
+		session:        session,
+	}
+	r.tagPeer(p, "relay-reservation", ReservationTagWeight)
+	r.checkHighWater(now)
+	if r.handshakeLatency != nil && rsvp != nil {
+		rsvp.Quality = r.makeQualityMsg()
+	}
 	r.mx.Unlock()
+	if exists {
+		r.reservationEnded(prev, ReservationEndRenewed, now)
+	}
+	r.audit(auditReservationGranted, AuditEvent{Peer: p, Addr: a, Status: pbv2.Status_OK, Expire: expire, Voucher: rsvp.GetVoucher(), Session: session})
 	if r.metricsTracer != nil {
 		r.metricsTracer.ReservationAllowed(exists)
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			mt.PeerReservationAllowed(p, exists)
+		}
 	}
 
-	log.Debug("reserving relay slot", "remote_peer", p)
+	log.Debug("reserving relay slot", "remote_peer", p, "restored", restored, "tier", tier.Name, "session", session)
+	return rsvp, exists, pbv2.Status_OK
+}
 
-	// Delivery of the reservation might fail for a number of reasons.
-	// For example, the stream might be reset or the connection might be closed before the reservation is received.
-	// In that case, the reservation will just be garbage collected later.
-	rsvp := makeReservationMsg(
-		r.reservationAddrFilter,
-		r.host.Peerstore().PrivKey(r.host.ID()),
-		r.host.ID(),
-		r.host.Addrs(),
-		p,
-		expire)
-	if err := r.writeResponse(s, pbv2.Status_OK, rsvp, r.makeLimitMsg(p)); err != nil {
-		log.Debug("error writing reservation response",
+func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Status {
+	return r.connect(s, msg, nil)
+}
+
+// handleReserveConnect reserves a slot for the remote peer and connects it to the requested
+// destination, sending a single response carrying both the reservation and the connection limit.
+// If the connection fails, a newly created reservation is retracted; a renewed reservation is kept.
+func (r *Relay) handleReserveConnect(s network.Stream, msg *pbv2.HopMessage) (reserveStatus, connectStatus pbv2.Status) {
+	p := s.Conn().RemotePeer()
+
+	rsvp, renewed, status := r.reserve(s, msg)
+	if status != pbv2.Status_OK {
+		r.handleError(s, status)
+		return status, status
+	}
+
+	status = r.connect(s, msg, rsvp)
+	if status != pbv2.Status_OK && !renewed {
+		log.Debug("retracting relay reservation",
 			"remote_peer", p,
-			"reason", "retracting reservation")
-		s.Reset()
-		return pbv2.Status_CONNECTION_FAILED
+			"reason", "connection failed")
+		r.retractReservation(p)
 	}
-	return pbv2.Status_OK
+	return pbv2.Status_OK, status
 }
 
-func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Status {
+// retractReservation removes the reservation of p.
+func (r *Relay) retractReservation(p peer.ID) {
+	r.mx.Lock()
+	rsvp, ok := r.rsvp[p]
+	if ok {
+		delete(r.rsvp, p)
+		r.constraints.cleanupPeer(p)
+		r.untagPeer(p, "relay-reservation")
+	}
+	r.mx.Unlock()
+
+	if ok {
+		r.reservationEnded(rsvp, ReservationEndRetracted, time.Now())
+	}
+	if ok && r.metricsTracer != nil {
+		r.metricsTracer.ReservationClosed(1)
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			mt.PeerReservationClosed(p)
+		}
+	}
+}
+
+// connect connects the remote peer of s to the destination requested in msg. If rsvp is not nil,
+// it is included in the response to the remote peer.
+func (r *Relay) connect(s network.Stream, msg *pbv2.HopMessage, rsvp *pbv2.Reservation) (status pbv2.Status) {
 	src := s.Conn().RemotePeer()
 	a := s.Conn().RemoteMultiaddr()
 
-	span, err := r.scope.BeginSpan()
+	var setupDeadline time.Time
+	if r.rc.SetupTimeout > 0 {
+		setupDeadline = time.Now().Add(r.rc.SetupTimeout)
+	}
+
+	traceID := msg.GetTraceID()
+	if !util.ValidTraceID(traceID) {
+		if traceID != "" {
+			log.Debug("replacing invalid trace ID", "source_peer", src, "length", len(traceID))
+		}
+		traceID = util.NewTraceID()
+	}
+	log := log.With("trace_id", traceID)
+
+	if r.loadShedder.Shed(time.Now()) {
+		log.Debug("refusing connection",
+			"source_peer", src,
+			"reason", "load shed")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "load shed", Constraint: "load shedder"})
+		r.handleError(s, pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+	}
+
+	dest, verified, refusal := r.precheckConnect(src, a, msg)
+	if refusal != nil {
+		log.Debug("refusing connection",
+			"source_peer", src,
+			"destination_peer", refusal.Destination,
+			"reason", refusal.Reason)
+		r.recordRefusal(*refusal)
+		r.handleError(s, refusal.Status)
+		return refusal.Status
+	}
+
+	span, err := r.circuitSpan(msg)
 	if err != nil {
 		log.Debug("failed to begin relay transaction",
 			"error", err)
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "failed to begin relay transaction", Constraint: err.Error()})
 		r.handleError(s, pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
 		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
 	}
@@ -276,120 +957,384 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Statu
 	if err := span.ReserveMemory(2*r.rc.BufferSize, network.ReservationPriorityHigh); err != nil {
 		log.Debug("error reserving memory for relay",
 			"error", err)
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "error reserving memory for relay", Constraint: err.Error()})
 		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
 		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
 	}
 
-	if isRelayAddr(a) {
-		log.Debug("refusing connection",
-			"reason", "connection attempt over relay connection")
-		fail(pbv2.Status_PERMISSION_DENIED)
-		return pbv2.Status_PERMISSION_DENIED
-	}
-
-	dest, err := util.PeerToPeerInfoV2(msg.GetPeer())
-	if err != nil {
-		fail(pbv2.Status_MALFORMED_MESSAGE)
-		return pbv2.Status_MALFORMED_MESSAGE
+	traceCtx := util.ContextWithTraceID(r.ctx, traceID)
+	if r.traceHook != nil {
+		var done func(pbv2.Status)
+		traceCtx, done = r.traceHook(traceCtx, traceID, src, dest.ID)
+		if done != nil {
+			defer func() { done(status) }()
+		}
 	}
 
-	if r.acl != nil && !r.acl.AllowConnect(src, s.Conn().RemoteMultiaddr(), dest.ID) {
+	r.mx.Lock()
+	if !r.connectLimiter.Allow(src, time.Now()) {
+		r.mx.Unlock()
 		log.Debug("refusing connection",
 			"source_peer", src,
 			"destination_peer", dest.ID,
-			"reason", "permission denied")
-		fail(pbv2.Status_PERMISSION_DENIED)
-		return pbv2.Status_PERMISSION_DENIED
+			"reason", "connect rate limit exceeded")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "connect rate limit exceeded", Constraint: "connect rate limit"})
+		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
 	}
 
-	r.mx.Lock()
-	_, rsvp := r.rsvp[dest.ID]
-	if !rsvp {
+	destRsvp, reserved := r.rsvp[dest.ID]
+	ok := reserved || verified
+	// nextHop is the relay through which the destination is reached in a two-hop circuit
+	var nextHop peer.ID
+	if !ok && r.allowNextHop(msg.GetHops()) {
+		nextHop, ok = r.nextHopRelay(dest)
+	}
+	if !ok {
 		r.mx.Unlock()
 		log.Debug("refusing connection",
 			"source_peer", src,
 			"destination_peer", dest.ID,
 			"reason", "no reservation")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_NO_RESERVATION, Reason: "no reservation"})
 		fail(pbv2.Status_NO_RESERVATION)
 		return pbv2.Status_NO_RESERVATION
 	}
 
+	if r.requireSourceReservation {
+		if _, ok := r.rsvp[src]; !ok {
+			r.mx.Unlock()
+			log.Debug("refusing connection",
+				"source_peer", src,
+				"destination_peer", dest.ID,
+				"reason", "source has no reservation")
+			r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_NO_RESERVATION, Reason: "source has no reservation", Constraint: "source reservation required"})
+			fail(pbv2.Status_NO_RESERVATION)
+			return pbv2.Status_NO_RESERVATION
+		}
+	}
+
+	cost := r.circuitCost(src, a, dest.ID)
+	budget := r.circuitCostBudget()
+
 	srcConns := r.conns[src]
-	if srcConns >= r.rc.MaxCircuits {
+	if srcConns+cost > budget {
 		r.mx.Unlock()
 		log.Debug("refusing connection",
 			"source_peer", src,
 			"destination_peer", dest.ID,
 			"reason", "too many connections from source")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "too many connections from source", Constraint: fmt.Sprintf("circuit cost %d+%d > %d", srcConns, cost, budget)})
 		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
 		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
 	}
 
 	destConns := r.conns[dest.ID]
-	if destConns >= r.rc.MaxCircuits {
+	if destConns+cost > budget {
 		r.mx.Unlock()
 		log.Debug("refusing connection",
 			"source_peer", src,
 			"destination_peer", dest.ID,
 			"reason", "too many connections to destination")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "too many connections to destination", Constraint: fmt.Sprintf("circuit cost %d+%d > %d", destConns, cost, budget)})
 		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
 		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
 	}
 
-	r.addConn(src)
-	r.addConn(dest.ID)
+	appProto := protocol.ID(msg.GetProtocol())
+	if p, exceeded := r.protocolLimitExceeded(src, dest.ID, appProto); exceeded {
+		r.mx.Unlock()
+		log.Debug("refusing connection",
+			"source_peer", src,
+			"destination_peer", dest.ID,
+			"protocol", appProto,
+			"reason", "too many connections for protocol")
+		r.recordRefusal(RefusalRecord{Type: pbv2.HopMessage_CONNECT, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED, Reason: "too many connections for protocol", Constraint: fmt.Sprintf("max circuits per peer protocol %d (peer %s, protocol %s)", r.rc.MaxCircuitsPerPeerProtocol, p, appProto)})
+		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+	}
+
+	if reserved {
+		destRsvp.lastUsed = time.Now()
+		r.rsvp[dest.ID] = destRsvp
+	}
+	r.addConn(src, cost)
+	r.addConn(dest.ID, cost)
+	r.addProtocolConn(src, dest.ID, appProto)
 	r.mx.Unlock()
+	// limit is the limit enforced on this connection; it is read once so that audit events
+	// carry the exact value the deadlines and data limits are derived from.
+	limit := r.reservationLimit(destRsvp)
+	r.audit(auditConnectionAllowed, AuditEvent{Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_OK, Limit: limit, Session: destRsvp.session})
+	r.stats.circuits.Add(1)
+	r.stats.circuitsOpened.Add(1)
 
 	if r.metricsTracer != nil {
-		r.metricsTracer.ConnectionOpened()
+		if mt, ok := r.metricsTracer.(ExemplarMetricsTracer); ok {
+			mt.ConnectionOpenedWithTraceID(traceID)
+		} else {
+			r.metricsTracer.ConnectionOpened()
+		}
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			mt.PeerConnectionOpened(src, dest.ID)
+		}
 	}
 	connStTime := time.Now()
 
 	cleanup := func() {
 		defer span.Done()
 		r.mx.Lock()
-		r.rmConn(src)
-		r.rmConn(dest.ID)
+		r.rmConn(src, cost)
+		r.rmConn(dest.ID, cost)
+		r.rmProtocolConn(src, dest.ID, appProto)
 		r.mx.Unlock()
+		r.stats.circuits.Add(-1)
 		if r.metricsTracer != nil {
-			r.metricsTracer.ConnectionClosed(time.Since(connStTime))
+			if mt, ok := r.metricsTracer.(ExemplarMetricsTracer); ok {
+				mt.ConnectionClosedWithTraceID(time.Since(connStTime), traceID)
+			} else {
+				r.metricsTracer.ConnectionClosed(time.Since(connStTime))
+			}
+			if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+				mt.PeerConnectionClosed(src, dest.ID)
+			}
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(r.ctx, ConnectTimeout)
+	// abort the connection request if the source goes away while we connect to the destination
+	srcCtx, srcCancel := context.WithCancelCause(traceCtx)
+	defer srcCancel(nil)
+	unwatch := r.sourceWatch.Watch(s.Conn(), func() { srcCancel(errSourceDisconnected) })
+	defer unwatch()
+
+	if !setupDeadline.IsZero() {
+		var setupCancel context.CancelFunc
+		srcCtx, setupCancel = context.WithDeadlineCause(srcCtx, setupDeadline, errSetupTimeout)
+		defer setupCancel()
+	}
+
+	ctx, cancel := context.WithTimeout(srcCtx, ConnectTimeout)
 	defer cancel()
 
 	ctx = network.WithNoDial(ctx, "relay connect")
+	if r.stopLocalAddr != nil {
+		ctx = network.WithPreferredLocalAddr(ctx, r.stopLocalAddr)
+	}
+
+	var bs network.Stream
+	var nextLimit *pbv2.Limit
+	if nextHop != "" {
+		bs, nextLimit, status = r.openNextHopStream(ctx, nextHop, dest.ID, msg.GetHops()+1, traceID)
+	} else {
+		start := time.Now()
+		bs, status = r.openStopStream(ctx, src, dest.ID, destRsvp.caps, limit, traceID)
+		if status == pbv2.Status_OK {
+			r.handshakeLatency.Add(time.Since(start))
+		}
+	}
+	if status != pbv2.Status_OK {
+		cleanup()
+		if errors.Is(context.Cause(ctx), errSourceDisconnected) {
+			log.Debug("aborted connection",
+				"source_peer", src,
+				"destination_peer", dest.ID,
+				"reason", "source disconnected")
+			s.Reset()
+			return status
+		}
+		if errors.Is(context.Cause(ctx), errSetupTimeout) {
+			log.Debug("aborted connection",
+				"source_peer", src,
+				"destination_peer", dest.ID,
+				"reason", "setup timeout")
+		}
+		r.handleError(s, status)
+		return status
+	}
 
-	bs, err := r.host.NewStream(ctx, dest.ID, proto.ProtoIDv2Stop)
+	var response pbv2.HopMessage
+	response.Type = pbv2.HopMessage_STATUS.Enum()
+	response.Status = pbv2.Status_OK.Enum()
+	response.Limit = minLimit(r.makeLimitMsg(limit), nextLimit)
+	if len(destRsvp.certifiedAddrs) > 0 {
+		response.Peer = util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest.ID, Addrs: destRsvp.certifiedAddrs})
+	}
+	if rsvp != nil {
+		response.Reservation = rsvp
+		caps := uint64(proto.SupportedCapabilities)
+		response.Capabilities = &caps
+	}
+
+	var sw io.Writer = s
+	if r.retryConnectResponse {
+		sw = &retryWriter{s: s, timeout: r.rc.responseWriteTimeout(), setupDeadline: setupDeadline}
+	}
+	s.SetWriteDeadline(responseWriteDeadline(r.rc.responseWriteTimeout(), setupDeadline))
+	start := time.Now()
+	err = r.writeHopMsg(sw, &response)
+	r.messageIODone(HopMessageWrite, start)
+	s.SetWriteDeadline(time.Time{})
 	if err != nil {
-		log.Debug("error opening relay stream",
-			"destination_peer", dest.ID,
+		log.Debug("error writing relay response",
 			"err", err)
+		if mt, ok := r.metricsTracer.(FailureMetricsTracer); ok {
+			mt.ConnectResponseWriteFailed()
+		}
+		bs.Reset()
+		s.Reset()
 		cleanup()
-		r.handleError(s, pbv2.Status_CONNECTION_FAILED)
 		return pbv2.Status_CONNECTION_FAILED
 	}
 
-	fail = func(status pbv2.Status) {
-		bs.Reset()
-		cleanup()
-		r.handleError(s, status)
+	// reset deadline
+	bs.SetDeadline(time.Time{})
+
+	log.Info("relaying connection",
+		"source_peer", src,
+		"destination_peer", dest.ID)
+
+	var goroutines atomic.Int32
+	goroutines.Store(2)
+
+	var ka *circuitKeepAlive
+	capture, srcCapture, destCapture := r.startCapture(src, dest.ID)
+	established := time.Now()
+	circuit := &activeCircuit{
+		id:          strconv.FormatUint(r.circuitSeq.Add(1), 10),
+		src:         s,
+		dest:        bs,
+		srcPeer:     src,
+		destPeer:    dest.ID,
+		established: established,
+		traceID:     traceID,
+		session:     destRsvp.session,
+	}
+	share := r.fairShare.add(src)
+	done := func() {
+		if goroutines.Add(-1) == 0 {
+			r.untrackCircuit(circuit)
+			r.audit(auditConnectionClosed, AuditEvent{Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_OK, Limit: limit, Session: circuit.session})
+			r.fairShare.remove(src)
+			ka.stop()
+			capture.close()
+			s.Close()
+			bs.Close()
+			cleanup()
+		}
+	}
+
+	r.audit(auditConnectionEstablished, AuditEvent{Time: established, Peer: src, Addr: a, Destination: dest.ID, Status: pbv2.Status_OK, Limit: limit, Session: circuit.session})
+	r.trackCircuit(circuit)
+
+	if limit != nil {
+		deadline := established.Add(limit.Duration)
+		s.SetDeadline(deadline)
+		bs.SetDeadline(deadline)
+		ka = r.keepCircuitAlive(s, bs, limit)
+		go r.relayLimited(s, bs, src, dest.ID, limit.srcToDest(), ka, srcCapture, share, done)
+		go r.relayLimited(bs, s, dest.ID, src, limit.destToSrc(), ka, destCapture, share, done)
+	} else {
+		go r.relayUnlimited(s, bs, src, dest.ID, srcCapture, share, done)
+		go r.relayUnlimited(bs, s, dest.ID, src, destCapture, share, done)
 	}
 
+	return pbv2.Status_OK
+}
+
+// responseWriteDeadline returns the deadline for writing a response, which doesn't extend past
+// the deadline of the connection setup, if any.
+func responseWriteDeadline(timeout time.Duration, setupDeadline time.Time) time.Time {
+	deadline := time.Now().Add(timeout)
+	if !setupDeadline.IsZero() && setupDeadline.Before(deadline) {
+		deadline = setupDeadline
+	}
+	return deadline
+}
+
+// retryWriter retries a write that timed out before writing anything once, with a fresh write
+// deadline. Other failures leave the stream reset or closed, and retrying after a partial write
+// would corrupt the message framing, so neither is retried.
+type retryWriter struct {
+	s             network.Stream
+	timeout       time.Duration
+	setupDeadline time.Time
+}
+
+func (w *retryWriter) Write(b []byte) (int, error) {
+	n, err := w.s.Write(b)
+	if err == nil || n > 0 || !isTimeout(err) {
+		return n, err
+	}
+	log.Debug("retrying timed out write", "err", err)
+	w.s.SetWriteDeadline(responseWriteDeadline(w.timeout, w.setupDeadline))
+	return w.s.Write(b)
+}
+
+// isTimeout returns true if err is a deadline error.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout())
+}
+
+// addConn accounts for a circuit with the given cost to or from p.
+func (r *Relay) addConn(p peer.ID, cost int) {
+	conns := r.conns[p]
+	if conns == 0 {
+		r.tagPeer(p, relayHopTag, relayHopTagValue)
+	}
+	r.conns[p] = conns + cost
+}
+
+// rmConn releases the cost of a circuit to or from p.
+func (r *Relay) rmConn(p peer.ID, cost int) {
+	conns := r.conns[p]
+	conns -= cost
+	if conns > 0 {
+		r.conns[p] = conns
+	} else {
+		delete(r.conns, p)
+		r.untagPeer(p, relayHopTag)
+	}
+}
+
+// openStopStream opens a stop stream to dest and performs the stop handshake for a connection
+// from src. On failure, the stream is reset and the status to respond to src with is returned.
+func (r *Relay) openStopStream(ctx context.Context, src, dest peer.ID, caps proto.Capabilities, limit *RelayLimit, traceID string) (network.Stream, pbv2.Status) {
+	log := log.With("trace_id", traceID)
+
+	if !r.acquireStopStream(ctx) {
+		log.Debug("error opening relay stream",
+			"destination_peer", dest,
+			"reason", "too many concurrent stop streams")
+		return nil, pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+	}
+	bs, err := r.host.NewStream(ctx, dest, proto.ProtoIDv2Stop)
+	r.releaseStopStream()
+	if err != nil {
+		log.Debug("error opening relay stream",
+			"destination_peer", dest,
+			"err", err)
+		return nil, pbv2.Status_CONNECTION_FAILED
+	}
+
+	// the stop handshake doesn't observe ctx, so reset the stream if the source disconnects or
+	// the setup times out
+	stop := resetOnSetupAbort(ctx, bs)
+	defer stop()
+
 	if err := bs.Scope().SetService(ServiceName); err != nil {
 		log.Debug("error attaching stream to relay service",
 			"error", err)
-		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
-		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+		bs.Reset()
+		return nil, pbv2.Status_RESOURCE_LIMIT_EXCEEDED
 	}
 
 	// handshake
 	if err := bs.Scope().ReserveMemory(maxMessageSize, network.ReservationPriorityAlways); err != nil {
 		log.Debug("error reserving memory for stream",
 			"error", err)
-		fail(pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
-		return pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+		bs.Reset()
+		return nil, pbv2.Status_RESOURCE_LIMIT_EXCEEDED
 	}
 	defer bs.Scope().ReleaseMemory(maxMessageSize)
 
@@ -400,127 +1345,81 @@ func (r *Relay) handleConnect(s network.Stream, msg *pbv2.HopMessage) pbv2.Statu
 	var stopmsg pbv2.StopMessage
 	stopmsg.Type = pbv2.StopMessage_CONNECT.Enum()
 	stopmsg.Peer = util.PeerInfoToPeerV2(peer.AddrInfo{ID: src})
-	stopmsg.Limit = r.makeLimitMsg(dest.ID)
+	stopmsg.Limit = r.makeLimitMsg(limit)
+	if caps.Has(proto.CapabilityTraceID) {
+		stopmsg.TraceID = &traceID
+	}
 
-	bs.SetDeadline(time.Now().Add(HandshakeTimeout))
+	bs.SetDeadline(time.Now().Add(r.rc.stopHandshakeTimeout()))
 
+	start := time.Now()
 	err = wr.WriteMsg(&stopmsg)
+	r.messageIODone(StopMessageWrite, start)
 	if err != nil {
 		log.Debug("error writing stop handshake")
-		fail(pbv2.Status_CONNECTION_FAILED)
-		return pbv2.Status_CONNECTION_FAILED
+		bs.Reset()
+		return nil, pbv2.Status_CONNECTION_FAILED
 	}
 
 	stopmsg.Reset()
 
+	start = time.Now()
 	err = rd.ReadMsg(&stopmsg)
+	r.messageIODone(StopMessageRead, start)
 	if err != nil {
 		log.Debug("error reading stop response",
 			"err", err)
-		fail(pbv2.Status_CONNECTION_FAILED)
-		return pbv2.Status_CONNECTION_FAILED
+		bs.Reset()
+		return nil, pbv2.Status_CONNECTION_FAILED
 	}
 
 	if t := stopmsg.GetType(); t != pbv2.StopMessage_STATUS {
 		log.Debug("unexpected stop response",
 			"message_type", t,
 			"expected", "status message")
-		fail(pbv2.Status_CONNECTION_FAILED)
-		return pbv2.Status_CONNECTION_FAILED
+		bs.Reset()
+		return nil, pbv2.Status_CONNECTION_FAILED
 	}
 
 	if status := stopmsg.GetStatus(); status != pbv2.Status_OK {
 		log.Debug("relay stop failure",
 			"status", status)
-		fail(pbv2.Status_CONNECTION_FAILED)
-		return pbv2.Status_CONNECTION_FAILED
-	}
-
-	var response pbv2.HopMessage
-	response.Type = pbv2.HopMessage_STATUS.Enum()
-	response.Status = pbv2.Status_OK.Enum()
-	response.Limit = r.makeLimitMsg(dest.ID)
-
-	wr = util.NewDelimitedWriter(s)
-	err = wr.WriteMsg(&response)
-	if err != nil {
-		log.Debug("error writing relay response",
-			"err", err)
 		bs.Reset()
-		s.Reset()
-		cleanup()
-		return pbv2.Status_CONNECTION_FAILED
+		return nil, pbv2.Status_CONNECTION_FAILED
 	}
 
-	// reset deadline
-	bs.SetDeadline(time.Time{})
-
-	log.Info("relaying connection",
-		"source_peer", src,
-		"destination_peer", dest.ID)
-
-	var goroutines atomic.Int32
-	goroutines.Store(2)
-
-	done := func() {
-		if goroutines.Add(-1) == 0 {
-			s.Close()
-			bs.Close()
-			cleanup()
-		}
+	if !stop() && setupAborted(ctx) {
+		// the stream was reset after the handshake completed
+		return nil, pbv2.Status_CONNECTION_FAILED
 	}
 
-	if r.rc.Limit != nil {
-		deadline := time.Now().Add(r.rc.Limit.Duration)
-		s.SetDeadline(deadline)
-		bs.SetDeadline(deadline)
-		go r.relayLimited(s, bs, src, dest.ID, r.rc.Limit.Data, done)
-		go r.relayLimited(bs, s, dest.ID, src, r.rc.Limit.Data, done)
-	} else {
-		go r.relayUnlimited(s, bs, src, dest.ID, done)
-		go r.relayUnlimited(bs, s, dest.ID, src, done)
-	}
-
-	return pbv2.Status_OK
+	return bs, pbv2.Status_OK
 }
 
-func (r *Relay) addConn(p peer.ID) {
-	conns := r.conns[p]
-	conns++
-	r.conns[p] = conns
-	if conns == 1 {
-		r.host.ConnManager().TagPeer(p, relayHopTag, relayHopTagValue)
-	}
-}
-
-func (r *Relay) rmConn(p peer.ID) {
-	conns := r.conns[p]
-	conns--
-	if conns > 0 {
-		r.conns[p] = conns
-	} else {
-		delete(r.conns, p)
-		r.host.ConnManager().UntagPeer(p, relayHopTag)
-	}
-}
-
-func (r *Relay) relayLimited(src, dest network.Stream, srcID, destID peer.ID, limit int64, done func()) {
+func (r *Relay) relayLimited(src, dest network.Stream, srcID, destID peer.ID, limit int64, ka *circuitKeepAlive, capture *captureDirection, share *rate.Limiter, done func()) {
 	defer done()
 
 	buf := pool.Get(r.rc.BufferSize)
 	defer pool.Put(buf)
 
-	limitedSrc := io.LimitReader(src, limit)
+	limitedSrc := io.LimitReader(r.throttle(src, share), limit)
 
-	count, err := r.copyWithBuffer(dest, limitedSrc, buf)
-	if err != nil {
+	count, err := r.copyWithBuffer(dest, limitedSrc, buf, ka.accounter(r.bytesAccounter(src, dest)), capture)
+	switch {
+	case r.completionError(err):
+		log.Debug("relay source ended abruptly", "err", err)
+		r.propagateClose(src, dest)
+	case err != nil:
 		log.Debug("relay copy error", "err", err)
 		// Reset both.
 		src.Reset()
 		dest.Reset()
-	} else {
-		// propagate the close
-		dest.CloseWrite()
+	case count == limit && r.rc.LimitExhaustedBehavior == LimitExhaustedReset:
+		log.Debug("relay data limit reached", "srcID", srcID, "destID", destID)
+		src.Reset()
+		dest.Reset()
+	default:
+		r.propagateClose(src, dest)
 		if count == limit {
 			// we've reached the limit, discard further input
 			src.CloseRead()
@@ -530,21 +1429,24 @@ func (r *Relay) relayLimited(src, dest network.Stream, srcID, destID peer.ID, li
 	log.Debug("relayed bytes", "count", count, "srcID", srcID, "destID", destID)
 }
 
-func (r *Relay) relayUnlimited(src, dest network.Stream, srcID, destID peer.ID, done func()) {
+func (r *Relay) relayUnlimited(src, dest network.Stream, srcID, destID peer.ID, capture *captureDirection, share *rate.Limiter, done func()) {
 	defer done()
 
 	buf := pool.Get(r.rc.BufferSize)
 	defer pool.Put(buf)
 
-	count, err := r.copyWithBuffer(dest, src, buf)
-	if err != nil {
+	count, err := r.copyWithBuffer(dest, r.throttle(src, share), buf, r.bytesAccounter(src, dest), capture)
+	switch {
+	case r.completionError(err):
+		log.Debug("relay source ended abruptly", "err", err)
+		r.propagateClose(src, dest)
+	case err != nil:
 		log.Debug("relay copy error", "err", err)
 		// Reset both.
 		src.Reset()
 		dest.Reset()
-	} else {
-		// propagate the close
-		dest.CloseWrite()
+	default:
+		r.propagateClose(src, dest)
 	}
 
 	log.Debug("relayed bytes", "count", count, "srcID", srcID, "destID", destID)
@@ -555,13 +1457,36 @@ func (r *Relay) relayUnlimited(src, dest network.Stream, srcID, destID peer.ID,
 var errInvalidWrite = errors.New("invalid write result")
 
 // copyWithBuffer copies from src to dst using the provided buf until either EOF is reached
-// on src or an error occurs. It reports the number of bytes transferred to metricsTracer.
+// on src or an error occurs. It reports the number of bytes transferred to metricsTracer and,
+// if not nil, to account, and hands the transferred bytes to capture.
 // The implementation is a modified form of io.CopyBuffer to support metrics tracking.
-func (r *Relay) copyWithBuffer(dst io.Writer, src io.Reader, buf []byte) (written int64, err error) {
+func (r *Relay) copyWithBuffer(dst io.Writer, src io.Reader, buf []byte, account func(n int), capture *captureDirection) (written int64, err error) {
+	tmt, _ := r.metricsTracer.(TransferMetricsTracer)
+	chunkSizes := tmt != nil && r.metricsChunkSizes
+	var emptyReads int
 	for {
 		nr, er := src.Read(buf)
+		if nr == 0 && er == nil {
+			// guard against a misbehaving transport spinning the loop without making progress
+			emptyReads++
+			if r.maxEmptyReads > 0 && emptyReads >= r.maxEmptyReads {
+				log.Debug("aborting relayed stream copy",
+					"reason", "source returns no data",
+					"empty_reads", emptyReads)
+				if tmt != nil {
+					tmt.CopyStall()
+				}
+				err = &sourceError{io.ErrNoProgress}
+				break
+			}
+			continue
+		}
+		emptyReads = 0
 		if nr > 0 {
-			nw, ew := dst.Write(buf[0:nr])
+			if chunkSizes {
+				tmt.ReadChunkSize(nr)
+			}
+			nw, ew := r.write(dst, buf[0:nr])
 			if nw < 0 || nr < nw {
 				nw = 0
 				if ew == nil {
@@ -577,13 +1502,18 @@ func (r *Relay) copyWithBuffer(dst io.Writer, src io.Reader, buf []byte) (writte
 				err = io.ErrShortWrite
 				break
 			}
+			r.stats.bytesRelayed.Add(uint64(nw))
+			capture.record(buf[0:nw])
 			if r.metricsTracer != nil {
 				r.metricsTracer.BytesTransferred(nw)
 			}
+			if account != nil {
+				account(nw)
+			}
 		}
 		if er != nil {
 			if er != io.EOF {
-				err = er
+				err = &sourceError{er}
 			}
 			break
 		}
@@ -603,40 +1533,66 @@ func (r *Relay) handleError(s network.Stream, status pbv2.Status) {
 }
 
 func (r *Relay) writeResponse(s network.Stream, status pbv2.Status, rsvp *pbv2.Reservation, limit *pbv2.Limit) error {
-	s.SetWriteDeadline(time.Now().Add(StreamTimeout))
+	s.SetWriteDeadline(time.Now().Add(r.rc.responseWriteTimeout()))
 	defer s.SetWriteDeadline(time.Time{})
-	wr := util.NewDelimitedWriter(s)
 
 	var msg pbv2.HopMessage
 	msg.Type = pbv2.HopMessage_STATUS.Enum()
 	msg.Status = status.Enum()
 	msg.Reservation = rsvp
 	msg.Limit = limit
+	if rsvp != nil {
+		caps := uint64(proto.SupportedCapabilities)
+		msg.Capabilities = &caps
+	}
+
+	defer r.messageIODone(HopMessageWrite, time.Now())
+	return r.writeHopMsg(s, &msg)
+}
+
+// reservationMsgOpts are the relay's parameters of a reservation message.
+type reservationMsgOpts struct {
+	addrFilter   ReservationAddressFilterFunc
+	signingKey   crypto.PrivKey
+	selfID       peer.ID
+	selfAddrs    []ma.Multiaddr
+	backupRelays []peer.AddrInfo
+	// handoffToken adds a handoff token to the reservation
+	handoffToken bool
+	// relayStart is the start time of the relay, recorded in handoff tokens
+	relayStart time.Time
+	// nonce makes the voucher single use, if not nil
+	nonce []byte
+}
 
-	return wr.WriteMsg(&msg)
+// reservationMsgOpts returns the parameters of the reservation messages of the relay.
+func (r *Relay) reservationMsgOpts(nonce []byte) reservationMsgOpts {
+	return reservationMsgOpts{
+		addrFilter:   r.reservationAddrFilter,
+		signingKey:   r.host.Peerstore().PrivKey(r.host.ID()),
+		selfID:       r.host.ID(),
+		selfAddrs:    r.host.Addrs(),
+		backupRelays: r.backupRelays,
+		handoffToken: r.handoffTokens,
+		relayStart:   r.started,
+		nonce:        nonce,
+	}
 }
 
-func makeReservationMsg(
-	reservationAddrFilter ReservationAddressFilterFunc,
-	signingKey crypto.PrivKey,
-	selfID peer.ID,
-	selfAddrs []ma.Multiaddr,
-	p peer.ID,
-	expire time.Time,
-) *pbv2.Reservation {
+func makeReservationMsg(opts reservationMsgOpts, p peer.ID, expire time.Time) (*pbv2.Reservation, error) {
 	expireUnix := uint64(expire.Unix())
 
 	rsvp := &pbv2.Reservation{Expire: &expireUnix}
 
-	selfP2PAddr, err := ma.NewComponent("p2p", selfID.String())
+	selfP2PAddr, err := ma.NewComponent("p2p", opts.selfID.String())
 	if err != nil {
 		log.Error("error creating p2p component", "err", err)
-		return rsvp
+		return rsvp, err
 	}
 
-	addrBytes := make([][]byte, 0, len(selfAddrs))
-	for _, addr := range selfAddrs {
-		if !reservationAddrFilter(addr) {
+	addrBytes := make([][]byte, 0, len(opts.selfAddrs))
+	for _, addr := range opts.selfAddrs {
+		if !opts.addrFilter(addr) {
 			continue
 		}
 
@@ -645,10 +1601,10 @@ func makeReservationMsg(
 		case id == "":
 			// No ID, we'll add one to the address
 			addr = addr.Encapsulate(selfP2PAddr)
-		case id == selfID:
+		case id == opts.selfID:
 		// This address already has our ID in it.
 		// Do nothing
-		case id != selfID:
+		case id != opts.selfID:
 			// This address has a different ID in it. Skip it.
 			log.Warn("skipping address", "addr", addr, "reason", "contains an unexpected ID")
 			continue
@@ -657,37 +1613,86 @@ func makeReservationMsg(
 	}
 
 	rsvp.Addrs = addrBytes
+	rsvp.BackupRelays = makeBackupRelayMsgs(opts.selfID, opts.backupRelays)
 
 	voucher := &proto.ReservationVoucher{
-		Relay:      selfID,
+		Relay:      opts.selfID,
 		Peer:       p,
 		Expiration: expire,
+		Nonce:      opts.nonce,
+	}
+
+	if opts.signingKey == nil {
+		log.Error("error sealing voucher", "peer", p, "err", errNoSigningKey)
+		return rsvp, errNoSigningKey
 	}
 
-	envelope, err := record.Seal(voucher, signingKey)
+	envelope, err := record.Seal(voucher, opts.signingKey)
 	if err != nil {
 		log.Error("error sealing voucher", "peer", p, "err", err)
-		return rsvp
+		return rsvp, err
 	}
 
 	blob, err := envelope.Marshal()
 	if err != nil {
 		log.Error("error marshalling voucher", "peer", p, "err", err)
-		return rsvp
+		return rsvp, err
 	}
 
 	rsvp.Voucher = blob
 
-	return rsvp
+	if opts.handoffToken {
+		// the reservation is usable without a handoff token, so don't fail it
+		token, err := makeHandoffToken(opts.signingKey, opts.selfID, p, expire, opts.relayStart)
+		if err != nil {
+			log.Error("error sealing handoff token", "peer", p, "err", err)
+		} else {
+			rsvp.HandoffToken = token
+		}
+	}
+
+	return rsvp, nil
+}
+
+// appendReservationAddrs adds addrs to the reservation, skipping addresses already present.
+func appendReservationAddrs(rsvp *pbv2.Reservation, addrs []ma.Multiaddr) {
+	for _, addr := range addrs {
+		b := addr.Bytes()
+		if slices.ContainsFunc(rsvp.Addrs, func(a []byte) bool { return bytes.Equal(a, b) }) {
+			continue
+		}
+		rsvp.Addrs = append(rsvp.Addrs, b)
+	}
+}
+
+// reservationTTL returns the duration of the reservation requested by msg. Clients may request a
+// shorter reservation, which is clamped to [MinReservationTTL, ReservationTTL].
+func (r *Relay) reservationTTL(msg *pbv2.HopMessage) time.Duration {
+	if msg.Ttl == nil {
+		return r.rc.ReservationTTL
+	}
+	ttl := time.Duration(msg.GetTtl()) * time.Second
+	return max(min(ttl, r.rc.ReservationTTL), min(r.rc.MinReservationTTL, r.rc.ReservationTTL))
+}
+
+// renewAfter returns the time after which a reservation granted at now and expiring at expire
+// should be renewed, or false if fraction is not in (0, 1].
+func renewAfter(now, expire time.Time, fraction float64) (time.Time, bool) {
+	if fraction <= 0 || fraction > 1 {
+		return time.Time{}, false
+	}
+	return now.Add(time.Duration(float64(expire.Sub(now)) * fraction)), true
 }
 
-func (r *Relay) makeLimitMsg(_ peer.ID) *pbv2.Limit {
-	if r.rc.Limit == nil {
+// makeLimitMsg returns the limit message for limit. The message has a single data limit for both
+// directions, so the stricter of the per direction limits is advertised.
+func (r *Relay) makeLimitMsg(limit *RelayLimit) *pbv2.Limit {
+	if limit == nil {
 		return nil
 	}
 
-	duration := uint32(r.rc.Limit.Duration / time.Second)
-	data := uint64(r.rc.Limit.Data)
+	duration := uint32(limit.Duration / time.Second)
+	data := uint64(min(limit.srcToDest(), limit.destToSrc()))
 
 	return &pbv2.Limit{
 		Duration: &duration,
@@ -699,10 +1704,19 @@ func (r *Relay) background() {
 	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
+	var probeTick <-chan time.Time
+	if r.probe != nil {
+		probeTicker := time.NewTicker(r.probe.interval)
+		defer probeTicker.Stop()
+		probeTick = probeTicker.C
+	}
+
 	for {
 		select {
 		case <-ticker.C:
 			r.gc()
+		case <-probeTick:
+			r.startProbeRound()
 		case <-r.ctx.Done():
 			return
 		}
@@ -715,40 +1729,171 @@ func (r *Relay) gc() {
 
 	now := time.Now()
 	cnt := 0
-	for p, expire := range r.rsvp {
-		if r.closed || expire.Before(now) {
+	for p, rsvp := range r.rsvp {
+		if r.closed || rsvp.expire.Before(now) {
 			delete(r.rsvp, p)
-			r.host.ConnManager().UntagPeer(p, "relay-reservation")
+			r.untagPeer(p, "relay-reservation")
 			cnt++
+			if r.closed {
+				r.reservationEnded(rsvp, ReservationEndRelayClosed, now)
+			} else {
+				r.reservationEnded(rsvp, ReservationEndExpired, now)
+			}
+			if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+				mt.PeerReservationClosed(p)
+			}
 		}
 	}
 	if r.metricsTracer != nil {
 		r.metricsTracer.ReservationClosed(cnt)
 	}
+	r.checkHighWater(now)
 
 	for p, count := range r.conns {
 		if count == 0 {
 			delete(r.conns, p)
 		}
 	}
+
+	r.connectStats.gc(now)
+
+	r.connectLimiter.gc(now)
+	r.probeLimiter.gc(now)
+	if r.readErrLimiter != nil {
+		r.readErrLimiter.gc(now)
+	}
+}
+
+// graceTimer is the timer of the disconnect grace period of a peer that disconnected at since.
+type graceTimer struct {
+	*time.Timer
+	since time.Time
+}
+
+// connected ends the disconnect grace period of a peer that reconnected.
+func (r *Relay) connected(_ network.Network, c network.Conn) {
+	p := c.RemotePeer()
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	gt, ok := r.graceTimers[p]
+	if !ok {
+		return
+	}
+	gt.Stop()
+	delete(r.graceTimers, p)
+	if rsvp, ok := r.rsvp[p]; ok && rsvp.disconnected.Equal(gt.since) {
+		rsvp.disconnected = time.Time{}
+		r.rsvp[p] = rsvp
+	}
 }
 
 func (r *Relay) disconnected(n network.Network, c network.Conn) {
+	r.sourceWatch.Closed(c)
+
 	p := c.RemotePeer()
 	if n.Connectedness(p) == network.Connected {
 		return
 	}
+	if r.disconnectBatch != nil {
+		r.queueDisconnect(p)
+		return
+	}
+	r.peersDisconnected([]peer.ID{p})
+}
+
+// peersDisconnected cleans up the state of peers that are no longer connected to the relay, and
+// drops their reservations unless they are kept for Resources.DisconnectGracePeriod.
+func (r *Relay) peersDisconnected(ps []peer.ID) {
+	for _, p := range ps {
+		r.connectStats.cleanupPeer(p)
+	}
 
+	now := time.Now()
+	dropped := make(map[peer.ID]reservation)
 	r.mx.Lock()
-	_, ok := r.rsvp[p]
-	if ok {
-		delete(r.rsvp, p)
+	for _, p := range ps {
+		r.connectLimiter.cleanupPeer(p)
+		r.probeLimiter.cleanupPeer(p)
+		rsvp, ok := r.rsvp[p]
+		if ok && r.rc.DisconnectGracePeriod > 0 {
+			// keep the reservation around in case the peer reconnects shortly
+			rsvp.disconnected = now
+			r.rsvp[p] = rsvp
+			if gt, ok := r.graceTimers[p]; ok {
+				gt.Stop()
+			}
+			if !r.closed {
+				r.graceTimers[p] = graceTimer{
+					Timer: time.AfterFunc(r.rc.DisconnectGracePeriod, func() {
+						r.expireDisconnected(p, now)
+					}),
+					since: now,
+				}
+			}
+			continue
+		}
+		if ok {
+			delete(r.rsvp, p)
+			dropped[p] = rsvp
+		}
+		r.constraints.cleanupPeer(p)
+	}
+	if len(dropped) > 0 {
+		r.checkHighWater(now)
+	}
+	r.mx.Unlock()
+
+	if len(dropped) == 0 {
+		return
+	}
+	for _, rsvp := range dropped {
+		r.reservationEnded(rsvp, ReservationEndDisconnected, now)
+	}
+	if r.metricsTracer != nil {
+		r.metricsTracer.ReservationClosed(len(dropped))
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			for p := range dropped {
+				mt.PeerReservationClosed(p)
+			}
+		}
+	}
+}
+
+// expireDisconnected drops the reservation of p at the end of the disconnect grace period that
+// started at since, unless the peer has reconnected in the meantime.
+func (r *Relay) expireDisconnected(p peer.ID, since time.Time) {
+	connected := r.host.Network().Connectedness(p) == network.Connected
+
+	r.mx.Lock()
+	if gt, ok := r.graceTimers[p]; ok && gt.since.Equal(since) {
+		delete(r.graceTimers, p)
 	}
+	rsvp, ok := r.rsvp[p]
+	if r.closed || !ok || !rsvp.disconnected.Equal(since) {
+		// the reservation is gone, was renewed, or the peer disconnected again
+		r.mx.Unlock()
+		return
+	}
+	if connected {
+		rsvp.disconnected = time.Time{}
+		r.rsvp[p] = rsvp
+		r.mx.Unlock()
+		return
+	}
+	delete(r.rsvp, p)
 	r.constraints.cleanupPeer(p)
+	r.untagPeer(p, "relay-reservation")
+	r.checkHighWater(time.Now())
 	r.mx.Unlock()
 
-	if ok && r.metricsTracer != nil {
+	log.Debug("dropped relay reservation", "remote_peer", p, "reason", "disconnect grace period elapsed")
+	r.reservationEnded(rsvp, ReservationEndDisconnected, time.Now())
+	if r.metricsTracer != nil {
 		r.metricsTracer.ReservationClosed(1)
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			mt.PeerReservationClosed(p)
+		}
 	}
 }
 
@@ -1,12 +1,22 @@
 package relay
 
 import (
+	"context"
 	"crypto/rand"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 	"github.com/stretchr/testify/require"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -23,6 +33,64 @@ func genKeyAndID(t *testing.T) (crypto.PrivKey, peer.ID) {
 	return key, id
 }
 
+// getTestHosts returns n TCP-only blank hosts, which are closed when the test ends.
+func getTestHosts(t testing.TB, n int, opts ...swarmt.Option) []host.Host {
+	t.Helper()
+	opts = append([]swarmt.Option{
+		swarmt.OptDisableQUIC,
+		swarmt.OptDisableWebTransport,
+		swarmt.OptDisableWebRTC,
+	}, opts...)
+	hosts := make([]host.Host, 0, n)
+	for range n {
+		h := bhost.NewBlankHost(swarmt.GenSwarm(t, opts...))
+		t.Cleanup(func() { h.Close() })
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// addCircuitTransport enables dialing and accepting relayed connections on h.
+func addCircuitTransport(t *testing.T, h host.Host) {
+	t.Helper()
+	upgrader := swarmt.GenUpgrader(t, h.Network().(*swarm.Swarm), nil)
+	require.NoError(t, client.AddTransport(h, upgrader))
+}
+
+// openCircuit connects src to dest through the relay host, reserving a slot for dest, and
+// opens a stream for the given protocol over the relayed connection.
+// dest must have a circuit transport and a handler for the protocol.
+func openCircuit(t *testing.T, src, dest, relayHost host.Host, proto protocol.ID) (network.Stream, error) {
+	t.Helper()
+	if _, err := reserve(t, dest, relayHost); err != nil {
+		return nil, err
+	}
+	if src.Network().Connectedness(relayHost.ID()) != network.Connected {
+		require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	}
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit", relayHost.ID()))
+	if err := src.Connect(context.Background(), peer.AddrInfo{ID: dest.ID(), Addrs: []ma.Multiaddr{raddr}}); err != nil {
+		return nil, err
+	}
+	return src.NewStream(network.WithAllowLimitedConn(context.Background(), string(proto)), dest.ID(), proto)
+}
+
+// reserve connects h to the relay host and reserves a slot.
+func reserve(t *testing.T, h, relayHost host.Host) (*client.Reservation, error) {
+	t.Helper()
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, h.Connect(context.Background(), rinfo))
+	return client.Reserve(context.Background(), h, rinfo)
+}
+
+// hasReservation returns true if the relay holds a reservation for p.
+func (r *Relay) hasReservation(p peer.ID) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	_, ok := r.rsvp[p]
+	return ok
+}
+
 // TestMakeReservationWithP2PAddrs ensures that our reservation message builder
 // sanitizes the input addresses
 func TestMakeReservationWithP2PAddrs(t *testing.T) {
@@ -63,7 +131,9 @@ func TestMakeReservationWithP2PAddrs(t *testing.T) {
 	}}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			rsvp := makeReservationMsg(tc.filter, selfKey, selfID, tc.input, reserverID, time.Now().Add(time.Minute))
+			opts := reservationMsgOpts{addrFilter: tc.filter, signingKey: selfKey, selfID: selfID, selfAddrs: tc.input}
+			rsvp, err := makeReservationMsg(opts, reserverID, time.Now().Add(time.Minute))
+			require.NoError(t, err)
 			require.NotNil(t, rsvp)
 
 			addrsFromRsvp := make([]ma.Multiaddr, 0, len(rsvp.GetAddrs()))
@@ -76,3 +146,27 @@ func TestMakeReservationWithP2PAddrs(t *testing.T) {
 		})
 	}
 }
+
+func TestRefuseConnectToSelf(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for _, h := range []host.Host{src, dest} {
+		handleStopEcho(h)
+		_, err := reserve(t, h, relayHost)
+		require.NoError(t, err)
+	}
+
+	_, status := connectRaw(t, src, relayHost, src.ID())
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, status)
+	refusals := r.RecentRefusals()
+	require.Len(t, refusals, 1)
+	require.Equal(t, "connection to self", refusals[0].Reason)
+
+	_, status = connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+}
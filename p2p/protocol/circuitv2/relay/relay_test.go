@@ -23,6 +23,7 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	"github.com/stretchr/testify/require"
@@ -379,3 +380,28 @@ func TestRelayLimitData(t *testing.T) {
 	}
 
 }
+
+func TestRelayAgentVersionFilter(t *testing.T) {
+	ctx := t.Context()
+
+	hosts, _ := getNetHosts(t, ctx, 2)
+
+	r, err := relay.New(hosts[1], relay.WithAgentVersionFilter(func(av string) bool {
+		return av != "old-client/0.1"
+	}, true))
+	require.NoError(t, err)
+	defer r.Close()
+
+	connect(t, hosts[0], hosts[1])
+	rinfo := hosts[1].Peerstore().PeerInfo(hosts[1].ID())
+
+	// unknown agent version is allowed
+	_, err = client.Reserve(ctx, hosts[0], rinfo)
+	require.NoError(t, err)
+
+	require.NoError(t, hosts[1].Peerstore().Put(hosts[0].ID(), "AgentVersion", "old-client/0.1"))
+	_, err = client.Reserve(ctx, hosts[0], rinfo)
+	var rerr client.ReservationError
+	require.ErrorAs(t, err, &rerr)
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, rerr.Status)
+}
@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ReservationInfo describes a reservation held by the relay.
+type ReservationInfo struct {
+	// Peer is the peer holding the reservation.
+	Peer peer.ID
+	// Addr is the address the peer reserved from.
+	Addr ma.Multiaddr
+	// Granted is the time the reservation was granted or last renewed.
+	Granted time.Time
+	// Expire is the time the reservation expires unless renewed.
+	Expire time.Time
+	// Disconnected is the time the peer disconnected while the reservation is kept for the
+	// disconnect grace period; it is zero while the peer is connected.
+	Disconnected time.Time
+	// Tier is the name of the tier granted by the ACL, if any.
+	Tier string
+	// Session is the session ID of the reservation, if any.
+	Session string
+}
+
+// Reservations returns the reservations held by the relay.
+func (r *Relay) Reservations() []ReservationInfo {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	res := make([]ReservationInfo, 0, len(r.rsvp))
+	for p, rsvp := range r.rsvp {
+		res = append(res, ReservationInfo{
+			Peer:         p,
+			Addr:         rsvp.addr,
+			Granted:      rsvp.granted,
+			Expire:       rsvp.expire,
+			Disconnected: rsvp.disconnected,
+			Tier:         rsvp.tier,
+			Session:      rsvp.session,
+		})
+	}
+	return res
+}
+
+// RevokeReservation removes the reservation of p before it expires. Relayed connections to and
+// from p are left alone, and p may reserve a slot again. It returns ErrNoReservation if p has no
+// reservation.
+func (r *Relay) RevokeReservation(p peer.ID) error {
+	now := time.Now()
+
+	r.mx.Lock()
+	rsvp, ok := r.rsvp[p]
+	if !ok {
+		r.mx.Unlock()
+		return ErrNoReservation
+	}
+	delete(r.rsvp, p)
+	r.constraints.cleanupPeer(p)
+	r.untagPeer(p, "relay-reservation")
+	r.checkHighWater(now)
+	r.mx.Unlock()
+
+	log.Debug("revoked relay reservation", "remote_peer", p)
+	r.reservationEnded(rsvp, ReservationEndRevoked, now)
+	if r.metricsTracer != nil {
+		r.metricsTracer.ReservationClosed(1)
+		if mt, ok := r.metricsTracer.(PeerMetricsTracer); ok && r.metricsPeerLabels {
+			mt.PeerReservationClosed(p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservations(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, h1, h2 := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+	require.Empty(t, r.Reservations())
+
+	start := time.Now()
+	_, err = reserve(t, h1, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, h2, relayHost)
+	require.NoError(t, err)
+
+	reservations := r.Reservations()
+	require.Len(t, reservations, 2)
+	for _, info := range reservations {
+		require.Contains(t, []peer.ID{h1.ID(), h2.ID()}, info.Peer)
+		require.NotNil(t, info.Addr)
+		require.False(t, info.Granted.Before(start))
+		require.True(t, info.Expire.After(info.Granted))
+		require.True(t, info.Disconnected.IsZero())
+	}
+}
+
+func TestRevokeReservation(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	mt := &lifetimeMetricsTracer{
+		lifetimes: make(map[ReservationEndReason][]time.Duration),
+		evictions: make(map[ReservationEndReason]int),
+	}
+	r, err := New(relayHost, WithMetricsTracer(mt))
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	require.ErrorIs(t, r.RevokeReservation(src.ID()), ErrNoReservation)
+
+	require.NoError(t, r.RevokeReservation(dest.ID()))
+	require.False(t, r.hasReservation(dest.ID()))
+	require.Zero(t, r.ConstraintsSnapshot().Total)
+	require.ErrorIs(t, r.RevokeReservation(dest.ID()), ErrNoReservation)
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+
+	mt.mx.Lock()
+	require.Equal(t, map[ReservationEndReason]int{ReservationEndRevoked: 1}, mt.evictions)
+	require.Equal(t, 1, mt.closed)
+	mt.mx.Unlock()
+
+	// the peer may reserve again
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+}
@@ -0,0 +1,136 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+)
+
+// handleStopEcho accepts relayed connections on h and echoes the data received over them.
+func handleStopEcho(h host.Host) {
+	h.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		defer s.Close()
+		rd := util.NewDelimitedReader(s, maxMessageSize)
+		defer rd.Close()
+		var msg pbv2.StopMessage
+		if err := rd.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		msg.Reset()
+		msg.Type = pbv2.StopMessage_STATUS.Enum()
+		msg.Status = pbv2.Status_OK.Enum()
+		if err := util.NewDelimitedWriter(s).WriteMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		io.Copy(s, s)
+	})
+}
+
+// reserveConnect sends a combined reservation and connection request for dest to the relay.
+func reserveConnect(t *testing.T, h, relayHost host.Host, dest peer.ID) (network.Stream, *pbv2.HopMessage) {
+	t.Helper()
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+
+	msg := &pbv2.HopMessage{
+		Type: pbv2.HopMessage_RESERVE_CONNECT.Enum(),
+		Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest}),
+	}
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(msg))
+
+	var resp pbv2.HopMessage
+	rd := util.NewDelimitedReader(s, maxMessageSize)
+	require.NoError(t, rd.ReadMsg(&resp))
+	return s, &resp
+}
+
+func TestReserveConnect(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	s, resp := reserveConnect(t, src, relayHost, dest.ID())
+	defer s.Close()
+	require.Equal(t, pbv2.HopMessage_STATUS, resp.GetType())
+	require.Equal(t, pbv2.Status_OK, resp.GetStatus())
+	require.NotNil(t, resp.GetReservation())
+	require.NotZero(t, resp.GetReservation().GetExpire())
+	require.NotEmpty(t, resp.GetReservation().GetVoucher())
+	require.NotNil(t, resp.GetLimit())
+	require.True(t, r.hasReservation(src.ID()))
+
+	// the stream is now relayed to dest
+	_, err = s.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(s, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+}
+
+func TestReserveConnectFailure(t *testing.T) {
+	for _, renewal := range []bool{false, true} {
+		name := "new reservation"
+		if renewal {
+			name = "renewed reservation"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			r, err := New(relayHost)
+			require.NoError(t, err)
+			defer r.Close()
+
+			if renewal {
+				_, err := reserve(t, src, relayHost)
+				require.NoError(t, err)
+			}
+
+			// dest has no reservation, so the connection fails after the reservation succeeded
+			s, resp := reserveConnect(t, src, relayHost, dest.ID())
+			defer s.Close()
+			require.Equal(t, pbv2.Status_NO_RESERVATION, resp.GetStatus())
+			require.Nil(t, resp.GetReservation())
+			require.Equal(t, renewal, r.hasReservation(src.ID()))
+
+			r.mx.Lock()
+			require.Zero(t, r.conns[src.ID()])
+			r.mx.Unlock()
+		})
+	}
+}
+
+func TestReserveConnectRefused(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 0
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	s, resp := reserveConnect(t, src, relayHost, dest.ID())
+	defer s.Close()
+	require.Equal(t, pbv2.Status_RESERVATION_REFUSED, resp.GetStatus())
+	require.False(t, r.hasReservation(src.ID()))
+}
@@ -0,0 +1,39 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// reservedCapacity is reservation capacity set aside for priority peers.
+type reservedCapacity struct {
+	peers map[peer.ID]struct{}
+	slots int
+}
+
+func (rc *reservedCapacity) isPriority(p peer.ID) bool {
+	if rc == nil {
+		return false
+	}
+	_, ok := rc.peers[p]
+	return ok
+}
+
+// exceeded returns whether a reservation by p would take up capacity set aside for priority
+// peers. Priority peers take up the reserved slots before the general capacity, so ordinary
+// peers are limited to MaxReservations minus the reserved slots, less any priority
+// reservations that didn't fit into the reserved slots.
+// c.mutex must be held.
+func (c *constraints) reservedCapacityExceeded(p peer.ID) bool {
+	rc := c.reserved
+	if rc == nil || rc.isPriority(p) {
+		return false
+	}
+	var priority int
+	for _, pe := range c.total {
+		if rc.isPriority(pe.Peer) {
+			priority++
+		}
+	}
+	general := len(c.total) - min(priority, rc.slots)
+	return general >= c.rc.MaxReservations-rc.slots
+}
@@ -0,0 +1,67 @@
+package relay
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservedCapacityConstraints(t *testing.T) {
+	prio1, prio2, prio3 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	expiry := time.Now().Add(30 * time.Minute)
+
+	c := newConstraints(&Resources{
+		MaxReservations:       4,
+		MaxReservationsPerIP:  math.MaxInt32,
+		MaxReservationsPerASN: math.MaxInt32,
+	})
+	c.reserved = &reservedCapacity{
+		peers: map[peer.ID]struct{}{prio1: {}, prio2: {}, prio3: {}},
+		slots: 2,
+	}
+
+	// a priority peer takes up a reserved slot first, leaving the general capacity to others
+	require.NoError(t, c.Reserve(prio1, randomIPv4Addr(t), expiry))
+	require.NoError(t, c.Reserve(test.RandPeerIDFatal(t), randomIPv4Addr(t), expiry))
+	require.NoError(t, c.Reserve(test.RandPeerIDFatal(t), randomIPv4Addr(t), expiry))
+	require.ErrorIs(t, c.Reserve(test.RandPeerIDFatal(t), randomIPv4Addr(t), expiry), errTooManyReservations)
+
+	// the remaining reserved slot is only available to priority peers
+	require.NoError(t, c.Reserve(prio2, randomIPv4Addr(t), expiry))
+	require.ErrorIs(t, c.Reserve(prio3, randomIPv4Addr(t), expiry), errTooManyReservations)
+}
+
+func TestReservedCapacity(t *testing.T) {
+	hosts := getTestHosts(t, 5)
+	relayHost, ordinary, priority := hosts[0], hosts[1:4], hosts[4]
+
+	rc := DefaultResources()
+	rc.MaxReservations = 3
+	r, err := New(relayHost, WithResources(rc), WithReservedCapacity([]peer.ID{priority.ID()}, 1))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// fill the relay with ordinary peers
+	for _, h := range ordinary[:2] {
+		_, err := reserve(t, h, relayHost)
+		require.NoError(t, err)
+	}
+	_, err = reserve(t, ordinary[2], relayHost)
+	require.Error(t, err)
+	require.False(t, r.hasReservation(ordinary[2].ID()))
+
+	_, err = reserve(t, priority, relayHost)
+	require.NoError(t, err)
+	require.True(t, r.hasReservation(priority.ID()))
+}
+
+func TestWithReservedCapacity(t *testing.T) {
+	p := test.RandPeerIDFatal(t)
+	require.Error(t, WithReservedCapacity([]peer.ID{p}, 0)(&Relay{}))
+	require.Error(t, WithReservedCapacity(nil, 1)(&Relay{}))
+	require.NoError(t, WithReservedCapacity([]peer.ID{p}, 1)(&Relay{}))
+}
@@ -12,14 +12,77 @@ type Resources struct {
 	// ReservationTTL is the duration of a new (or refreshed reservation).
 	// Defaults to 1hr.
 	ReservationTTL time.Duration
+	// MinReservationTTL is the minimum duration of a reservation. Clients may request a shorter
+	// reservation than ReservationTTL, which is clamped to [MinReservationTTL, ReservationTTL].
+	// Defaults to 1min.
+	MinReservationTTL time.Duration
+	// DisconnectGracePeriod is how long a reservation is kept after its peer disconnects, so
+	// that peers reconnecting shortly after a transient disconnect don't have to reserve again.
+	// Relayed connections still end on disconnect. Defaults to 0, dropping the reservation
+	// immediately.
+	DisconnectGracePeriod time.Duration
+	// ReservationRenewFraction is the fraction of the reservation duration after which clients
+	// are advised to renew their reservation, sent as the renew after hint of the reservation.
+	// Must be in (0, 1]; other values disable the hint. Defaults to 0.75.
+	ReservationRenewFraction float64
 
 	// MaxReservations is the maximum number of active relay slots; defaults to 128.
 	MaxReservations int
 	// MaxCircuits is the maximum number of open relay connections for each peer; defaults to 16.
 	MaxCircuits int
+	// MaxCircuitCostPerPeer is the maximum sum of the costs of the open relay connections of each
+	// peer, where the cost of each connection is set with WithCircuitCost and defaults to 1.
+	// If 0, MaxCircuits is used.
+	MaxCircuitCostPerPeer int
+	// MaxCircuitsPerPeerProtocol is the maximum number of open relay connections of each peer
+	// running the same protocol, as announced by the source in its connect request. Relay
+	// connections without an announced protocol don't count against it. Defaults to 0, which
+	// means unlimited.
+	MaxCircuitsPerPeerProtocol int
+	// ConnectRateLimit is the (optional) rate limit of connect requests from each source peer.
+	// Requests exceeding it are refused with RESOURCE_LIMIT_EXCEEDED. Defaults to nil, which
+	// disables rate limiting.
+	ConnectRateLimit *RateLimit
+	// MaxConcurrentHandshakes is the maximum number of hop streams handled concurrently, from
+	// reading the request to responding to it. Further hop streams are refused with
+	// RESOURCE_LIMIT_EXCEEDED. Established relayed connections don't count against it.
+	// Defaults to 0, which means unlimited.
+	MaxConcurrentHandshakes int
+	// MaxConcurrentStopStreams is the maximum number of stop streams opened concurrently to the
+	// destinations of relayed connections, to protect the host's dialer and resource manager
+	// from bursts of connect requests. Connect requests wait for their turn for up to
+	// ConnectTimeout, or until their setup times out, and are then refused with
+	// RESOURCE_LIMIT_EXCEEDED. Defaults to 0, which means unlimited.
+	MaxConcurrentStopStreams int
+	// SetupTimeout is the maximum time from receiving a connect request until the relayed
+	// connection is set up, including the stop handshake with the destination and the response to
+	// the source. Connect requests that aren't set up in time are abandoned. Defaults to 0, which
+	// leaves only the ConnectTimeout and StopHandshakeTimeout limits.
+	SetupTimeout time.Duration
+	// LimitExhaustedBehavior is how a relayed connection is ended when it reaches the data limit
+	// of Limit; defaults to LimitExhaustedClose.
+	LimitExhaustedBehavior LimitExhaustedBehavior
+	// CloseCircuitBehavior is what happens to active relayed connections when the relay is
+	// closed; defaults to CloseCircuitsLeave.
+	CloseCircuitBehavior CloseCircuitBehavior
+	// CloseDrainTimeout is how long active relayed connections may continue after the relay is
+	// closed with CloseCircuitsDrain, before they are reset. Defaults to 0, which means
+	// DefaultCloseDrainTimeout.
+	CloseDrainTimeout time.Duration
 	// BufferSize is the size of the relayed connection buffers; defaults to 2048.
 	BufferSize int
 
+	// ReserveReadTimeout is how long the relay waits for the request on a new hop stream.
+	// Defaults to 0, which means StreamTimeout.
+	ReserveReadTimeout time.Duration
+	// StopHandshakeTimeout is the maximum duration of the stop handshake with the destination of
+	// a relayed connection, or of the connect handshake with the next relay of a two-hop circuit.
+	// Defaults to 0, which means HandshakeTimeout.
+	StopHandshakeTimeout time.Duration
+	// ResponseWriteTimeout is the maximum time to write a response on a hop stream. Defaults to
+	// 0, which means StreamTimeout.
+	ResponseWriteTimeout time.Duration
+
 	// MaxReservationsPerPeer is the maximum number of reservations originating from the same
 	// peer; default is 4.
 	//
@@ -40,14 +103,50 @@ type RelayLimit struct {
 	// Data is the limit of data relayed (on each direction) before resetting the connection.
 	// Defaults to 128KB
 	Data int64
+	// DataSrcToDest is the limit of data relayed from the peer that requested the connection to
+	// its destination. If 0, Data applies.
+	DataSrcToDest int64
+	// DataDestToSrc is the limit of data relayed from the destination of the connection to the
+	// peer that requested it. If 0, Data applies.
+	DataDestToSrc int64
+}
+
+// srcToDest returns the limit of data relayed from the source to the destination.
+func (l *RelayLimit) srcToDest() int64 {
+	if l.DataSrcToDest > 0 {
+		return l.DataSrcToDest
+	}
+	return l.Data
+}
+
+// destToSrc returns the limit of data relayed from the destination to the source.
+func (l *RelayLimit) destToSrc() int64 {
+	if l.DataDestToSrc > 0 {
+		return l.DataDestToSrc
+	}
+	return l.Data
 }
 
+// LimitExhaustedBehavior is how a relayed connection is ended when its data limit is reached.
+type LimitExhaustedBehavior int
+
+const (
+	// LimitExhaustedClose closes the direction of the relayed connection that reached the limit,
+	// so the receiving peer sees a clean EOF.
+	LimitExhaustedClose LimitExhaustedBehavior = iota
+	// LimitExhaustedReset resets the relayed connection, so both peers abort immediately.
+	LimitExhaustedReset
+)
+
 // DefaultResources returns a Resources object with the default filled in.
 func DefaultResources() Resources {
 	return Resources{
 		Limit: DefaultLimit(),
 
-		ReservationTTL: time.Hour,
+		ReservationTTL:    time.Hour,
+		MinReservationTTL: time.Minute,
+
+		ReservationRenewFraction: 0.75,
 
 		MaxReservations: 128,
 		MaxCircuits:     16,
@@ -59,6 +158,27 @@ func DefaultResources() Resources {
 	}
 }
 
+func (rc *Resources) reserveReadTimeout() time.Duration {
+	if rc.ReserveReadTimeout > 0 {
+		return rc.ReserveReadTimeout
+	}
+	return StreamTimeout
+}
+
+func (rc *Resources) stopHandshakeTimeout() time.Duration {
+	if rc.StopHandshakeTimeout > 0 {
+		return rc.StopHandshakeTimeout
+	}
+	return HandshakeTimeout
+}
+
+func (rc *Resources) responseWriteTimeout() time.Duration {
+	if rc.ResponseWriteTimeout > 0 {
+		return rc.ResponseWriteTimeout
+	}
+	return StreamTimeout
+}
+
 // DefaultLimit returns a RelayLimit object with the defaults filled in.
 func DefaultLimit() *RelayLimit {
 	return &RelayLimit{
@@ -0,0 +1,274 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+)
+
+// failingWriteStream fails the first failures writes with err, or with a timeout if err is nil.
+type failingWriteStream struct {
+	network.Stream
+	err error
+
+	mx       sync.Mutex
+	failures int
+}
+
+func (s *failingWriteStream) Write(b []byte) (int, error) {
+	s.mx.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mx.Unlock()
+		if s.err != nil {
+			return 0, s.err
+		}
+		return 0, os.ErrDeadlineExceeded
+	}
+	s.mx.Unlock()
+	return s.Stream.Write(b)
+}
+
+type responseMetricsTracer struct {
+	metricsTracer
+
+	mx                 sync.Mutex
+	opened, closed     int
+	responseWriteFails int
+}
+
+func (mt *responseMetricsTracer) ConnectionOpenedWithTraceID(string) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.opened++
+}
+
+func (mt *responseMetricsTracer) ConnectionClosedWithTraceID(time.Duration, string) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.closed++
+}
+
+func (mt *responseMetricsTracer) ConnectResponseWriteFailed() {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.responseWriteFails++
+}
+
+func (mt *responseMetricsTracer) counts() (opened, closed, responseWriteFails int) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	return mt.opened, mt.closed, mt.responseWriteFails
+}
+
+func TestConnectResponseWriteFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		retry    bool
+		failures int
+		err      error
+		ok       bool
+	}{
+		{name: "no retry", retry: false, failures: 1, ok: false},
+		{name: "retry succeeds", retry: true, failures: 1, ok: true},
+		{name: "retry fails", retry: true, failures: 2, ok: false},
+		{name: "reset not retried", retry: true, failures: 1, err: network.ErrReset, ok: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			mt := &responseMetricsTracer{}
+			r, err := New(relayHost, WithMetricsTracer(mt), WithConnectResponseRetry(tc.retry))
+			require.NoError(t, err)
+			defer r.Close()
+
+			handleStopEcho(dest)
+			_, err = reserve(t, dest, relayHost)
+			require.NoError(t, err)
+
+			// the only write on the hop stream of a successful connection is the response
+			relayHost.SetStreamHandler(proto.ProtoIDv2Hop, func(s network.Stream) {
+				r.handleStream(&failingWriteStream{Stream: s, err: tc.err, failures: tc.failures})
+			})
+
+			require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+			s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+			require.NoError(t, err)
+			defer s.Reset()
+			require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{
+				Type: pbv2.HopMessage_CONNECT.Enum(),
+				Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest.ID()}),
+			}))
+			var resp pbv2.HopMessage
+			err = util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp)
+
+			if tc.ok {
+				require.NoError(t, err)
+				require.Equal(t, pbv2.Status_OK, resp.GetStatus())
+				opened, closed, fails := mt.counts()
+				require.Equal(t, 1, opened)
+				require.Zero(t, closed)
+				require.Zero(t, fails)
+				return
+			}
+
+			require.Error(t, err)
+			require.Eventually(t, func() bool {
+				_, closed, _ := mt.counts()
+				return closed == 1
+			}, time.Second, 10*time.Millisecond)
+			// give a duplicate cleanup the chance to run
+			time.Sleep(50 * time.Millisecond)
+			opened, closed, fails := mt.counts()
+			require.Equal(t, 1, opened)
+			require.Equal(t, 1, closed)
+			require.Equal(t, 1, fails)
+
+			r.mx.Lock()
+			defer r.mx.Unlock()
+			require.Empty(t, r.conns)
+		})
+	}
+}
+
+// shortWriteStream accepts only the first accept bytes of its first write, failing it with err.
+type shortWriteStream struct {
+	network.Stream
+	accept int
+	err    error
+
+	mx      sync.Mutex
+	written bool
+}
+
+func (s *shortWriteStream) Write(b []byte) (int, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.written || len(b) <= s.accept {
+		return s.Stream.Write(b)
+	}
+	s.written = true
+	n, err := s.Stream.Write(b[:s.accept])
+	if err != nil {
+		return n, err
+	}
+	return n, s.err
+}
+
+type shortWriteMetricsTracer struct {
+	metricsTracer
+	shortWrites atomic.Int32
+}
+
+func (mt *shortWriteMetricsTracer) ResponseWriteShort() {
+	mt.shortWrites.Add(1)
+}
+
+func TestResponseShortWrite(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{name: "with error", err: errors.New("injected write failure")},
+		{name: "without error"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, src := hosts[0], hosts[1]
+
+			mt := &shortWriteMetricsTracer{}
+			r, err := New(relayHost, WithMetricsTracer(mt))
+			require.NoError(t, err)
+			defer r.Close()
+
+			relayHost.SetStreamHandler(proto.ProtoIDv2Hop, func(s network.Stream) {
+				r.handleStream(&shortWriteStream{Stream: s, accept: 2, err: tc.err})
+			})
+
+			// the relay refuses the request, as there is no reservation for the destination
+			require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+			s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+			require.NoError(t, err)
+			defer s.Reset()
+			require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{
+				Type: pbv2.HopMessage_CONNECT.Enum(),
+				Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: test.RandPeerIDFatal(t)}),
+			}))
+
+			// the client sees the stream reset, rather than a truncated message
+			var resp pbv2.HopMessage
+			err = util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp)
+			require.ErrorIs(t, err, network.ErrReset)
+			require.Equal(t, int32(1), mt.shortWrites.Load())
+		})
+	}
+}
+
+// scriptedWriteStream returns the scripted results of its writes.
+type scriptedWriteStream struct {
+	network.Stream
+	results   []error
+	partial   bool
+	writes    int
+	deadlines []time.Time
+}
+
+func (s *scriptedWriteStream) Write(b []byte) (int, error) {
+	err := s.results[s.writes]
+	s.writes++
+	if err != nil && s.partial {
+		return len(b) / 2, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (s *scriptedWriteStream) SetWriteDeadline(t time.Time) error {
+	s.deadlines = append(s.deadlines, t)
+	return nil
+}
+
+func TestRetryWriter(t *testing.T) {
+	b := []byte("response")
+
+	t.Run("timeout", func(t *testing.T) {
+		s := &scriptedWriteStream{results: []error{os.ErrDeadlineExceeded, nil}}
+		n, err := (&retryWriter{s: s, timeout: time.Minute}).Write(b)
+		require.NoError(t, err)
+		require.Equal(t, len(b), n)
+		require.Equal(t, 2, s.writes)
+		// the retry gets a fresh deadline
+		require.Len(t, s.deadlines, 1)
+		require.True(t, s.deadlines[0].After(time.Now()))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		s := &scriptedWriteStream{results: []error{network.ErrReset, nil}}
+		_, err := (&retryWriter{s: s, timeout: time.Minute}).Write(b)
+		require.ErrorIs(t, err, network.ErrReset)
+		require.Equal(t, 1, s.writes)
+	})
+
+	t.Run("partial write", func(t *testing.T) {
+		s := &scriptedWriteStream{results: []error{os.ErrDeadlineExceeded, nil}, partial: true}
+		n, err := (&retryWriter{s: s, timeout: time.Minute}).Write(b)
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		require.Equal(t, len(b)/2, n)
+		require.Equal(t, 1, s.writes)
+	})
+}
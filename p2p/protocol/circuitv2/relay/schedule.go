@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Schedule decides when relay service is available to a peer.
+type Schedule interface {
+	// Open returns true if relay service is available at t.
+	Open(t time.Time) bool
+}
+
+// ScheduleFunc is a function implementing Schedule.
+type ScheduleFunc func(t time.Time) bool
+
+// Open implements Schedule.
+func (f ScheduleFunc) Open(t time.Time) bool {
+	return f(t)
+}
+
+// ScheduleWindow is a daily window of a WeeklySchedule.
+type ScheduleWindow struct {
+	// Days are the days of the week the window is open on; if empty, the window is open every
+	// day.
+	Days []time.Weekday
+	// Start and End are the times of day, as offsets from midnight, between which the window is
+	// open. The window includes Start and excludes End. If End is before Start, the window closes
+	// at End on the next day.
+	Start, End time.Duration
+}
+
+// WeeklySchedule is a Schedule open during a set of windows repeating every week, such as
+// business hours.
+type WeeklySchedule struct {
+	// Location is the time zone of the windows; if nil, UTC is used.
+	Location *time.Location
+	// Windows are the windows the schedule is open in.
+	Windows []ScheduleWindow
+}
+
+var _ Schedule = WeeklySchedule{}
+
+// Open implements Schedule.
+func (s WeeklySchedule) Open(t time.Time) bool {
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	offset := t.Sub(midnight)
+	yesterday := midnight.AddDate(0, 0, -1).Weekday()
+
+	for _, w := range s.Windows {
+		if w.Start <= w.End {
+			if w.openOn(t.Weekday()) && offset >= w.Start && offset < w.End {
+				return true
+			}
+			continue
+		}
+		// the window spans midnight: t is either in the part starting today, or in the part
+		// ending today of the window that started yesterday
+		if w.openOn(t.Weekday()) && offset >= w.Start {
+			return true
+		}
+		if w.openOn(yesterday) && offset < w.End {
+			return true
+		}
+	}
+	return false
+}
+
+func (w ScheduleWindow) openOn(day time.Weekday) bool {
+	return len(w.Days) == 0 || slices.Contains(w.Days, day)
+}
+
+// scheduleOpen returns true if the relay service schedule of p, if any, is open at t.
+func (r *Relay) scheduleOpen(p peer.ID, t time.Time) bool {
+	if r.schedule == nil {
+		return true
+	}
+	s := r.schedule(p)
+	return s == nil || s.Open(t)
+}
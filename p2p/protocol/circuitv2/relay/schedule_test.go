@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeeklySchedule(t *testing.T) {
+	businessHours := ScheduleWindow{
+		Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start: 9 * time.Hour,
+		End:   17 * time.Hour,
+	}
+	overnight := ScheduleWindow{Days: []time.Weekday{time.Saturday}, Start: 22 * time.Hour, End: 2 * time.Hour}
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s := WeeklySchedule{Location: loc, Windows: []ScheduleWindow{businessHours, overnight}}
+
+	for _, tc := range []struct {
+		t    time.Time
+		open bool
+	}{
+		// 2024-01-01 is a Monday
+		{time.Date(2024, 1, 1, 9, 0, 0, 0, loc), true},
+		{time.Date(2024, 1, 1, 16, 59, 0, 0, loc), true},
+		{time.Date(2024, 1, 1, 17, 0, 0, 0, loc), false},
+		{time.Date(2024, 1, 1, 8, 59, 0, 0, loc), false},
+		// the schedule's location applies
+		{time.Date(2024, 1, 1, 7, 30, 0, 0, time.UTC), true},
+		{time.Date(2024, 1, 1, 15, 30, 0, 0, time.UTC), false},
+		// weekend
+		{time.Date(2024, 1, 6, 12, 0, 0, 0, loc), false},
+		{time.Date(2024, 1, 6, 23, 0, 0, 0, loc), true},
+		// the overnight window ends on Sunday
+		{time.Date(2024, 1, 7, 1, 0, 0, 0, loc), true},
+		{time.Date(2024, 1, 7, 2, 0, 0, 0, loc), false},
+		{time.Date(2024, 1, 7, 23, 0, 0, 0, loc), false},
+	} {
+		require.Equal(t, tc.open, s.Open(tc.t), "at %s", tc.t)
+	}
+
+	require.False(t, WeeklySchedule{}.Open(time.Now()))
+}
+
+// scheduleAround returns a schedule that is open around now if open is true, and closed around
+// now otherwise.
+func scheduleAround(now time.Time, open bool) Schedule {
+	midnight := now.Truncate(24 * time.Hour)
+	offset := now.Sub(midnight)
+	if open {
+		return WeeklySchedule{Windows: []ScheduleWindow{{Start: (offset - time.Hour + 24*time.Hour) % (24 * time.Hour), End: (offset + time.Hour) % (24 * time.Hour)}}}
+	}
+	return WeeklySchedule{Windows: []ScheduleWindow{{Start: (offset + time.Hour) % (24 * time.Hour), End: (offset + 2*time.Hour) % (24 * time.Hour)}}}
+}
+
+func TestReservationSchedule(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, open, closed := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	now := time.Now().UTC()
+	var openClosed atomic.Bool
+	schedules := map[peer.ID]Schedule{
+		open.ID(): ScheduleFunc(func(t time.Time) bool {
+			return !openClosed.Load() && scheduleAround(now, true).Open(t)
+		}),
+		closed.ID(): scheduleAround(now, false),
+	}
+	r, err := New(relayHost, WithReservationSchedule(func(p peer.ID) Schedule { return schedules[p] }))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, src, relayHost)
+	require.NoError(t, err)
+
+	handleStopEcho(open)
+	_, err = reserve(t, open, relayHost)
+	require.NoError(t, err)
+	_, status := connectRaw(t, src, relayHost, open.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	_, err = reserve(t, closed, relayHost)
+	var rerr client.ReservationError
+	require.ErrorAs(t, err, &rerr)
+	require.Equal(t, pbv2.Status_RESERVATION_REFUSED, rerr.Status)
+	require.False(t, r.hasReservation(closed.ID()))
+
+	// the reservation of a peer isn't valid outside its schedule
+	openClosed.Store(true)
+	_, status = connectRaw(t, src, relayHost, open.ID())
+	require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+	require.True(t, r.hasReservation(open.ID()))
+
+	_, err = New(relayHost, WithReservationSchedule(nil))
+	require.Error(t, err)
+}
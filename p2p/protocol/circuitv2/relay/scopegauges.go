@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+)
+
+// Names of the gauges published to the relay's resource manager service scope with
+// WithScopeGauges.
+const (
+	ScopeGaugeReservations = "reservations"
+	ScopeGaugeCircuits     = "circuits"
+)
+
+// scopeGauges periodically publishes the relay's reservation and circuit counts to its service
+// scope.
+type scopeGauges struct {
+	interval time.Duration
+	done     chan struct{}
+}
+
+// runScopeGauges publishes the counts every interval until the relay is closed. Close publishes
+// zero counts once it returns.
+func (r *Relay) runScopeGauges(g *scopeGauges) {
+	defer close(g.done)
+
+	r.publishScopeGauges()
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.publishScopeGauges()
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// publishScopeGauges publishes the current reservation and circuit counts.
+func (r *Relay) publishScopeGauges() {
+	r.mx.Lock()
+	reservations := len(r.rsvp)
+	r.mx.Unlock()
+
+	r.setScopeGauges(int64(reservations), r.stats.circuits.Load())
+}
+
+// setScopeGauges sets the gauges of the relay's service scope, if the host's resource manager
+// supports service gauges.
+func (r *Relay) setScopeGauges(reservations, circuits int64) {
+	r.host.Network().ResourceManager().ViewService(ServiceName,
+		func(s network.ServiceScope) error {
+			if g, ok := s.(rcmgr.ServiceScopeGauges); ok {
+				g.SetGauge(ScopeGaugeReservations, reservations)
+				g.SetGauge(ScopeGaugeCircuits, circuits)
+			}
+			return nil
+		})
+}
@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeGauges(t *testing.T) {
+	rm, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(rcmgr.InfiniteLimits))
+	require.NoError(t, err)
+	defer rm.Close()
+
+	relayHost := getTestHosts(t, 1, swarmt.WithSwarmOpts(swarm.WithResourceManager(rm)))[0]
+	hosts := getTestHosts(t, 2)
+	src, dest := hosts[0], hosts[1]
+
+	r, err := New(relayHost, WithScopeGauges(10*time.Millisecond))
+	require.NoError(t, err)
+
+	gauges := func() map[string]int64 {
+		var g map[string]int64
+		rm.ViewService(ServiceName, func(s network.ServiceScope) error {
+			g = s.(rcmgr.ServiceScopeGauges).Gauges()
+			return nil
+		})
+		return g
+	}
+	requireGauges := func(reservations, circuits int64) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			g := gauges()
+			return g[ScopeGaugeReservations] == reservations && g[ScopeGaugeCircuits] == circuits
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	requireGauges(0, 0)
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	requireGauges(1, 0)
+
+	s, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+	requireGauges(1, 1)
+
+	s.Reset()
+	requireGauges(1, 0)
+
+	// closing the relay clears the gauges
+	require.NoError(t, r.Close())
+	require.Equal(t, map[string]int64{ScopeGaugeReservations: 0, ScopeGaugeCircuits: 0}, gauges())
+}
+
+func TestScopeGaugesInterval(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+	_, err := New(h, WithScopeGauges(0))
+	require.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ACLSessioner is an optional interface for ACLFilters that assign reservations a session ID of
+// an external system, e.g. to correlate relay usage with billing records. The session ID is
+// evaluated whenever a peer reserves a slot, including when it renews its reservation, and is
+// reported with the audit events of the reservation and of the connections relayed to its
+// holder, and with the active connections returned by Circuits. It is not used as a metrics
+// label, as the number of sessions is unbounded.
+type ACLSessioner interface {
+	// ReservationSession returns the session ID of a reservation from a peer with the given peer
+	// ID and multiaddr, or false if the reservation has no session ID.
+	ReservationSession(p peer.ID, a ma.Multiaddr) (session string, ok bool)
+}
+
+var _ ACLSessioner = &aclChain{}
+
+// ReservationSession returns the session ID of the first filter assigning one.
+func (c *aclChain) ReservationSession(p peer.ID, a ma.Multiaddr) (string, bool) {
+	for _, f := range c.filters {
+		if s, ok := f.(ACLSessioner); ok {
+			if session, ok := s.ReservationSession(p, a); ok {
+				return session, true
+			}
+		}
+	}
+	return "", false
+}
+
+// reservationSession consults the relay's ACL for the session ID of a reservation.
+func (r *Relay) reservationSession(p peer.ID, a ma.Multiaddr) string {
+	s, ok := r.acl.(ACLSessioner)
+	if !ok {
+		return ""
+	}
+	session, _ := s.ReservationSession(p, a)
+	return session
+}
@@ -0,0 +1,118 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// sessionACL allows everything and assigns the sessions set for peers.
+type sessionACL struct {
+	sessions map[peer.ID]string
+}
+
+func (a *sessionACL) AllowReserve(peer.ID, ma.Multiaddr) bool          { return true }
+func (a *sessionACL) AllowConnect(peer.ID, ma.Multiaddr, peer.ID) bool { return true }
+
+func (a *sessionACL) ReservationSession(p peer.ID, _ ma.Multiaddr) (string, bool) {
+	session, ok := a.sessions[p]
+	return session, ok
+}
+
+type closedAuditLogger struct {
+	establishedAuditLogger
+}
+
+func (l *closedAuditLogger) ConnectionClosed(ev AuditEvent) {
+	l.record("connection closed", ev)
+}
+
+func TestReservationSession(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	acl := &sessionACL{sessions: map[peer.ID]string{dest.ID(): "billing-42"}}
+	l := &closedAuditLogger{}
+	r, err := New(relayHost, WithACL(ChainACL(acl)), WithAuditLogger(l))
+	require.NoError(t, err)
+	defer r.Close()
+
+	srv := httptest.NewServer(r.AdminHandler())
+	defer srv.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+
+	circuits := r.Circuits()
+	require.Len(t, circuits, 1)
+	require.Equal(t, "billing-42", circuits[0].Session)
+
+	var listed []CircuitInfo
+	getAdminJSON(t, srv, "/circuits", &listed)
+	require.Len(t, listed, 1)
+	require.Equal(t, circuits[0].ID, listed[0].ID)
+	require.Equal(t, "billing-42", listed[0].Session)
+
+	require.NoError(t, r.CloseCircuit(circuits[0].ID))
+
+	var events []recordedAuditEvent
+	require.Eventually(t, func() bool {
+		events = l.Events()
+		return len(events) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	for i, event := range []string{"reservation granted", "connection allowed", "connection established", "connection closed"} {
+		require.Equal(t, event, events[i].event)
+		require.Equal(t, "billing-42", events[i].ev.Session, event)
+	}
+	require.Equal(t, src.ID(), events[3].ev.Peer)
+	require.Equal(t, dest.ID(), events[3].ev.Destination)
+	require.False(t, events[3].ev.Time.Before(events[2].ev.Time))
+}
+
+func TestReservationWebhookSession(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, withSession, withoutSession := hosts[0], hosts[1], hosts[2]
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body ReservationWebhookRequest
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		res := ReservationWebhookResponse{Allow: true}
+		if body.Peer == withSession.ID() {
+			res.Session = "webhook"
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv.Close()
+
+	acl := &sessionACL{sessions: map[peer.ID]string{withSession.ID(): "acl", withoutSession.ID(): "acl"}}
+	l := &recordingAuditLogger{}
+	r, err := New(relayHost, WithACL(acl), WithReservationWebhook(srv.URL, time.Second, false), WithAuditLogger(l))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, withSession, relayHost)
+	require.NoError(t, err)
+	_, err = reserve(t, withoutSession, relayHost)
+	require.NoError(t, err)
+
+	var events []recordedAuditEvent
+	require.Eventually(t, func() bool {
+		events = l.Events()
+		return len(events) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	// the webhook's session ID takes precedence over the ACL's
+	require.Equal(t, "webhook", events[0].ev.Session)
+	require.Equal(t, "acl", events[1].ev.Session)
+}
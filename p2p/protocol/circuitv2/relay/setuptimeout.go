@@ -0,0 +1,29 @@
+package relay
+
+import (
+	"context"
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// errSetupTimeout is the cause of the context of a connection request that wasn't set up
+// within Resources.SetupTimeout.
+var errSetupTimeout = errors.New("circuit setup timed out")
+
+// setupAborted returns true if the connection request of ctx was aborted, because its source
+// disconnected or it wasn't set up in time.
+func setupAborted(ctx context.Context) bool {
+	cause := context.Cause(ctx)
+	return errors.Is(cause, errSourceDisconnected) || errors.Is(cause, errSetupTimeout)
+}
+
+// resetOnSetupAbort resets s if the connection request of ctx is aborted, as the handshakes on s
+// don't observe ctx. Calling stop returns false if s has been reset.
+func resetOnSetupAbort(ctx context.Context, s network.Stream) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		if setupAborted(ctx) {
+			s.Reset()
+		}
+	})
+}
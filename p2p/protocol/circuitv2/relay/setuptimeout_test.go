@@ -0,0 +1,63 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupTimeout(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	const setupTimeout = 200 * time.Millisecond
+	rc := DefaultResources()
+	rc.SetupTimeout = setupTimeout
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	// the destination stalls the stop handshake
+	stopStreams := make(chan network.Stream, 1)
+	dest.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		var msg pbv2.StopMessage
+		if err := util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		stopStreams <- s
+	})
+
+	start := time.Now()
+	_, status := connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_CONNECTION_FAILED, status)
+	elapsed := time.Since(start)
+	require.GreaterOrEqual(t, elapsed, setupTimeout)
+	require.Less(t, elapsed, 5*time.Second)
+
+	// the stalled stop stream was reset and the circuit cleaned up
+	var bs network.Stream
+	select {
+	case bs = <-stopStreams:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay didn't open a stop stream")
+	}
+	bs.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = bs.Read(make([]byte, 1))
+	require.ErrorIs(t, err, network.ErrReset)
+	require.Eventually(t, func() bool { return r.Stats().Circuits == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// circuits set up in time are unaffected
+	dest.RemoveStreamHandler(proto.ProtoIDv2Stop)
+	handleStopEcho(dest)
+	_, status = connectRaw(t, src, relayHost, dest.ID())
+	require.Equal(t, pbv2.Status_OK, status)
+}
@@ -0,0 +1,42 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireSourceReservation(t *testing.T) {
+	for _, reserved := range []bool{true, false} {
+		name := "unreserved source"
+		if reserved {
+			name = "reserved source"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 3)
+			relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+			r, err := New(relayHost, WithRequireSourceReservation(true))
+			require.NoError(t, err)
+			defer r.Close()
+
+			addCircuitTransport(t, src)
+			addCircuitTransport(t, dest)
+			dest.SetStreamHandler("test", func(s network.Stream) { s.Close() })
+
+			if reserved {
+				_, err := reserve(t, src, relayHost)
+				require.NoError(t, err)
+			}
+
+			s, err := openCircuit(t, src, dest, relayHost, "test")
+			if reserved {
+				require.NoError(t, err)
+				s.Close()
+			} else {
+				require.ErrorContains(t, err, "NO_RESERVATION")
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package relay
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// errSourceDisconnected is the cause of the context of a connection request whose source
+// disconnected before the circuit was established.
+var errSourceDisconnected = errors.New("source disconnected")
+
+// connWatch calls the functions registered for a connection once it closes, so that pending
+// connection requests from a source that went away can be aborted.
+type connWatch struct {
+	mx   sync.Mutex
+	next uint64
+	m    map[network.Conn]map[uint64]func()
+}
+
+func newConnWatch() *connWatch {
+	return &connWatch{m: make(map[network.Conn]map[uint64]func())}
+}
+
+// Watch registers f to be called when c closes. f is called at most once, and not at all after
+// the returned function is called. If c is already closed, f is called right away.
+func (w *connWatch) Watch(c network.Conn, f func()) (unwatch func()) {
+	w.mx.Lock()
+	id := w.next
+	w.next++
+	fs, ok := w.m[c]
+	if !ok {
+		fs = make(map[uint64]func())
+		w.m[c] = fs
+	}
+	fs[id] = f
+	w.mx.Unlock()
+
+	// the connection may have closed before we registered, in which case we missed the
+	// notification
+	if c.IsClosed() {
+		w.Closed(c)
+	}
+
+	return func() {
+		w.mx.Lock()
+		defer w.mx.Unlock()
+		if fs, ok := w.m[c]; ok {
+			delete(fs, id)
+			if len(fs) == 0 {
+				delete(w.m, c)
+			}
+		}
+	}
+}
+
+// Closed calls and removes the functions registered for c.
+func (w *connWatch) Closed(c network.Conn) {
+	w.mx.Lock()
+	fs := w.m[c]
+	delete(w.m, c)
+	w.mx.Unlock()
+
+	for _, f := range fs {
+		f()
+	}
+}
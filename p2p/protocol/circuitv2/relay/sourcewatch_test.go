@@ -0,0 +1,74 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceDisconnectDuringHandshake(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	// the destination never completes the stop handshake
+	stopStreams := make(chan network.Stream, 1)
+	dest.SetStreamHandler(proto.ProtoIDv2Stop, func(s network.Stream) {
+		var msg pbv2.StopMessage
+		if err := util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		stopStreams <- s
+	})
+
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{
+		Type: pbv2.HopMessage_CONNECT.Enum(),
+		Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest.ID()}),
+	}))
+
+	var bs network.Stream
+	select {
+	case bs = <-stopStreams:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay didn't open a stop stream")
+	}
+	defer bs.Reset()
+
+	require.NoError(t, src.Network().ClosePeer(relayHost.ID()))
+
+	// the relay resets the stop stream well before the handshake times out
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := bs.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	select {
+	case err := <-readErr:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay didn't abort the stop handshake")
+	}
+
+	require.Eventually(t, func() bool {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		return len(r.conns) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
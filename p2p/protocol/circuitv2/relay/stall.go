@@ -0,0 +1,25 @@
+package relay
+
+import (
+	"io"
+	"time"
+)
+
+// DefaultStallThreshold is the default duration a write to the destination of a relayed
+// connection may block before it is recorded as a stall.
+const DefaultStallThreshold = time.Second
+
+// write writes buf to dst, reporting the write to the metrics tracer as a stall if it blocks
+// for longer than the stall threshold.
+func (r *Relay) write(dst io.Writer, buf []byte) (int, error) {
+	mt, ok := r.metricsTracer.(TransferMetricsTracer)
+	if !ok || r.stallThreshold <= 0 {
+		return dst.Write(buf)
+	}
+	start := time.Now()
+	n, err := dst.Write(buf)
+	if d := time.Since(start); d > r.stallThreshold {
+		mt.CircuitStalled(d)
+	}
+	return n, err
+}
@@ -0,0 +1,184 @@
+package relay
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type stallMetricsTracer struct {
+	metricsTracer
+
+	mx         sync.Mutex
+	stalls     []time.Duration
+	copyStalls int
+}
+
+func (mt *stallMetricsTracer) CircuitStalled(d time.Duration) {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.stalls = append(mt.stalls, d)
+}
+
+func (mt *stallMetricsTracer) CopyStall() {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.copyStalls++
+}
+
+func (mt *stallMetricsTracer) CopyStalls() int {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	return mt.copyStalls
+}
+
+func (mt *stallMetricsTracer) Stalls() []time.Duration {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	return append([]time.Duration(nil), mt.stalls...)
+}
+
+// slowWriter blocks every write whose index is in slow for the given delay.
+type slowWriter struct {
+	bytes.Buffer
+	delay  time.Duration
+	slow   map[int]bool
+	writes int
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	if w.slow[w.writes] {
+		time.Sleep(w.delay)
+	}
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+// chunkReader returns its data one byte per read.
+type chunkReader struct {
+	data []byte
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b[:1], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// emptyReader returns no data and no error for empty reads before every byte of data, and for
+// every read once data is exhausted.
+type emptyReader struct {
+	data  []byte
+	empty int
+	reads int
+}
+
+func (r *emptyReader) Read(b []byte) (int, error) {
+	r.reads++
+	if len(r.data) == 0 || r.reads%(r.empty+1) != 0 {
+		return 0, nil
+	}
+	n := copy(b[:1], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestCopyWithBufferRecordsStalls(t *testing.T) {
+	const threshold = 50 * time.Millisecond
+
+	mt := &stallMetricsTracer{}
+	r := &Relay{metricsTracer: mt, stallThreshold: threshold}
+	dst := &slowWriter{delay: 2 * threshold, slow: map[int]bool{1: true, 3: true}}
+
+	n, err := r.copyWithBuffer(dst, &chunkReader{data: []byte("hello")}, make([]byte, 16), nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n)
+	require.Equal(t, "hello", dst.String())
+
+	stalls := mt.Stalls()
+	require.Len(t, stalls, 2)
+	for _, d := range stalls {
+		require.Greater(t, d, threshold)
+	}
+}
+
+func TestCopyWithBufferStallTrackingDisabled(t *testing.T) {
+	mt := &stallMetricsTracer{}
+	r := &Relay{metricsTracer: mt}
+	dst := &slowWriter{delay: 10 * time.Millisecond, slow: map[int]bool{0: true}}
+
+	_, err := r.copyWithBuffer(dst, &chunkReader{data: []byte("hi")}, make([]byte, 16), nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, mt.Stalls())
+}
+
+func TestWithStallThreshold(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+
+	r, err := New(h)
+	require.NoError(t, err)
+	require.Equal(t, DefaultStallThreshold, r.stallThreshold)
+	r.Close()
+
+	r, err = New(h, WithStallThreshold(0))
+	require.NoError(t, err)
+	require.Zero(t, r.stallThreshold)
+	r.Close()
+
+	_, err = New(h, WithStallThreshold(-time.Second))
+	require.Error(t, err)
+}
+
+func TestCopyWithBufferAbortsOnEmptyReads(t *testing.T) {
+	mt := &stallMetricsTracer{}
+	r := &Relay{metricsTracer: mt, maxEmptyReads: 10}
+	src := &emptyReader{data: []byte("hi"), empty: 9}
+	var dst bytes.Buffer
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.copyWithBuffer(&dst, src, make([]byte, 16), nil, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, io.ErrNoProgress)
+	case <-time.After(5 * time.Second):
+		t.Fatal("copy loop didn't abort")
+	}
+
+	// the empty reads before each byte don't add up, only those after the data is exhausted
+	require.Equal(t, "hi", dst.String())
+	require.Equal(t, 2*10+10, src.reads)
+	require.Equal(t, 1, mt.CopyStalls())
+}
+
+func TestWithMaxEmptyReads(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+
+	// the check is opt-in
+	r, err := New(h)
+	require.NoError(t, err)
+	require.Zero(t, r.maxEmptyReads)
+	r.Close()
+
+	r, err = New(h, WithMaxEmptyReads(100))
+	require.NoError(t, err)
+	require.Equal(t, 100, r.maxEmptyReads)
+	r.Close()
+
+	r, err = New(h, WithMaxEmptyReads(0))
+	require.NoError(t, err)
+	require.Zero(t, r.maxEmptyReads)
+	r.Close()
+
+	_, err = New(h, WithMaxEmptyReads(-1))
+	require.Error(t, err)
+}
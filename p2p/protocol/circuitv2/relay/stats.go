@@ -0,0 +1,48 @@
+package relay
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the relay's activity.
+type Stats struct {
+	// Reservations is the number of active reservations.
+	Reservations int
+	// Circuits is the number of open relayed connections, including those still being
+	// established.
+	Circuits int
+	// CircuitsOpened is the number of relayed connections opened since the relay started.
+	CircuitsOpened uint64
+	// BytesRelayed is the number of bytes relayed in both directions since the relay started.
+	BytesRelayed uint64
+	// Refusals is the number of reservation, connection and probe requests refused since the
+	// relay started.
+	Refusals uint64
+	// Connects are the outcomes of connection requests over the last ConnectStatsWindow.
+	Connects ConnectStats
+}
+
+// relayStats are the counters backing Stats.
+type relayStats struct {
+	circuits       atomic.Int64
+	circuitsOpened atomic.Uint64
+	bytesRelayed   atomic.Uint64
+	refusals       atomic.Uint64
+}
+
+// Stats returns a snapshot of the relay's activity.
+func (r *Relay) Stats() Stats {
+	r.mx.Lock()
+	reservations := len(r.rsvp)
+	r.mx.Unlock()
+
+	return Stats{
+		Reservations:   reservations,
+		Circuits:       int(r.stats.circuits.Load()),
+		CircuitsOpened: r.stats.circuitsOpened.Load(),
+		BytesRelayed:   r.stats.bytesRelayed.Load(),
+		Refusals:       r.stats.refusals.Load(),
+		Connects:       r.connectStats.relay(time.Now()),
+	}
+}
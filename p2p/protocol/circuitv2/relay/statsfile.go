@@ -0,0 +1,63 @@
+package relay
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statsFile periodically writes the relay's stats to a JSON file.
+type statsFile struct {
+	path     string
+	interval time.Duration
+	done     chan struct{}
+}
+
+// runStatsFile writes the stats every interval until the relay is closed. Close writes the final
+// stats once it returns.
+func (r *Relay) runStatsFile(f *statsFile) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.writeStatsFile(f.path)
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// writeStatsFile replaces the file at path with the current stats. Failures are logged, as the
+// stats file is best effort.
+func (r *Relay) writeStatsFile(path string) {
+	if err := writeFileAtomic(path, r.Stats()); err != nil {
+		log.Warn("failed to write relay stats file", "path", path, "err", err)
+	}
+}
+
+// writeFileAtomic writes v as JSON to a temporary file next to path and renames it to path, so
+// that readers never see a partially written file.
+func writeFileAtomic(path string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/stretchr/testify/require"
+)
+
+func readStatsFile(t *testing.T, path string) (Stats, bool) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Stats{}, false
+	}
+	require.NoError(t, err)
+	var stats Stats
+	require.NoError(t, json.Unmarshal(b, &stats))
+	return stats, true
+}
+
+func TestStatsFile(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+	addCircuitTransport(t, src)
+	addCircuitTransport(t, dest)
+	dest.SetStreamHandler("/echo", func(s network.Stream) {
+		defer s.Close()
+		io.Copy(s, s)
+	})
+
+	path := filepath.Join(t.TempDir(), "stats.json")
+	rc := DefaultResources()
+	rc.MaxReservations = 1
+	r, err := New(relayHost, WithResources(rc), WithStatsFile(path, 10*time.Millisecond))
+	require.NoError(t, err)
+
+	s, err := openCircuit(t, src, dest, relayHost, "/echo")
+	require.NoError(t, err)
+	_, err = s.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(s, make([]byte, 5))
+	require.NoError(t, err)
+
+	// refused, as dest holds the only reservation
+	_, err = reserve(t, src, relayHost)
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool {
+		stats, ok := readStatsFile(t, path)
+		return ok && stats.Reservations == 1 && stats.Circuits == 1 && stats.CircuitsOpened == 1 &&
+			stats.BytesRelayed >= 10 && stats.Refusals == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, src.Network().ClosePeer(dest.ID()))
+	require.Eventually(t, func() bool { return r.Stats().Circuits == 0 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, r.Close())
+
+	// the final stats are written on close
+	stats, ok := readStatsFile(t, path)
+	require.True(t, ok)
+	require.Zero(t, stats.Reservations)
+	require.Equal(t, r.Stats(), stats)
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestStatsFileWriteError(t *testing.T) {
+	hosts := getTestHosts(t, 1)
+
+	path := filepath.Join(t.TempDir(), "missing", "stats.json")
+	r, err := New(hosts[0], WithStatsFile(path, 10*time.Millisecond))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, r.Close())
+
+	_, ok := readStatsFile(t, path)
+	require.False(t, ok)
+}
+
+func TestStatsFileOptionErrors(t *testing.T) {
+	hosts := getTestHosts(t, 1)
+	_, err := New(hosts[0], WithStatsFile("", time.Second))
+	require.Error(t, err)
+	_, err = New(hosts[0], WithStatsFile(filepath.Join(t.TempDir(), "stats.json"), 0))
+	require.Error(t, err)
+}
@@ -0,0 +1,131 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+)
+
+// slowStreamResourceManager delays opening outbound streams, and tracks how many are being
+// opened concurrently.
+type slowStreamResourceManager struct {
+	network.NullResourceManager
+	delay time.Duration
+
+	mx      sync.Mutex
+	opening int
+	maxOpen int
+}
+
+func (rm *slowStreamResourceManager) OpenStream(_ peer.ID, dir network.Direction) (network.StreamManagementScope, error) {
+	if dir != network.DirOutbound {
+		return &network.NullScope{}, nil
+	}
+	rm.mx.Lock()
+	rm.opening++
+	rm.maxOpen = max(rm.maxOpen, rm.opening)
+	rm.mx.Unlock()
+
+	time.Sleep(rm.delay)
+
+	rm.mx.Lock()
+	rm.opening--
+	rm.mx.Unlock()
+	return &network.NullScope{}, nil
+}
+
+func (rm *slowStreamResourceManager) maxConcurrent() int {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+	return rm.maxOpen
+}
+
+// connectConcurrently sends a connect request from src to each of dests at once, and returns
+// the response statuses.
+func connectConcurrently(t *testing.T, src, relayHost host.Host, dests []host.Host) []pbv2.Status {
+	t.Helper()
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	statuses := make([]pbv2.Status, len(dests))
+	var wg sync.WaitGroup
+	for i, dest := range dests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = pbv2.Status_CONNECTION_FAILED
+			s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+			if err != nil {
+				return
+			}
+			defer s.Reset()
+			msg := &pbv2.HopMessage{
+				Type: pbv2.HopMessage_CONNECT.Enum(),
+				Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest.ID()}),
+			}
+			if err := util.NewDelimitedWriter(s).WriteMsg(msg); err != nil {
+				return
+			}
+			var resp pbv2.HopMessage
+			if err := util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp); err != nil {
+				return
+			}
+			statuses[i] = resp.GetStatus()
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+func TestMaxConcurrentStopStreams(t *testing.T) {
+	const n = 8
+
+	for _, tc := range []struct {
+		name         string
+		setupTimeout time.Duration
+		refused      bool
+	}{
+		{name: "queued"},
+		{name: "refused", setupTimeout: 150 * time.Millisecond, refused: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rm := &slowStreamResourceManager{delay: 50 * time.Millisecond}
+			relayHost := getTestHosts(t, 1, swarmt.WithSwarmOpts(swarm.WithResourceManager(rm)))[0]
+			hosts := getTestHosts(t, n+1)
+			src, dests := hosts[0], hosts[1:]
+
+			rc := DefaultResources()
+			rc.MaxConcurrentStopStreams = 2
+			rc.SetupTimeout = tc.setupTimeout
+			r, err := New(relayHost, WithResources(rc))
+			require.NoError(t, err)
+			defer r.Close()
+
+			for _, dest := range dests {
+				handleStopEcho(dest)
+				_, err := reserve(t, dest, relayHost)
+				require.NoError(t, err)
+			}
+
+			statuses := connectConcurrently(t, src, relayHost, dests)
+			require.LessOrEqual(t, rm.maxConcurrent(), 2)
+			if !tc.refused {
+				for _, status := range statuses {
+					require.Equal(t, pbv2.Status_OK, status)
+				}
+				require.Equal(t, 2, rm.maxConcurrent())
+				return
+			}
+			require.Contains(t, statuses, pbv2.Status_RESOURCE_LIMIT_EXCEEDED)
+		})
+	}
+}
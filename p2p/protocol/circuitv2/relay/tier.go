@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ReservationTier is a class of service granted to reservations by the ACL.
+type ReservationTier struct {
+	// Name identifies the tier in logs.
+	Name string
+	// Limit is the limit of the connections relayed to the reserving peer. If nil,
+	// Resources.Limit applies.
+	Limit *RelayLimit
+	// TTL is the duration of the reservation. If 0, it is determined as for reservations without
+	// a tier.
+	TTL time.Duration
+}
+
+// ACLTierer is an optional interface for ACLFilters that grant reservations different tiers of
+// service. The tier is evaluated whenever a peer reserves a slot, including when it renews its
+// reservation, so that a peer upgraded to a higher tier gets it by renewing its reservation,
+// without dropping it. The relayed connections opened after the renewal get the new tier's
+// limit; connections already open keep theirs.
+type ACLTierer interface {
+	// ReservationTier returns the tier of a reservation from a peer with the given peer ID and
+	// multiaddr, or false if the reservation gets the relay's default limits.
+	ReservationTier(p peer.ID, a ma.Multiaddr) (tier ReservationTier, ok bool)
+}
+
+var _ ACLTierer = &aclChain{}
+
+// ReservationTier returns the tier of the first filter granting one.
+func (c *aclChain) ReservationTier(p peer.ID, a ma.Multiaddr) (ReservationTier, bool) {
+	for _, f := range c.filters {
+		if t, ok := f.(ACLTierer); ok {
+			if tier, ok := t.ReservationTier(p, a); ok {
+				return tier, true
+			}
+		}
+	}
+	return ReservationTier{}, false
+}
+
+// reservationTier consults the relay's ACL for the tier of a reservation.
+func (r *Relay) reservationTier(p peer.ID, a ma.Multiaddr) (ReservationTier, bool) {
+	t, ok := r.acl.(ACLTierer)
+	if !ok {
+		return ReservationTier{}, false
+	}
+	return t.ReservationTier(p, a)
+}
+
+// reservationLimit returns the limit of the connections relayed to the holder of rsvp.
+func (r *Relay) reservationLimit(rsvp reservation) *RelayLimit {
+	if rsvp.limit != nil {
+		return rsvp.limit
+	}
+	return r.rc.Limit
+}
+
+// peerLimit returns the limit of the connections relayed to p.
+func (r *Relay) peerLimit(p peer.ID) *RelayLimit {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.reservationLimit(r.rsvp[p])
+}
@@ -0,0 +1,88 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// tierACL allows everything and grants the tiers set for peers.
+type tierACL struct {
+	mx    sync.Mutex
+	tiers map[peer.ID]ReservationTier
+}
+
+func (a *tierACL) AllowReserve(peer.ID, ma.Multiaddr) bool          { return true }
+func (a *tierACL) AllowConnect(peer.ID, ma.Multiaddr, peer.ID) bool { return true }
+
+func (a *tierACL) ReservationTier(p peer.ID, _ ma.Multiaddr) (ReservationTier, bool) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	tier, ok := a.tiers[p]
+	return tier, ok
+}
+
+func (a *tierACL) set(p peer.ID, tier ReservationTier) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.tiers[p] = tier
+}
+
+func TestReservationTierUpgrade(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	acl := &tierACL{tiers: make(map[peer.ID]ReservationTier)}
+	r, err := New(relayHost, WithACL(ChainACL(acl)))
+	require.NoError(t, err)
+	defer r.Close()
+	handleStopEcho(dest)
+
+	connectLimit := func() *pbv2.Limit {
+		t.Helper()
+		require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+		s, err := src.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+		require.NoError(t, err)
+		defer s.Reset()
+		require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{
+			Type: pbv2.HopMessage_CONNECT.Enum(),
+			Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest.ID()}),
+		}))
+		var resp pbv2.HopMessage
+		require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+		require.Equal(t, pbv2.Status_OK, resp.GetStatus())
+		return resp.GetLimit()
+	}
+
+	rsvp, err := reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	require.Equal(t, uint64(DefaultResources().Limit.Data), rsvp.LimitData)
+	require.Equal(t, uint64(DefaultResources().Limit.Data), connectLimit().GetData())
+
+	premium := &RelayLimit{Duration: 10 * time.Minute, Data: 1 << 20}
+	acl.set(dest.ID(), ReservationTier{Name: "premium", Limit: premium, TTL: 2 * time.Hour})
+
+	// renewing the reservation upgrades it
+	rsvp, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+	require.Equal(t, uint64(premium.Data), rsvp.LimitData)
+	require.Equal(t, premium.Duration, rsvp.LimitDuration)
+	require.WithinDuration(t, time.Now().Add(2*time.Hour), rsvp.Expiration, 5*time.Second)
+	require.True(t, r.hasReservation(dest.ID()))
+
+	limit := connectLimit()
+	require.Equal(t, uint64(premium.Data), limit.GetData())
+	require.Equal(t, uint32(premium.Duration/time.Second), limit.GetDuration())
+
+	// the tier doesn't apply to connections to other peers
+	require.Equal(t, DefaultResources().Limit, r.peerLimit(src.ID()))
+}
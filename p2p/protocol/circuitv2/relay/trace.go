@@ -0,0 +1,19 @@
+package relay
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// TraceHook is called when the relay starts establishing a circuit from src to dest. It is not
+// called for connect requests refused before the relay reserves resources for the circuit, e.g.
+// because dest has no reservation or the ACL denies the circuit.
+//
+// The trace ID is the one supplied by the source in its CONNECT message, or a freshly generated
+// one if the source did not supply any; it is forwarded to the destination in the STOP message.
+// The passed context carries the trace ID (see util.TraceIDFromContext). The returned context is
+// used to open the stop stream to the destination, and the returned function, if non-nil, is
+// called with the final status of the connection attempt.
+type TraceHook func(ctx context.Context, traceID string, src, dest peer.ID) (context.Context, func(status pbv2.Status))
@@ -0,0 +1,117 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestCircuitTraceID(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, src, dest := hosts[0], hosts[1], hosts[2]
+
+	type traced struct {
+		traceID   string
+		ctxID     string
+		src, dest peer.ID
+		status    pbv2.Status
+	}
+	var mx sync.Mutex
+	var circuits []traced
+	r, err := New(relayHost, WithTraceHook(func(ctx context.Context, traceID string, s, d peer.ID) (context.Context, func(pbv2.Status)) {
+		ctxID, _ := util.TraceIDFromContext(ctx)
+		return ctx, func(status pbv2.Status) {
+			mx.Lock()
+			defer mx.Unlock()
+			circuits = append(circuits, traced{traceID: traceID, ctxID: ctxID, src: s, dest: d, status: status})
+		}
+	}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	addCircuitTransport(t, dest)
+	_, err = reserve(t, dest, relayHost)
+	require.NoError(t, err)
+
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	c, err := client.New(src, swarmt.GenUpgrader(t, src.Network().(*swarm.Swarm), nil))
+	require.NoError(t, err)
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", relayHost.ID(), dest.ID()))
+
+	destTraceIDs := func() []string {
+		var ids []string
+		for _, conn := range dest.Network().ConnsToPeer(src.ID()) {
+			if id, ok := conn.Stat().Extra[client.StatTraceID].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	t.Run("supplied by the source", func(t *testing.T) {
+		conn, err := c.Dial(util.ContextWithTraceID(context.Background(), "my-trace-id"), raddr, dest.ID())
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Equal(t, "my-trace-id", conn.(network.ConnStat).Stat().Extra[client.StatTraceID])
+
+		require.Eventually(t, func() bool { return len(destTraceIDs()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, []string{"my-trace-id"}, destTraceIDs())
+
+		mx.Lock()
+		defer mx.Unlock()
+		require.Len(t, circuits, 1)
+		require.Equal(t, traced{traceID: "my-trace-id", ctxID: "my-trace-id", src: src.ID(), dest: dest.ID(), status: pbv2.Status_OK}, circuits[0])
+	})
+
+	t.Run("generated by the relay", func(t *testing.T) {
+		conn, err := c.Dial(context.Background(), raddr, dest.ID())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, ok := conn.(network.ConnStat).Stat().Extra[client.StatTraceID]
+		require.False(t, ok)
+
+		mx.Lock()
+		require.Len(t, circuits, 2)
+		generated := circuits[1]
+		mx.Unlock()
+		require.NotEmpty(t, generated.traceID)
+		require.NotEqual(t, "my-trace-id", generated.traceID)
+		require.Equal(t, generated.traceID, generated.ctxID)
+		require.Equal(t, pbv2.Status_OK, generated.status)
+
+		require.Eventually(t, func() bool { return slices.Contains(destTraceIDs(), generated.traceID) }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("invalid, replaced by the relay", func(t *testing.T) {
+		for i, invalid := range []string{strings.Repeat("a", util.MaxTraceIDLength+1), "trace id\n"} {
+			conn, err := c.Dial(util.ContextWithTraceID(context.Background(), invalid), raddr, dest.ID())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			mx.Lock()
+			require.Len(t, circuits, 3+i)
+			replaced := circuits[2+i]
+			mx.Unlock()
+			require.True(t, util.ValidTraceID(replaced.traceID))
+			require.Equal(t, pbv2.Status_OK, replaced.status)
+
+			require.Eventually(t, func() bool { return slices.Contains(destTraceIDs(), replaced.traceID) }, 5*time.Second, 10*time.Millisecond)
+			require.NotContains(t, destTraceIDs(), invalid)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestedReservationTTL(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	rc := DefaultResources()
+	rc.ReservationTTL = time.Hour
+	rc.MinReservationTTL = 5 * time.Minute
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, h.Connect(context.Background(), rinfo))
+
+	tcs := []struct {
+		name     string
+		opts     []client.ReserveOption
+		expected time.Duration
+	}{
+		{name: "default", expected: time.Hour},
+		{name: "below min", opts: []client.ReserveOption{client.WithReservationTTL(time.Minute)}, expected: 5 * time.Minute},
+		{name: "within range", opts: []client.ReserveOption{client.WithReservationTTL(10 * time.Minute)}, expected: 10 * time.Minute},
+		{name: "above max", opts: []client.ReserveOption{client.WithReservationTTL(2 * time.Hour)}, expected: time.Hour},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rsvp, err := client.Reserve(context.Background(), h, rinfo, tc.opts...)
+			require.NoError(t, err)
+			expected := time.Now().Add(tc.expected)
+			require.WithinDuration(t, expected, rsvp.Expiration, 2*time.Second)
+			require.WithinDuration(t, expected, rsvp.Voucher.Expiration, 2*time.Second)
+
+			r.mx.Lock()
+			expire := r.rsvp[h.ID()].expire
+			r.mx.Unlock()
+			require.WithinDuration(t, expected, expire, 2*time.Second)
+		})
+	}
+}
+
+func TestRenewAfter(t *testing.T) {
+	now := time.Now()
+	tcs := []struct {
+		name     string
+		ttl      time.Duration
+		fraction float64
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "default", ttl: time.Hour, fraction: 0.75, expected: 45 * time.Minute, ok: true},
+		{name: "short ttl", ttl: time.Minute, fraction: 0.75, expected: 45 * time.Second, ok: true},
+		{name: "half", ttl: 10 * time.Minute, fraction: 0.5, expected: 5 * time.Minute, ok: true},
+		{name: "at expiry", ttl: time.Hour, fraction: 1, expected: time.Hour, ok: true},
+		{name: "disabled", ttl: time.Hour, fraction: 0},
+		{name: "negative", ttl: time.Hour, fraction: -0.5},
+		{name: "after expiry", ttl: time.Hour, fraction: 1.5},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			renew, ok := renewAfter(now, now.Add(tc.ttl), tc.fraction)
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				require.Equal(t, now.Add(tc.expected), renew)
+			}
+		})
+	}
+}
+
+func TestReservationRenewAfter(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, h, other := hosts[0], hosts[1], hosts[2]
+
+	rc := DefaultResources()
+	rc.ReservationTTL = time.Hour
+	rc.MinReservationTTL = 5 * time.Minute
+	r, err := New(relayHost, WithResources(rc))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rinfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	require.NoError(t, h.Connect(context.Background(), rinfo))
+
+	rsvp, err := client.Reserve(context.Background(), h, rinfo)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(45*time.Minute), rsvp.RenewAfter, 2*time.Second)
+
+	// the hint follows the granted duration
+	rsvp, err = client.Reserve(context.Background(), h, rinfo, client.WithReservationTTL(20*time.Minute))
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(15*time.Minute), rsvp.RenewAfter, 2*time.Second)
+
+	// the hint can be disabled
+	rc.ReservationRenewFraction = 0
+	r2, err := New(other, WithResources(rc))
+	require.NoError(t, err)
+	defer r2.Close()
+	rsvp, err = reserve(t, h, other)
+	require.NoError(t, err)
+	require.Zero(t, rsvp.RenewAfter)
+}
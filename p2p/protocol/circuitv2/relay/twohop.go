@@ -0,0 +1,152 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// allowNextHop returns true if a connection that has traversed hops relays before this one may
+// be forwarded to another relay.
+func (r *Relay) allowNextHop(hops uint32) bool {
+	return r.maxHops > 0 && int(hops)+2 <= r.maxHops
+}
+
+// nextHopRelay returns a relay through which dest is reachable, as advertised by the relay
+// addresses of dest in the connect request and the peerstore. Only relays that this relay is
+// already connected to are considered.
+func (r *Relay) nextHopRelay(dest peer.AddrInfo) (peer.ID, bool) {
+	for _, a := range slices.Concat(dest.Addrs, r.host.Peerstore().Addrs(dest.ID)) {
+		if !isRelayAddr(a) {
+			continue
+		}
+		relayAddr, _ := ma.SplitFunc(a, func(c ma.Component) bool {
+			return c.Protocol().Code == ma.P_CIRCUIT
+		})
+		relay, err := peer.IDFromP2PAddr(relayAddr)
+		if err != nil || relay == r.host.ID() || relay == dest.ID {
+			continue
+		}
+		if r.host.Network().Connectedness(relay) != network.Connected {
+			continue
+		}
+		return relay, true
+	}
+	return "", false
+}
+
+// openNextHopStream opens a hop stream to relay and connects through it to dest, for a
+// connection that has traversed hops relays, including this one. On success, it returns the
+// stream and the limit of the relay. On failure, the stream is reset and the status to respond
+// to the source with is returned.
+func (r *Relay) openNextHopStream(ctx context.Context, relay, dest peer.ID, hops uint32, traceID string) (network.Stream, *pbv2.Limit, pbv2.Status) {
+	log := log.With("trace_id", traceID)
+
+	bs, err := r.host.NewStream(ctx, relay, proto.ProtoIDv2Hop)
+	if err != nil {
+		log.Debug("error opening hop stream to next relay",
+			"relay_peer", relay,
+			"err", err)
+		return nil, nil, pbv2.Status_CONNECTION_FAILED
+	}
+
+	stop := resetOnSetupAbort(ctx, bs)
+	defer stop()
+
+	if err := bs.Scope().SetService(ServiceName); err != nil {
+		log.Debug("error attaching stream to relay service",
+			"error", err)
+		bs.Reset()
+		return nil, nil, pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+	}
+
+	// handshake
+	if err := bs.Scope().ReserveMemory(maxMessageSize, network.ReservationPriorityAlways); err != nil {
+		log.Debug("error reserving memory for stream",
+			"error", err)
+		bs.Reset()
+		return nil, nil, pbv2.Status_RESOURCE_LIMIT_EXCEEDED
+	}
+	defer bs.Scope().ReleaseMemory(maxMessageSize)
+
+	rd := util.NewDelimitedReader(bs, maxMessageSize)
+	wr := util.NewDelimitedWriter(bs)
+	defer rd.Close()
+
+	var msg pbv2.HopMessage
+	msg.Type = pbv2.HopMessage_CONNECT.Enum()
+	msg.Peer = util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest})
+	msg.Hops = &hops
+	msg.TraceID = &traceID
+
+	bs.SetDeadline(time.Now().Add(r.rc.stopHandshakeTimeout()))
+
+	if err := wr.WriteMsg(&msg); err != nil {
+		log.Debug("error writing connect message to next relay", "err", err)
+		bs.Reset()
+		return nil, nil, pbv2.Status_CONNECTION_FAILED
+	}
+
+	msg.Reset()
+
+	if err := rd.ReadMsg(&msg); err != nil {
+		log.Debug("error reading connect response from next relay", "err", err)
+		bs.Reset()
+		return nil, nil, pbv2.Status_CONNECTION_FAILED
+	}
+
+	if err := checkNextHopResponse(&msg); err != nil {
+		log.Debug("next relay connect failure",
+			"relay_peer", relay,
+			"err", err)
+		bs.Reset()
+		return nil, nil, pbv2.Status_CONNECTION_FAILED
+	}
+
+	if !stop() && setupAborted(ctx) {
+		// the stream was reset after the handshake completed
+		return nil, nil, pbv2.Status_CONNECTION_FAILED
+	}
+
+	return bs, msg.GetLimit(), pbv2.Status_OK
+}
+
+func checkNextHopResponse(msg *pbv2.HopMessage) error {
+	if t := msg.GetType(); t != pbv2.HopMessage_STATUS {
+		return fmt.Errorf("unexpected response type %s", t)
+	}
+	if status := msg.GetStatus(); status != pbv2.Status_OK {
+		return fmt.Errorf("connect failed: %s", status)
+	}
+	return nil
+}
+
+// minLimit returns the stricter of the limits a and b, either of which may be nil for no limit.
+func minLimit(a, b *pbv2.Limit) *pbv2.Limit {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	duration := minNonZero(a.GetDuration(), b.GetDuration())
+	data := minNonZero(a.GetData(), b.GetData())
+	return &pbv2.Limit{Duration: &duration, Data: &data}
+}
+
+// minNonZero returns the smaller of a and b, where 0 means unlimited.
+func minNonZero[T uint32 | uint64](a, b T) T {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
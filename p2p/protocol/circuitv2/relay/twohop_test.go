@@ -0,0 +1,162 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+	"github.com/stretchr/testify/require"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// connectHops sends a connect request for dest to the relay host from h, claiming that the
+// connection has traversed hops relays, and returns the response status.
+func connectHops(t *testing.T, h, relayHost host.Host, dest peer.ID, hops uint32) pbv2.Status {
+	t.Helper()
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	s, err := h.NewStream(context.Background(), relayHost.ID(), proto.ProtoIDv2Hop)
+	require.NoError(t, err)
+	defer s.Reset()
+
+	msg := &pbv2.HopMessage{
+		Type: pbv2.HopMessage_CONNECT.Enum(),
+		Peer: util.PeerInfoToPeerV2(peer.AddrInfo{ID: dest}),
+		Hops: &hops,
+	}
+	require.NoError(t, util.NewDelimitedWriter(s).WriteMsg(msg))
+	var resp pbv2.HopMessage
+	require.NoError(t, util.NewDelimitedReader(s, maxMessageSize).ReadMsg(&resp))
+	return resp.GetStatus()
+}
+
+// advertiseRelayAddr records in the peerstore of h that dest is reachable through relayHost,
+// and connects h to relayHost.
+func advertiseRelayAddr(t *testing.T, h, relayHost host.Host, dest peer.ID) {
+	t.Helper()
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+	raddr := relayHost.Addrs()[0].Encapsulate(ma.StringCast("/p2p/" + relayHost.ID().String() + "/p2p-circuit"))
+	h.Peerstore().AddAddr(dest, raddr, peerstore.PermanentAddrTTL)
+}
+
+func TestTwoHopCircuit(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	src, relay1, relay2, dest := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	r1, err := New(relay1, WithAllowTwoHop(2))
+	require.NoError(t, err)
+	defer r1.Close()
+	r2, err := New(relay2)
+	require.NoError(t, err)
+	defer r2.Close()
+
+	// dest only has a reservation with relay2
+	addCircuitTransport(t, src)
+	addCircuitTransport(t, dest)
+	_, err = reserve(t, dest, relay2)
+	require.NoError(t, err)
+	advertiseRelayAddr(t, relay1, relay2, dest.ID())
+
+	const echo = "/test/echo"
+	dest.SetStreamHandler(echo, func(s network.Stream) {
+		defer s.Close()
+		io.Copy(s, s)
+	})
+
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: relay1.ID(), Addrs: relay1.Addrs()}))
+	raddr := ma.StringCast("/p2p/" + relay1.ID().String() + "/p2p-circuit")
+	require.NoError(t, src.Connect(context.Background(), peer.AddrInfo{ID: dest.ID(), Addrs: []ma.Multiaddr{raddr}}))
+
+	s, err := src.NewStream(network.WithAllowLimitedConn(context.Background(), echo), dest.ID(), echo)
+	require.NoError(t, err)
+	defer s.Close()
+	msg := []byte("relayed twice")
+	_, err = s.Write(msg)
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(s, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+	// forwarding doesn't create a reservation for the destination
+	require.False(t, r1.hasReservation(dest.ID()))
+}
+
+func TestTwoHopLimit(t *testing.T) {
+	hosts := getTestHosts(t, 5)
+	src, relay1, relay2, relay3, dest := hosts[0], hosts[1], hosts[2], hosts[3], hosts[4]
+
+	r1, err := New(relay1, WithAllowTwoHop(2), WithRecentRefusals(8))
+	require.NoError(t, err)
+	defer r1.Close()
+	r2, err := New(relay2, WithAllowTwoHop(2))
+	require.NoError(t, err)
+	defer r2.Close()
+	r3, err := New(relay3)
+	require.NoError(t, err)
+	defer r3.Close()
+
+	// dest is reachable from relay1 through relay2, and from relay2 through relay3
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relay3)
+	require.NoError(t, err)
+	advertiseRelayAddr(t, relay1, relay2, dest.ID())
+	advertiseRelayAddr(t, relay2, relay3, dest.ID())
+
+	// requests that have traversed the maximum number of relays are refused
+	require.Equal(t, pbv2.Status_PERMISSION_DENIED, connectHops(t, src, relay1, dest.ID(), 2))
+	refusals := r1.RecentRefusals()
+	require.NotEmpty(t, refusals)
+	require.Equal(t, "hop limit exceeded", refusals[len(refusals)-1].Reason)
+
+	// requests that can't be forwarded without exceeding the limit need a reservation
+	require.Equal(t, pbv2.Status_NO_RESERVATION, connectHops(t, src, relay1, dest.ID(), 1))
+	require.Equal(t, pbv2.Status_NO_RESERVATION, connectHops(t, src, relay2, dest.ID(), 1))
+
+	// relay2 forwards to relay3 for requests from the first hop
+	require.Equal(t, pbv2.Status_OK, connectHops(t, src, relay2, dest.ID(), 0))
+	// but not when they come through relay1, which would be a third hop
+	require.Equal(t, pbv2.Status_CONNECTION_FAILED, connectHops(t, src, relay1, dest.ID(), 0))
+
+	// a larger limit allows the three hop circuit
+	r1.maxHops = 3
+	r2.maxHops = 3
+	require.Equal(t, pbv2.Status_OK, connectHops(t, src, relay1, dest.ID(), 0))
+}
+
+func TestTwoHopDisabled(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	src, relay1, relay2, dest := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	r1, err := New(relay1)
+	require.NoError(t, err)
+	defer r1.Close()
+	r2, err := New(relay2)
+	require.NoError(t, err)
+	defer r2.Close()
+
+	handleStopEcho(dest)
+	_, err = reserve(t, dest, relay2)
+	require.NoError(t, err)
+	advertiseRelayAddr(t, relay1, relay2, dest.ID())
+
+	require.Equal(t, pbv2.Status_NO_RESERVATION, connectHops(t, src, relay1, dest.ID(), 0))
+
+	_, err = New(relay1, WithAllowTwoHop(1))
+	require.Error(t, err)
+}
+
+func TestMinLimit(t *testing.T) {
+	limit := func(d uint32, data uint64) *pbv2.Limit { return &pbv2.Limit{Duration: &d, Data: &data} }
+	require.Nil(t, minLimit(nil, nil))
+	require.Equal(t, limit(10, 20), minLimit(limit(10, 20), nil))
+	require.Equal(t, limit(10, 20), minLimit(nil, limit(10, 20)))
+	require.Equal(t, limit(5, 20), minLimit(limit(10, 20), limit(5, 30)))
+	require.Equal(t, limit(10, 30), minLimit(limit(10, 0), limit(0, 30)))
+}
@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by New for contradictory configurations, which would otherwise produce a relay
+// that silently ignores part of its configuration.
+var (
+	// ErrKeepAliveWithoutDurationLimit is returned if WithKeepAlive is used without a duration
+	// limit in Resources.Limit to extend, or with a window that isn't shorter than the duration
+	// limit, so that connections end before their first window.
+	ErrKeepAliveWithoutDurationLimit = errors.New("keep-alive requires a duration limit longer than its window")
+	// ErrReservedCapacityExceedsMax is returned if WithReservedCapacity sets aside all of
+	// Resources.MaxReservations, leaving no reservations to ordinary peers.
+	ErrReservedCapacityExceedsMax = errors.New("reserved capacity must leave reservations to ordinary peers")
+	// ErrLimitBehaviorWithoutDataLimit is returned if Resources.LimitExhaustedBehavior is set
+	// without a data limit in Resources.Limit.
+	ErrLimitBehaviorWithoutDataLimit = errors.New("limit exhausted behavior requires a data limit")
+	// ErrWebhookClientWithoutWebhook is returned if WithReservationWebhookClient is used without
+	// WithReservationWebhook.
+	ErrWebhookClientWithoutWebhook = errors.New("reservation webhook client requires a reservation webhook")
+)
+
+// validateConfig checks the configuration of the relay, after all options are applied, for
+// contradictory settings. It returns all conflicts found, joined.
+func (r *Relay) validateConfig() error {
+	var errs []error
+	if r.keepAlive != nil && (r.rc.Limit == nil || r.rc.Limit.Duration <= r.keepAlive.window) {
+		errs = append(errs, ErrKeepAliveWithoutDurationLimit)
+	}
+	if r.reservedCapacity != nil && r.reservedCapacity.slots >= r.rc.MaxReservations {
+		errs = append(errs, fmt.Errorf("%w: %d reserved of %d", ErrReservedCapacityExceedsMax, r.reservedCapacity.slots, r.rc.MaxReservations))
+	}
+	if r.rc.LimitExhaustedBehavior != LimitExhaustedClose && (r.rc.Limit == nil || (r.rc.Limit.Data <= 0 && r.rc.Limit.DataSrcToDest <= 0 && r.rc.Limit.DataDestToSrc <= 0)) {
+		errs = append(errs, ErrLimitBehaviorWithoutDataLimit)
+	}
+	if r.webhookClient != nil && r.webhook == nil {
+		errs = append(errs, ErrWebhookClientWithoutWebhook)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+
+	limitReset := DefaultResources()
+	limitReset.LimitExhaustedBehavior = LimitExhaustedReset
+	fewReservations := DefaultResources()
+	fewReservations.MaxReservations = 2
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		err  error
+	}{
+		{
+			name: "keep-alive without limits",
+			opts: []Option{WithInfiniteLimits(), WithKeepAlive(1, time.Second)},
+			err:  ErrKeepAliveWithoutDurationLimit,
+		},
+		{
+			name: "keep-alive window exceeds duration limit",
+			opts: []Option{WithLimit(&RelayLimit{Duration: time.Second, Data: 1 << 10}), WithKeepAlive(1, time.Minute)},
+			err:  ErrKeepAliveWithoutDurationLimit,
+		},
+		{
+			name: "all reservations reserved",
+			opts: []Option{WithResources(fewReservations), WithReservedCapacity([]peer.ID{h.ID()}, 2)},
+			err:  ErrReservedCapacityExceedsMax,
+		},
+		{
+			name: "limit exhausted behavior without limits",
+			opts: []Option{WithResources(limitReset), WithInfiniteLimits()},
+			err:  ErrLimitBehaviorWithoutDataLimit,
+		},
+		{
+			name: "webhook client without webhook",
+			opts: []Option{WithReservationWebhookClient(&http.Client{})},
+			err:  ErrWebhookClientWithoutWebhook,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(h, tc.opts...)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	// options are validated together, regardless of their order
+	r, err := New(h, WithKeepAlive(1, time.Second), WithResources(limitReset))
+	require.NoError(t, err)
+	r.Close()
+}
@@ -0,0 +1,32 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"golang.org/x/time/rate"
+)
+
+// verifyDestination asks dest, which has no reservation with this relay, whether it expects
+// relayed connections, by performing a probe handshake with it on behalf of src. Only destinations
+// the relay is connected to are asked. It returns true if dest confirmed, and otherwise the
+// constraint that prevented verifying it, which is empty if dest doesn't expect relayed
+// connections.
+func (r *Relay) verifyDestination(src, dest peer.ID) (bool, string) {
+	if !r.destVerifyLimiter.Allow() {
+		return false, "destination verification rate limit"
+	}
+
+	status, err := r.probeDestination(src, dest)
+	if err != nil {
+		log.Debug("error verifying destination", "source_peer", src, "destination_peer", dest, "err", err)
+		return false, ""
+	}
+	// peers that don't run the relay client refuse probes with an error status
+	return status == pbv2.Status_OK, ""
+}
+
+// newDestVerifyLimiter returns the limiter of the destination verifications of the relay.
+func newDestVerifyLimiter(limit RateLimit) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(limit.RPS), limit.Burst)
+}
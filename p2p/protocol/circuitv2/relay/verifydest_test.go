@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	"github.com/stretchr/testify/require"
+)
+
+// dropReservation removes the reservation of p from the relay's local state only, simulating a
+// relay whose view of the reservations lags behind.
+func (r *Relay) dropReservation(p peer.ID) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	delete(r.rsvp, p)
+}
+
+func TestDestinationVerification(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   []Option
+		status pbv2.Status
+	}{
+		{name: "disabled", status: pbv2.Status_NO_RESERVATION},
+		{name: "enabled", opts: []Option{WithDestinationVerification(RateLimit{RPS: 10, Burst: 10})}, status: pbv2.Status_OK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 4)
+			relayHost, src, dest, unwilling := hosts[0], hosts[1], hosts[2], hosts[3]
+
+			r, err := New(relayHost, tc.opts...)
+			require.NoError(t, err)
+			defer r.Close()
+
+			handleStopEcho(dest)
+			_, err = reserve(t, dest, relayHost)
+			require.NoError(t, err)
+			r.dropReservation(dest.ID())
+
+			s, status := connectRaw(t, src, relayHost, dest.ID())
+			require.Equal(t, tc.status, status)
+			if status == pbv2.Status_OK {
+				_, err := s.Write([]byte("hello"))
+				require.NoError(t, err)
+				buf := make([]byte, 5)
+				_, err = io.ReadFull(s, buf)
+				require.NoError(t, err)
+				require.Equal(t, "hello", string(buf))
+				// no reservation is made up for the destination
+				require.False(t, r.hasReservation(dest.ID()))
+			}
+
+			// peers connected to the relay that don't run the relay client are not verified
+			require.NoError(t, unwilling.Connect(context.Background(), peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}))
+			_, status = connectRaw(t, src, relayHost, unwilling.ID())
+			require.Equal(t, pbv2.Status_NO_RESERVATION, status)
+		})
+	}
+}
+
+func TestDestinationVerificationRateLimit(t *testing.T) {
+	hosts := getTestHosts(t, 4)
+	relayHost, src, dests := hosts[0], hosts[1], hosts[2:]
+
+	r, err := New(relayHost, WithDestinationVerification(RateLimit{RPS: 0.001, Burst: 1}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	connect := func(dest host.Host) pbv2.Status {
+		handleStopEcho(dest)
+		_, err := reserve(t, dest, relayHost)
+		require.NoError(t, err)
+		r.dropReservation(dest.ID())
+		_, status := connectRaw(t, src, relayHost, dest.ID())
+		return status
+	}
+	require.Equal(t, pbv2.Status_OK, connect(dests[0]))
+	require.Equal(t, pbv2.Status_NO_RESERVATION, connect(dests[1]))
+
+	refusals := r.RecentRefusals()
+	require.NotEmpty(t, refusals)
+	refusal := refusals[len(refusals)-1]
+	require.Equal(t, dests[1].ID(), refusal.Destination)
+	require.Equal(t, "destination verification rate limit", refusal.Constraint)
+}
@@ -0,0 +1,53 @@
+package relay
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// agentVersionCacheSize is the number of distinct agent versions whose filter result is cached.
+const agentVersionCacheSize = 256
+
+// AgentVersionFilter decides whether a client advertising the given agent version may reserve
+// a slot in the relay.
+type AgentVersionFilter func(agentVersion string) bool
+
+// agentVersionGate refuses reservations based on the agent version learned through identify.
+type agentVersionGate struct {
+	filter       AgentVersionFilter
+	allowUnknown bool
+
+	// cache memoizes filter decisions per agent version, as the filter may be expensive
+	// (e.g. semver parsing) and the number of distinct agent versions is small.
+	cache *lru.Cache[string, bool]
+}
+
+func newAgentVersionGate(filter AgentVersionFilter, allowUnknown bool) *agentVersionGate {
+	cache, _ := lru.New[string, bool](agentVersionCacheSize)
+	return &agentVersionGate{
+		filter:       filter,
+		allowUnknown: allowUnknown,
+		cache:        cache,
+	}
+}
+
+// Allow returns true if the peer's agent version is acceptable.
+func (g *agentVersionGate) Allow(ps peerstore.Peerstore, p peer.ID) bool {
+	v, err := ps.Get(p, "AgentVersion")
+	if err != nil {
+		return g.allowUnknown
+	}
+	av, ok := v.(string)
+	if !ok || av == "" {
+		return g.allowUnknown
+	}
+
+	if allow, ok := g.cache.Get(av); ok {
+		return allow
+	}
+	allow := g.filter(av)
+	g.cache.Add(av, allow)
+	return allow
+}
@@ -0,0 +1,45 @@
+package relay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentVersionGate(t *testing.T) {
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+
+	calls := 0
+	filter := func(av string) bool {
+		calls++
+		return !strings.HasPrefix(av, "old-client/")
+	}
+
+	oldPeer := test.RandPeerIDFatal(t)
+	newPeer := test.RandPeerIDFatal(t)
+	newPeer2 := test.RandPeerIDFatal(t)
+	unknownPeer := test.RandPeerIDFatal(t)
+	require.NoError(t, ps.Put(oldPeer, "AgentVersion", "old-client/0.1"))
+	require.NoError(t, ps.Put(newPeer, "AgentVersion", "new-client/1.0"))
+	require.NoError(t, ps.Put(newPeer2, "AgentVersion", "new-client/1.0"))
+
+	g := newAgentVersionGate(filter, false)
+	require.False(t, g.Allow(ps, oldPeer))
+	require.True(t, g.Allow(ps, newPeer))
+	require.True(t, g.Allow(ps, newPeer2))
+	require.Equal(t, 2, calls, "expected filter results to be cached per agent version")
+
+	require.False(t, g.Allow(ps, unknownPeer))
+	require.True(t, newAgentVersionGate(filter, true).Allow(ps, unknownPeer))
+}
+
+func TestWithAgentVersionFilterNil(t *testing.T) {
+	h := getTestHosts(t, 1)[0]
+	_, err := New(h, WithAgentVersionFilter(nil, true))
+	require.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+)
+
+// voucherNonceSize is the size of the nonces of single use vouchers.
+const voucherNonceSize = 16
+
+var (
+	// ErrVoucherReplayed is returned by ConsumeVoucher for a single use voucher that was already
+	// consumed, or that was superseded by renewing the reservation it was issued with.
+	ErrVoucherReplayed = errors.New("voucher already used")
+
+	errVoucherExpired = errors.New("voucher expired")
+)
+
+// newVoucherNonce returns a random nonce for a single use voucher.
+func newVoucherNonce() []byte {
+	nonce := make([]byte, voucherNonceSize)
+	// crypto/rand.Read never returns an error
+	rand.Read(nonce)
+	return nonce
+}
+
+// ConsumeVoucher checks that a reservation voucher presented by p, as a serialized record
+// envelope, was issued by this relay for p and hasn't expired. It is meant for applications that
+// accept vouchers as proof of a reservation; p must be the authenticated peer presenting it.
+// With WithSingleUseVouchers, the voucher must also be the latest one issued for the current
+// reservation of p, and it is consumed, so presenting it again fails with ErrVoucherReplayed.
+func (r *Relay) ConsumeVoucher(p peer.ID, voucher []byte) error {
+	env, rec, err := record.ConsumeEnvelope(voucher, proto.RecordDomain)
+	if err != nil {
+		return err
+	}
+	rv, ok := rec.(*proto.ReservationVoucher)
+	if !ok {
+		return fmt.Errorf("unexpected record type %T", rec)
+	}
+	signer, err := peer.IDFromPublicKey(env.PublicKey)
+	if err != nil {
+		return err
+	}
+	self := r.host.ID()
+	if signer != self || rv.Relay != self {
+		return fmt.Errorf("voucher issued by %s", signer)
+	}
+	if rv.Peer != p {
+		return fmt.Errorf("voucher issued for %s", rv.Peer)
+	}
+	if !rv.Expiration.After(time.Now()) {
+		return errVoucherExpired
+	}
+	if !r.singleUseVouchers {
+		return nil
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	rsvp, ok := r.rsvp[p]
+	if !ok {
+		return fmt.Errorf("no reservation for %s", p)
+	}
+	if len(rsvp.voucherNonce) == 0 || !bytes.Equal(rsvp.voucherNonce, rv.Nonce) {
+		return ErrVoucherReplayed
+	}
+	rsvp.voucherNonce = nil
+	r.rsvp[p] = rsvp
+	return nil
+}
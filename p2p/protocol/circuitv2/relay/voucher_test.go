@@ -0,0 +1,161 @@
+package relay
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/stretchr/testify/require"
+)
+
+// noKeyHost is a host whose peerstore doesn't hold any private keys, so vouchers can't be sealed.
+type noKeyHost struct {
+	host.Host
+}
+
+func (h *noKeyHost) Peerstore() peerstore.Peerstore { return noKeyPeerstore{h.Host.Peerstore()} }
+
+type noKeyPeerstore struct {
+	peerstore.Peerstore
+}
+
+func (noKeyPeerstore) PrivKey(peer.ID) crypto.PrivKey { return nil }
+
+type voucherMetricsTracer struct {
+	metricsTracer
+
+	mx       sync.Mutex
+	failures int
+}
+
+func (mt *voucherMetricsTracer) VoucherSealFailed() {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	mt.failures++
+}
+
+func (mt *voucherMetricsTracer) Failures() int {
+	mt.mx.Lock()
+	defer mt.mx.Unlock()
+	return mt.failures
+}
+
+func TestVoucherSealFailure(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		name := "lenient"
+		if strict {
+			name = "strict"
+		}
+		t.Run(name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, h := hosts[0], hosts[1]
+
+			mt := &voucherMetricsTracer{}
+			r, err := New(&noKeyHost{Host: relayHost}, WithMetricsTracer(mt), WithStrictVouchers(strict))
+			require.NoError(t, err)
+			defer r.Close()
+
+			rsvp, err := reserve(t, h, relayHost)
+			require.Equal(t, 1, mt.Failures())
+			if strict {
+				var rerr client.ReservationError
+				require.ErrorAs(t, err, &rerr)
+				require.Equal(t, pbv2.Status_RESERVATION_REFUSED, rerr.Status)
+				require.False(t, r.hasReservation(h.ID()))
+
+				refusals := r.RecentRefusals()
+				require.Len(t, refusals, 1)
+				require.Equal(t, "failed to seal reservation voucher", refusals[0].Reason)
+				require.Equal(t, errNoSigningKey.Error(), refusals[0].Constraint)
+				return
+			}
+			// the reservation is granted without a voucher
+			require.NoError(t, err)
+			require.Nil(t, rsvp.Voucher)
+			require.True(t, r.hasReservation(h.ID()))
+		})
+	}
+}
+
+func TestVoucherSealSuccess(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	mt := &voucherMetricsTracer{}
+	r, err := New(relayHost, WithMetricsTracer(mt), WithStrictVouchers(true))
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.NotNil(t, rsvp.Voucher)
+	require.Zero(t, mt.Failures())
+}
+
+// sealVoucher returns the voucher of rsvp as a serialized record envelope signed with the key of
+// relayHost, as the relay issued it.
+func sealVoucher(t *testing.T, relayHost host.Host, rsvp *client.Reservation) []byte {
+	t.Helper()
+	require.NotNil(t, rsvp.Voucher)
+	env, err := record.Seal(rsvp.Voucher, relayHost.Peerstore().PrivKey(relayHost.ID()))
+	require.NoError(t, err)
+	b, err := env.Marshal()
+	require.NoError(t, err)
+	return b
+}
+
+func TestSingleUseVouchers(t *testing.T) {
+	hosts := getTestHosts(t, 3)
+	relayHost, h, other := hosts[0], hosts[1], hosts[2]
+
+	r, err := New(relayHost, WithSingleUseVouchers())
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.Len(t, rsvp.Voucher.Nonce, voucherNonceSize)
+	voucher := sealVoucher(t, relayHost, rsvp)
+
+	require.Error(t, r.ConsumeVoucher(other.ID(), voucher), "voucher issued for another peer")
+	require.NoError(t, r.ConsumeVoucher(h.ID(), voucher))
+	require.ErrorIs(t, r.ConsumeVoucher(h.ID(), voucher), ErrVoucherReplayed)
+
+	// renewing the reservation issues a fresh voucher and supersedes the previous one
+	rsvp, err = reserve(t, h, relayHost)
+	require.NoError(t, err)
+	renewed := sealVoucher(t, relayHost, rsvp)
+	require.ErrorIs(t, r.ConsumeVoucher(h.ID(), voucher), ErrVoucherReplayed)
+	require.NoError(t, r.ConsumeVoucher(h.ID(), renewed))
+	require.ErrorIs(t, r.ConsumeVoucher(h.ID(), renewed), ErrVoucherReplayed)
+
+	// a voucher with the same contents signed by another relay isn't accepted
+	forged, err := record.Seal(rsvp.Voucher, other.Peerstore().PrivKey(other.ID()))
+	require.NoError(t, err)
+	b, err := forged.Marshal()
+	require.NoError(t, err)
+	require.Error(t, r.ConsumeVoucher(h.ID(), b))
+}
+
+func TestReusableVouchers(t *testing.T) {
+	hosts := getTestHosts(t, 2)
+	relayHost, h := hosts[0], hosts[1]
+
+	r, err := New(relayHost)
+	require.NoError(t, err)
+	defer r.Close()
+
+	rsvp, err := reserve(t, h, relayHost)
+	require.NoError(t, err)
+	require.Empty(t, rsvp.Voucher.Nonce)
+	voucher := sealVoucher(t, relayHost, rsvp)
+
+	require.NoError(t, r.ConsumeVoucher(h.ID(), voucher))
+	require.NoError(t, r.ConsumeVoucher(h.ID(), voucher))
+}
@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// maxWebhookResponseSize bounds the size of the reservation webhook responses that are read.
+const maxWebhookResponseSize = 4096
+
+// ReservationWebhookRequest is the JSON body POSTed to the reservation webhook.
+type ReservationWebhookRequest struct {
+	// Peer is the peer requesting the reservation.
+	Peer peer.ID `json:"peer"`
+	// Addr is the remote address of the peer's connection.
+	Addr string `json:"addr"`
+	// TTL is the reservation duration requested by the peer, in seconds, or 0 if the peer didn't
+	// request a duration.
+	TTL uint32 `json:"ttl,omitempty"`
+}
+
+// ReservationWebhookResponse is the JSON body the reservation webhook responds with.
+type ReservationWebhookResponse struct {
+	// Allow grants or refuses the reservation.
+	Allow bool `json:"allow"`
+	// TTL, if not 0, overrides the duration of the reservation, in seconds. It can only shorten
+	// the reservation, which is still bounded by Resources.ReservationTTL.
+	TTL uint32 `json:"ttl,omitempty"`
+	// Session, if not empty, is the session ID of the reservation, overriding the one assigned
+	// by an ACLSessioner.
+	Session string `json:"session,omitempty"`
+}
+
+// newWebhookClient returns the HTTP client used to consult the reservation webhook unless one is
+// set with WithReservationWebhookClient. Requests time out after timeout, and redirects aren't
+// followed, so that the webhook can't send the relay's requests on to another host.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// reservationWebhook consults an external HTTP endpoint for reservation decisions.
+type reservationWebhook struct {
+	url      string
+	timeout  time.Duration
+	failOpen bool
+	client   *http.Client
+}
+
+// check asks the webhook whether p may reserve a slot. It returns the TTL override, which is 0
+// if the webhook doesn't override the TTL, and the session ID assigned by the webhook, if any.
+func (w *reservationWebhook) check(ctx context.Context, p peer.ID, a ma.Multiaddr, ttl uint32) (allow bool, ttlOverride time.Duration, session string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(ReservationWebhookRequest{Peer: p, Addr: a.String(), TTL: ttl})
+	if err != nil {
+		return false, 0, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return false, 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, 0, "", fmt.Errorf("unexpected webhook response status: %s", resp.Status)
+	}
+	var res ReservationWebhookResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWebhookResponseSize)).Decode(&res); err != nil {
+		return false, 0, "", fmt.Errorf("invalid webhook response: %w", err)
+	}
+	return res.Allow, time.Duration(res.TTL) * time.Second, res.Session, nil
+}
+
+// webhookAllowReserve consults the reservation webhook, if any. Webhook failures allow or refuse
+// the reservation according to the fail-open setting.
+func (r *Relay) webhookAllowReserve(p peer.ID, a ma.Multiaddr, msg *pbv2.HopMessage) (allow bool, ttlOverride time.Duration, session string) {
+	if r.webhook == nil {
+		return true, 0, ""
+	}
+	allow, ttlOverride, session, err := r.webhook.check(r.ctx, p, a, msg.GetTtl())
+	if err != nil {
+		log.Debug("reservation webhook failed",
+			"remote_peer", p,
+			"fail_open", r.webhook.failOpen,
+			"err", err)
+		return r.webhook.failOpen, 0, ""
+	}
+	return allow, ttlOverride, session
+}
@@ -0,0 +1,161 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservationWebhook(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		handler  http.HandlerFunc
+		failOpen bool
+		allow    bool
+		ttl      time.Duration
+	}{
+		{
+			name: "allow",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				json.NewEncoder(w).Encode(ReservationWebhookResponse{Allow: true})
+			},
+			allow: true,
+			ttl:   time.Hour,
+		},
+		{
+			name: "allow with TTL override",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				json.NewEncoder(w).Encode(ReservationWebhookResponse{Allow: true, TTL: 600})
+			},
+			allow: true,
+			ttl:   10 * time.Minute,
+		},
+		{
+			name: "deny",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				json.NewEncoder(w).Encode(ReservationWebhookResponse{Allow: false})
+			},
+		},
+		{
+			name: "error fail closed",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "policy unavailable", http.StatusServiceUnavailable)
+			},
+		},
+		{
+			name: "timeout fail closed",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				<-req.Context().Done()
+			},
+		},
+		{
+			name: "timeout fail open",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				<-req.Context().Done()
+			},
+			failOpen: true,
+			allow:    true,
+			ttl:      time.Hour,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts := getTestHosts(t, 2)
+			relayHost, h := hosts[0], hosts[1]
+
+			var mx sync.Mutex
+			var req ReservationWebhookRequest
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodPost, r.Method)
+				mx.Lock()
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				mx.Unlock()
+				tc.handler(w, r)
+			}))
+			defer srv.Close()
+
+			r, err := New(relayHost, WithReservationWebhook(srv.URL, 200*time.Millisecond, tc.failOpen))
+			require.NoError(t, err)
+			defer r.Close()
+
+			rsvp, err := reserve(t, h, relayHost)
+			mx.Lock()
+			require.Equal(t, h.ID(), req.Peer)
+			require.NotEmpty(t, req.Addr)
+			mx.Unlock()
+			if !tc.allow {
+				var rerr client.ReservationError
+				require.ErrorAs(t, err, &rerr)
+				require.Equal(t, "PERMISSION_DENIED", rerr.Status.String())
+				require.False(t, r.hasReservation(h.ID()))
+				return
+			}
+			require.NoError(t, err)
+			require.WithinDuration(t, time.Now().Add(tc.ttl), rsvp.Expiration, 5*time.Second)
+		})
+	}
+
+	_, err := New(getTestHosts(t, 1)[0], WithReservationWebhook("", time.Second, false))
+	require.Error(t, err)
+}
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestReservationWebhookClient(t *testing.T) {
+	allow := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(ReservationWebhookResponse{Allow: true})
+	})
+
+	t.Run("redirects aren't followed", func(t *testing.T) {
+		hosts := getTestHosts(t, 2)
+		relayHost, h := hosts[0], hosts[1]
+
+		target := httptest.NewServer(allow)
+		defer target.Close()
+		srv := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+		defer srv.Close()
+
+		r, err := New(relayHost, WithReservationWebhook(srv.URL, time.Second, false))
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, err = reserve(t, h, relayHost)
+		require.Error(t, err)
+		require.False(t, r.hasReservation(h.ID()))
+	})
+
+	t.Run("custom client", func(t *testing.T) {
+		hosts := getTestHosts(t, 2)
+		relayHost, h := hosts[0], hosts[1]
+
+		srv := httptest.NewServer(allow)
+		defer srv.Close()
+
+		transport := &countingTransport{}
+		r, err := New(relayHost,
+			WithReservationWebhookClient(&http.Client{Transport: transport}),
+			WithReservationWebhook(srv.URL, time.Second, false),
+		)
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, err = reserve(t, h, relayHost)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), transport.requests.Load())
+	})
+}
@@ -0,0 +1,22 @@
+package util
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+type protocolKey struct{}
+
+// ContextWithProtocol returns a context carrying the application protocol of a circuit.
+// When dialing through a relay, the protocol is announced to the relay, which may account the
+// resources of the circuit to it.
+func ContextWithProtocol(ctx context.Context, proto protocol.ID) context.Context {
+	return context.WithValue(ctx, protocolKey{}, proto)
+}
+
+// ProtocolFromContext returns the application protocol of a circuit carried by the context, if any.
+func ProtocolFromContext(ctx context.Context) (protocol.ID, bool) {
+	proto, ok := ctx.Value(protocolKey{}).(protocol.ID)
+	return proto, ok && proto != ""
+}
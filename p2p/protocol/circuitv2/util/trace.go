@@ -0,0 +1,49 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type traceIDKey struct{}
+
+// MaxTraceIDLength is the maximum length of a circuit trace ID.
+const MaxTraceIDLength = 64
+
+// ContextWithTraceID returns a context carrying the circuit trace ID.
+// When dialing through a relay, the trace ID is sent to the relay, which forwards it to the
+// destination, allowing correlation of a circuit across all three peers. Relays replace trace
+// IDs that are not valid according to ValidTraceID with one of their own.
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFromContext returns the circuit trace ID carried by the context, if any.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDKey{}).(string)
+	return traceID, ok && traceID != ""
+}
+
+// ValidTraceID returns true if traceID is a valid circuit trace ID: a non-empty string of at most
+// MaxTraceIDLength ASCII letters, digits and dashes.
+func ValidTraceID(traceID string) bool {
+	if traceID == "" || len(traceID) > MaxTraceIDLength {
+		return false
+	}
+	for i := 0; i < len(traceID); i++ {
+		switch c := traceID[i]; {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewTraceID generates a random circuit trace ID.
+func NewTraceID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}